@@ -224,10 +224,24 @@ func main() {
 	strategyService := service.NewStrategyService(logger.GetGlobalLogger())
 	logger.Info("✓ 策略服务已创建")
 
+	// 启用策略持久化存储
+	if err := strategyService.SetStore(service.NewStrategyStore(databaseService.GetDB())); err != nil {
+		logger.Fatal("加载策略数据失败", logger.ErrorField(err))
+	}
+	logger.Info("✓ 策略持久化存储已启用")
+
 	// 创建回测服务
 	backtestService := service.NewBacktestService(strategyService, dataSourceService, cacheService, logger.GetGlobalLogger())
+	backtestService.SetFundamentalFactorSource(service.NewFundamentalFactorService(dataSourceClient))
+	backtestService.SetUniverseSources(service.NewLocalStockService("data"), favoriteService)
 	logger.Info("✓ 回测服务已创建")
 
+	// 启用回测持久化存储
+	if err := backtestService.SetStore(service.NewBacktestStore(databaseService.GetDB())); err != nil {
+		logger.Fatal("加载回测数据失败", logger.ErrorField(err))
+	}
+	logger.Info("✓ 回测持久化存储已启用")
+
 	// 创建参数优化服务
 	parameterOptimizer := service.NewParameterOptimizer(backtestService, strategyService, logger.GetGlobalLogger())
 	logger.Info("✓ 参数优化服务已创建")
@@ -593,6 +607,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap 返回原始ResponseWriter，使 http.ResponseController 可以刷新SSE推送
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // withCORS CORS中间件
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
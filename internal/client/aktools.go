@@ -144,6 +144,17 @@ type AKToolsDailyResponse struct {
 	Turnover  float64 `json:"换手率"`
 }
 
+// AKToolsDividendResponse AKTools分红送配响应结构（stock_history_dividend_detail），送股、转增、派息均为每10股
+type AKToolsDividendResponse struct {
+	AnnounceDate string  `json:"公告日期"`
+	Bonus        float64 `json:"送股"`
+	Transfer     float64 `json:"转增"`
+	Dividend     float64 `json:"派息"`
+	Progress     string  `json:"进度"`
+	ExDate       string  `json:"除权除息日"`
+	RecordDate   string  `json:"股权登记日"`
+}
+
 // AKToolsStockBasicResponse AKTools股票基本信息响应结构
 type AKToolsStockBasicResponse struct {
 	Code     string `json:"代码"`
@@ -394,6 +405,14 @@ func (c *AKToolsClient) saveResponseToFile(responseBody []byte, apiName, symbol
 	return nil
 }
 
+// aktoolsAdjust 转换为 stock_zh_a_hist 的复权参数，该接口只接受 ""（不复权）、"qfq" 和 "hfq"
+func aktoolsAdjust(adjust string) string {
+	if adjust == string(models.PriceAdjustNone) {
+		return ""
+	}
+	return adjust
+}
+
 // GetDailyData 获取股票日线数据
 func (c *AKToolsClient) GetDailyData(symbol, startDate, endDate, adjust string) ([]models.StockDaily, error) {
 	// 清理股票代码，移除市场后缀
@@ -404,7 +423,7 @@ func (c *AKToolsClient) GetDailyData(symbol, startDate, endDate, adjust string)
 	params.Set("symbol", cleanSymbol)
 	params.Set("start_date", startDate)
 	params.Set("end_date", endDate)
-	params.Set("adjust", adjust)
+	params.Set("adjust", aktoolsAdjust(adjust))
 
 	// 构建完整URL
 	apiURL := fmt.Sprintf("%s/api/public/stock_zh_a_hist?%s", c.baseURL, params.Encode())
@@ -433,6 +452,49 @@ func (c *AKToolsClient) GetDailyData(symbol, startDate, endDate, adjust string)
 	return c.convertToStockDaily(aktoolsResp, symbol), nil
 }
 
+// GetIndexDailyData 获取指数日线数据
+func (c *AKToolsClient) GetIndexDailyData(symbol, startDate, endDate string) ([]models.StockDaily, error) {
+	// 清理指数代码，移除市场后缀
+	cleanSymbol := c.CleanStockSymbol(symbol)
+
+	// 构建查询参数
+	params := url.Values{}
+	params.Set("symbol", cleanSymbol)
+	params.Set("period", "daily")
+	params.Set("start_date", startDate)
+	params.Set("end_date", endDate)
+
+	// 构建完整URL
+	apiURL := fmt.Sprintf("%s/api/public/index_zh_a_hist?%s", c.baseURL, params.Encode())
+
+	// 使用带缓存的请求方法
+	ctx := context.Background()
+	body, fromCache, err := c.doRequestWithCacheAndDebug(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("获取指数日线数据失败: %w, 指数代码: %s", err, symbol)
+	}
+
+	// 只在非缓存数据时保存响应到文件用于调试
+	if !fromCache {
+		if err := c.saveResponseToFile(body, "index_daily", cleanSymbol, c.config.Debug); err != nil {
+			log.Printf("保存响应文件失败: %v", err)
+		}
+	}
+
+	// index_zh_a_hist 与 stock_zh_a_hist 的返回字段一致
+	var aktoolsResp []AKToolsDailyResponse
+	if err := json.Unmarshal(body, &aktoolsResp); err != nil {
+		return nil, fmt.Errorf("解析AKTools指数响应失败: %w", err)
+	}
+
+	result := c.convertToStockDaily(aktoolsResp, symbol)
+	// 指数代码与股票代码可能重复（如000300），保留调用方传入的带后缀代码
+	for i := range result {
+		result[i].TSCode = symbol
+	}
+	return result, nil
+}
+
 // GetDailyDataByDate 根据交易日期获取所有股票数据
 func (c *AKToolsClient) GetDailyDataByDate(tradeDate string) ([]models.StockDaily, error) {
 	// AKTools暂不支持按日期批量获取，这里返回空结果
@@ -440,6 +502,79 @@ func (c *AKToolsClient) GetDailyDataByDate(tradeDate string) ([]models.StockDail
 	return []models.StockDaily{}, nil
 }
 
+// GetCorporateActions 获取已实施的分红送转记录，日期为空时不限制
+func (c *AKToolsClient) GetCorporateActions(symbol, startDate, endDate string) ([]models.CorporateAction, error) {
+	// 清理股票代码，移除市场后缀
+	cleanSymbol := c.CleanStockSymbol(symbol)
+
+	params := url.Values{}
+	params.Set("symbol", cleanSymbol)
+	params.Set("indicator", "分红")
+
+	apiURL := fmt.Sprintf("%s/api/public/stock_history_dividend_detail?%s", c.baseURL, params.Encode())
+
+	// 使用带缓存的请求方法
+	ctx := context.Background()
+	body, fromCache, err := c.doRequestWithCacheAndDebug(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("获取分红送转数据失败: %w, 股票代码: %s", err, symbol)
+	}
+
+	// 只在非缓存数据时保存响应到文件用于调试
+	if !fromCache {
+		if err := c.saveResponseToFile(body, "dividend", cleanSymbol, c.config.Debug); err != nil {
+			log.Printf("保存响应文件失败: %v", err)
+		}
+	}
+
+	var aktoolsResp []AKToolsDividendResponse
+	if err := json.Unmarshal(body, &aktoolsResp); err != nil {
+		return nil, fmt.Errorf("解析AKTools分红送转响应失败: %w", err)
+	}
+
+	return c.convertToCorporateActions(aktoolsResp, symbol, startDate, endDate), nil
+}
+
+// convertToCorporateActions 将AKTools分红送配数据转换为按每股计的分红送转记录，只保留已实施且有除权除息日的记录
+func (c *AKToolsClient) convertToCorporateActions(aktoolsData []AKToolsDividendResponse, symbol, startDate, endDate string) []models.CorporateAction {
+	tsCode := c.DetermineTSCode(symbol)
+
+	var actions []models.CorporateAction
+	for _, data := range aktoolsData {
+		// 日期可能带有时间部分，如 2023-07-06T00:00:00.000
+		exDate := c.formatDateForFrontend(strings.SplitN(data.ExDate, "T", 2)[0])
+		if data.Progress != "实施" || len(exDate) != 8 {
+			continue
+		}
+		if (startDate != "" && exDate < startDate) || (endDate != "" && exDate > endDate) {
+			continue
+		}
+		actions = append(actions, models.CorporateAction{
+			TSCode:         tsCode,
+			ExDate:         exDate,
+			RecordDate:     c.formatDateForFrontend(strings.SplitN(data.RecordDate, "T", 2)[0]),
+			CashDividend:   data.Dividend / 10,
+			BonusShares:    data.Bonus / 10,
+			TransferShares: data.Transfer / 10,
+		})
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ExDate < actions[j].ExDate
+	})
+	return actions
+}
+
+// GetNameChanges AKShare的简称变更接口没有变更日期，无法还原历史交易日的证券简称
+func (c *AKToolsClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	return nil, fmt.Errorf("%w: AKTools 不提供带日期的证券简称变更历史", ErrUnsupported)
+}
+
+// GetDelistedStocks AKTools 的股票列表只包含当前上市的股票
+func (c *AKToolsClient) GetDelistedStocks() ([]models.StockBasic, error) {
+	return nil, fmt.Errorf("%w: AKTools 不提供已退市的股票列表", ErrUnsupported)
+}
+
 // GetStockBasic 获取股票基本信息
 func (c *AKToolsClient) GetStockBasic(symbol string) (*models.StockBasic, error) {
 	// 清理股票代码，移除市场后缀
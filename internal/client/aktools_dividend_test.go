@@ -0,0 +1,30 @@
+package client
+
+import "testing"
+
+// TestAKToolsConvertToCorporateActions 测试分红送配数据按每股换算并过滤未实施的方案
+func TestAKToolsConvertToCorporateActions(t *testing.T) {
+	client := NewAKToolsClient("http://127.0.0.1:8080")
+
+	testData := []AKToolsDividendResponse{
+		{AnnounceDate: "2024-06-12", Bonus: 3, Transfer: 2, Dividend: 5, Progress: "实施", ExDate: "2024-06-20T00:00:00.000", RecordDate: "2024-06-19T00:00:00.000"},
+		{AnnounceDate: "2023-06-08", Dividend: 2.5, Progress: "实施", ExDate: "2023-06-15"},
+		{AnnounceDate: "2024-08-30", Dividend: 1, Progress: "预案"},
+		{AnnounceDate: "2019-06-01", Dividend: 1, Progress: "实施", ExDate: "2019-06-10"},
+	}
+
+	actions := client.convertToCorporateActions(testData, "600000", "20200101", "")
+	if len(actions) != 2 {
+		t.Fatalf("期望得到2条已实施的记录，实际得到%d条: %+v", len(actions), actions)
+	}
+	if actions[0].ExDate != "20230615" || actions[0].CashDividend != 0.25 {
+		t.Errorf("记录应按除权除息日升序排列并按每股换算: %+v", actions[0])
+	}
+	latest := actions[1]
+	if latest.TSCode != "600000.SH" || latest.ExDate != "20240620" || latest.RecordDate != "20240619" {
+		t.Errorf("股票代码或日期转换错误: %+v", latest)
+	}
+	if latest.CashDividend != 0.5 || latest.BonusShares != 0.3 || latest.TransferShares != 0.2 || latest.ShareRatio() != 0.5 {
+		t.Errorf("每10股数据应换算为每股: %+v", latest)
+	}
+}
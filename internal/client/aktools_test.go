@@ -1,7 +1,12 @@
 package client
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+
+	"stock-a-future/internal/models"
 )
 
 func TestAKToolsClient_FormatDateForFrontend(t *testing.T) {
@@ -252,3 +257,23 @@ func TestAKToolsClient_DetermineTSCode(t *testing.T) {
 		})
 	}
 }
+
+// TestAKToolsClient_GetDailyDataAdjust 测试复权方式转换为 stock_zh_a_hist 接受的参数
+func TestAKToolsClient_GetDailyDataAdjust(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Query().Get("adjust"))
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client := NewAKToolsClient(server.URL)
+	for _, adjust := range []string{string(models.PriceAdjustNone), string(models.PriceAdjustForward)} {
+		if _, err := client.GetDailyData("600000.SH", "20240101", "20240131", adjust); err != nil {
+			t.Fatalf("adjust=%q 获取日线失败: %v", adjust, err)
+		}
+	}
+	if want := []string{"", "qfq"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("复权参数错误: %q, 期望 %q", got, want)
+	}
+}
@@ -2,10 +2,14 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"stock-a-future/internal/models"
 )
 
+// ErrUnsupported 数据源不提供该数据
+var ErrUnsupported = errors.New("数据源不支持该接口")
+
 // DataSourceClient 数据源客户端接口
 type DataSourceClient interface {
 	// ===== 基础数据接口 =====
@@ -16,12 +20,24 @@ type DataSourceClient interface {
 	// 根据交易日期获取所有股票数据
 	GetDailyDataByDate(tradeDate string) ([]models.StockDaily, error)
 
+	// 获取指数日线数据（如沪深300 000300.SH）
+	GetIndexDailyData(symbol, startDate, endDate string) ([]models.StockDaily, error)
+
 	// 获取股票基本信息
 	GetStockBasic(symbol string) (*models.StockBasic, error)
 
 	// 获取股票列表
 	GetStockList() ([]models.StockBasic, error)
 
+	// 获取已实施的分红送转记录，按除权除息日升序排列
+	GetCorporateActions(symbol, startDate, endDate string) ([]models.CorporateAction, error)
+
+	// 获取证券简称变更历史，按开始日期升序排列；数据源不提供时返回 ErrUnsupported
+	GetNameChanges(symbol string) ([]models.NameChange, error)
+
+	// 获取已退市的股票列表（含退市日期）；数据源不提供时返回 ErrUnsupported
+	GetDelistedStocks() ([]models.StockBasic, error)
+
 	// ===== 基本面数据接口 =====
 
 	// 获取利润表数据
@@ -16,6 +16,10 @@ type MockDataSourceClient struct {
 	FinancialIndicatorData *models.FinancialIndicator
 	StockBasicData         *models.StockBasic
 	StockDailyData         []models.StockDaily
+	IndexDailyData         []models.StockDaily
+	CorporateActionData    []models.CorporateAction
+	NameChangeData         []models.NameChange
+	DelistedStockData      []models.StockBasic
 	FundamentalFactorData  *models.FundamentalFactor
 
 	// 控制行为
@@ -46,6 +50,34 @@ func (m *MockDataSourceClient) GetDailyDataByDate(tradeDate string) ([]models.St
 	return m.StockDailyData, nil
 }
 
+func (m *MockDataSourceClient) GetIndexDailyData(symbol, startDate, endDate string) ([]models.StockDaily, error) {
+	if m.ShouldFail {
+		return nil, errors.New("模拟错误")
+	}
+	return m.IndexDailyData, nil
+}
+
+func (m *MockDataSourceClient) GetCorporateActions(symbol, startDate, endDate string) ([]models.CorporateAction, error) {
+	if m.ShouldFail {
+		return nil, errors.New("模拟错误")
+	}
+	return m.CorporateActionData, nil
+}
+
+func (m *MockDataSourceClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	if m.ShouldFail {
+		return nil, errors.New("模拟错误")
+	}
+	return m.NameChangeData, nil
+}
+
+func (m *MockDataSourceClient) GetDelistedStocks() ([]models.StockBasic, error) {
+	if m.ShouldFail {
+		return nil, errors.New("模拟错误")
+	}
+	return m.DelistedStockData, nil
+}
+
 func (m *MockDataSourceClient) GetStockBasic(symbol string) (*models.StockBasic, error) {
 	if m.ShouldFail {
 		return nil, errors.New("模拟错误")
@@ -71,11 +71,14 @@ func (c *TushareClient) GetDailyData(tsCode, startDate, endDate, adjust string)
 		params["end_date"] = endDate
 	}
 
-	// 设置复权方式，如果没有指定则使用前复权
-	if adjust == "" {
-		adjust = "qfq" // 默认前复权，更符合用户习惯
+	// 设置复权方式，如果没有指定则使用前复权；daily 接口本身返回不复权行情，不复权时不传该参数
+	switch adjust {
+	case "":
+		params["adjust"] = "qfq" // 默认前复权，更符合用户习惯
+	case string(models.PriceAdjustNone):
+	default:
+		params["adjust"] = adjust
 	}
-	params["adjust"] = adjust
 
 	request := TushareRequest{
 		APIName: "daily",
@@ -96,6 +99,37 @@ func (c *TushareClient) GetDailyData(tsCode, startDate, endDate, adjust string)
 	return c.parseDailyData(response.Data)
 }
 
+// GetIndexDailyData 获取指数日线数据
+func (c *TushareClient) GetIndexDailyData(tsCode, startDate, endDate string) ([]models.StockDaily, error) {
+	params := map[string]interface{}{
+		"ts_code": tsCode,
+	}
+	if startDate != "" {
+		params["start_date"] = startDate
+	}
+	if endDate != "" {
+		params["end_date"] = endDate
+	}
+
+	request := TushareRequest{
+		APIName: "index_daily",
+		Token:   c.token,
+		Params:  params,
+		Fields:  "ts_code,trade_date,open,high,low,close,pre_close,change,pct_chg,vol,amount",
+	}
+
+	response, err := c.makeRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求Tushare API失败: %w", err)
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("tushare API错误: %s (代码: %d)", response.Msg, response.Code)
+	}
+
+	return c.parseDailyData(response.Data)
+}
+
 // GetDailyDataByDate 根据交易日期获取所有股票数据
 func (c *TushareClient) GetDailyDataByDate(tradeDate string) ([]models.StockDaily, error) {
 	params := map[string]interface{}{
@@ -121,6 +155,132 @@ func (c *TushareClient) GetDailyDataByDate(tradeDate string) ([]models.StockDail
 	return c.parseDailyData(response.Data)
 }
 
+// GetCorporateActions 获取已实施的分红送转记录
+// dividend 接口不支持按日期区间查询，取回全部记录后按除权除息日过滤，日期为空时不限制
+func (c *TushareClient) GetCorporateActions(tsCode, startDate, endDate string) ([]models.CorporateAction, error) {
+	request := TushareRequest{
+		APIName: "dividend",
+		Token:   c.token,
+		Params:  map[string]interface{}{"ts_code": tsCode},
+		Fields:  "ts_code,div_proc,stk_bo_rate,stk_co_rate,cash_div_tax,record_date,ex_date",
+	}
+
+	response, err := c.makeRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求Tushare API失败: %w", err)
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("tushare API错误: %s (代码: %d)", response.Msg, response.Code)
+	}
+
+	return c.parseCorporateActions(response.Data, startDate, endDate), nil
+}
+
+// GetNameChanges 获取证券简称变更历史，按开始日期升序排列
+func (c *TushareClient) GetNameChanges(tsCode string) ([]models.NameChange, error) {
+	request := TushareRequest{
+		APIName: "namechange",
+		Token:   c.token,
+		Params:  map[string]interface{}{"ts_code": tsCode},
+		Fields:  "ts_code,name,start_date,end_date",
+	}
+
+	response, err := c.makeRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求Tushare API失败: %w", err)
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("tushare API错误: %s (代码: %d)", response.Msg, response.Code)
+	}
+
+	return c.parseNameChanges(response.Data), nil
+}
+
+// parseNameChanges 解析证券简称变更记录
+func (c *TushareClient) parseNameChanges(data *TushareData) []models.NameChange {
+	var changes []models.NameChange
+	if data == nil {
+		return changes
+	}
+
+	fieldMap := make(map[string]int)
+	for i, field := range data.Fields {
+		fieldMap[field] = i
+	}
+	stringField := func(item []interface{}, name string) string {
+		if idx, ok := fieldMap[name]; ok && idx < len(item) {
+			if val, ok := item[idx].(string); ok {
+				return val
+			}
+		}
+		return ""
+	}
+
+	for _, item := range data.Items {
+		change := models.NameChange{
+			TSCode:    stringField(item, "ts_code"),
+			Name:      stringField(item, "name"),
+			StartDate: stringField(item, "start_date"),
+			EndDate:   stringField(item, "end_date"),
+		}
+		if change.StartDate == "" {
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].StartDate < changes[j].StartDate
+	})
+	return changes
+}
+
+// parseCorporateActions 解析分红送转记录，只保留已实施且有除权除息日的记录
+func (c *TushareClient) parseCorporateActions(data *TushareData, startDate, endDate string) []models.CorporateAction {
+	var actions []models.CorporateAction
+	if data == nil {
+		return actions
+	}
+
+	fieldMap := make(map[string]int)
+	for i, field := range data.Fields {
+		fieldMap[field] = i
+	}
+	stringField := func(item []interface{}, name string) string {
+		if idx, ok := fieldMap[name]; ok && idx < len(item) {
+			if val, ok := item[idx].(string); ok {
+				return val
+			}
+		}
+		return ""
+	}
+
+	for _, item := range data.Items {
+		exDate := stringField(item, "ex_date")
+		if stringField(item, "div_proc") != "实施" || exDate == "" {
+			continue
+		}
+		if (startDate != "" && exDate < startDate) || (endDate != "" && exDate > endDate) {
+			continue
+		}
+		actions = append(actions, models.CorporateAction{
+			TSCode:         stringField(item, "ts_code"),
+			ExDate:         exDate,
+			RecordDate:     stringField(item, "record_date"),
+			CashDividend:   c.parseDecimal(item, fieldMap, "cash_div_tax").InexactFloat64(),
+			BonusShares:    c.parseDecimal(item, fieldMap, "stk_bo_rate").InexactFloat64(),
+			TransferShares: c.parseDecimal(item, fieldMap, "stk_co_rate").InexactFloat64(),
+		})
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ExDate < actions[j].ExDate
+	})
+	return actions
+}
+
 // makeRequest 发送HTTP请求到Tushare API
 func (c *TushareClient) makeRequest(req TushareRequest) (*TushareResponse, error) {
 	jsonData, err := json.Marshal(req)
@@ -362,6 +522,27 @@ func (c *TushareClient) GetStockList() ([]models.StockBasic, error) {
 	return c.parseStockList(response.Data)
 }
 
+// GetDelistedStocks 获取已退市的股票列表
+func (c *TushareClient) GetDelistedStocks() ([]models.StockBasic, error) {
+	request := TushareRequest{
+		APIName: "stock_basic",
+		Token:   c.token,
+		Params:  map[string]interface{}{"list_status": "D"},
+		Fields:  "ts_code,symbol,name,area,industry,market,list_date,delist_date",
+	}
+
+	response, err := c.makeRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求Tushare API失败: %w", err)
+	}
+
+	if response.Code != 0 {
+		return nil, fmt.Errorf("tushare API错误: %s (代码: %d)", response.Msg, response.Code)
+	}
+
+	return c.parseStockList(response.Data)
+}
+
 // parseStockList 解析股票列表
 func (c *TushareClient) parseStockList(data *TushareData) ([]models.StockBasic, error) {
 	if data == nil || len(data.Items) == 0 {
@@ -421,6 +602,12 @@ func (c *TushareClient) parseStockList(data *TushareData) ([]models.StockBasic,
 			}
 		}
 
+		if idx, ok := fieldMap["delist_date"]; ok && idx < len(item) {
+			if val, ok := item[idx].(string); ok {
+				stockBasic.DelistDate = val
+			}
+		}
+
 		stockList = append(stockList, *stockBasic)
 	}
 
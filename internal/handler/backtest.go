@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -38,6 +39,7 @@ func (h *BacktestHandler) RegisterRoutes(mux *http.ServeMux) {
 	// 回测管理路由
 	mux.HandleFunc("GET /api/v1/backtests", h.handleCORS(h.getBacktestsList))
 	mux.HandleFunc("POST /api/v1/backtests", h.handleCORS(h.createBacktest))
+	mux.HandleFunc("POST /api/v1/backtests/compare", h.handleCORS(h.compareBacktests))
 	mux.HandleFunc("GET /api/v1/backtests/{id}", h.handleCORS(h.getBacktest))
 	mux.HandleFunc("PUT /api/v1/backtests/{id}", h.handleCORS(h.updateBacktest))
 	mux.HandleFunc("DELETE /api/v1/backtests/{id}", h.handleCORS(h.deleteBacktest))
@@ -46,7 +48,21 @@ func (h *BacktestHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/v1/backtests/{id}/start", h.handleCORS(h.startBacktest))
 	mux.HandleFunc("POST /api/v1/backtests/{id}/cancel", h.handleCORS(h.cancelBacktest))
 	mux.HandleFunc("GET /api/v1/backtests/{id}/progress", h.handleCORS(h.getBacktestProgress))
+	mux.HandleFunc("GET /api/v1/backtests/{id}/events", h.handleCORS(h.streamBacktestEvents))
 	mux.HandleFunc("GET /api/v1/backtests/{id}/results", h.handleCORS(h.getBacktestResults))
+	mux.HandleFunc("GET /api/v1/backtests/{id}/round-trips", h.handleCORS(h.getRoundTrips))
+	mux.HandleFunc("POST /api/v1/backtests/{id}/monte-carlo", h.handleCORS(h.runMonteCarlo))
+	mux.HandleFunc("GET /api/v1/backtests/{id}/manifest", h.handleCORS(h.getBacktestManifest))
+	mux.HandleFunc("POST /api/v1/backtests/{id}/replay", h.handleCORS(h.replayBacktest))
+	mux.HandleFunc("GET /api/v1/backtests/{id}/replay", h.handleCORS(h.getReplay))
+	mux.HandleFunc("GET /api/v1/backtests/{id}/export", h.handleCORS(h.exportBacktestReport))
+
+	// 不复权回测使用的分红送转记录
+	mux.HandleFunc("GET /api/v1/corporate-actions/{symbol}", h.handleCORS(h.getCorporateActions))
+	mux.HandleFunc("PUT /api/v1/corporate-actions/{symbol}", h.handleCORS(h.importCorporateActions))
+
+	// 机器学习策略的训练需要历史行情，由回测服务完成
+	mux.HandleFunc("POST /api/v1/strategies/{id}/train", h.handleCORS(h.trainMLStrategy))
 }
 
 // getBacktestsList 获取回测列表
@@ -168,6 +184,13 @@ func (h *BacktestHandler) createBacktest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 解析交易成本参数
+	costConfig, err := service.ResolveCostConfig(req.CostProfile, req.CostConfig, req.Commission, req.Slippage)
+	if err != nil {
+		h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 创建回测对象
 	backtest := &models.Backtest{
 		ID:          uuid.New().String(),
@@ -184,6 +207,15 @@ func (h *BacktestHandler) createBacktest(w http.ResponseWriter, r *http.Request)
 		Status:      models.BacktestStatusPending,
 		Progress:    0,
 		CreatedBy:   "user", // TODO: 从认证信息获取
+
+		DisableTradingRules: req.DisableTradingRules,
+		CostConfig:          costConfig,
+		PositionSizing:      req.PositionSizing,
+		ExitRules:           req.ExitRules,
+		Execution:           req.Execution,
+		Portfolio:           req.Portfolio,
+		Universe:            req.Universe,
+		PriceAdjust:         req.PriceAdjust,
 	}
 
 	// 记录原始名称，用于检查是否被重命名
@@ -443,6 +475,29 @@ func (h *BacktestHandler) getBacktestProgress(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// streamBacktestEvents 以SSE推送回测进度、状态、成交和权益点，连接建立后先推送当前状态
+func (h *BacktestHandler) streamBacktestEvents(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	events, cancel, err := h.backtestService.SubscribeBacktest(backtestID)
+	if err != nil {
+		if errors.Is(err, service.ErrBacktestNotFound) {
+			h.writeErrorResponse(w, "回测不存在", http.StatusNotFound)
+			return
+		}
+		h.logger.Error("订阅回测事件失败", logger.ErrorField(err))
+		h.writeErrorResponse(w, "订阅回测事件失败", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("订阅回测事件", logger.String("backtest_id", backtestID))
+	streamEvents(w, r, events, cancel, h.logger)
+}
+
 // getBacktestResults 获取回测结果
 func (h *BacktestHandler) getBacktestResults(w http.ResponseWriter, r *http.Request) {
 	backtestID := r.PathValue("id")
@@ -475,6 +530,337 @@ func (h *BacktestHandler) getBacktestResults(w http.ResponseWriter, r *http.Requ
 	})
 }
 
+// getRoundTrips 获取回测的开平仓记录及MAE/MFE、期望值等统计，可通过 strategy_id 只查看单个策略
+func (h *BacktestHandler) getRoundTrips(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	strategyID := r.URL.Query().Get("strategy_id")
+	analysis, err := h.backtestService.GetRoundTrips(r.Context(), backtestID, strategyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBacktestNotFound):
+			h.writeErrorResponse(w, "回测不存在", http.StatusNotFound)
+		case errors.Is(err, service.ErrBacktestNotCompleted):
+			h.writeErrorResponse(w, "回测尚未完成", http.StatusBadRequest)
+		default:
+			h.logger.Error("获取开平仓分析失败", logger.ErrorField(err))
+			h.writeErrorResponse(w, "获取开平仓分析失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    analysis,
+		"message": "获取开平仓分析成功",
+	})
+}
+
+// getCorporateActions 获取股票已实施的分红送转记录，有导入记录时返回导入的记录，可按 start_date、end_date（YYYYMMDD）过滤
+func (h *BacktestHandler) getCorporateActions(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	query := r.URL.Query()
+
+	actions, err := h.backtestService.GetCorporateActions(r.Context(), symbol, query.Get("start_date"), query.Get("end_date"))
+	if err != nil {
+		h.logger.Error("获取分红送转记录失败", logger.String("symbol", symbol), logger.ErrorField(err))
+		h.writeErrorResponse(w, "获取分红送转记录失败", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    actions,
+		"message": "获取分红送转记录成功",
+	})
+}
+
+// importCorporateActions 导入股票的分红送转记录，覆盖之前导入的记录，actions 为空时清除导入记录
+func (h *BacktestHandler) importCorporateActions(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+
+	var req models.ImportCorporateActionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, "请求参数格式错误", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("导入分红送转记录请求",
+		logger.String("symbol", symbol),
+		logger.Int("count", len(req.Actions)),
+	)
+
+	if err := h.backtestService.ImportCorporateActions(r.Context(), symbol, req.Actions); err != nil {
+		if errors.Is(err, service.ErrInvalidCorporateAction) {
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.logger.Error("导入分红送转记录失败", logger.String("symbol", symbol), logger.ErrorField(err))
+		h.writeErrorResponse(w, "导入分红送转记录失败", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"message": "导入分红送转记录成功",
+	})
+}
+
+// runMonteCarlo 对已完成的回测进行蒙特卡洛稳健性分析，请求体可为空
+func (h *BacktestHandler) runMonteCarlo(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MonteCarloRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeErrorResponse(w, "请求参数格式错误", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("蒙特卡洛分析请求", logger.String("backtest_id", backtestID))
+
+	result, err := h.backtestService.RunMonteCarlo(r.Context(), backtestID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBacktestNotFound):
+			h.writeErrorResponse(w, "回测不存在", http.StatusNotFound)
+		case errors.Is(err, service.ErrBacktestNotCompleted):
+			h.writeErrorResponse(w, "回测尚未完成", http.StatusBadRequest)
+		case errors.Is(err, service.ErrInvalidMonteCarlo):
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.logger.Error("蒙特卡洛分析失败", logger.ErrorField(err))
+			h.writeErrorResponse(w, "蒙特卡洛分析失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    result,
+		"message": "蒙特卡洛分析完成",
+	})
+}
+
+// trainMLStrategy 在指定股票和日期区间上训练机器学习策略的模型，返回交叉验证结果
+func (h *BacktestHandler) trainMLStrategy(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	if strategyID == "" {
+		h.writeErrorResponse(w, "策略ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MLTrainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, "请求参数格式错误", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("训练机器学习策略请求",
+		logger.String("strategy_id", strategyID),
+		logger.Int("symbols", len(req.Symbols)),
+		logger.String("start_date", req.StartDate),
+		logger.String("end_date", req.EndDate),
+	)
+
+	model, err := h.backtestService.TrainMLStrategy(r.Context(), strategyID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrStrategyNotFound):
+			h.writeErrorResponse(w, "策略不存在", http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidML):
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.logger.Error("训练机器学习策略失败", logger.ErrorField(err))
+			h.writeErrorResponse(w, "训练机器学习策略失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    model,
+		"message": "训练机器学习策略成功",
+	})
+}
+
+// getBacktestManifest 获取已完成回测的运行清单
+func (h *BacktestHandler) getBacktestManifest(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := h.backtestService.GetBacktestManifest(r.Context(), backtestID)
+	if err != nil {
+		h.writeManifestError(w, "获取运行清单失败", err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    manifest,
+		"message": "获取运行清单成功",
+	})
+}
+
+// replayBacktest 在后台按运行清单重新运行回测，通过 GET /replay 查询结果是否与原结果逐位一致
+func (h *BacktestHandler) replayBacktest(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("重新运行回测请求", logger.String("backtest_id", backtestID))
+
+	task, err := h.backtestService.StartReplay(r.Context(), backtestID)
+	if err != nil {
+		h.writeManifestError(w, "重新运行回测失败", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    task,
+		"message": "已开始重新运行回测",
+	})
+}
+
+// getReplay 获取重新运行回测的任务状态，完成后包含与原结果的对比报告
+func (h *BacktestHandler) getReplay(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	task, err := h.backtestService.GetReplay(r.Context(), backtestID)
+	if err != nil {
+		h.writeManifestError(w, "获取重新运行结果失败", err)
+		return
+	}
+
+	message := "回测正在重新运行"
+	switch {
+	case task.Status == models.BacktestStatusFailed:
+		message = "重新运行回测失败"
+	case task.Report != nil && task.Report.Match:
+		message = "重新运行结果与原结果一致"
+	case task.Report != nil:
+		message = "重新运行结果与原结果不一致"
+	}
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    task,
+		"message": message,
+	})
+}
+
+// writeManifestError 将运行清单相关的错误映射为HTTP状态码
+func (h *BacktestHandler) writeManifestError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrBacktestNotFound):
+		h.writeErrorResponse(w, "回测不存在", http.StatusNotFound)
+	case errors.Is(err, service.ErrBacktestNotCompleted):
+		h.writeErrorResponse(w, "回测尚未完成", http.StatusBadRequest)
+	case errors.Is(err, service.ErrBacktestManifestNotFound):
+		h.writeErrorResponse(w, "回测没有运行清单，请重新运行回测", http.StatusNotFound)
+	case errors.Is(err, service.ErrReplayNotFound):
+		h.writeErrorResponse(w, "回测没有重新运行的任务", http.StatusNotFound)
+	case errors.Is(err, service.ErrReplayRunning):
+		h.writeErrorResponse(w, "回测正在重新运行", http.StatusConflict)
+	default:
+		h.logger.Error(message, logger.ErrorField(err))
+		h.writeErrorResponse(w, message, http.StatusInternalServerError)
+	}
+}
+
+// compareBacktests 对比多个已完成的回测，第一个回测作为基准
+func (h *BacktestHandler) compareBacktests(w http.ResponseWriter, r *http.Request) {
+	var req models.CompareBacktestsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, "请求参数格式错误", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("回测对比请求", logger.Int("backtests", len(req.BacktestIDs)))
+
+	comparison, err := h.backtestService.CompareBacktests(r.Context(), req.BacktestIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidComparison):
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrBacktestNotFound):
+			h.writeErrorResponse(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrBacktestNotCompleted):
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.logger.Error("回测对比失败", logger.ErrorField(err))
+			h.writeErrorResponse(w, "回测对比失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    comparison,
+		"message": "回测对比完成",
+	})
+}
+
+// exportBacktestReport 导出回测报告文件，format 为 xlsx（默认）或 html
+func (h *BacktestHandler) exportBacktestReport(w http.ResponseWriter, r *http.Request) {
+	backtestID := r.PathValue("id")
+	if backtestID == "" {
+		h.writeErrorResponse(w, "回测ID不能为空", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.ReportFormatExcel
+	}
+
+	h.logger.Info("导出回测报告请求",
+		logger.String("backtest_id", backtestID),
+		logger.String("format", format),
+	)
+
+	report, err := h.backtestService.ExportBacktestReport(r.Context(), backtestID, format)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBacktestNotFound):
+			h.writeErrorResponse(w, "回测不存在", http.StatusNotFound)
+		case errors.Is(err, service.ErrBacktestNotCompleted):
+			h.writeErrorResponse(w, "回测尚未完成", http.StatusBadRequest)
+		case errors.Is(err, service.ErrUnsupportedReportFormat):
+			h.writeErrorResponse(w, "不支持的报告格式，可选 xlsx 或 html", http.StatusBadRequest)
+		default:
+			h.logger.Error("导出回测报告失败", logger.ErrorField(err))
+			h.writeErrorResponse(w, "导出回测报告失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", report.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.Filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(report.Data)))
+	if _, err := w.Write(report.Data); err != nil {
+		h.logger.Error("写入回测报告失败", logger.ErrorField(err))
+	}
+}
+
 // validateCreateBacktestRequest 验证创建回测请求
 func (h *BacktestHandler) validateCreateBacktestRequest(req *models.CreateBacktestRequest) error {
 	if strings.TrimSpace(req.Name) == "" {
@@ -518,12 +904,22 @@ func (h *BacktestHandler) validateCreateBacktestRequest(req *models.CreateBackte
 		return fmt.Errorf("单策略ID不能为空字符串")
 	}
 
-	if len(req.Symbols) == 0 {
-		return fmt.Errorf("股票列表不能为空")
-	}
+	// 固定股票列表与动态股票池二选一
+	if req.Universe != nil {
+		if len(req.Symbols) > 0 {
+			return errors.New("股票列表和股票池不能同时设置")
+		}
+		if err := service.ValidateUniverseConfig(req.Universe); err != nil {
+			return err
+		}
+	} else {
+		if len(req.Symbols) == 0 {
+			return fmt.Errorf("股票列表不能为空")
+		}
 
-	if len(req.Symbols) > 100 {
-		return fmt.Errorf("股票数量不能超过100个")
+		if len(req.Symbols) > 100 {
+			return fmt.Errorf("股票数量不能超过100个")
+		}
 	}
 
 	// 验证日期格式
@@ -570,6 +966,30 @@ func (h *BacktestHandler) validateCreateBacktestRequest(req *models.CreateBackte
 		return errors.New("滑点必须在0-1%之间")
 	}
 
+	if err := service.ValidatePositionSizingConfig(req.PositionSizing); err != nil {
+		return err
+	}
+
+	if err := service.ValidateExitRulesConfig(req.ExitRules); err != nil {
+		return err
+	}
+
+	if err := service.ValidateExecutionConfig(req.Execution); err != nil {
+		return err
+	}
+
+	if err := service.ValidatePriceAdjust(req.PriceAdjust); err != nil {
+		return err
+	}
+
+	strategyIDs := req.StrategyIDs
+	if len(strategyIDs) == 0 && req.StrategyID != "" {
+		strategyIDs = []string{req.StrategyID}
+	}
+	if err := service.ValidatePortfolioConfig(req.Portfolio, strategyIDs); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -28,6 +28,7 @@ func (h *ParameterOptimizerHandler) RegisterRoutes(mux *http.ServeMux) {
 	// 参数优化路由
 	mux.HandleFunc("POST /api/v1/strategies/{id}/optimize", h.handleCORS(h.startOptimization))
 	mux.HandleFunc("GET /api/v1/optimizations/{id}/progress", h.handleCORS(h.getOptimizationProgress))
+	mux.HandleFunc("GET /api/v1/optimizations/{id}/events", h.handleCORS(h.streamOptimizationEvents))
 	mux.HandleFunc("GET /api/v1/optimizations/{id}/results", h.handleCORS(h.getOptimizationResults))
 	mux.HandleFunc("POST /api/v1/optimizations/{id}/cancel", h.handleCORS(h.cancelOptimization))
 }
@@ -84,6 +85,15 @@ func (h *ParameterOptimizerHandler) startOptimization(w http.ResponseWriter, r *
 		return
 	}
 
+	if err := service.ValidateWalkForwardConfig(config.WalkForward); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "前向分析参数无效",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// 启动优化（使用background context，让优化任务独立于HTTP请求生命周期）
 	optimizationID, err := h.optimizer.StartOptimization(context.Background(), &config)
 	if err != nil {
@@ -144,6 +154,23 @@ func (h *ParameterOptimizerHandler) getOptimizationProgress(w http.ResponseWrite
 	})
 }
 
+// streamOptimizationEvents 以SSE推送优化任务进度，连接建立后先推送当前进度
+func (h *ParameterOptimizerHandler) streamOptimizationEvents(w http.ResponseWriter, r *http.Request) {
+	optimizationID := r.PathValue("id")
+
+	events, cancel, err := h.optimizer.SubscribeOptimization(optimizationID)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "优化任务不存在",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	streamEvents(w, r, events, cancel, h.logger)
+}
+
 // getOptimizationResults 获取优化结果
 func (h *ParameterOptimizerHandler) getOptimizationResults(w http.ResponseWriter, r *http.Request) {
 	optimizationID := r.PathValue("id")
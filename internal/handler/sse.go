@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+// sseHeartbeatInterval 没有事件时发送注释行保持连接，避免被代理断开
+const sseHeartbeatInterval = 15 * time.Second
+
+// streamEvents 以 Server-Sent Events 推送任务事件，直到事件通道关闭或客户端断开
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan models.ProgressEvent, cancel func(), log logger.Logger) {
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	if err := controller.Flush(); err != nil {
+		log.Error("当前连接不支持SSE推送", logger.ErrorField(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				log.Error("序列化推送事件失败", logger.String("type", string(event.Type)), logger.ErrorField(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -25,6 +25,10 @@ func (m *MockDataSourceClient) GetDailyDataByDate(tradeDate string) ([]models.St
 	return nil, nil
 }
 
+func (m *MockDataSourceClient) GetIndexDailyData(symbol, startDate, endDate string) ([]models.StockDaily, error) {
+	return nil, nil
+}
+
 func (m *MockDataSourceClient) GetStockBasic(symbol string) (*models.StockBasic, error) {
 	return nil, nil
 }
@@ -33,6 +37,18 @@ func (m *MockDataSourceClient) GetStockList() ([]models.StockBasic, error) {
 	return nil, nil
 }
 
+func (m *MockDataSourceClient) GetCorporateActions(symbol, startDate, endDate string) ([]models.CorporateAction, error) {
+	return nil, nil
+}
+
+func (m *MockDataSourceClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	return nil, nil
+}
+
+func (m *MockDataSourceClient) GetDelistedStocks() ([]models.StockBasic, error) {
+	return nil, nil
+}
+
 func (m *MockDataSourceClient) GetBaseURL() string {
 	return m.baseURL
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -37,6 +38,13 @@ func (h *StrategyHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("PUT /api/v1/strategies/{id}", h.handleCORS(h.updateStrategy))
 	mux.HandleFunc("DELETE /api/v1/strategies/{id}", h.handleCORS(h.deleteStrategy))
 	mux.HandleFunc("GET /api/v1/strategies/{id}/performance", h.handleCORS(h.getStrategyPerformance))
+	mux.HandleFunc("GET /api/v1/strategies/{id}/model", h.handleCORS(h.getMLModel))
+
+	// 策略版本路由
+	mux.HandleFunc("GET /api/v1/strategies/{id}/versions", h.handleCORS(h.listStrategyVersions))
+	mux.HandleFunc("GET /api/v1/strategies/{id}/versions/diff", h.handleCORS(h.diffStrategyVersions))
+	mux.HandleFunc("GET /api/v1/strategies/{id}/versions/{version}", h.handleCORS(h.getStrategyVersion))
+	mux.HandleFunc("POST /api/v1/strategies/{id}/versions/{version}/rollback", h.handleCORS(h.rollbackStrategy))
 
 	// 新增: 策略模板和定义路由
 	mux.HandleFunc("GET /api/v1/strategies/templates", h.handleCORS(h.getStrategyTemplates))
@@ -139,6 +147,10 @@ func (h *StrategyHandler) createStrategy(w http.ResponseWriter, r *http.Request)
 
 	// 调用服务层
 	if err := h.strategyService.CreateStrategy(r.Context(), strategy); err != nil {
+		if isInvalidStrategyError(err) {
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		h.logger.Errorf("创建策略失败: %v, strategy_name: %s", err, req.Name)
 		h.writeErrorResponse(w, "创建策略失败", http.StatusInternalServerError)
 		return
@@ -204,6 +216,10 @@ func (h *StrategyHandler) updateStrategy(w http.ResponseWriter, r *http.Request)
 			h.writeErrorResponse(w, "策略不存在", http.StatusNotFound)
 			return
 		}
+		if isInvalidStrategyError(err) {
+			h.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		h.logger.Error("更新策略失败", logger.ErrorField(err))
 		h.writeErrorResponse(w, "更新策略失败", http.StatusInternalServerError)
 		return
@@ -233,6 +249,10 @@ func (h *StrategyHandler) deleteStrategy(w http.ResponseWriter, r *http.Request)
 			h.writeErrorResponse(w, "策略不存在", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, service.ErrStrategyInUse) {
+			h.writeErrorResponse(w, err.Error(), http.StatusConflict)
+			return
+		}
 		h.logger.Error("删除策略失败", logger.ErrorField(err))
 		h.writeErrorResponse(w, "删除策略失败", http.StatusInternalServerError)
 		return
@@ -392,13 +412,26 @@ func (h *StrategyHandler) validateCreateStrategyRequest(req *models.CreateStrate
 		return fmt.Errorf("无效的策略类型: %s", req.Type)
 	}
 
-	if strings.TrimSpace(req.Code) == "" {
-		return fmt.Errorf("策略代码不能为空")
+	// 复合策略、基本面策略和机器学习策略完全由参数定义，不需要策略代码
+	switch req.Type {
+	case models.StrategyTypeComposite, models.StrategyTypeFundamental, models.StrategyTypeML:
+	default:
+		if strings.TrimSpace(req.Code) == "" {
+			return fmt.Errorf("策略代码不能为空")
+		}
 	}
 
 	return nil
 }
 
+// isInvalidStrategyError 策略定义无效（规则、复合策略、基本面或机器学习策略参数错误），应返回400
+func isInvalidStrategyError(err error) bool {
+	return errors.Is(err, service.ErrInvalidRule) ||
+		errors.Is(err, service.ErrInvalidComposite) ||
+		errors.Is(err, service.ErrInvalidFundamental) ||
+		errors.Is(err, service.ErrInvalidML)
+}
+
 // toggleStrategy 切换策略状态
 func (h *StrategyHandler) toggleStrategy(w http.ResponseWriter, r *http.Request) {
 	strategyID := r.PathValue("id")
@@ -443,6 +476,133 @@ func (h *StrategyHandler) toggleStrategy(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// listStrategyVersions 获取策略的版本历史
+func (h *StrategyHandler) listStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	h.logger.Info("获取策略版本列表请求", logger.String("strategy_id", strategyID))
+
+	versions, err := h.strategyService.ListStrategyVersions(r.Context(), strategyID)
+	if err != nil {
+		h.writeVersionError(w, "获取策略版本列表失败", err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    versions,
+		"message": "获取策略版本列表成功",
+	})
+}
+
+// getMLModel 获取机器学习策略最近一次训练的模型及交叉验证结果
+func (h *StrategyHandler) getMLModel(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	h.logger.Info("获取机器学习模型请求", logger.String("strategy_id", strategyID))
+
+	model, err := h.strategyService.GetMLModel(r.Context(), strategyID)
+	if err != nil {
+		if errors.Is(err, service.ErrStrategyNotFound) || errors.Is(err, service.ErrMLModelNotTrained) {
+			h.writeErrorResponse(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.logger.Error("获取机器学习模型失败", logger.ErrorField(err))
+		h.writeErrorResponse(w, "获取机器学习模型失败", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    model,
+		"message": "获取机器学习模型成功",
+	})
+}
+
+// getStrategyVersion 获取策略的指定版本
+func (h *StrategyHandler) getStrategyVersion(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	version := r.PathValue("version")
+	h.logger.Info("获取策略版本请求",
+		logger.String("strategy_id", strategyID),
+		logger.String("version", version),
+	)
+
+	strategyVersion, err := h.strategyService.GetStrategyVersion(r.Context(), strategyID, version)
+	if err != nil {
+		h.writeVersionError(w, "获取策略版本失败", err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    strategyVersion,
+		"message": "获取策略版本成功",
+	})
+}
+
+// diffStrategyVersions 比较两个策略版本的参数，版本通过 from 和 to 查询参数指定
+func (h *StrategyHandler) diffStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		h.writeErrorResponse(w, "需要指定 from 和 to 版本", http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("比较策略版本请求",
+		logger.String("strategy_id", strategyID),
+		logger.String("from", from),
+		logger.String("to", to),
+	)
+
+	diff, err := h.strategyService.DiffStrategyVersions(r.Context(), strategyID, from, to)
+	if err != nil {
+		h.writeVersionError(w, "比较策略版本失败", err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    diff,
+		"message": "比较策略版本成功",
+	})
+}
+
+// rollbackStrategy 将策略回滚到指定版本
+func (h *StrategyHandler) rollbackStrategy(w http.ResponseWriter, r *http.Request) {
+	strategyID := r.PathValue("id")
+	version := r.PathValue("version")
+	h.logger.Info("回滚策略请求",
+		logger.String("strategy_id", strategyID),
+		logger.String("version", version),
+	)
+
+	strategy, err := h.strategyService.RollbackStrategy(r.Context(), strategyID, version)
+	if err != nil {
+		h.writeVersionError(w, "回滚策略失败", err)
+		return
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"success": true,
+		"data":    strategy,
+		"message": fmt.Sprintf("策略已回滚到版本%s，当前版本%s", version, strategy.Version),
+	})
+}
+
+// writeVersionError 将策略版本相关的错误映射为HTTP状态码
+func (h *StrategyHandler) writeVersionError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrStrategyNotFound):
+		h.writeErrorResponse(w, "策略不存在", http.StatusNotFound)
+	case errors.Is(err, service.ErrStrategyVersionNotFound):
+		h.writeErrorResponse(w, err.Error(), http.StatusNotFound)
+	default:
+		h.logger.Error(message, logger.ErrorField(err))
+		h.writeErrorResponse(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+	}
+}
+
 // getStrategyTemplates 获取策略模板
 func (h *StrategyHandler) getStrategyTemplates(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("获取策略模板请求")
@@ -463,6 +623,7 @@ func (h *StrategyHandler) validateStrategyParameters(w http.ResponseWriter, r *h
 	var req struct {
 		StrategyType models.StrategyType    `json:"strategy_type"`
 		Parameters   map[string]interface{} `json:"parameters"`
+		Code         string                 `json:"code"` // 技术指标策略的规则代码，可选
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -472,6 +633,14 @@ func (h *StrategyHandler) validateStrategyParameters(w http.ResponseWriter, r *h
 	}
 
 	errors := h.strategyService.ValidateParameters(req.StrategyType, req.Parameters)
+	if req.StrategyType == models.StrategyTypeTechnical && strings.TrimSpace(req.Code) != "" {
+		if err := h.strategyService.ValidateRules(req.Code, req.Parameters); err != nil {
+			errors = append(errors, map[string]string{
+				"field":   "code",
+				"message": err.Error(),
+			})
+		}
+	}
 
 	if len(errors) == 0 {
 		h.writeJSONResponse(w, map[string]interface{}{
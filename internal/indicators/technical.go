@@ -21,47 +21,86 @@ func (c *Calculator) CalculateMA(data []models.StockDaily, period int) []decimal
 		return []decimal.Decimal{}
 	}
 
-	var mas []decimal.Decimal
+	// 滚动求和：十进制加减法没有精度损失，结果与逐个窗口求和相同
+	divisor := decimal.NewFromInt(int64(period))
+	mas := make([]decimal.Decimal, 0, len(data)-period+1)
+	sum := decimal.Zero
+	for i, daily := range data {
+		sum = sum.Add(daily.Close.Decimal)
+		if i >= period {
+			sum = sum.Sub(data[i-period].Close.Decimal)
+		}
+		if i >= period-1 {
+			mas = append(mas, sum.Div(divisor))
+		}
+	}
+	return mas
+}
+
+// CalculateEMA 计算指数移动平均线
+func (c *Calculator) CalculateEMA(data []models.StockDaily, period int) []decimal.Decimal {
+	if period <= 0 {
+		return []decimal.Decimal{}
+	}
+	return c.calculateEMA(data, period)
+}
+
+// CalculateWMA 计算加权移动平均线（越近的交易日权重越高）
+func (c *Calculator) CalculateWMA(data []models.StockDaily, period int) []decimal.Decimal {
+	if period <= 0 || len(data) < period {
+		return []decimal.Decimal{}
+	}
+
+	weightSum := decimal.NewFromInt(int64(period * (period + 1) / 2))
+	var wmas []decimal.Decimal
 	for i := period - 1; i < len(data); i++ {
 		sum := decimal.Zero
-		for j := i - period + 1; j <= i; j++ {
-			sum = sum.Add(data[j].Close.Decimal)
+		for j := 0; j < period; j++ {
+			weight := decimal.NewFromInt(int64(j + 1))
+			sum = sum.Add(data[i-period+1+j].Close.Decimal.Mul(weight))
 		}
-		ma := sum.Div(decimal.NewFromInt(int64(period)))
-		mas = append(mas, ma)
+		wmas = append(wmas, sum.Div(weightSum))
 	}
-	return mas
+	return wmas
 }
 
 // CalculateMACD 计算MACD指标
 func (c *Calculator) CalculateMACD(data []models.StockDaily) []models.MACDIndicator {
-	if len(data) < 26 {
+	return c.CalculateMACDWithPeriods(data, 12, 26, 9)
+}
+
+// CalculateMACDWithPeriods 按指定的快线、慢线和信号线周期计算MACD指标
+// 返回结果的最后一个元素对应data的最后一个交易日
+func (c *Calculator) CalculateMACDWithPeriods(data []models.StockDaily, fastPeriod, slowPeriod, signalPeriod int) []models.MACDIndicator {
+	if fastPeriod <= 0 || slowPeriod <= fastPeriod || signalPeriod <= 0 || len(data) < slowPeriod {
 		return []models.MACDIndicator{}
 	}
 
-	// 计算EMA12和EMA26
-	ema12 := c.calculateEMA(data, 12)
-	ema26 := c.calculateEMA(data, 26)
+	emaFast := c.calculateEMA(data, fastPeriod)
+	emaSlow := c.calculateEMA(data, slowPeriod)
 
 	var macdResults []models.MACDIndicator
 	var difValues []decimal.Decimal
 
-	// 计算DIF线
-	for i := 0; i < len(ema12) && i < len(ema26); i++ {
-		dif := ema12[i].Sub(ema26[i])
+	// 计算DIF线：快线EMA比慢线EMA早 slowPeriod-fastPeriod 个交易日开始，需要对齐到同一交易日
+	offset := slowPeriod - fastPeriod
+	for i := 0; i < len(emaSlow) && i+offset < len(emaFast); i++ {
+		dif := emaFast[i+offset].Sub(emaSlow[i])
 		difValues = append(difValues, dif)
 	}
 
-	// 计算DEA线(DIF的9日EMA)
-	deaValues := c.calculateEMAFromValues(difValues, 9)
+	// 计算DEA线(DIF的signalPeriod日EMA)
+	deaValues := c.calculateEMAFromValues(difValues, signalPeriod)
 
-	// 计算MACD柱状图和信号
-	for i := 0; i < len(difValues) && i < len(deaValues); i++ {
-		macd := difValues[i].Sub(deaValues[i]).Mul(decimal.NewFromInt(2))
+	// 计算MACD柱状图和信号，DEA比DIF晚 signalPeriod-1 个交易日开始
+	deaOffset := signalPeriod - 1
+	for i := 0; i < len(deaValues) && i+deaOffset < len(difValues); i++ {
+		dif := difValues[i+deaOffset]
+		macd := dif.Sub(deaValues[i]).Mul(decimal.NewFromInt(2))
 
 		signal := "HOLD"
 		if i > 0 {
-			prevMACD := difValues[i-1].Sub(deaValues[i-1]).Mul(decimal.NewFromInt(2))
+			prevMACD := difValues[i+deaOffset-1].Sub(deaValues[i-1]).Mul(decimal.NewFromInt(2))
 			// 金叉：MACD由负转正
 			if prevMACD.LessThan(decimal.Zero) && macd.GreaterThan(decimal.Zero) {
 				signal = "BUY"
@@ -73,7 +112,7 @@ func (c *Calculator) CalculateMACD(data []models.StockDaily) []models.MACDIndica
 		}
 
 		macdResults = append(macdResults, models.MACDIndicator{
-			DIF:       models.NewJSONDecimal(difValues[i]),
+			DIF:       models.NewJSONDecimal(dif),
 			DEA:       models.NewJSONDecimal(deaValues[i]),
 			Histogram: models.NewJSONDecimal(macd),
 			Signal:    signal,
@@ -0,0 +1,64 @@
+package indicators
+
+import (
+	"math"
+	"stock-a-future/internal/models"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func buildCloseSeries(closes []float64) []models.StockDaily {
+	data := make([]models.StockDaily, len(closes))
+	for i, c := range closes {
+		data[i] = models.StockDaily{
+			Close: models.NewJSONDecimal(decimal.NewFromFloat(c)),
+			High:  models.NewJSONDecimal(decimal.NewFromFloat(c)),
+			Low:   models.NewJSONDecimal(decimal.NewFromFloat(c)),
+		}
+	}
+	return data
+}
+
+func TestCalculateMACDWithPeriods_AlignedToLatestBar(t *testing.T) {
+	calculator := NewCalculator()
+
+	var closes []float64
+	for i := 0; i < 60; i++ {
+		closes = append(closes, 10+math.Sin(float64(i)/5))
+	}
+	data := buildCloseSeries(closes)
+
+	macd := calculator.CalculateMACDWithPeriods(data, 12, 26, 9)
+	if want := len(data) - 26 - 9 + 2; len(macd) != want {
+		t.Fatalf("期望MACD结果数量 %d, 实际 %d", want, len(macd))
+	}
+
+	// 最后一个DIF应等于最后一根K线上的EMA12-EMA26
+	ema12 := calculator.CalculateEMA(data, 12)
+	ema26 := calculator.CalculateEMA(data, 26)
+	expected := ema12[len(ema12)-1].Sub(ema26[len(ema26)-1])
+	if !macd[len(macd)-1].DIF.Decimal.Equal(expected) {
+		t.Errorf("DIF未与最新K线对齐: 期望 %s, 实际 %s", expected, macd[len(macd)-1].DIF.Decimal)
+	}
+
+	// 默认参数应与CalculateMACD一致
+	if len(calculator.CalculateMACD(data)) != len(macd) {
+		t.Error("CalculateMACD应等价于12/26/9参数")
+	}
+}
+
+func TestCalculateWMA(t *testing.T) {
+	calculator := NewCalculator()
+	data := buildCloseSeries([]float64{1, 2, 3})
+
+	wma := calculator.CalculateWMA(data, 3)
+	if len(wma) != 1 {
+		t.Fatalf("期望1个WMA结果, 实际 %d", len(wma))
+	}
+	// (1*1 + 2*2 + 3*3) / 6
+	expected := decimal.NewFromFloat(14.0 / 6.0)
+	if wma[0].Sub(expected).Abs().GreaterThan(decimal.NewFromFloat(1e-9)) {
+		t.Errorf("WMA计算错误: 期望 %s, 实际 %s", expected, wma[0])
+	}
+}
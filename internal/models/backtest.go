@@ -37,27 +37,193 @@ type Backtest struct {
 	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
 	StartedAt     *time.Time     `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt   *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
+
+	// 回测引擎选项
+	DisableTradingRules bool                  `json:"disable_trading_rules" db:"disable_trading_rules"` // 关闭A股交易规则（T+1、整手、涨跌停、停牌），用于对比规则对结果的影响
+	CostConfig          *CostConfig           `json:"cost_config,omitempty" db:"cost_config"`           // 交易成本参数，为空时按Commission/Slippage构造
+	PositionSizing      *PositionSizingConfig `json:"position_sizing,omitempty" db:"position_sizing"`   // 仓位管理参数，为空时每次投入20%现金
+	ExitRules           *ExitRulesConfig      `json:"exit_rules,omitempty" db:"exit_rules"`             // 止损止盈等风控退出规则
+	Execution           *ExecutionConfig      `json:"execution,omitempty" db:"execution"`               // 信号成交时机，为空时按信号当日收盘价成交
+	Portfolio           *PortfolioConfig      `json:"portfolio,omitempty" db:"portfolio"`               // 多策略资金模式，为空时每个策略独立使用全部初始资金
+	Universe            *UniverseConfig       `json:"universe,omitempty" db:"universe"`                 // 动态股票池，设置时忽略 Symbols
+	PriceAdjust         PriceAdjustMode       `json:"price_adjust,omitempty" db:"price_adjust"`         // 行情复权方式，为空时使用前复权
+
+	// 启动回测时各策略的版本号: strategyID -> version
+	StrategyVersions map[string]string `json:"strategy_versions,omitempty" db:"strategy_versions"`
+
+	// 运行时因数据源能力不足而降级处理的警告，如股票池不含退市股票（幸存者偏差）
+	Warnings []string `json:"warnings,omitempty" db:"warnings"`
 }
 
 // BacktestResult 回测结果
 type BacktestResult struct {
-	ID              string    `json:"id" db:"id"`
-	BacktestID      string    `json:"backtest_id" db:"backtest_id"`
-	StrategyID      string    `json:"strategy_id" db:"strategy_id"`           // 对应的策略ID（多策略时区分）
-	StrategyName    string    `json:"strategy_name,omitempty"`                // 策略名称
-	TotalReturn     float64   `json:"total_return" db:"total_return"`         // 总收益率
-	AnnualReturn    float64   `json:"annual_return" db:"annual_return"`       // 年化收益率
-	MaxDrawdown     float64   `json:"max_drawdown" db:"max_drawdown"`         // 最大回撤
-	SharpeRatio     float64   `json:"sharpe_ratio" db:"sharpe_ratio"`         // 夏普比率
-	SortinoRatio    float64   `json:"sortino_ratio" db:"sortino_ratio"`       // 索提诺比率
-	WinRate         float64   `json:"win_rate" db:"win_rate"`                 // 胜率
-	ProfitFactor    float64   `json:"profit_factor" db:"profit_factor"`       // 盈亏比
-	TotalTrades     int       `json:"total_trades" db:"total_trades"`         // 总交易次数
-	AvgTradeReturn  float64   `json:"avg_trade_return" db:"avg_trade_return"` // 平均交易收益
-	BenchmarkReturn float64   `json:"benchmark_return" db:"benchmark_return"` // 基准收益
-	Alpha           float64   `json:"alpha" db:"alpha"`                       // Alpha
-	Beta            float64   `json:"beta" db:"beta"`                         // Beta
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	ID               string    `json:"id" db:"id"`
+	BacktestID       string    `json:"backtest_id" db:"backtest_id"`
+	StrategyID       string    `json:"strategy_id" db:"strategy_id"`             // 对应的策略ID（多策略时区分）
+	StrategyName     string    `json:"strategy_name,omitempty"`                  // 策略名称
+	TotalReturn      float64   `json:"total_return" db:"total_return"`           // 总收益率
+	AnnualReturn     float64   `json:"annual_return" db:"annual_return"`         // 年化收益率
+	MaxDrawdown      float64   `json:"max_drawdown" db:"max_drawdown"`           // 最大回撤
+	SharpeRatio      float64   `json:"sharpe_ratio" db:"sharpe_ratio"`           // 夏普比率
+	SortinoRatio     float64   `json:"sortino_ratio" db:"sortino_ratio"`         // 索提诺比率
+	WinRate          float64   `json:"win_rate" db:"win_rate"`                   // 胜率
+	ProfitFactor     float64   `json:"profit_factor" db:"profit_factor"`         // 盈亏比
+	TotalTrades      int       `json:"total_trades" db:"total_trades"`           // 总交易次数
+	AvgTradeReturn   float64   `json:"avg_trade_return" db:"avg_trade_return"`   // 平均交易收益
+	BenchmarkReturn  float64   `json:"benchmark_return" db:"benchmark_return"`   // 基准收益
+	Alpha            float64   `json:"alpha" db:"alpha"`                         // Alpha
+	Beta             float64   `json:"beta" db:"beta"`                           // Beta
+	TrackingError    float64   `json:"tracking_error" db:"tracking_error"`       // 年化跟踪误差
+	InformationRatio float64   `json:"information_ratio" db:"information_ratio"` // 信息比率
+	RejectedOrders   int       `json:"rejected_orders" db:"rejected_orders"`     // 被交易规则拒绝的订单数
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+
+	// 交易成本汇总
+	TotalCommission  float64 `json:"total_commission" db:"total_commission"`     // 佣金合计
+	TotalStampDuty   float64 `json:"total_stamp_duty" db:"total_stamp_duty"`     // 印花税合计
+	TotalTransferFee float64 `json:"total_transfer_fee" db:"total_transfer_fee"` // 过户费合计
+	TotalSlippage    float64 `json:"total_slippage" db:"total_slippage"`         // 滑点成本合计
+	TotalCosts       float64 `json:"total_costs" db:"total_costs"`               // 交易成本总计
+
+	// 分红送转（仅不复权行情回测时计入）
+	DividendIncome float64 `json:"dividend_income" db:"dividend_income"` // 现金分红收入（税前）
+	BonusShares    int     `json:"bonus_shares" db:"bonus_shares"`       // 送股和转增获得的股数
+
+	OpenPositions []Position `json:"open_positions,omitempty" db:"-"` // 回测结束时未平仓的持仓（含送转股），按股票代码排序
+}
+
+// CostConfig 交易成本参数
+type CostConfig struct {
+	Profile         string  `json:"profile,omitempty"` // 成本方案名称，自定义参数时为 custom
+	CommissionRate  float64 `json:"commission_rate"`   // 佣金费率，买卖双向收取
+	MinCommission   float64 `json:"min_commission"`    // 单笔最低佣金（元）
+	StampDutyRate   float64 `json:"stamp_duty_rate"`   // 印花税率，仅卖出收取
+	TransferFeeRate float64 `json:"transfer_fee_rate"` // 过户费率，按成交金额双向收取
+	SlippageRate    float64 `json:"slippage_rate"`     // 滑点比例，买入价上浮、卖出价下浮
+}
+
+// PositionSizingMethod 仓位计算方法
+type PositionSizingMethod string
+
+const (
+	PositionSizingFixedFraction PositionSizingMethod = "fixed_fraction"    // 固定比例：每次投入可用现金的固定比例
+	PositionSizingFixedAmount   PositionSizingMethod = "fixed_amount"      // 固定金额：每次投入固定金额
+	PositionSizingEqualWeight   PositionSizingMethod = "equal_weight"      // 等权：每只股票的目标仓位为总资产/股票数
+	PositionSizingVolatility    PositionSizingMethod = "volatility_target" // 波动率目标：按ATR使单笔风险占总资产的固定比例
+	PositionSizingKelly         PositionSizingMethod = "kelly"             // 分数凯利：按历史胜率和盈亏比计算投入比例
+)
+
+// PositionSizingConfig 仓位管理参数，未设置的参数使用默认值
+type PositionSizingConfig struct {
+	Method         PositionSizingMethod `json:"method"`
+	Fraction       float64              `json:"fraction,omitempty"`         // fixed_fraction投入现金比例，kelly样本不足时也使用该比例，默认0.2
+	Amount         float64              `json:"amount,omitempty"`           // fixed_amount每次投入金额（元）
+	RiskPerTrade   float64              `json:"risk_per_trade,omitempty"`   // volatility_target单笔风险占总资产比例，默认0.01
+	ATRPeriod      int                  `json:"atr_period,omitempty"`       // volatility_target的ATR周期，默认14
+	ATRMultiple    float64              `json:"atr_multiple,omitempty"`     // volatility_target的止损距离（ATR倍数），默认2
+	KellyFraction  float64              `json:"kelly_fraction,omitempty"`   // kelly使用的凯利比例，默认0.5（半凯利）
+	KellyMinTrades int                  `json:"kelly_min_trades,omitempty"` // kelly计算所需的最少平仓次数，默认10
+	MinAmount      float64              `json:"min_amount,omitempty"`       // 最小下单金额（元），默认1000
+	ScaleBySignal  bool                 `json:"scale_by_signal,omitempty"`  // 是否按信号强度和置信度缩放下单金额
+}
+
+// ExitRulesConfig 风控退出规则，每个交易日按最高价/最低价判断是否触及，为0的规则不启用
+type ExitRulesConfig struct {
+	StopLossPct     float64 `json:"stop_loss_pct,omitempty"`     // 固定止损：相对成本价下跌比例，如0.08
+	ATRStopMultiple float64 `json:"atr_stop_multiple,omitempty"` // ATR止损：成本价减去建仓时ATR的倍数
+	ATRPeriod       int     `json:"atr_period,omitempty"`        // ATR周期，默认14
+	TakeProfitPct   float64 `json:"take_profit_pct,omitempty"`   // 止盈：相对成本价上涨比例
+	TrailingStopPct float64 `json:"trailing_stop_pct,omitempty"` // 移动止损：从持仓期最高价回撤比例
+	MaxHoldingDays  int     `json:"max_holding_days,omitempty"`  // 最长持有交易日数，到期按收盘价卖出
+}
+
+// ExecutionTiming 策略信号的成交时机
+type ExecutionTiming string
+
+const (
+	ExecutionSameBarClose ExecutionTiming = "same_bar_close" // 信号当日收盘价成交（存在前视偏差）
+	ExecutionNextBarOpen  ExecutionTiming = "next_bar_open"  // 次一交易日开盘价成交
+	ExecutionNextBarVWAP  ExecutionTiming = "next_bar_vwap"  // 次一交易日成交均价（成交额/成交量）成交，超出当日最高最低价时按开盘价
+	ExecutionNextBarLimit ExecutionTiming = "next_bar_limit" // 以信号日收盘价为基准挂限价单，次一交易日起触及限价时成交
+)
+
+// ExecutionConfig 信号成交时机参数
+type ExecutionConfig struct {
+	Timing         ExecutionTiming `json:"timing"`
+	LimitOffsetPct float64         `json:"limit_offset_pct,omitempty"` // 限价相对信号日收盘价的让价比例：买入向下、卖出向上
+	OrderValidDays int             `json:"order_valid_days,omitempty"` // 限价单有效交易日数，默认1，到期未成交则撤销
+}
+
+// PortfolioMode 多策略回测的资金模式
+type PortfolioMode string
+
+const (
+	PortfolioModeIndependent PortfolioMode = "independent" // 每个策略使用全部初始资金独立运行，组合指标取各策略平均值
+	PortfolioModeShared      PortfolioMode = "shared"      // 所有策略共用一个账户，按权重分配资金
+)
+
+// ConflictResolution 共享资金模式下同一交易日不同策略对同一股票发出相反信号时的处理方式
+type ConflictResolution string
+
+const (
+	ConflictSellFirst ConflictResolution = "sell_first" // 卖出优先，放弃买入信号
+	ConflictPriority  ConflictResolution = "priority"   // 资金权重高的策略优先，权重相同时按策略顺序
+	ConflictSkip      ConflictResolution = "skip"       // 相反信号均不执行
+)
+
+// PortfolioConfig 多策略资金模式参数
+type PortfolioConfig struct {
+	Mode               PortfolioMode      `json:"mode"`
+	Weights            map[string]float64 `json:"weights,omitempty"`             // 策略ID -> 资金分配权重，为空时等权；权重会归一化
+	ConflictResolution ConflictResolution `json:"conflict_resolution,omitempty"` // 相反信号的处理方式，默认卖出优先
+	MaxGrossExposure   float64            `json:"max_gross_exposure,omitempty"`  // 持仓市值占账户总资产的上限，如0.8，0表示不限制
+}
+
+// PriceAdjustMode 回测使用的行情复权方式
+type PriceAdjustMode string
+
+const (
+	PriceAdjustForward PriceAdjustMode = "qfq"  // 前复权：价格已包含分红送转的影响，持仓不做除权处理
+	PriceAdjustNone    PriceAdjustMode = "none" // 不复权：按真实成交价格撮合，在除权除息日将送转股和现金分红记入持仓和现金
+)
+
+// UniverseType 动态股票池的来源
+type UniverseType string
+
+const (
+	UniverseAll       UniverseType = "all"       // 全部A股
+	UniverseIndustry  UniverseType = "industry"  // 指定行业
+	UniverseBoard     UniverseType = "board"     // 指定板块（主板、创业板、科创板、北交所）
+	UniverseFavorites UniverseType = "favorites" // 自选股分组
+)
+
+// UniverseConfig 动态股票池参数，设置后回测不再使用固定的股票列表
+// 成员按交易日确定：未上市、上市未满 MinListingDays 天或已退市的股票当日不在股票池中
+type UniverseConfig struct {
+	Type           UniverseType `json:"type"`
+	Industry       string       `json:"industry,omitempty"`         // 行业名称，对应股票基本信息中的所属行业
+	Board          string       `json:"board,omitempty"`            // 板块：main、chinext、star、bse
+	GroupID        string       `json:"group_id,omitempty"`         // 自选股分组ID
+	ExcludeST      bool         `json:"exclude_st"`                 // 排除ST股票
+	MinListingDays int          `json:"min_listing_days,omitempty"` // 上市满N个自然日才纳入，如365表示排除上市不满1年的次新股
+}
+
+// TradeCost 单笔成交的成本明细
+type TradeCost struct {
+	Commission  float64 `json:"commission"`   // 佣金
+	StampDuty   float64 `json:"stamp_duty"`   // 印花税
+	TransferFee float64 `json:"transfer_fee"` // 过户费
+	Slippage    float64 `json:"slippage"`     // 滑点成本（已体现在成交价中）
+}
+
+// Fees 需要从现金中支付的税费（不含已体现在成交价中的滑点）
+func (c TradeCost) Fees() float64 {
+	return c.Commission + c.StampDuty + c.TransferFee
+}
+
+// Total 交易成本总计
+func (c TradeCost) Total() float64 {
+	return c.Fees() + c.Slippage
 }
 
 // Trade 交易记录
@@ -69,7 +235,11 @@ type Trade struct {
 	Side          TradeSide `json:"side" db:"side"`                               // 买入/卖出
 	Quantity      int       `json:"quantity" db:"quantity"`                       // 数量
 	Price         float64   `json:"price" db:"price"`                             // 价格
-	Commission    float64   `json:"commission" db:"commission"`                   // 手续费
+	Commission    float64   `json:"commission" db:"commission"`                   // 佣金
+	StampDuty     float64   `json:"stamp_duty" db:"stamp_duty"`                   // 印花税（仅卖出）
+	TransferFee   float64   `json:"transfer_fee" db:"transfer_fee"`               // 过户费
+	SlippageCost  float64   `json:"slippage_cost" db:"slippage_cost"`             // 滑点成本
+	TotalCost     float64   `json:"total_cost" db:"total_cost"`                   // 交易成本合计
 	PnL           float64   `json:"pnl,omitempty" db:"pnl"`                       // 盈亏（卖出时计算）
 	SignalType    string    `json:"signal_type,omitempty" db:"signal_type"`       // 触发信号类型
 	TotalAssets   float64   `json:"total_assets,omitempty" db:"total_assets"`     // 交易后的总资产（现金+持仓）
@@ -79,6 +249,11 @@ type Trade struct {
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
 
+// Fees 本笔交易从现金中支付的税费（佣金+印花税+过户费）
+func (t *Trade) Fees() float64 {
+	return t.Commission + t.StampDuty + t.TransferFee
+}
+
 // Position 持仓记录
 type Position struct {
 	ID           string    `json:"id" db:"id"`
@@ -90,6 +265,60 @@ type Position struct {
 	UnrealizedPL float64   `json:"unrealized_pl" db:"unrealized_pl"` // 未实现盈亏
 	Timestamp    time.Time `json:"timestamp" db:"timestamp"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	// T+1 规则所需：最近一次买入的日期及当日累计买入数量
+	LastBuyDate     time.Time `json:"last_buy_date,omitempty" db:"last_buy_date"`
+	LastBuyQuantity int       `json:"last_buy_quantity,omitempty" db:"last_buy_quantity"`
+
+	// 风控退出规则所需
+	PeakPrice   float64 `json:"peak_price,omitempty" db:"peak_price"`     // 持仓期间最高价，用于移动止损
+	EntryATR    float64 `json:"entry_atr,omitempty" db:"entry_atr"`       // 建仓时的ATR，用于ATR止损；加仓后按数量加权
+	HoldingDays int     `json:"holding_days,omitempty" db:"holding_days"` // 已持有交易日数；加仓后按数量加权
+}
+
+// OrderRejectReason 订单被拒绝的原因代码
+type OrderRejectReason string
+
+const (
+	OrderRejectTPlusOne  OrderRejectReason = "t_plus_one" // T+1：当日买入的股份不可卖出
+	OrderRejectLotSize   OrderRejectReason = "lot_size"   // 不满足整手/最小申报数量
+	OrderRejectLimitUp   OrderRejectReason = "limit_up"   // 涨停不可买入
+	OrderRejectLimitDown OrderRejectReason = "limit_down" // 跌停不可卖出
+	OrderRejectSuspended OrderRejectReason = "suspended"  // 停牌无法成交
+	OrderRejectExpired   OrderRejectReason = "expired"    // 限价单有效期内未触及限价
+)
+
+// Description 获取拒绝原因的中文描述
+func (r OrderRejectReason) Description() string {
+	switch r {
+	case OrderRejectTPlusOne:
+		return "T+1限制，当日买入的股份不可卖出"
+	case OrderRejectLotSize:
+		return "申报数量不足一手"
+	case OrderRejectLimitUp:
+		return "涨停无法买入"
+	case OrderRejectLimitDown:
+		return "跌停无法卖出"
+	case OrderRejectSuspended:
+		return "停牌无法成交"
+	case OrderRejectExpired:
+		return "限价单到期未成交"
+	}
+	return string(r)
+}
+
+// RejectedOrder 被模拟交易所规则拒绝的订单
+type RejectedOrder struct {
+	ID         string            `json:"id" db:"id"`
+	BacktestID string            `json:"backtest_id" db:"backtest_id"`
+	StrategyID string            `json:"strategy_id" db:"strategy_id"`
+	Symbol     string            `json:"symbol" db:"symbol"`
+	Side       TradeSide         `json:"side" db:"side"`
+	Quantity   int               `json:"quantity" db:"quantity"` // 拒绝前的申报数量
+	Price      float64           `json:"price" db:"price"`       // 申报价格
+	Reason     OrderRejectReason `json:"reason" db:"reason"`
+	Message    string            `json:"message" db:"message"`
+	Timestamp  time.Time         `json:"timestamp" db:"timestamp"`
 }
 
 // EquityPoint 权益曲线点
@@ -112,6 +341,30 @@ type BacktestProgress struct {
 	Error               string     `json:"error,omitempty"`
 }
 
+// ProgressEventType 任务进度推送的事件类型
+type ProgressEventType string
+
+const (
+	ProgressEventSnapshot ProgressEventType = "snapshot" // 订阅时推送的当前状态
+	ProgressEventProgress ProgressEventType = "progress" // 进度更新
+	ProgressEventStatus   ProgressEventType = "status"   // 状态变化，任务结束时为最后一个事件
+	ProgressEventTrade    ProgressEventType = "trade"    // 新成交
+	ProgressEventEquity   ProgressEventType = "equity"   // 新的组合权益点
+)
+
+// ProgressEvent 回测、参数优化任务通过SSE推送的事件
+type ProgressEvent struct {
+	Type ProgressEventType `json:"type"`
+	Data interface{}       `json:"data"`
+}
+
+// BacktestSnapshot 订阅回测事件时推送的当前状态：进度以及已产生的成交和权益曲线
+type BacktestSnapshot struct {
+	Progress    *BacktestProgress `json:"progress"`
+	Trades      []Trade           `json:"trades"`
+	EquityCurve []EquityPoint     `json:"equity_curve"`
+}
+
 // BacktestStrategyPerformance 单个策略的回测性能结果（包含独立权益曲线）
 // 注意：与strategy.go中的StrategyPerformance区分，这里专门用于回测结果
 type BacktestStrategyPerformance struct {
@@ -128,6 +381,7 @@ type BacktestResultsResponse struct {
 	EquityCurve          []EquityPoint                 `json:"equity_curve"`          // 整体权益曲线
 	Trades               []Trade                       `json:"trades"`
 	Positions            []Position                    `json:"positions,omitempty"`
+	RejectedOrders       []RejectedOrder               `json:"rejected_orders,omitempty"`  // 被交易规则拒绝的订单
 	Strategies           []*Strategy                   `json:"strategies"`                 // 多策略信息
 	BacktestConfig       BacktestConfig                `json:"backtest_config"`            // 回测配置
 	CombinedMetrics      *BacktestResult               `json:"combined_metrics,omitempty"` // 组合策略整体指标
@@ -142,6 +396,18 @@ type BacktestConfig struct {
 	Symbols     []string `json:"symbols"`
 	Commission  float64  `json:"commission"`
 	CreatedAt   string   `json:"created_at"`
+
+	DisableTradingRules bool                  `json:"disable_trading_rules"`
+	CostConfig          *CostConfig           `json:"cost_config,omitempty"`
+	PositionSizing      *PositionSizingConfig `json:"position_sizing,omitempty"`
+	ExitRules           *ExitRulesConfig      `json:"exit_rules,omitempty"`
+	Execution           *ExecutionConfig      `json:"execution,omitempty"`
+	Portfolio           *PortfolioConfig      `json:"portfolio,omitempty"`
+	Universe            *UniverseConfig       `json:"universe,omitempty"`
+	PriceAdjust         PriceAdjustMode       `json:"price_adjust,omitempty"`
+	Benchmark           string                `json:"benchmark"`
+	StrategyVersions    map[string]string     `json:"strategy_versions,omitempty"` // 运行时各策略的版本号
+	Warnings            []string              `json:"warnings,omitempty"`          // 运行时降级处理的警告
 }
 
 // CreateBacktestRequest 创建回测请求
@@ -149,13 +415,23 @@ type CreateBacktestRequest struct {
 	Name        string   `json:"name" validate:"required,max=100"`
 	StrategyID  string   `json:"strategy_id,omitempty"`                        // 兼容单策略，废弃字段
 	StrategyIDs []string `json:"strategy_ids" validate:"required,min=1,max=5"` // 多策略ID列表，最多5个
-	Symbols     []string `json:"symbols" validate:"required,min=1"`
+	Symbols     []string `json:"symbols"`                                      // 固定股票列表，与 universe 二选一
 	StartDate   string   `json:"start_date" validate:"required"`
 	EndDate     string   `json:"end_date" validate:"required"`
 	InitialCash float64  `json:"initial_cash" validate:"min=10000"`
 	Commission  float64  `json:"commission" validate:"min=0,max=0.01"` // 0-1%
 	Slippage    float64  `json:"slippage" validate:"min=0,max=0.01"`   // 0-1%
 	Benchmark   string   `json:"benchmark"`
+
+	DisableTradingRules bool                  `json:"disable_trading_rules"`     // 关闭A股交易规则
+	CostProfile         string                `json:"cost_profile"`              // 预设成本方案名称，如 standard、low_commission
+	CostConfig          *CostConfig           `json:"cost_config,omitempty"`     // 自定义成本参数，优先于 cost_profile
+	PositionSizing      *PositionSizingConfig `json:"position_sizing,omitempty"` // 仓位管理参数
+	ExitRules           *ExitRulesConfig      `json:"exit_rules,omitempty"`      // 止损止盈等风控退出规则
+	Execution           *ExecutionConfig      `json:"execution,omitempty"`       // 信号成交时机
+	Portfolio           *PortfolioConfig      `json:"portfolio,omitempty"`       // 多策略资金模式
+	Universe            *UniverseConfig       `json:"universe,omitempty"`        // 动态股票池
+	PriceAdjust         PriceAdjustMode       `json:"price_adjust,omitempty"`    // 行情复权方式：qfq（默认）、none
 }
 
 // UpdateBacktestRequest 更新回测请求
@@ -183,6 +459,233 @@ type BacktestListResponse struct {
 	Items []Backtest `json:"items"`
 }
 
+// MonteCarloMethod 蒙特卡洛模拟方法
+type MonteCarloMethod string
+
+const (
+	MonteCarloTradeShuffle MonteCarloMethod = "trade_shuffle" // 打乱已平仓交易收益率的先后顺序，总收益不变，不返回总收益分布
+	MonteCarloBootstrap    MonteCarloMethod = "bootstrap"     // 对日收益率有放回重抽样
+	MonteCarloTradeSkip    MonteCarloMethod = "trade_skip"    // 随机跳过一部分交易
+)
+
+// MonteCarloRequest 蒙特卡洛稳健性分析请求
+type MonteCarloRequest struct {
+	Simulations     *int    `json:"simulations,omitempty"` // 每种方法的模拟次数（1-10000），未设置时为1000，显式设为0无效
+	SkipFraction    float64 `json:"skip_fraction"`         // 随机跳过交易的比例，默认10%
+	ConfidenceLevel float64 `json:"confidence_level"`      // 置信水平，默认95%
+	StrategyID      string  `json:"strategy_id"`           // 分析的策略，为空时分析组合整体
+	Seed            *int64  `json:"seed,omitempty"`        // 随机种子（可以为0），未设置时随机生成；实际使用的种子记录在结果中，用于复现结果
+}
+
+// HistogramBin 分布直方图的一个区间
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// MetricDistribution 单个指标在多次模拟中的分布
+type MetricDistribution struct {
+	Original  float64        `json:"original"` // 原始交易序列的指标值
+	Mean      float64        `json:"mean"`
+	StdDev    float64        `json:"std_dev"`
+	Min       float64        `json:"min"`
+	Max       float64        `json:"max"`
+	P5        float64        `json:"p5"`
+	P25       float64        `json:"p25"`
+	Median    float64        `json:"median"`
+	P75       float64        `json:"p75"`
+	P95       float64        `json:"p95"`
+	CILower   float64        `json:"ci_lower"`  // 置信区间下限
+	CIUpper   float64        `json:"ci_upper"`  // 置信区间上限
+	Histogram []HistogramBin `json:"histogram"` // 分布直方图
+}
+
+// MonteCarloMethodResult 单种模拟方法的结果
+// 交易类模拟在当时的已实现权益上复利计入每笔交易的收益率，打乱顺序时总收益恒等于原始值，TotalReturn 为空
+type MonteCarloMethodResult struct {
+	Method      MonteCarloMethod    `json:"method"`
+	Simulations int                 `json:"simulations"`
+	TotalReturn *MetricDistribution `json:"total_return,omitempty"`
+	MaxDrawdown MetricDistribution  `json:"max_drawdown"`
+	SharpeRatio MetricDistribution  `json:"sharpe_ratio"`
+}
+
+// MonteCarloResult 蒙特卡洛稳健性分析结果
+type MonteCarloResult struct {
+	BacktestID      string                   `json:"backtest_id"`
+	StrategyID      string                   `json:"strategy_id,omitempty"`
+	Simulations     int                      `json:"simulations"`
+	ConfidenceLevel float64                  `json:"confidence_level"`
+	SkipFraction    float64                  `json:"skip_fraction"`
+	Seed            int64                    `json:"seed"`        // 实际使用的随机种子，请求中传入即可复现本次结果
+	TradeCount      int                      `json:"trade_count"` // 参与模拟的已平仓交易数
+	Methods         []MonteCarloMethodResult `json:"methods"`
+	CreatedAt       time.Time                `json:"created_at"`
+}
+
+// ImportCorporateActionsRequest 导入股票分红送转记录的请求，覆盖该股票之前导入的记录
+type ImportCorporateActionsRequest struct {
+	Actions []CorporateAction `json:"actions"`
+}
+
+// BacktestEngineOptions 决定回测模拟过程的全部参数，与 Backtest 中的同名字段含义相同
+type BacktestEngineOptions struct {
+	Symbols             []string              `json:"symbols"`
+	StartDate           time.Time             `json:"start_date"`
+	EndDate             time.Time             `json:"end_date"`
+	InitialCash         float64               `json:"initial_cash"`
+	Commission          float64               `json:"commission"`
+	Slippage            float64               `json:"slippage"`
+	Benchmark           string                `json:"benchmark"`
+	DisableTradingRules bool                  `json:"disable_trading_rules"`
+	CostConfig          *CostConfig           `json:"cost_config,omitempty"`
+	PositionSizing      *PositionSizingConfig `json:"position_sizing,omitempty"`
+	ExitRules           *ExitRulesConfig      `json:"exit_rules,omitempty"`
+	Execution           *ExecutionConfig      `json:"execution,omitempty"`
+	Portfolio           *PortfolioConfig      `json:"portfolio,omitempty"`
+	Universe            *UniverseConfig       `json:"universe,omitempty"`
+	PriceAdjust         PriceAdjustMode       `json:"price_adjust,omitempty"`
+}
+
+// BacktestManifest 回测运行清单，记录复现一次回测结果所需的全部输入和结果的哈希
+type BacktestManifest struct {
+	BacktestID        string                `json:"backtest_id"`
+	Strategies        []Strategy            `json:"strategies"`                 // 运行时的策略定义和参数
+	ChildStrategies   []Strategy            `json:"child_strategies,omitempty"` // 复合策略递归引用的子策略定义，按ID排序
+	MLModels          []MLModel             `json:"ml_models,omitempty"`        // 机器学习策略使用的模型，按策略ID排序
+	CodeVersion       string                `json:"code_version"`               // 构建时的代码版本（VCS提交号）
+	DataSourceType    string                `json:"data_source_type"`           // 数据源类型
+	DataSourceBaseURL string                `json:"data_source_base_url"`       // 数据源基础URL
+	DataHash          string                `json:"data_hash"`                  // 实际使用的行情、基准、分红送转和基本面因子数据的SHA-256
+	Seed              int64                 `json:"seed"`                       // 随机成分使用的随机数种子
+	Engine            BacktestEngineOptions `json:"engine"`                     // 回测引擎选项
+	ResultHash        string                `json:"result_hash"`                // 全部结果数据的SHA-256
+	ResultHashes      map[string]string     `json:"result_hashes"`              // 各部分结果数据的SHA-256，如 results、trades、equity_curve
+	CreatedAt         time.Time             `json:"created_at"`
+}
+
+// BacktestReplayReport 按运行清单重新运行回测的对比报告
+type BacktestReplayReport struct {
+	BacktestID       string            `json:"backtest_id"`
+	Match            bool              `json:"match"`                // 重新运行的结果与原结果逐位一致
+	Mismatches       []string          `json:"mismatches,omitempty"` // 结果不一致的部分
+	CodeVersionMatch bool              `json:"code_version_match"`   // 代码版本是否相同
+	DataSourceMatch  bool              `json:"data_source_match"`    // 数据源类型和基础URL是否相同
+	DataHashMatch    bool              `json:"data_hash_match"`      // 实际使用的数据是否相同，不同时结果不一致通常来自数据变化
+	Original         *BacktestManifest `json:"original"`
+	Replay           *BacktestManifest `json:"replay"`
+	ReplayedAt       time.Time         `json:"replayed_at"`
+}
+
+// BacktestReplayTask 在后台按运行清单重新运行回测的任务
+type BacktestReplayTask struct {
+	BacktestID  string                `json:"backtest_id"`
+	Status      BacktestStatus        `json:"status"`                 // running、completed 或 failed
+	Error       string                `json:"error,omitempty"`        // 失败原因
+	Report      *BacktestReplayReport `json:"report,omitempty"`       // 完成后的对比报告
+	StartedAt   time.Time             `json:"started_at"`             // 开始时间
+	CompletedAt *time.Time            `json:"completed_at,omitempty"` // 完成或失败的时间
+}
+
+// CompareBacktestsRequest 多个回测对比请求，第一个回测作为对比基准
+type CompareBacktestsRequest struct {
+	BacktestIDs []string `json:"backtest_ids"`
+}
+
+// ComparedBacktest 参与对比的回测及其整体指标（多策略时为组合指标）
+type ComparedBacktest struct {
+	BacktestID string         `json:"backtest_id"`
+	Name       string         `json:"name"`
+	StartDate  string         `json:"start_date"`
+	EndDate    string         `json:"end_date"`
+	Metrics    BacktestResult `json:"metrics"`
+}
+
+// MetricDelta 回测相对基准回测的指标差值（当前值-基准值）
+type MetricDelta struct {
+	BacktestID string             `json:"backtest_id"`
+	Deltas     map[string]float64 `json:"deltas"`
+}
+
+// NormalizedEquityCurve 归一化到同一起点（100）的权益曲线，与对比结果的 Dates 一一对应
+type NormalizedEquityCurve struct {
+	BacktestID string    `json:"backtest_id"`
+	Values     []float64 `json:"values"`
+}
+
+// TradeDivergence 各回测在同一日期同一股票上的交易动作不一致
+type TradeDivergence struct {
+	Date    string            `json:"date"`
+	Symbol  string            `json:"symbol"`
+	Actions map[string]string `json:"actions"` // 回测ID -> buy、sell、buy+sell 或 none
+}
+
+// BacktestComparison 多个回测的对比结果
+type BacktestComparison struct {
+	BaselineID       string                  `json:"baseline_id"`
+	Backtests        []ComparedBacktest      `json:"backtests"`
+	MetricDeltas     []MetricDelta           `json:"metric_deltas"`
+	Dates            []string                `json:"dates"` // 所有回测共有的交易日
+	EquityCurves     []NormalizedEquityCurve `json:"equity_curves"`
+	Correlation      [][]float64             `json:"correlation"` // 日收益率相关系数矩阵，顺序同 Backtests
+	TradeDivergences []TradeDivergence       `json:"trade_divergences"`
+}
+
+// RoundTrip 一次完整的开平仓：同一策略同一股票的买入按先进先出与卖出配对，部分平仓会拆分为多笔
+type RoundTrip struct {
+	StrategyID  string    `json:"strategy_id"`
+	Symbol      string    `json:"symbol"`
+	Quantity    int       `json:"quantity"`
+	EntryTime   time.Time `json:"entry_time"`
+	ExitTime    time.Time `json:"exit_time"`
+	EntryPrice  float64   `json:"entry_price"`
+	ExitPrice   float64   `json:"exit_price"`
+	Fees        float64   `json:"fees"`         // 按数量分摊的买卖税费
+	PnL         float64   `json:"pnl"`          // 扣除税费后的盈亏
+	Return      float64   `json:"return"`       // 盈亏/建仓金额
+	HoldingDays int       `json:"holding_days"` // 持有交易日数
+	MAE         float64   `json:"mae"`          // 最大不利偏移：持仓期间最低价相对建仓价的跌幅（<=0）
+	MFE         float64   `json:"mfe"`          // 最大有利偏移：持仓期间最高价相对建仓价的涨幅（>=0）
+}
+
+// HoldingPeriodBucket 持有时间分布的一个区间，MaxDays 为0表示不设上限
+type HoldingPeriodBucket struct {
+	Label         string  `json:"label"`
+	MinDays       int     `json:"min_days"`
+	MaxDays       int     `json:"max_days"`
+	Count         int     `json:"count"`
+	WinRate       float64 `json:"win_rate"`
+	AverageReturn float64 `json:"average_return"`
+}
+
+// RoundTripStats 开平仓的汇总统计
+type RoundTripStats struct {
+	Count              int                   `json:"count"`
+	Wins               int                   `json:"wins"`
+	Losses             int                   `json:"losses"`
+	WinRate            float64               `json:"win_rate"`
+	AverageWin         float64               `json:"average_win"`          // 盈利交易的平均盈亏
+	AverageLoss        float64               `json:"average_loss"`         // 亏损交易的平均盈亏（<=0）
+	PayoffRatio        float64               `json:"payoff_ratio"`         // 平均盈利/平均亏损的绝对值
+	Expectancy         float64               `json:"expectancy"`           // 每笔交易的期望盈亏
+	ExpectancyReturn   float64               `json:"expectancy_return"`    // 每笔交易的期望收益率
+	LongestWinStreak   int                   `json:"longest_win_streak"`   // 按平仓时间排序的最长连续盈利笔数
+	LongestLossStreak  int                   `json:"longest_loss_streak"`  // 按平仓时间排序的最长连续亏损笔数
+	AverageHoldingDays float64               `json:"average_holding_days"` // 平均持有交易日数
+	AverageMAE         float64               `json:"average_mae"`
+	AverageMFE         float64               `json:"average_mfe"`
+	HoldingPeriods     []HoldingPeriodBucket `json:"holding_periods"` // 持有时间分布
+}
+
+// RoundTripAnalysis 回测的开平仓分析结果
+type RoundTripAnalysis struct {
+	BacktestID    string                    `json:"backtest_id"`
+	RoundTrips    []RoundTrip               `json:"round_trips"`
+	Stats         RoundTripStats            `json:"stats"`          // 全部策略合计
+	StrategyStats map[string]RoundTripStats `json:"strategy_stats"` // 策略ID -> 该策略的统计
+}
+
 // BacktestEngine 回测引擎接口
 type BacktestEngine interface {
 	// StartBacktest 启动回测
@@ -214,17 +717,29 @@ const (
 	OrderTypeLimit  OrderType = "limit"  // 限价单
 )
 
+// 订单状态
+const (
+	OrderStatusPending = "pending" // 等待成交
+	OrderStatusFilled  = "filled"  // 已成交
+	OrderStatusExpired = "expired" // 到期撤销
+)
+
 // Order 订单
 type Order struct {
-	ID         string     `json:"id"`
-	Symbol     string     `json:"symbol"`
-	Side       TradeSide  `json:"side"`
-	Type       OrderType  `json:"type"`
-	Quantity   int        `json:"quantity"`
-	Price      float64    `json:"price"`
-	Status     string     `json:"status"`
-	CreatedAt  time.Time  `json:"created_at"`
-	ExecutedAt *time.Time `json:"executed_at,omitempty"`
+	ID            string          `json:"id"`
+	StrategyID    string          `json:"strategy_id,omitempty"`
+	Symbol        string          `json:"symbol"`
+	Side          TradeSide       `json:"side"`
+	Type          OrderType       `json:"type"`
+	Timing        ExecutionTiming `json:"timing,omitempty"` // 市价单的成交价格基准（开盘价/成交均价）
+	Quantity      int             `json:"quantity"`         // 买入为0时在成交时由仓位管理计算，卖出为0时卖出全部持仓
+	Amount        float64         `json:"amount,omitempty"` // 按金额买入（定期调仓），为0时由仓位管理计算
+	Price         float64         `json:"price"`            // 限价单的限价
+	Status        string          `json:"status"`
+	Signal        *Signal         `json:"signal,omitempty"`         // 产生订单的策略信号
+	RemainingDays int             `json:"remaining_days,omitempty"` // 剩余有效交易日数
+	CreatedAt     time.Time       `json:"created_at"`
+	ExecutedAt    *time.Time      `json:"executed_at,omitempty"`
 }
 
 // MarketData 市场数据
@@ -269,11 +784,26 @@ func (pm *PerformanceMetrics) CalculateMetrics() *BacktestResult {
 		result.BenchmarkReturn = pm.calculateBenchmarkReturn()
 		result.Alpha = pm.calculateAlpha()
 		result.Beta = pm.calculateBeta()
+		result.TrackingError = pm.calculateTrackingError()
+		result.InformationRatio = pm.calculateInformationRatio()
 	}
 
+	pm.calculateCostTotals(result)
+
 	return result
 }
 
+// calculateCostTotals 汇总交易成本
+func (pm *PerformanceMetrics) calculateCostTotals(result *BacktestResult) {
+	for _, trade := range pm.Trades {
+		result.TotalCommission += trade.Commission
+		result.TotalStampDuty += trade.StampDuty
+		result.TotalTransferFee += trade.TransferFee
+		result.TotalSlippage += trade.SlippageCost
+		result.TotalCosts += trade.TotalCost
+	}
+}
+
 // calculateTotalReturn 计算总收益率
 func (pm *PerformanceMetrics) calculateTotalReturn() float64 {
 	totalReturn := 1.0
@@ -471,17 +1001,76 @@ func (pm *PerformanceMetrics) calculateBenchmarkReturn() float64 {
 	return totalReturn - 1
 }
 
-// calculateAlpha 计算Alpha
+// calculateAlpha 计算年化Jensen's Alpha
+// RiskFreeRate 为日无风险利率，因此使用日均收益率计算后再年化
 func (pm *PerformanceMetrics) calculateAlpha() float64 {
-	if len(pm.Returns) == 0 || len(pm.BenchmarkReturns) == 0 {
+	portfolioReturns, benchmarkReturns := pm.alignedReturns()
+	if len(portfolioReturns) == 0 {
 		return 0
 	}
 
-	portfolioReturn := pm.calculateTotalReturn()
-	benchmarkReturn := pm.calculateBenchmarkReturn()
+	portfolioAvg := mean(portfolioReturns)
+	benchmarkAvg := mean(benchmarkReturns)
 	beta := pm.calculateBeta()
 
-	return portfolioReturn - (pm.RiskFreeRate + beta*(benchmarkReturn-pm.RiskFreeRate))
+	dailyAlpha := portfolioAvg - (pm.RiskFreeRate + beta*(benchmarkAvg-pm.RiskFreeRate))
+	return dailyAlpha * 252
+}
+
+// calculateTrackingError 计算年化跟踪误差（超额收益的标准差）
+func (pm *PerformanceMetrics) calculateTrackingError() float64 {
+	active := pm.activeReturns()
+	if len(active) < 2 {
+		return 0
+	}
+
+	avg := mean(active)
+	variance := 0.0
+	for _, ret := range active {
+		variance += (ret - avg) * (ret - avg)
+	}
+	variance /= float64(len(active) - 1)
+	return math.Sqrt(variance) * math.Sqrt(252)
+}
+
+// calculateInformationRatio 计算信息比率（年化超额收益 / 年化跟踪误差）
+func (pm *PerformanceMetrics) calculateInformationRatio() float64 {
+	trackingError := pm.calculateTrackingError()
+	if trackingError == 0 {
+		return 0
+	}
+	return mean(pm.activeReturns()) * 252 / trackingError
+}
+
+// alignedReturns 截取等长的策略收益率和基准收益率序列
+func (pm *PerformanceMetrics) alignedReturns() ([]float64, []float64) {
+	n := len(pm.Returns)
+	if len(pm.BenchmarkReturns) < n {
+		n = len(pm.BenchmarkReturns)
+	}
+	return pm.Returns[:n], pm.BenchmarkReturns[:n]
+}
+
+// activeReturns 计算每日超额收益率（策略收益率 - 基准收益率）
+func (pm *PerformanceMetrics) activeReturns() []float64 {
+	portfolioReturns, benchmarkReturns := pm.alignedReturns()
+	active := make([]float64, len(portfolioReturns))
+	for i := range portfolioReturns {
+		active[i] = portfolioReturns[i] - benchmarkReturns[i]
+	}
+	return active
+}
+
+// mean 计算平均值
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
 }
 
 // calculateBeta 计算Beta
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPerformanceMetrics_BenchmarkRelative(t *testing.T) {
+	benchmark := []float64{0.01, -0.02, 0.015, 0.005, -0.01}
+	returns := make([]float64, len(benchmark))
+	for i, r := range benchmark {
+		returns[i] = 2*r + 0.001
+	}
+
+	result := (&PerformanceMetrics{Returns: returns, BenchmarkReturns: benchmark}).CalculateMetrics()
+
+	if math.Abs(result.Beta-2) > 1e-9 {
+		t.Errorf("Beta应为2, 实际 %.6f", result.Beta)
+	}
+	// 日Alpha为0.001，年化后为0.252
+	if math.Abs(result.Alpha-0.252) > 1e-9 {
+		t.Errorf("年化Alpha应为0.252, 实际 %.6f", result.Alpha)
+	}
+
+	// 超额收益 = 基准收益 + 0.001，跟踪误差等于基准收益的年化标准差
+	avg := 0.0
+	for _, r := range benchmark {
+		avg += r
+	}
+	avg /= float64(len(benchmark))
+	variance := 0.0
+	for _, r := range benchmark {
+		variance += (r - avg) * (r - avg)
+	}
+	expectedTE := math.Sqrt(variance/float64(len(benchmark)-1)) * math.Sqrt(252)
+	if math.Abs(result.TrackingError-expectedTE) > 1e-9 {
+		t.Errorf("跟踪误差应为 %.6f, 实际 %.6f", expectedTE, result.TrackingError)
+	}
+	expectedIR := (avg + 0.001) * 252 / expectedTE
+	if math.Abs(result.InformationRatio-expectedIR) > 1e-9 {
+		t.Errorf("信息比率应为 %.6f, 实际 %.6f", expectedIR, result.InformationRatio)
+	}
+}
+
+func TestPerformanceMetrics_NoBenchmark(t *testing.T) {
+	result := (&PerformanceMetrics{Returns: []float64{0.01, 0.02, -0.01}}).CalculateMetrics()
+
+	if result.Alpha != 0 || result.Beta != 0 || result.TrackingError != 0 || result.InformationRatio != 0 {
+		t.Errorf("无基准数据时相对指标应为0: %+v", result)
+	}
+}
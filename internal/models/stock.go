@@ -45,13 +45,22 @@ func NewJSONDecimal(d decimal.Decimal) JSONDecimal {
 
 // StockBasic 股票基本信息
 type StockBasic struct {
-	TSCode   string `json:"ts_code"`   // 股票代码
-	Symbol   string `json:"symbol"`    // 股票简称
-	Name     string `json:"name"`      // 股票名称
-	Area     string `json:"area"`      // 所在地域
-	Industry string `json:"industry"`  // 所属行业
-	Market   string `json:"market"`    // 市场类型
-	ListDate string `json:"list_date"` // 上市日期
+	TSCode     string `json:"ts_code"`               // 股票代码
+	Symbol     string `json:"symbol"`                // 股票简称
+	Name       string `json:"name"`                  // 股票名称
+	Area       string `json:"area"`                  // 所在地域
+	Industry   string `json:"industry"`              // 所属行业
+	Market     string `json:"market"`                // 市场类型
+	ListDate   string `json:"list_date"`             // 上市日期
+	DelistDate string `json:"delist_date,omitempty"` // 退市日期，只有已退市的股票才有
+}
+
+// NameChange 证券简称变更记录，用于还原历史交易日的ST状态
+type NameChange struct {
+	TSCode    string `json:"ts_code"`
+	Name      string `json:"name"`       // 证券简称
+	StartDate string `json:"start_date"` // 开始日期 YYYYMMDD
+	EndDate   string `json:"end_date"`   // 结束日期 YYYYMMDD，为空表示仍在使用
 }
 
 // StockDaily 股票日线数据
@@ -69,6 +78,21 @@ type StockDaily struct {
 	Amount    JSONDecimal `json:"amount"`     // 成交额(千元)
 }
 
+// CorporateAction 已实施的分红送转（除权除息）事件，数量和金额均按每股计
+type CorporateAction struct {
+	TSCode         string  `json:"ts_code"`               // 股票代码
+	ExDate         string  `json:"ex_date"`               // 除权除息日 YYYYMMDD
+	RecordDate     string  `json:"record_date,omitempty"` // 股权登记日 YYYYMMDD
+	CashDividend   float64 `json:"cash_dividend"`         // 每股派息（税前，元）
+	BonusShares    float64 `json:"bonus_shares"`          // 每股送股
+	TransferShares float64 `json:"transfer_shares"`       // 每股转增
+}
+
+// ShareRatio 每股送转的股数合计，如10送3转2为0.5
+func (a CorporateAction) ShareRatio() float64 {
+	return a.BonusShares + a.TransferShares
+}
+
 // TechnicalIndicators 技术指标
 type TechnicalIndicators struct {
 	TSCode    string                   `json:"ts_code"`
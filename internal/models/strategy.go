@@ -12,6 +12,7 @@ const (
 	StrategyTypeFundamental StrategyType = "fundamental" // 基本面策略
 	StrategyTypeML          StrategyType = "ml"          // 机器学习策略
 	StrategyTypeComposite   StrategyType = "composite"   // 复合策略
+	StrategyTypeRebalance   StrategyType = "rebalance"   // 定期调仓策略
 )
 
 // StrategyStatus 策略状态
@@ -31,21 +32,41 @@ type Strategy struct {
 	Type        StrategyType           `json:"strategy_type" db:"strategy_type"`
 	Status      StrategyStatus         `json:"status" db:"status"`
 	Parameters  map[string]interface{} `json:"parameters" db:"parameters"`
-	Code        string                 `json:"code,omitempty" db:"code"` // 策略代码（敏感信息，通常不返回给前端）
+	Code        string                 `json:"code,omitempty" db:"code"`       // 策略代码（敏感信息，通常不返回给前端）
+	Version     string                 `json:"version,omitempty" db:"version"` // 当前版本号，创建时为1，每次更新加1
 	CreatedBy   string                 `json:"created_by" db:"created_by"`
 	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
 }
 
-// StrategyVersion 策略版本
+// StrategyVersion 策略版本，记录每次创建、更新和回滚后的策略定义
 type StrategyVersion struct {
-	ID         string                 `json:"id" db:"id"`
-	StrategyID string                 `json:"strategy_id" db:"strategy_id"`
-	Version    string                 `json:"version" db:"version"`
-	Code       string                 `json:"code" db:"code"`
-	Parameters map[string]interface{} `json:"parameters" db:"parameters"`
-	Changelog  string                 `json:"changelog" db:"changelog"`
-	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+	ID          string                 `json:"id" db:"id"`
+	StrategyID  string                 `json:"strategy_id" db:"strategy_id"`
+	Version     string                 `json:"version" db:"version"`
+	Name        string                 `json:"name" db:"name"`
+	Description string                 `json:"description" db:"description"`
+	Code        string                 `json:"code" db:"code"`
+	Parameters  map[string]interface{} `json:"parameters" db:"parameters"`
+	Changelog   string                 `json:"changelog" db:"changelog"`
+	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
+}
+
+// StrategyParameterChange 两个策略版本之间一个参数的变化
+type StrategyParameterChange struct {
+	Key    string      `json:"key"`
+	Change string      `json:"change"` // added、removed、modified
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// StrategyVersionDiff 两个策略版本的参数差异
+type StrategyVersionDiff struct {
+	StrategyID  string                    `json:"strategy_id"`
+	FromVersion string                    `json:"from_version"`
+	ToVersion   string                    `json:"to_version"`
+	Changes     []StrategyParameterChange `json:"changes"`      // 按参数名排序
+	CodeChanged bool                      `json:"code_changed"` // 策略代码是否不同
 }
 
 // StrategyPerformance 策略表现
@@ -90,6 +111,16 @@ const (
 	SignalTypeSell SignalType = "sell" // 卖出信号
 	SignalTypeHold SignalType = "hold" // 持有信号
 	SignalTypeExit SignalType = "exit" // 退出信号
+
+	// 风控退出信号，由回测引擎根据退出规则产生
+	SignalTypeStopLoss     SignalType = "stop_loss"     // 固定比例止损
+	SignalTypeATRStop      SignalType = "atr_stop"      // ATR倍数止损
+	SignalTypeTakeProfit   SignalType = "take_profit"   // 止盈
+	SignalTypeTrailingStop SignalType = "trailing_stop" // 移动止损
+	SignalTypeMaxHolding   SignalType = "max_holding"   // 超过最长持有期
+
+	// 定期调仓策略按目标权重生成的订单
+	SignalTypeRebalance SignalType = "rebalance"
 )
 
 // TradeSide 交易方向
@@ -133,6 +164,7 @@ type UpdateStrategyRequest struct {
 	Status      *StrategyStatus         `json:"status,omitempty"`
 	Parameters  *map[string]interface{} `json:"parameters,omitempty"`
 	Code        *string                 `json:"code,omitempty"`
+	Changelog   string                  `json:"changelog,omitempty"` // 版本说明，为空时按修改的字段生成
 }
 
 // 预定义策略参数结构
@@ -167,6 +199,118 @@ type BollingerStrategyParams struct {
 	StdDev float64 `json:"std_dev" validate:"min=0.5,max=5"` // 标准差倍数，默认2
 }
 
+// RebalanceFrequency 定期调仓的频率，在每周/月/季度的第一个交易日调仓
+type RebalanceFrequency string
+
+const (
+	RebalanceWeekly    RebalanceFrequency = "weekly"
+	RebalanceMonthly   RebalanceFrequency = "monthly"
+	RebalanceQuarterly RebalanceFrequency = "quarterly"
+)
+
+// RebalanceWeighting 入选股票的目标权重分配方式
+type RebalanceWeighting string
+
+const (
+	RebalanceWeightEqual RebalanceWeighting = "equal" // 等权
+	RebalanceWeightRank  RebalanceWeighting = "rank"  // 按排名线性加权，排名越靠前权重越高
+)
+
+// RebalanceStrategyParams 定期调仓策略参数：按打分选出前N只股票并调整到目标权重
+type RebalanceStrategyParams struct {
+	Frequency   RebalanceFrequency `json:"frequency"`    // 调仓频率，默认monthly
+	TopN        int                `json:"top_n"`        // 持有股票数量，默认5
+	Score       string             `json:"score"`        // 打分方法：momentum/low_volatility/trend 或基本面 value/growth/quality/profitability/composite，默认momentum
+	Lookback    int                `json:"lookback"`     // 技术指标打分的回看交易日数，默认20
+	Weighting   RebalanceWeighting `json:"weighting"`    // 权重分配方式，默认equal
+	MaxTurnover float64            `json:"max_turnover"` // 单次调仓最大换手率（买卖金额合计/组合总资产），0表示不限制
+}
+
+// FundamentalStrategyParams 基本面策略参数：按基本面因子得分在股票池中的分位数和估值上限决定买卖，定期重新评估
+type FundamentalStrategyParams struct {
+	Frequency      RebalanceFrequency `json:"frequency"`       // 重新评估频率，默认monthly
+	Score          string             `json:"score,omitempty"` // 打分因子：value/growth/quality/profitability/composite，为空时只按估值上限筛选
+	BuyPercentile  float64            `json:"buy_percentile"`  // 得分分位数（0-100）不低于该值时买入，默认80
+	SellPercentile float64            `json:"sell_percentile"` // 得分分位数低于该值时卖出，默认50
+	MaxPE          float64            `json:"max_pe"`          // 市盈率上限，亏损（PE为空）视为超限，0表示不限制
+	MaxPB          float64            `json:"max_pb"`          // 市净率上限，0表示不限制
+}
+
+// MLStrategyParams 机器学习策略参数：用技术指标和图形特征预测未来N日上涨的概率
+type MLStrategyParams struct {
+	Horizon         int     `json:"horizon"`          // 标签使用未来N个交易日的收益，默认5
+	LabelThreshold  float64 `json:"label_threshold"`  // 未来收益超过该值标为上涨，默认0
+	BuyProbability  float64 `json:"buy_probability"`  // 上涨概率不低于该值时买入，默认0.6
+	SellProbability float64 `json:"sell_probability"` // 上涨概率不高于该值时卖出，默认0.4
+	L2              float64 `json:"l2"`               // 逻辑回归的L2正则系数，默认0.01
+	Folds           int     `json:"folds"`            // 时间序列交叉验证的折数，默认4
+}
+
+// MLTrainRequest 训练机器学习策略模型的请求
+type MLTrainRequest struct {
+	Symbols   []string `json:"symbols"`    // 训练使用的股票
+	StartDate string   `json:"start_date"` // 样本开始日期，YYYY-MM-DD
+	EndDate   string   `json:"end_date"`   // 样本结束日期，YYYY-MM-DD，标签需要的未来行情不会超过该日期
+}
+
+// MLFoldMetrics 时间序列交叉验证中一折的结果：用较早的样本训练，在其后的样本上评估
+type MLFoldMetrics struct {
+	Fold         int     `json:"fold"`
+	TrainEnd     string  `json:"train_end"`     // 训练样本的最后一个交易日
+	TestStart    string  `json:"test_start"`    // 验证样本的第一个交易日
+	TestEnd      string  `json:"test_end"`      // 验证样本的最后一个交易日
+	TrainSamples int     `json:"train_samples"` // 训练样本数
+	TestSamples  int     `json:"test_samples"`  // 验证样本数
+	Accuracy     float64 `json:"accuracy"`      // 以0.5为界的分类准确率
+	LogLoss      float64 `json:"log_loss"`      // 对数损失
+	BaseRate     float64 `json:"base_rate"`     // 验证样本中上涨的比例，准确率应与之比较
+}
+
+// MLModel 训练好的机器学习模型，特征按训练样本的均值和标准差标准化后做逻辑回归
+type MLModel struct {
+	StrategyID      string          `json:"strategy_id"`
+	StrategyVersion string          `json:"strategy_version"` // 训练时的策略版本
+	Algorithm       string          `json:"algorithm"`        // 目前为 logistic_regression
+	Features        []string        `json:"features"`         // 特征名称，与权重按下标对应
+	Mean            []float64       `json:"mean"`             // 特征均值
+	Std             []float64       `json:"std"`              // 特征标准差
+	Weights         []float64       `json:"weights"`          // 标准化特征的系数
+	Bias            float64         `json:"bias"`
+	Horizon         int             `json:"horizon"`
+	LabelThreshold  float64         `json:"label_threshold"`
+	Symbols         []string        `json:"symbols"`
+	StartDate       string          `json:"start_date"`
+	EndDate         string          `json:"end_date"`
+	Samples         int             `json:"samples"`       // 训练样本数
+	PositiveRate    float64         `json:"positive_rate"` // 训练样本中上涨的比例
+	Folds           []MLFoldMetrics `json:"folds"`
+	CVAccuracy      float64         `json:"cv_accuracy"` // 各折准确率按验证样本数加权的平均
+	CVLogLoss       float64         `json:"cv_log_loss"`
+	TrainedAt       time.Time       `json:"trained_at"`
+}
+
+// CompositeMode 复合策略合并子策略信号的方式
+type CompositeMode string
+
+const (
+	CompositeModeAnd      CompositeMode = "and"      // 全部子策略一致时才发出信号
+	CompositeModeOr       CompositeMode = "or"       // 任一子策略发出信号即跟随，买卖冲突时持有
+	CompositeModeWeighted CompositeMode = "weighted" // 按 权重×强度×置信度 加权投票
+	CompositeModeFilter   CompositeMode = "filter"   // 过滤策略处于买入状态时才放行触发策略的买入，卖出不受限制
+)
+
+// CompositeStrategyParams 复合策略参数：引用其他策略并合并它们的信号
+type CompositeStrategyParams struct {
+	Mode       CompositeMode      `json:"mode"`
+	Strategies []string           `json:"strategies,omitempty"` // 子策略ID，and/or/weighted 模式使用
+	Weights    map[string]float64 `json:"weights,omitempty"`    // weighted 模式各子策略的权重，未设置的为1
+	Threshold  float64            `json:"threshold,omitempty"`  // weighted 模式的得分阈值，得分绝对值达到阈值才发出信号
+	Filter     string             `json:"filter,omitempty"`     // filter 模式的过滤策略ID
+	Trigger    string             `json:"trigger,omitempty"`    // filter 模式的触发策略ID
+	// filter 模式过滤策略信号的有效期（交易日）：过滤策略当日持有时，沿用有效期内最近一次买入或卖出信号，默认20，为1时只看当日信号
+	FilterLookback int `json:"filter_lookback,omitempty"`
+}
+
 // DefaultStrategies 默认策略配置
 // 注意：使用固定的基准时间并手动设置不同的创建时间，确保排序的稳定性
 var DefaultStrategies = []Strategy{
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/indicators"
 	"stock-a-future/internal/logger"
 	"stock-a-future/internal/models"
 )
@@ -53,27 +57,58 @@ var (
 	ErrBacktestExists       = errors.New("回测已存在")
 	ErrBacktestNotCompleted = errors.New("回测尚未完成")
 	ErrBacktestRunning      = errors.New("回测正在运行")
+	ErrNoMarketData         = errors.New("没有可用的行情数据")
 )
 
+// DefaultBenchmark 默认基准指数（沪深300）
+const DefaultBenchmark = "000300.SH"
+
 // BacktestService 回测服务
 type BacktestService struct {
-	// 在真实环境中，这里会有数据库连接
-	// 目前使用内存存储进行演示
+	// 内存中的回测数据，启用持久化存储后同时写入数据库，重启后按需从数据库加载
 	backtests                    map[string]*models.Backtest
 	backtestResults              map[string]*models.BacktestResult          // 单策略结果（兼容性）
 	backtestMultiResults         map[string][]models.BacktestResult         // 多策略结果
 	backtestEquityCurves         map[string][]models.EquityPoint            // 组合权益曲线
 	backtestStrategyEquityCurves map[string]map[string][]models.EquityPoint // 每个策略的独立权益曲线: backtestID -> strategyID -> curve
 	backtestTrades               map[string][]models.Trade
+	backtestRejectedOrders       map[string][]models.RejectedOrder   // 被交易规则拒绝的订单
+	backtestRoundTrips           map[string][]models.RoundTrip       // 配对后的开平仓记录
+	backtestManifests            map[string]*models.BacktestManifest // 运行清单
 	backtestProgress             map[string]*models.BacktestProgress
-	runningBacktests             map[string]context.CancelFunc // 用于取消运行中的回测
+	runningBacktests             map[string]context.CancelFunc       // 用于取消运行中的回测
+	liveRuns                     map[string]*backtestLiveRun         // 运行中回测已产生的成交和权益，回测结束后移除
+	events                       *eventHub                           // 回测进度事件推送
+	corporateActions             map[string][]models.CorporateAction // 手工导入的分红送转记录，优先于数据源
 
 	strategyService   *StrategyService
 	tradingCalendar   *TradingCalendar
+	tradingRules      *AShareTradingRules
+	calculator        *indicators.Calculator
 	dataSourceService *DataSourceService
-	dailyCacheService *DailyCacheService // 使用现有的日线数据缓存服务
+	dailyCacheService *DailyCacheService                    // 使用现有的日线数据缓存服务
+	store             *BacktestStore                        // 回测持久化存储，为空时仅保存在内存中
+	factorSource      FundamentalFactorSource               // 定期调仓策略基本面打分的数据源，为空时不支持基本面打分
+	stockListSource   StockListSource                       // 动态股票池的全部A股列表，为空时不支持全市场、行业和板块股票池
+	favoriteSource    FavoriteStockSource                   // 动态股票池的自选股来源，为空时不支持自选股分组股票池
+	simulationWorkers int                                   // 日循环中并行准备行情和信号的工作协程数
+	stockInfoCache    sync.Map                              // 股票基本信息和简称变更历史: 数据源类型:股票代码 -> *stockInfo
+	replays           map[string]*models.BacktestReplayTask // 按运行清单重新运行回测的后台任务，每个回测保留最近一次
 	logger            logger.Logger
 	mutex             sync.RWMutex
+
+	// 回测状态在持有 mutex 时登记到 pendingWrites，释放锁后再写入存储，避免数据库I/O阻塞其他请求。
+	// 多个协程释放锁后的写入顺序不确定，按登记序号丢弃比已写入版本更旧的状态。
+	pendingWrites []backtestWrite
+	writeSeq      uint64
+	persistMutex  sync.Mutex
+	persistedSeq  map[string]uint64 // 受 persistMutex 保护
+}
+
+// backtestWrite 待写入存储的回测状态快照
+type backtestWrite struct {
+	backtest models.Backtest
+	seq      uint64
 }
 
 // NewBacktestService 创建回测服务
@@ -100,17 +135,155 @@ func NewBacktestService(strategyService *StrategyService, dataSourceService *Dat
 		backtestEquityCurves:         make(map[string][]models.EquityPoint),
 		backtestStrategyEquityCurves: make(map[string]map[string][]models.EquityPoint),
 		backtestTrades:               make(map[string][]models.Trade),
+		backtestRejectedOrders:       make(map[string][]models.RejectedOrder),
+		backtestRoundTrips:           make(map[string][]models.RoundTrip),
+		backtestManifests:            make(map[string]*models.BacktestManifest),
 		backtestProgress:             make(map[string]*models.BacktestProgress),
 		runningBacktests:             make(map[string]context.CancelFunc),
+		liveRuns:                     make(map[string]*backtestLiveRun),
+		events:                       newEventHub(),
+		corporateActions:             make(map[string][]models.CorporateAction),
+		persistedSeq:                 make(map[string]uint64),
+		replays:                      make(map[string]*models.BacktestReplayTask),
 		strategyService:              strategyService,
 		tradingCalendar:              NewTradingCalendar(),
+		tradingRules:                 NewAShareTradingRules(),
+		calculator:                   indicators.NewCalculator(),
 		dataSourceService:            dataSourceService,
 		dailyCacheService:            dailyCacheService,
+		simulationWorkers:            runtime.GOMAXPROCS(0),
 		logger:                       log,
 	}
 }
 
-// GetBacktestsList 获取回测列表
+// SetFundamentalFactorSource 设置定期调仓策略基本面打分使用的因子数据源
+func (s *BacktestService) SetFundamentalFactorSource(source FundamentalFactorSource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.factorSource = source
+}
+
+// SetUniverseSources 设置动态股票池使用的股票列表和自选股来源
+func (s *BacktestService) SetUniverseSources(stocks StockListSource, favorites FavoriteStockSource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stockListSource = stocks
+	s.favoriteSource = favorites
+}
+
+// SetStore 启用回测持久化存储，并加载已保存的回测列表和手工导入的分红送转记录
+// 服务重启前仍在运行或等待执行的回测无法恢复，标记为失败
+func (s *BacktestService) SetStore(store *BacktestStore) error {
+	backtests, err := store.LoadBacktests()
+	if err != nil {
+		return err
+	}
+	corporateActions, err := store.LoadCorporateActions()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.unlockAndPersist()
+
+	s.store = store
+	for _, backtest := range backtests {
+		if backtest.Status == models.BacktestStatusRunning || backtest.Status == models.BacktestStatusPending {
+			backtest.Status = models.BacktestStatusFailed
+			backtest.ErrorMessage = "服务重启，回测已中断"
+			s.persistBacktest(backtest)
+		}
+		s.backtests[backtest.ID] = backtest
+	}
+	for symbol, actions := range corporateActions {
+		s.corporateActions[symbol] = actions
+	}
+
+	s.logger.Info("已加载持久化的回测", logger.Int("count", len(backtests)))
+	return nil
+}
+
+// persistBacktest 登记回测参数和状态的快照，调用方需持有锁，并通过 unlockAndPersist 释放锁后写入存储
+func (s *BacktestService) persistBacktest(backtest *models.Backtest) {
+	if s.store == nil {
+		return
+	}
+	s.writeSeq++
+	s.pendingWrites = append(s.pendingWrites, backtestWrite{backtest: *backtest, seq: s.writeSeq})
+}
+
+// unlockAndPersist 释放锁，并将持有锁期间登记的回测状态写入存储
+func (s *BacktestService) unlockAndPersist() {
+	writes := s.pendingWrites
+	s.pendingWrites = nil
+	store := s.store
+	s.mutex.Unlock()
+
+	if store == nil || len(writes) == 0 {
+		return
+	}
+	s.persistMutex.Lock()
+	defer s.persistMutex.Unlock()
+	for i := range writes {
+		write := &writes[i]
+		if write.seq <= s.persistedSeq[write.backtest.ID] {
+			continue
+		}
+		if err := store.SaveBacktest(&write.backtest); err != nil {
+			s.logger.Error("保存回测到数据库失败",
+				logger.String("backtest_id", write.backtest.ID),
+				logger.ErrorField(err),
+			)
+			continue
+		}
+		s.persistedSeq[write.backtest.ID] = write.seq
+	}
+}
+
+// ensureRunDataLoaded 内存中没有已完成回测的结果时从存储加载
+// 读取数据库时不持有锁，加载完成后重新检查，期间回测被删除或结果已加载时丢弃读取的数据
+func (s *BacktestService) ensureRunDataLoaded(backtestID string) error {
+	s.mutex.RLock()
+	store := s.store
+	needLoad := s.runDataMissingLocked(backtestID)
+	s.mutex.RUnlock()
+	if store == nil || !needLoad {
+		return nil
+	}
+
+	data, err := store.LoadRunData(backtestID)
+	if err != nil || data == nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.runDataMissingLocked(backtestID) {
+		return nil
+	}
+
+	s.backtestMultiResults[backtestID] = data.Results
+	s.backtestResults[backtestID] = &data.Results[0]
+	s.backtestTrades[backtestID] = data.Trades
+	s.backtestRejectedOrders[backtestID] = data.RejectedOrders
+	s.backtestRoundTrips[backtestID] = data.RoundTrips
+	s.backtestManifests[backtestID] = data.Manifest
+	s.backtestEquityCurves[backtestID] = data.EquityCurve
+	s.backtestStrategyEquityCurves[backtestID] = data.StrategyEquityCurves
+	return nil
+}
+
+// runDataMissingLocked 已完成的回测在内存中没有运行结果时返回 true，调用方需持有锁
+func (s *BacktestService) runDataMissingLocked(backtestID string) bool {
+	backtest, exists := s.backtests[backtestID]
+	if !exists || backtest.Status != models.BacktestStatusCompleted {
+		return false
+	}
+	_, loaded := s.backtestResults[backtestID]
+	return !loaded
+}
+
+// GetBacktestsList 获取回测列表，按创建时间倒序排列
 func (s *BacktestService) GetBacktestsList(ctx context.Context, req *models.BacktestListRequest) ([]models.Backtest, int, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -124,6 +297,10 @@ func (s *BacktestService) GetBacktestsList(ctx context.Context, req *models.Back
 		}
 	}
 
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+
 	total := len(results)
 
 	// 分页
@@ -214,6 +391,11 @@ func (s *BacktestService) CreateBacktest(ctx context.Context, backtest *models.B
 	backtest.CreatedAt = now
 
 	// 保存回测
+	if s.store != nil {
+		if err := s.store.SaveBacktest(backtest); err != nil {
+			return err
+		}
+	}
 	s.backtests[backtest.ID] = backtest
 
 	s.logger.Info("回测创建成功",
@@ -228,7 +410,7 @@ func (s *BacktestService) CreateBacktest(ctx context.Context, backtest *models.B
 // UpdateBacktest 更新回测
 func (s *BacktestService) UpdateBacktest(ctx context.Context, backtestID string, req *models.UpdateBacktestRequest) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	defer s.unlockAndPersist()
 
 	backtest, exists := s.backtests[backtestID]
 	if !exists {
@@ -245,6 +427,7 @@ func (s *BacktestService) UpdateBacktest(ctx context.Context, backtestID string,
 	if req.Status != nil {
 		backtest.Status = *req.Status
 	}
+	s.persistBacktest(backtest)
 
 	s.logger.Info("回测更新成功",
 		logger.String("backtest_id", backtestID),
@@ -254,6 +437,14 @@ func (s *BacktestService) UpdateBacktest(ctx context.Context, backtestID string,
 	return nil
 }
 
+// benchmarkSymbol 返回回测使用的基准指数代码
+func benchmarkSymbol(backtest *models.Backtest) string {
+	if backtest.Benchmark == "" {
+		return DefaultBenchmark
+	}
+	return backtest.Benchmark
+}
+
 // DeleteBacktest 删除回测
 func (s *BacktestService) DeleteBacktest(ctx context.Context, backtestID string) error {
 	s.mutex.Lock()
@@ -273,9 +464,20 @@ func (s *BacktestService) DeleteBacktest(ctx context.Context, backtestID string)
 	}
 
 	// 删除相关数据
+	if s.store != nil {
+		if err := s.store.DeleteBacktest(backtestID); err != nil {
+			return err
+		}
+	}
 	delete(s.backtests, backtestID)
 	delete(s.backtestResults, backtestID)
+	delete(s.backtestMultiResults, backtestID)
+	delete(s.backtestEquityCurves, backtestID)
+	delete(s.backtestStrategyEquityCurves, backtestID)
 	delete(s.backtestTrades, backtestID)
+	delete(s.backtestRejectedOrders, backtestID)
+	delete(s.backtestRoundTrips, backtestID)
+	delete(s.backtestManifests, backtestID)
 	delete(s.backtestProgress, backtestID)
 
 	s.logger.Info("回测删除成功", logger.String("backtest_id", backtestID))
@@ -356,7 +558,7 @@ func (s *BacktestService) isBacktestNameExistsExcluding(name string, excludeID s
 // StartBacktest 启动回测（支持多策略）
 func (s *BacktestService) StartBacktest(ctx context.Context, backtest *models.Backtest, strategies []*models.Strategy) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	defer s.unlockAndPersist()
 
 	// 检查回测状态
 	if backtest.Status != models.BacktestStatusPending {
@@ -372,11 +574,18 @@ func (s *BacktestService) StartBacktest(ctx context.Context, backtest *models.Ba
 		return fmt.Errorf("策略数量与配置不匹配")
 	}
 
+	// 记录运行时各策略的版本，之后修改策略不影响对回测结果的追溯
+	backtest.StrategyVersions = make(map[string]string, len(strategies))
+	for _, strategy := range strategies {
+		backtest.StrategyVersions[strategy.ID] = strategy.Version
+	}
+
 	// 更新状态
 	backtest.Status = models.BacktestStatusRunning
 	backtest.Progress = 0
 	now := time.Now()
 	backtest.StartedAt = &now
+	s.persistBacktest(backtest)
 
 	// 初始化进度
 	s.backtestProgress[backtest.ID] = &models.BacktestProgress{
@@ -385,14 +594,11 @@ func (s *BacktestService) StartBacktest(ctx context.Context, backtest *models.Ba
 		Progress:   0,
 		Message:    fmt.Sprintf("初始化多策略回测环境... (%d个策略)", len(strategies)),
 	}
+	s.liveRuns[backtest.ID] = &backtestLiveRun{}
+	s.publishProgressLocked(backtest.ID, models.ProgressEventStatus)
 
 	// 创建可取消的上下文，根据回测时间范围动态设置超时
-	totalDays := int(backtest.EndDate.Sub(backtest.StartDate).Hours() / 24)
-	// 多策略需要更多时间，超时时间适当增加
-	timeoutMinutes := maxInt(10, minInt(240, totalDays/3*len(strategies)))
-	timeout := time.Duration(timeoutMinutes) * time.Minute
-
-	backtestCtx, cancel := context.WithTimeout(ctx, timeout)
+	backtestCtx, cancel := context.WithTimeout(ctx, backtestTimeout(backtest, len(strategies)))
 	s.runningBacktests[backtest.ID] = cancel
 
 	s.logger.Info("启动多策略回测",
@@ -416,359 +622,456 @@ func (s *BacktestService) StartBacktest(ctx context.Context, backtest *models.Ba
 	return nil
 }
 
+// backtestTimeout 根据回测时间范围和策略数确定回测的超时时间，多策略需要更多时间
+func backtestTimeout(backtest *models.Backtest, strategies int) time.Duration {
+	totalDays := int(backtest.EndDate.Sub(backtest.StartDate).Hours() / 24)
+	timeoutMinutes := maxInt(10, minInt(240, totalDays/3*strategies))
+	return time.Duration(timeoutMinutes) * time.Minute
+}
+
+// preloadWorkers 预加载回测数据的并发请求数，耗时主要是数据源的网络延迟，并发数不宜过大以免触发数据源限流
+const preloadWorkers = 4
+
+// stockInfoCacheTTL 股票基本信息和简称变更历史的缓存时间，名称和ST状态最多每个交易日变化一次
+const stockInfoCacheTTL = 12 * time.Hour
+
 // preloadBacktestData 预加载回测期间所有股票的历史数据
-func (s *BacktestService) preloadBacktestData(ctx context.Context, symbols []string, startDate, endDate time.Time) error {
+// 为了让策略在回测第一天就能计算指标，会额外加载回测开始前的预热数据
+// 返回每只股票按交易日期排列的历史数据，用于为策略提供滚动窗口；多只股票并发加载
+// 单只股票加载失败时跳过该股票，所有股票都没有行情时返回 ErrNoMarketData，避免回测以零交易“成功”完成
+func (s *BacktestService) preloadBacktestData(ctx context.Context, symbols []string, startDate, endDate time.Time, adjust models.PriceAdjustMode) (map[string]*symbolHistory, error) {
 	s.logger.Info("开始预加载回测数据",
 		logger.Int("symbols_count", len(symbols)),
 		logger.String("start_date", startDate.Format("2006-01-02")),
 		logger.String("end_date", endDate.Format("2006-01-02")),
+		logger.String("adjust", string(adjust)),
 	)
 
 	// 获取数据源客户端
+	if s.dataSourceService == nil {
+		return nil, errors.New("数据源服务未配置")
+	}
 	client, err := s.dataSourceService.GetClient()
 	if err != nil {
-		return fmt.Errorf("获取数据源客户端失败: %w", err)
+		return nil, fmt.Errorf("获取数据源客户端失败: %w", err)
 	}
+	units := dailyUnitsOf(s.dataSourceService.SourceType())
+
+	// 预热区间：约 StrategyLookbackDays 个交易日对应的自然日
+	warmupStart := startDate.AddDate(0, 0, -StrategyLookbackDays*3/2)
 
 	// 格式化日期
-	startDateStr := startDate.Format("20060102")
+	startDateStr := warmupStart.Format("20060102")
 	endDateStr := endDate.Format("20060102")
 
-	// 为每个股票预加载数据
-	for _, symbol := range symbols {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	// 并发预加载每只股票的数据，结果按下标保存，避免并发写入map
+	loaded := make([]*symbolHistory, len(symbols))
+	loadErrors := make([]error, len(symbols))
+	err = parallelEach(len(symbols), preloadWorkers, func(i int) {
+		if ctx.Err() != nil {
+			return
 		}
+		symbol := symbols[i]
 
-		// 检查缓存中是否已有数据
-		if s.dailyCacheService != nil {
-			if _, found := s.dailyCacheService.Get(symbol, startDateStr, endDateStr); found {
-				continue
-			}
+		// 检查缓存中是否已有数据，前复权以外的行情按复权方式单独缓存
+		cacheKey := symbol
+		if adjust != models.PriceAdjustForward {
+			cacheKey = symbol + ":" + string(adjust)
 		}
-
-		// 从API获取数据
-		data, err := client.GetDailyData(symbol, startDateStr, endDateStr, "qfq")
-		if err != nil {
-			s.logger.Error("预加载股票数据失败",
-				logger.String("symbol", symbol),
-				logger.ErrorField(err),
-			)
-			// 继续处理其他股票，不中断整个预加载过程
-			continue
+		data, found := []models.StockDaily(nil), false
+		if s.dailyCacheService != nil {
+			data, found = s.dailyCacheService.Get(cacheKey, startDateStr, endDateStr)
 		}
 
-		// 存入缓存 - 使用多个时间范围键提高命中率
-		if s.dailyCacheService != nil && len(data) > 0 {
-			// 1. 存储原始回测期间范围
-			s.dailyCacheService.Set(symbol, startDateStr, endDateStr, data)
-
-			// 2. 按月份分别存储，提高月度查找命中率
-			s.storeDataByMonths(symbol, data, startDate, endDate)
+		if !found {
+			// 从API获取数据
+			var err error
+			data, err = client.GetDailyData(symbol, startDateStr, endDateStr, string(adjust))
+			if err != nil {
+				s.logger.Error("预加载股票数据失败",
+					logger.String("symbol", symbol),
+					logger.ErrorField(err),
+				)
+				// 继续处理其他股票，不中断整个预加载过程
+				loadErrors[i] = err
+				return
+			}
 
+			// 存入缓存，相同区间的回测（如参数优化）可直接复用
+			if s.dailyCacheService != nil && len(data) > 0 {
+				s.dailyCacheService.Set(cacheKey, startDateStr, endDateStr, data)
+			}
 		}
-	}
-
-	return nil
-}
 
-// storeDataByMonths 按月份存储数据到缓存，提高查找命中率
-func (s *BacktestService) storeDataByMonths(symbol string, data []models.StockDaily, startDate, endDate time.Time) {
-	// 按月份组织数据
-	monthlyData := make(map[string][]models.StockDaily)
+		history := newSymbolHistory(data)
+		history.units = units
+		s.applyStockBasic(client, symbol, history)
+		loaded[i] = history
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	for _, daily := range data {
-		// 解析交易日期
-		tradeTime, err := time.Parse("2006-01-02T15:04:05.000", daily.TradeDate)
-		if err != nil {
-			continue
+	histories := make(map[string]*symbolHistory, len(symbols))
+	var lastErr error
+	for i, symbol := range symbols {
+		if loaded[i] != nil {
+			histories[symbol] = loaded[i]
 		}
-
-		// 生成月份键 (YYYYMM)
-		monthKey := tradeTime.Format("200601")
-		if monthlyData[monthKey] == nil {
-			monthlyData[monthKey] = make([]models.StockDaily, 0)
+		if loadErrors[i] != nil {
+			lastErr = loadErrors[i]
 		}
-		monthlyData[monthKey] = append(monthlyData[monthKey], daily)
 	}
-
-	// 为每个月份存储缓存
-	for monthKey, monthData := range monthlyData {
-		if len(monthData) == 0 {
-			continue
+	for _, history := range histories {
+		if history.Len() > 0 {
+			return histories, nil
 		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %d 只股票均未能加载行情: %v", ErrNoMarketData, len(symbols), lastErr)
+	}
+	return nil, fmt.Errorf("%w: %d 只股票在回测区间内均没有行情", ErrNoMarketData, len(symbols))
+}
 
-		// 解析月份，生成完整的月份范围
-		year, _ := time.Parse("200601", monthKey)
-		monthStart := time.Date(year.Year(), year.Month(), 1, 0, 0, 0, 0, time.UTC)
-		monthEnd := monthStart.AddDate(0, 1, -1)
-
-		monthStartStr := monthStart.Format("20060102")
-		monthEndStr := monthEnd.Format("20060102")
+// stockInfo 股票基本信息和证券简称变更历史的缓存条目
+type stockInfo struct {
+	nameChanges []models.NameChange
+	nameHistory bool               // 数据源是否提供了简称变更历史
+	basic       *models.StockBasic // 获取失败时为空
+	loadedAt    time.Time
+}
 
-		// 检查是否已经缓存
-		if _, found := s.dailyCacheService.Get(symbol, monthStartStr, monthEndStr); !found {
-			s.dailyCacheService.Set(symbol, monthStartStr, monthEndStr, monthData)
-			s.logger.Debug("月度数据已缓存",
-				logger.String("symbol", symbol),
-				logger.String("month", monthKey),
-				logger.Int("data_count", len(monthData)),
-			)
+// lookupStockInfo 获取股票基本信息和证券简称变更历史，按数据源缓存 stockInfoCacheTTL
+// 回测和参数优化会反复加载同一批股票，日线命中缓存时不应再为每只股票发起两次网络请求；
+// 获取失败（数据源不支持除外）的结果不缓存，下次重新获取
+func (s *BacktestService) lookupStockInfo(dataClient client.DataSourceClient, symbol string) *stockInfo {
+	var source client.DataSourceType
+	if s.dataSourceService != nil {
+		source = s.dataSourceService.SourceType()
+	}
+	key := string(source) + ":" + symbol
+	if cached, ok := s.stockInfoCache.Load(key); ok {
+		if info := cached.(*stockInfo); time.Since(info.loadedAt) < stockInfoCacheTTL {
+			return info
 		}
 	}
-}
 
-// getRealMarketData 获取真实市场数据（从预加载的缓存中查找）
-func (s *BacktestService) getRealMarketData(ctx context.Context, symbol string, date time.Time) (*models.MarketData, error) {
-	// 从缓存中查找包含该日期的数据
-	if s.dailyCacheService == nil {
-		return nil, fmt.Errorf("缓存服务未启用")
+	info := &stockInfo{loadedAt: time.Now()}
+	cacheable := true
+	if changes, err := dataClient.GetNameChanges(symbol); err == nil {
+		info.nameChanges = changes
+		info.nameHistory = true
+	} else {
+		cacheable = errors.Is(err, client.ErrUnsupported)
+		s.logger.Debug("获取证券简称变更历史失败，按当前名称判断ST状态",
+			logger.String("symbol", symbol),
+			logger.ErrorField(err),
+		)
 	}
 
-	// 优化缓存查找逻辑：尝试从不同时间范围的缓存中查找
+	basic, err := dataClient.GetStockBasic(symbol)
+	if err != nil || basic == nil {
+		cacheable = cacheable && (err == nil || errors.Is(err, client.ErrUnsupported))
+		s.logger.Debug("获取股票基本信息失败，按非ST股票处理",
+			logger.String("symbol", symbol),
+			logger.ErrorField(err),
+		)
+	} else {
+		info.basic = basic
+	}
 
-	// 1. 首先尝试从预加载的回测期间缓存中查找
-	// 这是最可能命中的情况，因为preloadBacktestData已经加载了完整回测期间的数据
-	if cachedData := s.findCachedDataContainingDate(symbol, date); cachedData != nil {
-		return s.findDataForDate(cachedData, symbol, date)
+	if cacheable {
+		s.stockInfoCache.Store(key, info)
 	}
+	return info
+}
 
-	// 2. 如果没有找到预加载缓存，尝试月度缓存
-	monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
-	monthEnd := monthStart.AddDate(0, 1, -1)
-	monthStartStr := monthStart.Format("20060102")
-	monthEndStr := monthEnd.Format("20060102")
+// applyStockBasic 根据股票基本信息和证券简称变更历史设置ST状态（用于确定涨跌停幅度和动态股票池）和上市日期（用于动态股票池）
+// 有简称变更历史时按每个交易日当时的简称判断ST；数据源不提供时只能按当前名称判断，获取失败时按非ST、上市日期未知处理
+func (s *BacktestService) applyStockBasic(dataClient client.DataSourceClient, symbol string, history *symbolHistory) {
+	info := s.lookupStockInfo(dataClient, symbol)
+	history.nameChanges = info.nameChanges
+	history.nameHistory = info.nameHistory
 
-	if cachedData, found := s.dailyCacheService.Get(symbol, monthStartStr, monthEndStr); found {
-		return s.findDataForDate(cachedData, symbol, date)
+	basic := info.basic
+	if basic == nil {
+		return
+	}
+	history.isST = IsSTStockName(basic.Name)
+	if listDate, err := parseTradeDate(basic.ListDate); err == nil {
+		history.listDate = listDate
 	}
-
-	// 3. 最后才回退到直接API调用，但优化为获取更大时间段以减少API调用
-	return s.getRealMarketDataDirectOptimized(ctx, symbol, date)
 }
 
-// findCachedDataContainingDate 查找包含指定日期的缓存数据
-func (s *BacktestService) findCachedDataContainingDate(symbol string, targetDate time.Time) []models.StockDaily {
-	// 遍历所有缓存条目，查找包含目标日期的时间范围
+// loadBenchmark 加载基准指数在回测期间的日线数据，未设置基准时使用沪深300
+func (s *BacktestService) loadBenchmark(ctx context.Context, backtest *models.Backtest) (*benchmarkSeries, error) {
+	symbol := benchmarkSymbol(backtest)
 
-	// 由于cache是sync.Map，我们需要通过反射或其他方式遍历
-	// 这里采用一种更直接的方式：尝试常见的时间范围
+	// 多取一段回测开始前的数据，用于确定基准的起始净值
+	startDateStr := backtest.StartDate.AddDate(0, 0, -15).Format("20060102")
+	endDateStr := backtest.EndDate.Format("20060102")
 
-	// 尝试不同的时间范围组合，从大到小
-	timeRanges := []struct {
-		start, end time.Time
-	}{
-		// 尝试季度范围
-		{
-			start: time.Date(targetDate.Year(), ((targetDate.Month()-1)/3)*3+1, 1, 0, 0, 0, 0, targetDate.Location()),
-			end:   time.Date(targetDate.Year(), ((targetDate.Month()-1)/3+1)*3, 31, 0, 0, 0, 0, targetDate.Location()),
-		},
-		// 尝试半年范围
-		{
-			start: time.Date(targetDate.Year(), 1, 1, 0, 0, 0, 0, targetDate.Location()),
-			end:   time.Date(targetDate.Year(), 6, 30, 0, 0, 0, 0, targetDate.Location()),
-		},
-		{
-			start: time.Date(targetDate.Year(), 7, 1, 0, 0, 0, 0, targetDate.Location()),
-			end:   time.Date(targetDate.Year(), 12, 31, 0, 0, 0, 0, targetDate.Location()),
-		},
-		// 尝试全年范围
-		{
-			start: time.Date(targetDate.Year(), 1, 1, 0, 0, 0, 0, targetDate.Location()),
-			end:   time.Date(targetDate.Year(), 12, 31, 0, 0, 0, 0, targetDate.Location()),
-		},
-		// 尝试跨年范围（前一年下半年到当年上半年）
-		{
-			start: time.Date(targetDate.Year()-1, 7, 1, 0, 0, 0, 0, targetDate.Location()),
-			end:   time.Date(targetDate.Year(), 6, 30, 0, 0, 0, 0, targetDate.Location()),
-		},
+	var data []models.StockDaily
+	if s.dailyCacheService != nil {
+		data, _ = s.dailyCacheService.Get(symbol, startDateStr, endDateStr)
 	}
-
-	for _, tr := range timeRanges {
-		startStr := tr.start.Format("20060102")
-		endStr := tr.end.Format("20060102")
-
-		if cachedData, found := s.dailyCacheService.Get(symbol, startStr, endStr); found {
-			// 验证缓存数据确实包含目标日期
-			if s.dataContainsDate(cachedData, targetDate) {
-				return cachedData
-			}
+	if len(data) == 0 {
+		client, err := s.dataSourceService.GetClient()
+		if err != nil {
+			return nil, fmt.Errorf("获取数据源客户端失败: %w", err)
+		}
+		data, err = client.GetIndexDailyData(symbol, startDateStr, endDateStr)
+		if err != nil {
+			return nil, fmt.Errorf("获取基准指数 %s 日线数据失败: %w", symbol, err)
+		}
+		if s.dailyCacheService != nil && len(data) > 0 {
+			s.dailyCacheService.Set(symbol, startDateStr, endDateStr, data)
 		}
 	}
 
-	return nil
+	return newBenchmarkSeries(data, backtest.StartDate)
 }
 
-// dataContainsDate 检查数据是否包含指定日期
-func (s *BacktestService) dataContainsDate(data []models.StockDaily, targetDate time.Time) bool {
-	targetDateStr := targetDate.Format("20060102")
-
-	for _, daily := range data {
-		// 从ISO格式转换为YYYYMMDD格式进行比较
-		if tradeTime, err := time.Parse("2006-01-02T15:04:05.000", daily.TradeDate); err == nil {
-			tradeDateStr := tradeTime.Format("20060102")
-			if tradeDateStr == targetDateStr {
-				return true
-			}
-		}
-	}
-	return false
+// benchmarkSeries 基准指数收盘价序列
+type benchmarkSeries struct {
+	history   *symbolHistory
+	baseClose float64 // 回测开始前最后一个交易日的收盘价，作为基准净值的起点
 }
 
-// getRealMarketDataDirectOptimized 优化的直接API获取（获取更大时间段减少API调用）
-func (s *BacktestService) getRealMarketDataDirectOptimized(ctx context.Context, symbol string, date time.Time) (*models.MarketData, error) {
-	// 获取数据源客户端
-	client, err := s.dataSourceService.GetClient()
-	if err != nil {
-		return nil, fmt.Errorf("获取数据源客户端失败: %w", err)
+// newBenchmarkSeries 构建基准序列，起始价取回测开始前最后一个交易日的收盘价，没有时取回测期间第一个收盘价
+func newBenchmarkSeries(data []models.StockDaily, startDate time.Time) (*benchmarkSeries, error) {
+	history := newSymbolHistory(data)
+	if history.Len() == 0 {
+		return nil, errors.New("基准指数无日线数据")
 	}
 
-	// 优化：获取更大的时间范围（一个月）而不是一周，减少API调用次数
-	monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
-	monthEnd := monthStart.AddDate(0, 1, -1)
-
-	startDateStr := monthStart.Format("20060102")
-	endDateStr := monthEnd.Format("20060102")
-
-	s.logger.Info("直接API获取月度数据",
-		logger.String("symbol", symbol),
-		logger.String("target_date", date.Format("2006-01-02")),
-		logger.String("fetch_range", fmt.Sprintf("%s至%s", startDateStr, endDateStr)),
-	)
-
-	monthData, err := client.GetDailyData(symbol, startDateStr, endDateStr, "qfq")
-	if err != nil {
-		// 如果月度获取失败，回退到原来的周度获取
-		s.logger.Warn("月度数据获取失败，回退到周度获取",
-			logger.String("symbol", symbol),
-			logger.ErrorField(err),
-		)
-		return s.getRealMarketDataDirect(ctx, symbol, date)
+	base := history.bars[0]
+	if before := history.window(startDate.AddDate(0, 0, -1), 1); len(before) > 0 {
+		base = before[0]
 	}
-
-	if len(monthData) == 0 {
-		return nil, fmt.Errorf("股票 %s 在 %s 月份无交易数据", symbol, date.Format("2006-01"))
+	baseClose := base.Close.InexactFloat64()
+	if baseClose <= 0 {
+		return nil, errors.New("基准指数起始收盘价无效")
 	}
+	return &benchmarkSeries{history: history, baseClose: baseClose}, nil
+}
 
-	// 存入缓存（使用月度范围）
-	if s.dailyCacheService != nil {
-		s.dailyCacheService.Set(symbol, startDateStr, endDateStr, monthData)
-		s.logger.Info("月度数据已缓存",
-			logger.String("symbol", symbol),
-			logger.String("range", fmt.Sprintf("%s至%s", startDateStr, endDateStr)),
-			logger.Int("data_count", len(monthData)),
-		)
+// valueOn 返回指定交易日以初始资金计的基准净值，缺失日期沿用最近的收盘价；基准未加载时返回0
+func (b *benchmarkSeries) valueOn(date time.Time, initialCash float64) float64 {
+	if b == nil {
+		return 0
 	}
+	window := b.history.window(date, 1)
+	if len(window) == 0 {
+		return initialCash
+	}
+	return initialCash * window[0].Close.InexactFloat64() / b.baseClose
+}
 
-	return s.findDataForDate(monthData, symbol, date)
+// symbolHistory 单只股票按交易日期升序排列的历史日线数据
+type symbolHistory struct {
+	bars     []models.StockDaily
+	dates    []time.Time
+	isST     bool      // 当前名称是否为ST股票，没有简称变更历史时用于所有交易日
+	listDate time.Time // 上市日期，未知时为零值
+	offsets  []int     // 按回测交易日下标索引：第一根晚于该交易日的K线下标，由 alignTo 生成
+
+	nameChanges []models.NameChange // 证券简称变更历史，按开始日期升序
+	nameHistory bool                // 数据源是否提供了简称变更历史
+	units       dailyUnits          // 数据源的成交量和成交额单位
 }
 
-// getRealMarketDataDirect 直接从API获取市场数据（作为备用方案）
-func (s *BacktestService) getRealMarketDataDirect(ctx context.Context, symbol string, date time.Time) (*models.MarketData, error) {
-	dateStr := date.Format("20060102")
+// newSymbolHistory 解析交易日期并按日期升序整理历史数据，无法解析日期的记录会被丢弃
+func newSymbolHistory(data []models.StockDaily) *symbolHistory {
+	history := &symbolHistory{
+		bars:  make([]models.StockDaily, 0, len(data)),
+		dates: make([]time.Time, 0, len(data)),
+		units: tushareDailyUnits,
+	}
 
-	// 获取数据源客户端
-	client, err := s.dataSourceService.GetClient()
-	if err != nil {
-		return nil, fmt.Errorf("获取数据源客户端失败: %w", err)
+	for _, daily := range data {
+		tradeTime, err := parseTradeDate(daily.TradeDate)
+		if err != nil {
+			continue
+		}
+		history.bars = append(history.bars, daily)
+		history.dates = append(history.dates, tradeTime)
 	}
 
-	// 尝试获取前后一周的数据，找到最近的交易日
-	startDate := date.AddDate(0, 0, -7)
-	endDate := date.AddDate(0, 0, 7)
-	startDateStr := startDate.Format("20060102")
-	endDateStr := endDate.Format("20060102")
+	sort.Sort(history)
+	return history
+}
 
-	weekData, err := client.GetDailyData(symbol, startDateStr, endDateStr, "qfq")
-	if err != nil {
-		return nil, fmt.Errorf("获取股票数据失败: %w", err)
+func (h *symbolHistory) Len() int           { return len(h.bars) }
+func (h *symbolHistory) Less(i, j int) bool { return h.dates[i].Before(h.dates[j]) }
+func (h *symbolHistory) Swap(i, j int) {
+	h.bars[i], h.bars[j] = h.bars[j], h.bars[i]
+	h.dates[i], h.dates[j] = h.dates[j], h.dates[i]
+}
+
+// window 返回截至指定日期（含当日）的最近 lookback 根K线，不包含任何未来数据
+func (h *symbolHistory) window(date time.Time, lookback int) []models.StockDaily {
+	if h == nil {
+		return nil
 	}
+	return h.windowEnding(h.indexAfter(date), lookback)
+}
 
-	if len(weekData) == 0 {
-		return nil, fmt.Errorf("股票 %s 在 %s 前后一周都无交易数据", symbol, dateStr)
+// windowEnding 返回下标 end 之前的最近 lookback 根K线
+func (h *symbolHistory) windowEnding(end, lookback int) []models.StockDaily {
+	start := end - lookback
+	if start < 0 {
+		start = 0
 	}
+	return h.bars[start:end]
+}
 
-	// 存入缓存
-	if s.dailyCacheService != nil {
-		s.dailyCacheService.Set(symbol, startDateStr, endDateStr, weekData)
+// alignTo 按回测交易日预先计算每个交易日对应的K线位置，日循环中按交易日下标直接取数，不再逐日查找日期
+func (h *symbolHistory) alignTo(days []time.Time) {
+	h.offsets = make([]int, len(days))
+	end := 0
+	for i, day := range days {
+		cutoff := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		for end < len(h.dates) {
+			d := h.dates[end]
+			if time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC).After(cutoff) {
+				break
+			}
+			end++
+		}
+		h.offsets[i] = end
 	}
+}
 
-	return s.findDataForDate(weekData, symbol, date)
+// endAt 返回第 day 个回测交易日之后第一根K线的下标，未对齐时按日期查找
+func (h *symbolHistory) endAt(day int, date time.Time) int {
+	if day < len(h.offsets) {
+		return h.offsets[day]
+	}
+	return h.indexAfter(date)
 }
 
-// findDataForDate 从数据列表中找到指定日期的数据
-func (s *BacktestService) findDataForDate(dailyData []models.StockDaily, symbol string, targetDate time.Time) (*models.MarketData, error) {
-	targetDateStr := targetDate.Format("20060102")
+// windowAt 返回截至第 day 个回测交易日（含当日）的最近 lookback 根K线
+func (h *symbolHistory) windowAt(day int, date time.Time, lookback int) []models.StockDaily {
+	if h == nil {
+		return nil
+	}
+	return h.windowEnding(h.endAt(day, date), lookback)
+}
 
-	// 首先尝试精确匹配
-	for _, data := range dailyData {
-		// 从ISO格式转换为YYYYMMDD格式进行比较
-		if tradeTime, err := time.Parse("2006-01-02T15:04:05.000", data.TradeDate); err == nil {
-			tradeDateStr := tradeTime.Format("20060102")
-			if tradeDateStr == targetDateStr {
-				return s.convertStockDailyToMarketData(data, symbol, targetDate)
-			}
-		}
+// latestAt 返回截至第 day 个回测交易日（含当日）的最后一根K线，当日停牌时为之前最近的K线
+func (h *symbolHistory) latestAt(day int, date time.Time) (models.StockDaily, bool) {
+	if h == nil {
+		return models.StockDaily{}, false
+	}
+	end := h.endAt(day, date)
+	if end == 0 {
+		return models.StockDaily{}, false
 	}
+	return h.bars[end-1], true
+}
 
-	// 如果没有精确匹配，找最近的交易日
-	var closestData *models.StockDaily
-	minDiff := int64(^uint64(0) >> 1) // 最大int64值
+// indexAfter 返回第一根交易日期晚于指定日期的K线下标
+func (h *symbolHistory) indexAfter(date time.Time) int {
+	cutoff := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return sort.Search(len(h.dates), func(i int) bool {
+		d := h.dates[i]
+		return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC).After(cutoff)
+	})
+}
 
-	for _, data := range dailyData {
-		// 使用正确的ISO日期格式解析
-		tradeTime, err := time.Parse("2006-01-02T15:04:05.000", data.TradeDate)
-		if err != nil {
-			continue
+// isSTOn 判断股票在指定交易日是否为ST股票：有简称变更历史时按当日使用的简称判断，否则按当前名称判断
+func (h *symbolHistory) isSTOn(date time.Time) bool {
+	if len(h.nameChanges) == 0 {
+		return h.isST
+	}
+	day := date.Format("20060102")
+	// 早于第一条记录的交易日（通常尚未上市）按最早的简称判断
+	st := IsSTStockName(h.nameChanges[0].Name)
+	for _, change := range h.nameChanges[1:] {
+		if change.StartDate > day {
+			break
 		}
+		st = IsSTStockName(change.Name)
+	}
+	return st
+}
 
-		diff := targetDate.Unix() - tradeTime.Unix()
-		if diff < 0 {
-			diff = -diff
-		}
+// orderBar 构造指定交易日的撮合环境
+// 当日没有K线或成交量为0视为停牌；昨收价优先使用当日的PreClose，缺失时使用前一根K线的收盘价
+func (h *symbolHistory) orderBar(marketData *models.MarketData, date time.Time) *orderBar {
+	if h == nil {
+		return &orderBar{marketData: marketData}
+	}
+	return h.orderBarEnding(marketData, h.indexAfter(date), date)
+}
 
-		if diff < minDiff {
-			minDiff = diff
-			closestData = &data
+// orderBarEnding 构造撮合环境，end 为第一根晚于 date 的K线下标
+func (h *symbolHistory) orderBarEnding(marketData *models.MarketData, end int, date time.Time) *orderBar {
+	bar := &orderBar{marketData: marketData, isST: h.isSTOn(date)}
+	if end == 0 || !sameTradingDay(h.dates[end-1], date) {
+		bar.suspended = true
+		if end > 0 {
+			bar.prevClose = h.bars[end-1].Close.InexactFloat64()
 		}
+		return bar
 	}
 
-	if closestData == nil {
-		return nil, fmt.Errorf("无法找到股票 %s 在 %s 的有效交易数据", symbol, targetDateStr)
+	today := h.bars[end-1]
+	bar.suspended = today.Vol.IsZero()
+	bar.prevClose = today.PreClose.InexactFloat64()
+	if bar.prevClose <= 0 && end > 1 {
+		bar.prevClose = h.bars[end-2].Close.InexactFloat64()
 	}
+	return bar
+}
 
-	// 只在使用非精确匹配时记录日志
-	if closestTradeTime, err := time.Parse("2006-01-02T15:04:05.000", closestData.TradeDate); err == nil {
-		closestDateStr := closestTradeTime.Format("20060102")
-		if closestDateStr != targetDateStr {
-			s.logger.Debug("使用最近交易日",
-				logger.String("symbol", symbol),
-				logger.String("target", targetDateStr),
-				logger.String("actual", closestDateStr),
-			)
+// parseTradeDate 解析数据源返回的交易日期，兼容ISO格式和YYYYMMDD格式
+func parseTradeDate(tradeDate string) (time.Time, error) {
+	layouts := []string{"2006-01-02T15:04:05.000", "20060102", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, tradeDate); err == nil {
+			return t, nil
 		}
 	}
+	return time.Time{}, fmt.Errorf("无法解析交易日期: %s", tradeDate)
+}
+
+// dailyUnits 数据源日线成交量和成交额的单位
+type dailyUnits struct {
+	sharesPerVol  float64 // 每单位成交量对应的股数
+	yuanPerAmount float64 // 每单位成交额对应的元
+}
+
+var (
+	tushareDailyUnits = dailyUnits{sharesPerVol: 100, yuanPerAmount: 1000} // 成交量为手，成交额为千元
+	aktoolsDailyUnits = dailyUnits{sharesPerVol: 100, yuanPerAmount: 1}    // 成交量为手，成交额为元
+)
 
-	return s.convertStockDailyToMarketData(*closestData, symbol, targetDate)
+// dailyUnitsOf 返回数据源日线数据的单位，未知数据源按Tushare处理
+func dailyUnitsOf(sourceType client.DataSourceType) dailyUnits {
+	if sourceType == client.DataSourceAKTools {
+		return aktoolsDailyUnits
+	}
+	return tushareDailyUnits
 }
 
-// convertStockDailyToMarketData 将StockDaily转换为MarketData
-func (s *BacktestService) convertStockDailyToMarketData(stockDaily models.StockDaily, symbol string, date time.Time) (*models.MarketData, error) {
+// convertStockDailyToMarketData 将StockDaily转换为MarketData，成交量换算为股、成交额换算为元
+func (s *BacktestService) convertStockDailyToMarketData(stockDaily models.StockDaily, symbol string, date time.Time, units dailyUnits) (*models.MarketData, error) {
 	// 转换价格数据（去掉无意义的精度警告）
 	open, _ := stockDaily.Open.Float64()
 	high, _ := stockDaily.High.Float64()
 	low, _ := stockDaily.Low.Float64()
 	close, _ := stockDaily.Close.Float64()
 
-	// 转换成交量（注意：StockDaily.Vol是手，需要转换为股）
+	// 转换成交量和成交额，各数据源的单位不同
 	vol, _ := stockDaily.Vol.Float64()
-	volume := int64(vol * 100) // 1手 = 100股
-
-	// 转换成交额（注意：StockDaily.Amount是千元，需要转换为元）
+	volume := int64(vol * units.sharesPerVol)
 	amount, _ := stockDaily.Amount.Float64()
-	amountInYuan := amount * 1000 // 千元转元
+	amountInYuan := amount * units.yuanPerAmount
 
 	return &models.MarketData{
 		Symbol:   symbol,
@@ -787,7 +1090,7 @@ func (s *BacktestService) convertStockDailyToMarketData(stockDaily models.StockD
 func (s *BacktestService) updatePortfolioWithTrade(portfolio *models.Portfolio, trade *models.Trade) {
 	if trade.Side == models.TradeSideBuy {
 		// 买入
-		totalCost := float64(trade.Quantity)*trade.Price + trade.Commission
+		totalCost := float64(trade.Quantity)*trade.Price + trade.Fees()
 		portfolio.Cash -= totalCost
 
 		// 更新持仓
@@ -809,13 +1112,13 @@ func (s *BacktestService) updatePortfolioWithTrade(portfolio *models.Portfolio,
 		}
 	} else {
 		// 卖出
-		totalRevenue := float64(trade.Quantity)*trade.Price - trade.Commission
+		totalRevenue := float64(trade.Quantity)*trade.Price - trade.Fees()
 		portfolio.Cash += totalRevenue
 
 		// 更新持仓
 		if position, exists := portfolio.Positions[trade.Symbol]; exists {
 			// 计算盈亏
-			trade.PnL = float64(trade.Quantity)*(trade.Price-position.AvgPrice) - trade.Commission
+			trade.PnL = float64(trade.Quantity)*(trade.Price-position.AvgPrice) - trade.Fees()
 
 			position.Quantity -= trade.Quantity
 			if position.Quantity <= 0 {
@@ -827,22 +1130,19 @@ func (s *BacktestService) updatePortfolioWithTrade(portfolio *models.Portfolio,
 	}
 }
 
-// updatePortfolioValue 更新组合价值
-func (s *BacktestService) updatePortfolioValue(ctx context.Context, portfolio *models.Portfolio, symbols []string, date time.Time) {
+// updatePortfolioValue 按第 day 个回测交易日的收盘价更新组合价值，当日停牌的股票使用之前最近的收盘价，没有行情时沿用原市值
+func (s *BacktestService) updatePortfolioValue(portfolio *models.Portfolio, histories map[string]*symbolHistory, day int, date time.Time) {
 	holdingsValue := 0.0
 
-	for symbol, position := range portfolio.Positions {
-		if position.Quantity > 0 {
-			// 获取当前市价
-			marketData, err := s.getRealMarketData(ctx, symbol, date)
-			if err != nil {
-				// 如果获取数据失败，使用上一次的市值继续计算
-				// 保持原有的市值不变
+	for _, symbol := range positionSymbols(portfolio) {
+		if position := portfolio.Positions[symbol]; position.Quantity > 0 {
+			latest, ok := histories[symbol].latestAt(day, date)
+			if !ok {
 				holdingsValue += position.MarketValue
 				continue
 			}
 
-			marketValue := float64(position.Quantity) * marketData.Close
+			marketValue := float64(position.Quantity) * latest.Close.InexactFloat64()
 			holdingsValue += marketValue
 
 			// 更新持仓信息
@@ -885,7 +1185,7 @@ func (s *BacktestService) calculateBacktestResult(backtest *models.Backtest, dai
 // CancelBacktest 取消回测
 func (s *BacktestService) CancelBacktest(ctx context.Context, backtestID string) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	defer s.unlockAndPersist()
 
 	backtest, exists := s.backtests[backtestID]
 	if !exists {
@@ -906,6 +1206,12 @@ func (s *BacktestService) CancelBacktest(ctx context.Context, backtestID string)
 	backtest.Status = models.BacktestStatusCancelled
 	now := time.Now()
 	backtest.CompletedAt = &now
+	s.persistBacktest(backtest)
+	if progress, ok := s.backtestProgress[backtestID]; ok {
+		progress.Status = string(models.BacktestStatusCancelled)
+		progress.Message = "回测已取消"
+	}
+	s.publishProgressLocked(backtestID, models.ProgressEventStatus)
 
 	s.logger.Info("回测取消成功", logger.String("backtest_id", backtestID))
 
@@ -923,14 +1229,20 @@ func (s *BacktestService) GetBacktestProgress(ctx context.Context, backtestID st
 		return nil, ErrBacktestNotFound
 	}
 
+	return s.backtestProgressLocked(backtest), nil
+}
+
+// backtestProgressLocked 返回回测当前进度的副本，调用方需持有锁
+func (s *BacktestService) backtestProgressLocked(backtest *models.Backtest) *models.BacktestProgress {
 	// 获取进度信息
-	if progress, ok := s.backtestProgress[backtestID]; ok {
-		return progress, nil
+	if progress, ok := s.backtestProgress[backtest.ID]; ok {
+		progressCopy := *progress
+		return &progressCopy
 	}
 
 	// 如果没有进度信息，根据状态返回默认进度
 	progress := &models.BacktestProgress{
-		BacktestID: backtestID,
+		BacktestID: backtest.ID,
 		Status:     string(backtest.Status),
 		Progress:   backtest.Progress,
 	}
@@ -950,11 +1262,18 @@ func (s *BacktestService) GetBacktestProgress(ctx context.Context, backtestID st
 		progress.Message = "已取消"
 	}
 
-	return progress, nil
+	return progress
 }
 
 // GetBacktestResults 获取回测结果
 func (s *BacktestService) GetBacktestResults(ctx context.Context, backtestID string) (*models.BacktestResultsResponse, error) {
+	if err := s.ensureRunDataLoaded(backtestID); err != nil {
+		s.logger.Error("从数据库加载回测结果失败",
+			logger.String("backtest_id", backtestID),
+			logger.ErrorField(err),
+		)
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -1023,8 +1342,20 @@ func (s *BacktestService) GetBacktestResults(ctx context.Context, backtestID str
 		EndDate:     backtest.EndDate.Format("2006-01-02"),
 		InitialCash: backtest.InitialCash,
 		Symbols:     backtest.Symbols,
+		Universe:    backtest.Universe,
 		Commission:  backtest.Commission,
 		CreatedAt:   backtest.CreatedAt.Format("2006-01-02 15:04:05"),
+
+		DisableTradingRules: backtest.DisableTradingRules,
+		CostConfig:          backtest.CostConfig,
+		PositionSizing:      backtest.PositionSizing,
+		ExitRules:           backtest.ExitRules,
+		Execution:           backtest.Execution,
+		Portfolio:           backtest.Portfolio,
+		PriceAdjust:         priceAdjust(backtest),
+		Benchmark:           benchmarkSymbol(backtest),
+		StrategyVersions:    backtest.StrategyVersions,
+		Warnings:            backtest.Warnings,
 	}
 
 	// 检查是否有多策略结果
@@ -1091,9 +1422,15 @@ func (s *BacktestService) GetBacktestResults(ctx context.Context, backtestID str
 		finalEquityCurve = equityCurve
 	}
 
-	// 计算组合整体指标（如果是多策略）
+	// 计算组合整体指标：共享资金模式按账户实际权益计算，独立模式的多策略取平均值
 	var combinedMetrics *models.BacktestResult
-	if len(performanceResults) > 1 {
+	if sharedPortfolioMode(backtest) && hasEquityCurve && len(combinedEquityCurve) > 1 {
+		combinedMetrics = s.calculateAccountMetrics(backtest, combinedEquityCurve, trades)
+		for _, result := range performanceResults {
+			combinedMetrics.DividendIncome += result.DividendIncome
+			combinedMetrics.BonusShares += result.BonusShares
+		}
+	} else if len(performanceResults) > 1 {
 		combinedMetrics = s.calculateCombinedMetrics(performanceResults)
 
 		s.logger.Info("✅ 计算组合指标完成",
@@ -1115,6 +1452,7 @@ func (s *BacktestService) GetBacktestResults(ctx context.Context, backtestID str
 		StrategyPerformances: strategyPerformances, // 新增：每个策略的详细性能（含独立权益曲线）
 		EquityCurve:          finalEquityCurve,
 		Trades:               trades,
+		RejectedOrders:       s.backtestRejectedOrders[backtestID],
 		Strategies:           strategies,
 		BacktestConfig:       backtestConfig,
 		CombinedMetrics:      combinedMetrics,
@@ -1330,7 +1668,7 @@ func (s *BacktestService) generateEquityCurve(backtest *models.Backtest, result
 // updateBacktestStatus 更新回测状态
 func (s *BacktestService) updateBacktestStatus(backtestID string, status models.BacktestStatus, message string) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	defer s.unlockAndPersist()
 
 	if backtest, exists := s.backtests[backtestID]; exists {
 		backtest.Status = status
@@ -1338,15 +1676,24 @@ func (s *BacktestService) updateBacktestStatus(backtestID string, status models.
 			backtest.ErrorMessage = message
 		}
 
-		if status == models.BacktestStatusCompleted || status == models.BacktestStatusFailed || status == models.BacktestStatusCancelled {
+		if backtestFinished(status) {
 			now := time.Now()
 			backtest.CompletedAt = &now
 		}
+		s.persistBacktest(backtest)
 	}
-}
 
-// updateBacktestProgress 更新回测进度
-func (s *BacktestService) updateBacktestProgress(backtestID string, progress int, message string) {
+	if progressInfo, exists := s.backtestProgress[backtestID]; exists {
+		progressInfo.Status = string(status)
+		if status == models.BacktestStatusFailed {
+			progressInfo.Error = message
+		}
+	}
+	s.publishProgressLocked(backtestID, models.ProgressEventStatus)
+}
+
+// updateBacktestProgress 更新回测进度
+func (s *BacktestService) updateBacktestProgress(backtestID string, progress int, message string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -1363,6 +1710,7 @@ func (s *BacktestService) updateBacktestProgress(backtestID string, progress int
 	if backtest, exists := s.backtests[backtestID]; exists {
 		backtest.Progress = progress
 	}
+	s.publishProgressLocked(backtestID, models.ProgressEventProgress)
 }
 
 // runMultiStrategyBacktestTask 运行多策略回测任务
@@ -1388,17 +1736,160 @@ func (s *BacktestService) runMultiStrategyBacktestTask(ctx context.Context, back
 		s.logger.Info("多策略回测任务清理完成", logger.String("backtest_id", backtest.ID))
 	}()
 
-	// 预加载回测数据
+	runData, err := s.simulateBacktest(ctx, backtest, strategies, &simulationObserver{
+		onDay: func(dayIndex, totalDays int, date time.Time) {
+			progress := int(float64(dayIndex+1) / float64(totalDays) * 100)
+			s.updateBacktestProgress(backtest.ID, progress, fmt.Sprintf("多策略回测进行中... %s (交易日 %d/%d)", date.Format("2006-01-02"), dayIndex+1, totalDays))
+		},
+		onTrade: func(trade models.Trade) {
+			s.recordLiveTrade(backtest.ID, trade)
+		},
+		onEquity: func(point models.EquityPoint) {
+			s.recordLiveEquity(backtest.ID, point)
+		},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			s.logger.Error("多策略回测超时",
+				logger.String("backtest_id", backtest.ID),
+				logger.ErrorField(err),
+			)
+			s.updateBacktestStatus(backtest.ID, models.BacktestStatusFailed, "回测执行超时")
+		case errors.Is(err, context.Canceled):
+			s.logger.Info("多策略回测被取消",
+				logger.String("backtest_id", backtest.ID),
+				logger.ErrorField(err),
+			)
+			s.updateBacktestStatus(backtest.ID, models.BacktestStatusCancelled, "回测已取消")
+		default:
+			s.logger.Error("多策略回测执行失败",
+				logger.String("backtest_id", backtest.ID),
+				logger.ErrorField(err),
+			)
+			s.updateBacktestStatus(backtest.ID, models.BacktestStatusFailed, err.Error())
+		}
+		return
+	}
 
-	if err := s.preloadBacktestData(ctx, backtest.Symbols, backtest.StartDate, backtest.EndDate); err != nil {
-		s.logger.Error("预加载回测数据失败",
+	// 保存失败时标记回测失败，否则重启后状态为已完成却没有结果
+	if err := s.saveRunData(backtest.ID, runData); err != nil {
+		s.logger.Error("保存回测结果到数据库失败",
 			logger.String("backtest_id", backtest.ID),
 			logger.ErrorField(err),
 		)
-		s.updateBacktestStatus(backtest.ID, models.BacktestStatusFailed, "预加载数据失败")
+		s.updateBacktestStatus(backtest.ID, models.BacktestStatusFailed, fmt.Sprintf("保存回测结果失败: %v", err))
 		return
 	}
 
+	// 确保进度设置为100%
+	s.updateBacktestProgress(backtest.ID, 100, "多策略回测完成")
+	s.updateBacktestStatus(backtest.ID, models.BacktestStatusCompleted, "多策略回测完成")
+
+	s.logger.Info("🎉 多策略回测任务完成",
+		logger.String("backtest_id", backtest.ID),
+		logger.Int("strategies_count", len(strategies)),
+		logger.Int("total_trades", len(runData.Trades)),
+		logger.Int("rejected_orders", len(runData.RejectedOrders)),
+		logger.Int("equity_points", len(runData.EquityCurve)),
+	)
+}
+
+// saveRunData 保存回测运行结果：启用持久化存储时先写入数据库，成功后再保存到内存
+// 序列化和写入整个运行结果耗时较长，不能持有锁，否则进度查询、事件订阅和结果读取都会被阻塞；runData 只属于本次运行，无需加锁
+func (s *BacktestService) saveRunData(backtestID string, runData *backtestRunData) error {
+	s.mutex.RLock()
+	store := s.store
+	s.mutex.RUnlock()
+	if store != nil {
+		if err := store.SaveRunData(backtestID, runData); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 警告随之后标记完成的回测状态一起保存
+	if backtest, exists := s.backtests[backtestID]; exists {
+		backtest.Warnings = runData.Warnings
+	}
+	s.backtestTrades[backtestID] = runData.Trades
+	s.backtestRejectedOrders[backtestID] = runData.RejectedOrders
+	s.backtestRoundTrips[backtestID] = runData.RoundTrips
+	s.backtestManifests[backtestID] = runData.Manifest
+
+	// 保存多策略结果到新的存储结构
+	s.backtestMultiResults[backtestID] = runData.Results
+	s.backtestEquityCurves[backtestID] = runData.EquityCurve
+	s.backtestStrategyEquityCurves[backtestID] = runData.StrategyEquityCurves
+
+	// 保存第一个策略的结果作为主结果（兼容性）
+	if len(runData.Results) > 0 {
+		s.backtestResults[backtestID] = &runData.Results[0]
+	}
+	return nil
+}
+
+// sortedOpenPositions 返回组合中数量大于0的持仓，按股票代码排序
+func sortedOpenPositions(portfolio *models.Portfolio) []models.Position {
+	var positions []models.Position
+	for _, position := range portfolio.Positions {
+		if position.Quantity > 0 {
+			positions = append(positions, position)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions
+}
+
+// simulationObserver 回测模拟过程的回调，字段均可为空
+type simulationObserver struct {
+	onDay    func(dayIndex, totalDays int, date time.Time) // 每个交易日开始时回调，可用于更新进度
+	onTrade  func(trade models.Trade)                      // 每笔成交后回调
+	onEquity func(point models.EquityPoint)                // 每个交易日结束时回调组合权益
+}
+
+// simulateBacktest 逐个交易日模拟多策略回测，返回各策略的结果、交易记录和权益曲线
+// 不修改服务中保存的回测状态，模拟过程通过 observer 通知（可为nil）；ctx 取消时返回 ctx.Err()
+func (s *BacktestService) simulateBacktest(ctx context.Context, backtest *models.Backtest, strategies []*models.Strategy, observer *simulationObserver) (*backtestRunData, error) {
+	if observer == nil {
+		observer = &simulationObserver{}
+	}
+
+	// 确定候选股票：固定股票列表或动态股票池
+	universe, err := s.resolveUniverse(backtest)
+	if err != nil {
+		return nil, err
+	}
+
+	// 预加载回测数据
+	histories, err := s.preloadBacktestData(ctx, universe.symbols, backtest.StartDate, backtest.EndDate, priceAdjust(backtest))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("预加载数据失败: %w", err)
+	}
+	universe.prepare(histories)
+
+	// 不复权行情不包含分红送转的影响，需要在除权除息日调整持仓和现金
+	var corporateActions *corporateActionSchedule
+	if priceAdjust(backtest) == models.PriceAdjustNone {
+		corporateActions = s.loadCorporateActions(ctx, backtest, universe.symbols)
+	}
+
+	// 加载基准指数数据，失败时结果中不包含基准对比（Alpha/Beta为0）
+	benchmark, err := s.loadBenchmark(ctx, backtest)
+	if err != nil {
+		s.logger.Warn("加载基准指数数据失败，结果中将不包含基准对比",
+			logger.String("backtest_id", backtest.ID),
+			logger.String("benchmark", backtest.Benchmark),
+			logger.ErrorField(err),
+		)
+	}
+
 	// 计算回测参数
 	totalDays := int(backtest.EndDate.Sub(backtest.StartDate).Hours() / 24)
 	if totalDays <= 0 {
@@ -1410,173 +1901,429 @@ func (s *BacktestService) runMultiStrategyBacktestTask(ctx context.Context, back
 	strategyTrades := make(map[string][]models.Trade)
 	strategyEquityCurves := make(map[string][]models.EquityPoint)
 	strategyDailyReturns := make(map[string][]float64)
+	strategyBenchmarkReturns := make(map[string][]float64)
+	strategyRejectedOrders := make(map[string][]models.RejectedOrder)
+	strategyDividends := make(map[string]float64)
+	strategyBonusShares := make(map[string]int)
+	var lotAdjustments []lotAdjustment
+	strategySizers := make(map[string]PositionSizer)
+	// 非当日收盘成交时，信号转为挂单在后续交易日撮合: strategyID -> symbol -> order
+	pendingOrders := make(map[string]map[string]*models.Order)
+	timing := executionTiming(backtest)
+
+	// 定期调仓策略不逐个股票生成信号，而是在调仓日按打分调整到目标权重
+	rebalanceParams := make(map[string]*models.RebalanceStrategyParams)
+	factorCache := make(map[string]map[string]*models.FundamentalFactor)
+	for _, strategy := range strategies {
+		if strategy.Type != models.StrategyTypeRebalance {
+			continue
+		}
+		params, err := ParseRebalanceParams(strategy.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("策略 %s: %w", strategy.ID, err)
+		}
+		if usesFundamentalScore(params) && s.factorSource == nil {
+			return nil, fmt.Errorf("策略 %s: 未配置基本面因子数据源，无法使用 %s 打分", strategy.ID, params.Score)
+		}
+		rebalanceParams[strategy.ID] = params
+	}
 
-	// 🔧 重要修复：每个策略都应该有完整的初始资金，而不是平均分配
-	// 这样可以让每个策略独立运作，就像单独运行一样
-	initialCashPerStrategy := backtest.InitialCash
+	// 基本面策略在评估日按股票池的基本面因子截面给出买卖结论，其余交易日不产生信号
+	fundamentalParams := make(map[string]*models.FundamentalStrategyParams)
+	for _, strategy := range strategies {
+		if strategy.Type != models.StrategyTypeFundamental {
+			continue
+		}
+		params, err := ParseFundamentalParams(strategy.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("策略 %s: %w", strategy.ID, err)
+		}
+		if s.factorSource == nil {
+			return nil, fmt.Errorf("策略 %s: 未配置基本面因子数据源，无法运行基本面策略", strategy.ID)
+		}
+		fundamentalParams[strategy.ID] = params
+	}
 
-	s.logger.Info("初始化多策略投资组合",
-		logger.String("backtest_id", backtest.ID),
-		logger.Int("strategies_count", len(strategies)),
-		logger.Float64("initial_cash_per_strategy", initialCashPerStrategy),
-		logger.Float64("total_virtual_capital", initialCashPerStrategy*float64(len(strategies))),
-	)
+	// 复合策略的子策略定义在回测开始时确定，运行中修改子策略不影响本次回测；重新运行时使用运行清单中的定义
+	knownChildren, _ := ctx.Value(compositeChildrenKey{}).(map[string]*models.Strategy)
+	children, err := s.strategyService.collectCompositeChildren(ctx, strategies, knownChildren)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withCompositeChildren(ctx, children)
+
+	// 机器学习策略（包括作为子策略的）必须先训练模型，模型在回测开始时确定，重新运行时使用运行清单中的模型；
+	// 训练区间与回测区间重叠时回测结果包含样本内表现
+	knownModels, _ := ctx.Value(mlModelsKey{}).(map[string]*models.MLModel)
+	mlModels := make(map[string]*models.MLModel)
+	mlStrategies := append([]*models.Strategy(nil), strategies...)
+	childIDs := make([]string, 0, len(children))
+	for id := range children {
+		childIDs = append(childIDs, id)
+	}
+	sort.Strings(childIDs)
+	for _, id := range childIDs {
+		mlStrategies = append(mlStrategies, children[id])
+	}
+	for _, strategy := range mlStrategies {
+		if strategy.Type != models.StrategyTypeML {
+			continue
+		}
+		model, ok := knownModels[strategy.ID]
+		if !ok {
+			if model, err = s.strategyService.GetMLModel(ctx, strategy.ID); err != nil {
+				return nil, fmt.Errorf("策略 %s: %w", strategy.ID, err)
+			}
+		}
+		mlModels[strategy.ID] = model
+		params, err := ParseMLParams(strategy.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("策略 %s: %w", strategy.ID, err)
+		}
+		if err := checkMLModel(model, strategy, params); err != nil {
+			return nil, fmt.Errorf("策略 %s: %w", strategy.ID, err)
+		}
+		if model.EndDate >= backtest.StartDate.Format("2006-01-02") {
+			s.logger.Warn("机器学习策略的训练区间与回测区间重叠，回测结果包含样本内表现",
+				logger.String("backtest_id", backtest.ID),
+				logger.String("strategy_id", strategy.ID),
+				logger.String("train_end", model.EndDate),
+			)
+		}
+	}
+	ctx = withMLModels(ctx, mlModels)
+
+	// 机器学习策略的特征在每只股票的完整预加载历史上计算一次，与训练时的计算方式一致，执行时按交易日取行
+	if len(mlModels) > 0 {
+		tables := make([]*mlFeatureTable, len(universe.symbols))
+		err := parallelEach(len(universe.symbols), s.simulationWorkers, func(i int) {
+			if history := histories[universe.symbols[i]]; history != nil {
+				tables[i] = newMLFeatureTable(s.strategyService.calculator, history.bars)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("计算机器学习策略的特征失败: %w", err)
+		}
+		features := make(map[string]*mlFeatureTable, len(tables))
+		for i, symbol := range universe.symbols {
+			if tables[i] != nil {
+				features[symbol] = tables[i]
+			}
+		}
+		ctx = withMLFeatures(ctx, features)
+	}
+
+	// 独立模式下每个策略都有完整的初始资金，就像单独运行一样；
+	// 共享资金模式下所有策略共用一个账户，每个策略的组合是账户中按权重分配的分账
+	strategyCapital := make(map[string]float64, len(strategies))
+	var account *sharedAccount
+	var combinedEquityCurve []models.EquityPoint
+	if sharedPortfolioMode(backtest) {
+		strategyIDs := make([]string, 0, len(strategies))
+		for _, strategy := range strategies {
+			strategyIDs = append(strategyIDs, strategy.ID)
+		}
+		weights := strategyWeights(backtest.Portfolio, strategyIDs)
+		account = newSharedAccount(backtest.InitialCash, weights, backtest.Portfolio.MaxGrossExposure)
+		for id, weight := range weights {
+			strategyCapital[id] = backtest.InitialCash * weight
+		}
+
+		s.logger.Info("初始化共享资金账户",
+			logger.String("backtest_id", backtest.ID),
+			logger.Int("strategies_count", len(strategies)),
+			logger.Float64("initial_cash", backtest.InitialCash),
+			logger.Float64("max_gross_exposure", backtest.Portfolio.MaxGrossExposure),
+		)
+	} else {
+		for _, strategy := range strategies {
+			strategyCapital[strategy.ID] = backtest.InitialCash
+		}
+
+		s.logger.Info("初始化多策略投资组合",
+			logger.String("backtest_id", backtest.ID),
+			logger.Int("strategies_count", len(strategies)),
+			logger.Float64("initial_cash_per_strategy", backtest.InitialCash),
+			logger.Float64("total_virtual_capital", backtest.InitialCash*float64(len(strategies))),
+		)
+	}
 
 	for _, strategy := range strategies {
-		strategyPortfolios[strategy.ID] = &models.Portfolio{
-			Cash:       initialCashPerStrategy,
-			Positions:  make(map[string]models.Position),
-			TotalValue: initialCashPerStrategy,
+		sizer := NewPositionSizer(backtest.PositionSizing, s.calculator)
+		if account != nil {
+			strategyPortfolios[strategy.ID] = account.sleeves[strategy.ID]
+			sizer = &allocationSizer{PositionSizer: sizer, account: account, strategyID: strategy.ID}
+		} else {
+			strategyPortfolios[strategy.ID] = &models.Portfolio{
+				Cash:       backtest.InitialCash,
+				Positions:  make(map[string]models.Position),
+				TotalValue: backtest.InitialCash,
+			}
 		}
 		strategyTrades[strategy.ID] = []models.Trade{}
+		strategySizers[strategy.ID] = sizer
+		pendingOrders[strategy.ID] = make(map[string]*models.Order)
 		strategyEquityCurves[strategy.ID] = []models.EquityPoint{}
 		strategyDailyReturns[strategy.ID] = []float64{}
 
 		s.logger.Debug("创建策略投资组合",
 			logger.String("strategy_id", strategy.ID),
-			logger.Float64("initial_cash", initialCashPerStrategy),
+			logger.Float64("initial_cash", strategyCapital[strategy.ID]),
 		)
 	}
 
-	// 开始模拟每日回测
+	// recordOrder 记录策略的成交和被规则拒绝的订单
+	recordOrder := func(strategyID, symbol string, trade *models.Trade, rejected *models.RejectedOrder) {
+		if rejected != nil {
+			strategyRejectedOrders[strategyID] = append(strategyRejectedOrders[strategyID], *rejected)
+		}
+		if trade == nil {
+			return
+		}
+		portfolio := strategyPortfolios[strategyID]
+
+		// 注意：不要在这里重新计算持仓资产，因为executeSignalForStrategy已经计算了正确的值
+		// 重新计算会导致使用不同的市场数据，造成计算错误
+
+		// 只更新现金余额（如果需要的话）
+		trade.CashBalance = portfolio.Cash
+
+		// 共享资金模式下记录的是整个账户的资产（此时组合的现金即账户现金）
+		if account != nil {
+			trade.HoldingAssets = account.holdingsValue()
+			trade.TotalAssets = portfolio.Cash + trade.HoldingAssets
+		} else {
+			// 🔧 重要修复：分别计算单策略资产和多策略总资产
+			// 计算当前策略的总资产（现金 + 持仓）
+			currentStrategyAssets := portfolio.Cash + trade.HoldingAssets
+
+			// 计算所有策略的虚拟总资产（现金总和 + 持仓市值总和）
+			// 注意：由于每个策略都有完整的初始资金，这里计算的是虚拟总资产
+			// 实际投资时不会同时使用所有策略的资金，这只是用于分析对比
+			totalCash := 0.0
+			totalHoldings := 0.0
+			for _, p := range strategyPortfolios {
+				totalCash += p.Cash
+				for _, pos := range p.Positions {
+					totalHoldings += pos.MarketValue
+				}
+			}
+			allStrategiesVirtualAssets := totalCash + totalHoldings
+
+			// 🚨 关键修复：TotalAssets应该记录当前策略的总资产，而不是所有策略的总资产
+			// 这样前端显示时就不会出现资产数值混乱的问题
+			trade.TotalAssets = currentStrategyAssets
 
-	// 用于控制日志输出频率
-	var lastLoggedProgress int = -1
+			// 如果需要记录所有策略的虚拟总资产，可以添加新字段
+			// trade.AllStrategiesVirtualAssets = allStrategiesVirtualAssets
+
+			// 添加调试日志
+			s.logger.Debug("交易资产计算",
+				logger.String("strategy_id", strategyID),
+				logger.String("symbol", symbol),
+				logger.Float64("holding_assets", trade.HoldingAssets),
+				logger.Float64("cash_balance", portfolio.Cash),
+				logger.Float64("current_strategy_assets", currentStrategyAssets),
+				logger.Float64("all_strategies_virtual_assets", allStrategiesVirtualAssets),
+			)
+
+			// 重要说明：
+			// - trade.HoldingAssets 记录的是当前策略的持仓资产（在executeSignalForStrategy中计算）
+			// - trade.TotalAssets 现在记录的是当前策略的总资产（持仓+现金）
+			// - 前端显示时可以直接使用 TotalAssets 或者 HoldingAssets + CashBalance
+		}
+
+		strategyTrades[strategyID] = append(strategyTrades[strategyID], *trade)
+		if tradeObserver, ok := strategySizers[strategyID].(tradeObserver); ok {
+			tradeObserver.ObserveTrade(trade)
+		}
+		if observer.onTrade != nil {
+			observer.onTrade(*trade)
+		}
+	}
+
+	// 开始模拟每日回测
 
 	// 获取回测期间的所有交易日
 	tradingDays := s.tradingCalendar.GetTradingDaysInRange(backtest.StartDate, backtest.EndDate)
 	totalTradingDays := len(tradingDays)
+	for _, history := range histories {
+		history.alignTo(tradingDays)
+	}
 
 	for dayIndex, currentDate := range tradingDays {
-		select {
-		case <-ctx.Done():
-			// 回测被取消或超时
-			if ctx.Err() == context.DeadlineExceeded {
-				s.logger.Error("多策略回测超时",
-					logger.String("backtest_id", backtest.ID),
-					logger.ErrorField(ctx.Err()),
-				)
-				s.updateBacktestStatus(backtest.ID, models.BacktestStatusFailed, "回测执行超时")
-			} else {
-				s.logger.Info("多策略回测被取消",
-					logger.String("backtest_id", backtest.ID),
-					logger.ErrorField(ctx.Err()),
-				)
-				s.updateBacktestStatus(backtest.ID, models.BacktestStatusCancelled, "回测已取消")
-			}
-			return
-		default:
+		// 回测被取消或超时
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		// 更新进度（基于交易日数量）
-		progress := int(float64(dayIndex+1) / float64(totalTradingDays) * 100)
+		if observer.onDay != nil {
+			observer.onDay(dayIndex, totalTradingDays, currentDate)
+		}
 
-		// 只在重要进度节点更新进度（减少更新频率）
-		if progress >= lastLoggedProgress+20 || dayIndex == 0 || dayIndex == totalTradingDays-1 {
-			lastLoggedProgress = progress
+		// 除权除息日开盘前记入送转股和现金分红
+		for _, action := range corporateActions.due(currentDate) {
+			for _, strategy := range strategies {
+				account.acquire(strategy.ID)
+				dividend, shares := applyCorporateAction(strategyPortfolios[strategy.ID], action)
+				account.release(strategy.ID)
+				if dividend == 0 && shares == 0 {
+					continue
+				}
+
+				strategyDividends[strategy.ID] += dividend
+				strategyBonusShares[strategy.ID] += shares
+				lotAdjustments = append(lotAdjustments, lotAdjustment{
+					strategyID:   strategy.ID,
+					symbol:       action.TSCode,
+					date:         currentDate,
+					cashDividend: action.CashDividend,
+					shareRatio:   action.ShareRatio(),
+				})
+				s.logger.Debug("除权除息调整持仓",
+					logger.String("backtest_id", backtest.ID),
+					logger.String("strategy_id", strategy.ID),
+					logger.String("symbol", action.TSCode),
+					logger.String("ex_date", action.ExDate),
+					logger.Float64("dividend", dividend),
+					logger.Int("bonus_shares", shares),
+				)
+			}
 		}
-		s.updateBacktestProgress(backtest.ID, progress, fmt.Sprintf("多策略回测进行中... %s (交易日 %d/%d)", currentDate.Format("2006-01-02"), dayIndex+1, totalTradingDays))
 
 		// 先更新每个策略的组合价值（基于当日市价）
 		// 注意：这里更新的市值将在后续交易计算中使用，确保数据一致性
 		for _, strategy := range strategies {
 			portfolio := strategyPortfolios[strategy.ID]
-			s.updatePortfolioValue(ctx, portfolio, backtest.Symbols, currentDate)
+			s.updatePortfolioValue(portfolio, histories, dayIndex, currentDate)
 		}
 
-		// 对每个股票执行所有策略
-		for _, symbol := range backtest.Symbols {
-			// 获取真实市场数据
-			marketData, err := s.getRealMarketData(ctx, symbol, currentDate)
-			if err != nil {
-				s.logger.Error("获取真实市场数据失败，跳过该股票",
-					logger.String("backtest_id", backtest.ID),
-					logger.String("symbol", symbol),
-					logger.String("date", currentDate.Format("2006-01-02")),
-					logger.ErrorField(err),
-				)
+		// 当日股票池成员：只有成员会产生买入信号和参与调仓打分，已移出股票池的持仓仍处理风控退出、挂单和卖出信号
+		members := universe.members(currentDate, histories)
+		inUniverse := make(map[string]bool, len(members))
+		for _, symbol := range members {
+			inUniverse[symbol] = true
+		}
+		active := make([]string, 0, len(universe.symbols))
+		for _, symbol := range universe.symbols {
+			if inUniverse[symbol] || holdsOrPending(symbol, strategyPortfolios, pendingOrders) {
+				active = append(active, symbol)
+			}
+		}
+
+		fundamentalDecisions, err := s.evaluateFundamentalStrategies(fundamentalParams, dayIndex, currentDate, members, factorCache)
+		if err != nil {
+			s.logger.Error("基本面策略评估失败，本评估日不产生信号",
+				logger.String("backtest_id", backtest.ID),
+				logger.String("date", currentDate.Format("2006-01-02")),
+				logger.ErrorField(err),
+			)
+		}
+
+		// 并行准备各股票的行情并执行策略，再按股票顺序逐个撮合
+		symbolDays, err := s.prepareSymbolDays(ctx, backtest, strategies, rebalanceParams, fundamentalDecisions, active, histories, dayIndex, currentDate, len(members))
+		if err != nil {
+			return nil, err
+		}
+		dayBars := make(map[string]*orderBar, len(active))
+		for _, symbolDay := range symbolDays {
+			if symbolDay == nil {
 				continue
 			}
+			symbol, marketData, bar := symbolDay.symbol, symbolDay.marketData, symbolDay.bar
+			dayBars[symbol] = bar
 
-			// 为每个策略执行交易逻辑
-			for _, strategy := range strategies {
+			// 为每个策略处理风控退出和挂单，并收集当日信号
+			signals := make(map[string]*models.Signal, len(strategies))
+			for i, strategy := range strategies {
 				portfolio := strategyPortfolios[strategy.ID]
+				account.acquire(strategy.ID)
+
+				// 先按当日最高价/最低价检查风控退出规则（止损、止盈、最长持有期）
+				trade, rejected := s.applyExitRules(bar, portfolio, backtest, strategy.ID)
+				recordOrder(strategy.ID, symbol, trade, rejected)
+
+				// 撮合之前交易日的信号生成的挂单
+				if order, exists := pendingOrders[strategy.ID][symbol]; exists {
+					trade, rejected, keep := s.executePendingOrder(order, bar, portfolio, backtest, strategySizers[strategy.ID])
+					recordOrder(strategy.ID, symbol, trade, rejected)
+					if !keep {
+						delete(pendingOrders[strategy.ID], symbol)
+					}
+				}
+				account.release(strategy.ID)
 
-				// 执行策略
-				signal, err := s.strategyService.ExecuteStrategy(ctx, strategy.ID, marketData)
-				if err != nil {
-					s.logger.Error("策略执行失败",
-						logger.String("backtest_id", backtest.ID),
-						logger.String("strategy_id", strategy.ID),
-						logger.String("symbol", symbol),
-						logger.String("date", currentDate.Format("2006-01-02")),
-						logger.ErrorField(err),
-					)
+				signal := symbolDay.signals[i]
+				if signal == nil {
 					continue
 				}
+				// 不在当日股票池中的股票只处理已有持仓的卖出信号
+				if !inUniverse[symbol] && (portfolio.Positions[symbol].Quantity == 0 || signal.SignalType == models.SignalTypeBuy) {
+					continue
+				}
+				signals[strategy.ID] = signal
+			}
+
+			// 共享资金模式下，不同策略对同一股票的相反信号按配置取舍
+			if account != nil {
+				resolveSignalConflicts(backtest.Portfolio, account.weights, strategies, signals)
+			}
 
-				// 根据信号执行交易
-				if trade := s.executeSignalForStrategy(signal, marketData, portfolio, backtest, strategy.ID); trade != nil {
-					// 注意：不要在这里重新计算持仓资产，因为executeSignalForStrategy已经计算了正确的值
-					// 重新计算会导致使用不同的市场数据，造成计算错误
-
-					// 只更新现金余额（如果需要的话）
-					trade.CashBalance = portfolio.Cash
-
-					// 🔧 重要修复：分别计算单策略资产和多策略总资产
-					// 计算当前策略的总资产（现金 + 持仓）
-					currentStrategyAssets := portfolio.Cash + trade.HoldingAssets
-
-					// 计算所有策略的虚拟总资产（现金总和 + 持仓市值总和）
-					// 注意：由于每个策略都有完整的初始资金，这里计算的是虚拟总资产
-					// 实际投资时不会同时使用所有策略的资金，这只是用于分析对比
-					totalCash := 0.0
-					totalHoldings := 0.0
-					for _, p := range strategyPortfolios {
-						totalCash += p.Cash
-						for _, pos := range p.Positions {
-							totalHoldings += pos.MarketValue
-						}
+			// 根据信号执行交易：当日收盘价直接成交，其他成交时机生成挂单，新信号替换未成交的旧挂单
+			for _, strategy := range strategies {
+				signal := signals[strategy.ID]
+				if signal == nil {
+					continue
+				}
+				if timing != models.ExecutionSameBarClose {
+					if order := s.newPendingOrder(signal, marketData, backtest, strategy.ID); order != nil {
+						pendingOrders[strategy.ID][symbol] = order
 					}
-					allStrategiesVirtualAssets := totalCash + totalHoldings
-
-					// 🚨 关键修复：TotalAssets应该记录当前策略的总资产，而不是所有策略的总资产
-					// 这样前端显示时就不会出现资产数值混乱的问题
-					trade.TotalAssets = currentStrategyAssets
-
-					// 如果需要记录所有策略的虚拟总资产，可以添加新字段
-					// trade.AllStrategiesVirtualAssets = allStrategiesVirtualAssets
-
-					// 添加调试日志
-					s.logger.Debug("交易资产计算",
-						logger.String("strategy_id", strategy.ID),
-						logger.String("symbol", symbol),
-						logger.Float64("holding_assets", trade.HoldingAssets),
-						logger.Float64("cash_balance", portfolio.Cash),
-						logger.Float64("current_strategy_assets", currentStrategyAssets),
-						logger.Float64("all_strategies_virtual_assets", allStrategiesVirtualAssets),
-					)
+					continue
+				}
 
-					// 重要说明：
-					// - trade.HoldingAssets 记录的是当前策略的持仓资产（在executeSignalForStrategy中计算）
-					// - trade.TotalAssets 现在记录的是当前策略的总资产（持仓+现金）
-					// - 前端显示时可以直接使用 TotalAssets 或者 HoldingAssets + CashBalance
+				account.acquire(strategy.ID)
+				trade, rejected := s.executeSignalForStrategy(signal, bar, strategyPortfolios[strategy.ID], backtest, strategy.ID, strategySizers[strategy.ID])
+				recordOrder(strategy.ID, symbol, trade, rejected)
+				account.release(strategy.ID)
+			}
+		}
 
-					strategyTrades[strategy.ID] = append(strategyTrades[strategy.ID], *trade)
-				}
+		// 定期调仓策略在回测首日和每个调仓周期的第一个交易日调仓，按回测的成交时机成交
+		for _, strategy := range strategies {
+			params, ok := rebalanceParams[strategy.ID]
+			if !ok || (dayIndex > 0 && !s.tradingCalendar.IsFirstTradingDayOfPeriod(currentDate, params.Frequency)) {
+				continue
 			}
+			scores, err := s.rebalanceScores(params, currentDate, members, dayBars, factorCache)
+			if err != nil {
+				s.logger.Error("调仓打分失败，跳过本次调仓",
+					logger.String("backtest_id", backtest.ID),
+					logger.String("strategy_id", strategy.ID),
+					logger.String("date", currentDate.Format("2006-01-02")),
+					logger.ErrorField(err),
+				)
+				continue
+			}
+			targets := rebalanceTargetWeights(params, scores)
+			s.rebalancePortfolio(params, targets, dayBars, strategyPortfolios[strategy.ID], backtest, strategy.ID, strategySizers[strategy.ID], account, pendingOrders[strategy.ID], recordOrder)
+
+			s.logger.Debug("定期调仓完成",
+				logger.String("backtest_id", backtest.ID),
+				logger.String("strategy_id", strategy.ID),
+				logger.String("date", currentDate.Format("2006-01-02")),
+				logger.Int("scored_symbols", len(scores)),
+				logger.Int("targets", len(targets)),
+			)
 		}
 
 		// 最终更新每个策略的组合价值（确保权益曲线记录正确）
 		for _, strategy := range strategies {
 			portfolio := strategyPortfolios[strategy.ID]
-			s.updatePortfolioValue(ctx, portfolio, backtest.Symbols, currentDate)
+			s.updatePortfolioValue(portfolio, histories, dayIndex, currentDate)
 
-			// 记录权益曲线
-			// 🔧 添加基准收益计算（简化使用固定年化收益率8%）
-			daysSinceStart := int(currentDate.Sub(backtest.StartDate).Hours() / 24)
-			benchmarkDailyReturn := 0.08 / 252 // 年化8%转为日收益率
-			benchmarkValue := backtest.InitialCash * math.Pow(1+benchmarkDailyReturn, float64(daysSinceStart))
+			// 记录权益曲线（基准净值按基准指数实际收盘价换算，未能加载基准时为0）
+			benchmarkValue := benchmark.valueOn(currentDate, strategyCapital[strategy.ID])
 
 			strategyEquityCurves[strategy.ID] = append(strategyEquityCurves[strategy.ID], models.EquityPoint{
 				Date:           currentDate.Format("2006-01-02"),
@@ -1589,15 +2336,40 @@ func (s *BacktestService) runMultiStrategyBacktestTask(ctx context.Context, back
 			// 计算日收益率
 			if len(strategyEquityCurves[strategy.ID]) > 1 {
 				prevValue := strategyEquityCurves[strategy.ID][len(strategyEquityCurves[strategy.ID])-2].PortfolioValue
+				prevBenchmark := strategyEquityCurves[strategy.ID][len(strategyEquityCurves[strategy.ID])-2].BenchmarkValue
 				if prevValue > 0 {
 					dailyReturn := (portfolio.TotalValue - prevValue) / prevValue
 					strategyDailyReturns[strategy.ID] = append(strategyDailyReturns[strategy.ID], dailyReturn)
+					// 基准收益率与策略收益率按同一交易日对齐
+					if prevBenchmark > 0 {
+						strategyBenchmarkReturns[strategy.ID] = append(strategyBenchmarkReturns[strategy.ID], benchmarkValue/prevBenchmark-1)
+					}
 				}
 			}
 		}
 
-		// 添加小延迟以避免过于频繁的操作
-		time.Sleep(1 * time.Millisecond)
+		// 共享资金模式下组合权益曲线即账户的实际资产；
+		// 独立模式下每个策略都有完整的初始资金，直接相加会导致虚拟总资产过大，因此取所有策略的平均值
+		var combinedPoint models.EquityPoint
+		switch {
+		case account != nil:
+			holdings := account.holdingsValue()
+			combinedPoint = models.EquityPoint{
+				Date:           currentDate.Format("2006-01-02"),
+				PortfolioValue: account.cash + holdings,
+				BenchmarkValue: benchmark.valueOn(currentDate, backtest.InitialCash),
+				Cash:           account.cash,
+				Holdings:       holdings,
+			}
+		case len(strategies) > 0:
+			combinedPoint = averageEquityPoint(strategies, strategyEquityCurves)
+		default:
+			continue
+		}
+		combinedEquityCurve = append(combinedEquityCurve, combinedPoint)
+		if observer.onEquity != nil {
+			observer.onEquity(combinedPoint)
+		}
 	}
 
 	// 回测完成，计算结果
@@ -1605,14 +2377,15 @@ func (s *BacktestService) runMultiStrategyBacktestTask(ctx context.Context, back
 	// 为每个策略计算性能指标
 	var allResults []models.BacktestResult
 	var allTrades []models.Trade
-	var combinedEquityCurve []models.EquityPoint
+	var allRejectedOrders []models.RejectedOrder
 
 	for _, strategy := range strategies {
 		// 计算该策略的性能指标
 		performanceMetrics := &models.PerformanceMetrics{
-			Returns:      strategyDailyReturns[strategy.ID],
-			RiskFreeRate: 0.03 / 252, // 假设年化无风险利率3%
-			Trades:       strategyTrades[strategy.ID],
+			Returns:          strategyDailyReturns[strategy.ID],
+			BenchmarkReturns: strategyBenchmarkReturns[strategy.ID],
+			RiskFreeRate:     0.03 / 252, // 假设年化无风险利率3%
+			Trades:           strategyTrades[strategy.ID],
 		}
 
 		result := performanceMetrics.CalculateMetrics()
@@ -1620,246 +2393,341 @@ func (s *BacktestService) runMultiStrategyBacktestTask(ctx context.Context, back
 		result.BacktestID = backtest.ID
 		result.StrategyID = strategy.ID
 		result.StrategyName = strategy.Name
+		result.RejectedOrders = len(strategyRejectedOrders[strategy.ID])
+		result.DividendIncome = strategyDividends[strategy.ID]
+		result.BonusShares = strategyBonusShares[strategy.ID]
+		result.OpenPositions = sortedOpenPositions(strategyPortfolios[strategy.ID])
 		result.CreatedAt = time.Now()
 
 		allResults = append(allResults, *result)
 
 		// 合并交易记录
 		allTrades = append(allTrades, strategyTrades[strategy.ID]...)
+		allRejectedOrders = append(allRejectedOrders, strategyRejectedOrders[strategy.ID]...)
 
 	}
 
-	// 计算组合整体权益曲线（所有策略的平均或加权组合）
-	if len(strategies) > 0 {
-		maxLen := 0
-		for _, curve := range strategyEquityCurves {
-			if len(curve) > maxLen {
-				maxLen = len(curve)
-			}
-		}
+	runData := &backtestRunData{
+		Results:              allResults,
+		Trades:               allTrades,
+		RejectedOrders:       allRejectedOrders,
+		RoundTrips:           buildRoundTrips(allTrades, histories, lotAdjustments),
+		EquityCurve:          combinedEquityCurve,
+		StrategyEquityCurves: strategyEquityCurves,
+		Warnings:             universe.warnings,
+	}
 
-		for i := 0; i < maxLen; i++ {
-			var totalValue, totalCash, totalHoldings, totalBenchmark float64
-			var date string
-			count := 0
+	// 记录运行清单，生成失败不影响回测结果，只是之后无法重新运行对比
+	dataHash, err := marketDataHash(histories, benchmark, corporateActions, factorCache)
+	if err == nil {
+		runData.Manifest, err = s.newRunManifest(backtest, strategies, children, mlModels, dataHash, runData)
+	}
+	if err != nil {
+		s.logger.Warn("生成回测运行清单失败",
+			logger.String("backtest_id", backtest.ID),
+			logger.ErrorField(err),
+		)
+	}
+	return runData, nil
+}
 
-			for _, curve := range strategyEquityCurves {
-				if i < len(curve) {
-					totalValue += curve[i].PortfolioValue
-					totalCash += curve[i].Cash
-					totalHoldings += curve[i].Holdings
-					totalBenchmark += curve[i].BenchmarkValue // 累加基准值
-					date = curve[i].Date
-					count++
-				}
-			}
+// averageEquityPoint 独立资金模式下当日的组合权益：各策略最新权益点的平均值
+func averageEquityPoint(strategies []*models.Strategy, curves map[string][]models.EquityPoint) models.EquityPoint {
+	var point models.EquityPoint
+	for _, strategy := range strategies {
+		curve := curves[strategy.ID]
+		latest := curve[len(curve)-1]
+		point.Date = latest.Date
+		point.PortfolioValue += latest.PortfolioValue
+		point.BenchmarkValue += latest.BenchmarkValue
+		point.Cash += latest.Cash
+		point.Holdings += latest.Holdings
+	}
+	count := float64(len(strategies))
+	point.PortfolioValue /= count
+	point.BenchmarkValue /= count
+	point.Cash /= count
+	point.Holdings /= count
+	return point
+}
 
-			if count > 0 {
-				// 🔧 重要修复：组合权益曲线应该显示平均值或者加权平均，而不是简单相加
-				// 因为每个策略都有完整的初始资金，直接相加会导致虚拟总资产过大
-				avgValue := totalValue / float64(count)
-				avgCash := totalCash / float64(count)
-				avgHoldings := totalHoldings / float64(count)
-				avgBenchmark := totalBenchmark / float64(count) // 基准值也使用平均值
-
-				combinedEquityCurve = append(combinedEquityCurve, models.EquityPoint{
-					Date:           date,
-					PortfolioValue: avgValue,     // 使用平均值而不是总和
-					BenchmarkValue: avgBenchmark, // 添加基准值
-					Cash:           avgCash,
-					Holdings:       avgHoldings,
-				})
-			}
-		}
+// executeSignalForStrategy 为特定策略执行交易信号
+// 买入金额由仓位计算器决定；未关闭交易规则时按A股规则撮合，被规则拒绝的订单通过第二个返回值返回
+func (s *BacktestService) executeSignalForStrategy(signal *models.Signal, bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string, sizer PositionSizer) (*models.Trade, *models.RejectedOrder) {
+	if signal == nil || signal.SignalType == models.SignalTypeHold {
+		return nil, nil
 	}
 
-	// 保存结果到内存（在真实环境中应该保存到数据库）
-	s.backtestTrades[backtest.ID] = allTrades
-
-	// 保存多策略结果到新的存储结构
-	s.backtestMultiResults[backtest.ID] = allResults
-	s.backtestEquityCurves[backtest.ID] = combinedEquityCurve
+	price := bar.marketData.Close
+	if !backtest.DisableTradingRules {
+		price = s.tradingRules.RoundToTick(price)
+	}
 
-	// 保存第一个策略的结果作为主结果（兼容性）
-	if len(allResults) > 0 {
-		s.backtestResults[backtest.ID] = &allResults[0]
+	switch signal.SignalType {
+	case models.SignalTypeBuy:
+		return s.executeBuy(signal, bar, portfolio, backtest, strategyID, sizer, price)
+	case models.SignalTypeSell:
+		return s.executeSell(bar, portfolio, backtest, strategyID, signal.SignalType, price)
 	}
 
-	// 更新回测状态
-	backtest.Status = models.BacktestStatusCompleted
-	backtest.Progress = 100
-	now := time.Now()
-	backtest.CompletedAt = &now
+	return nil, nil
+}
 
-	// 确保进度设置为100%
-	s.updateBacktestProgress(backtest.ID, 100, "多策略回测完成")
-	s.updateBacktestStatus(backtest.ID, models.BacktestStatusCompleted, "多策略回测完成")
+// executeBuy 按指定申报价买入，price 为未加滑点的申报价，买入金额由仓位计算器决定
+func (s *BacktestService) executeBuy(signal *models.Signal, bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string, sizer PositionSizer, price float64) (*models.Trade, *models.RejectedOrder) {
+	marketData := bar.marketData
+	symbol := marketData.Symbol
+	applyRules := !backtest.DisableTradingRules
+	costModel := costModelForBacktest(backtest)
 
-	s.logger.Info("🎉 多策略回测任务完成",
-		logger.String("backtest_id", backtest.ID),
-		logger.Int("strategies_count", len(strategies)),
-		logger.Int("total_trades", len(allTrades)),
-		logger.Int("equity_points", len(combinedEquityCurve)),
-	)
-}
+	// 动态股票池按当日成员数量计算等权仓位
+	symbolCount := len(backtest.Symbols)
+	if bar.universeSize > 0 {
+		symbolCount = bar.universeSize
+	}
 
-// executeSignalForStrategy 为特定策略执行交易信号
-func (s *BacktestService) executeSignalForStrategy(signal *models.Signal, marketData *models.MarketData, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string) *models.Trade {
-	if signal == nil || signal.SignalType == models.SignalTypeHold {
-		return nil
+	fillPrice := s.fillPrice(costModel, bar, models.TradeSideBuy, price, applyRules)
+	targetAmount := sizer.TargetAmount(&SizingInput{
+		Signal:        signal,
+		Price:         fillPrice,
+		Cash:          portfolio.Cash,
+		TotalValue:    portfolio.TotalValue,
+		PositionValue: portfolio.Positions[symbol].MarketValue,
+		SymbolCount:   symbolCount,
+		History:       bar.history,
+	})
+	if targetAmount <= 0 {
+		return nil, nil
 	}
 
-	symbol := marketData.Symbol
-	price := marketData.Close
+	quantity := int(targetAmount / fillPrice)
+	if quantity <= 0 {
+		return nil, nil
+	}
 
-	switch signal.SignalType {
-	case models.SignalTypeBuy:
-		// 买入逻辑
-		maxInvestment := portfolio.Cash * 0.2 // 每次最多投入20%的现金
-		if maxInvestment < 1000 {             // 最小投资金额
-			return nil
+	if applyRules {
+		if reason := s.tradingRules.CheckBuy(bar, price); reason != "" {
+			return nil, newRejectedOrder(backtest, strategyID, marketData, models.TradeSideBuy, quantity, price, reason)
 		}
-
-		quantity := int(maxInvestment / price)
-		if quantity <= 0 {
-			return nil
+		requested := quantity
+		if quantity = s.tradingRules.NormalizeBuyQuantity(symbol, quantity); quantity <= 0 {
+			return nil, newRejectedOrder(backtest, strategyID, marketData, models.TradeSideBuy, requested, price, models.OrderRejectLotSize)
 		}
+	}
 
-		cost := float64(quantity) * price
-		commission := cost * backtest.Commission
-		totalCost := cost + commission
-
-		if totalCost > portfolio.Cash {
-			return nil
+	// 现金不足以支付成交额和税费时逐手减少买入数量
+	step := 1
+	if applyRules {
+		step = boardLotSize
+	}
+	tradeCost := costModel.Calculate(models.TradeSideBuy, quantity, fillPrice, price)
+	for quantity > 0 && float64(quantity)*fillPrice+tradeCost.Fees() > portfolio.Cash {
+		quantity -= step
+		if applyRules {
+			quantity = s.tradingRules.NormalizeBuyQuantity(symbol, quantity)
 		}
+		tradeCost = costModel.Calculate(models.TradeSideBuy, quantity, fillPrice, price)
+	}
+	if quantity <= 0 {
+		return nil, nil
+	}
 
-		// 执行买入
-		portfolio.Cash -= totalCost
-		if position, exists := portfolio.Positions[symbol]; exists {
-			// 更新现有持仓
-			totalShares := position.Quantity + quantity
-			totalCostBasis := position.AvgPrice*float64(position.Quantity) + cost
-			position.AvgPrice = totalCostBasis / float64(totalShares)
-			position.Quantity = totalShares
-			position.MarketValue = float64(totalShares) * price // 使用当前交易价格作为市值
-			position.UnrealizedPL = position.MarketValue - totalCostBasis
-			portfolio.Positions[symbol] = position
+	amount := float64(quantity) * fillPrice
+	totalCost := amount + tradeCost.Fees()
+
+	// 执行买入
+	portfolio.Cash -= totalCost
+	if position, exists := portfolio.Positions[symbol]; exists {
+		// 更新现有持仓
+		s.addToPosition(backtest.ExitRules, &position, quantity, bar.history)
+		totalShares := position.Quantity + quantity
+		totalCostBasis := position.AvgPrice*float64(position.Quantity) + amount
+		position.AvgPrice = totalCostBasis / float64(totalShares)
+		position.Quantity = totalShares
+		position.MarketValue = float64(totalShares) * price // 使用当前交易价格作为市值
+		position.UnrealizedPL = position.MarketValue - totalCostBasis
+		if sameTradingDay(position.LastBuyDate, marketData.Date) {
+			position.LastBuyQuantity += quantity
 		} else {
-			// 创建新持仓
-			portfolio.Positions[symbol] = models.Position{
-				Symbol:       symbol,
-				Quantity:     quantity,
-				AvgPrice:     price,
-				MarketValue:  float64(quantity) * price, // 使用当前交易价格作为市值
-				UnrealizedPL: 0,
-				Timestamp:    marketData.Date,
-			}
+			position.LastBuyQuantity = quantity
 		}
+		position.LastBuyDate = marketData.Date
+		position.PeakPrice = math.Max(position.PeakPrice, fillPrice)
+		portfolio.Positions[symbol] = position
+	} else {
+		// 创建新持仓
+		portfolio.Positions[symbol] = models.Position{
+			Symbol:          symbol,
+			Quantity:        quantity,
+			AvgPrice:        fillPrice,
+			MarketValue:     float64(quantity) * price, // 使用当前交易价格作为市值
+			UnrealizedPL:    0,
+			Timestamp:       marketData.Date,
+			LastBuyDate:     marketData.Date,
+			LastBuyQuantity: quantity,
+			PeakPrice:       fillPrice,
+		}
+	}
+
+	// 计算交易后的持仓资产（使用已更新的市值，确保数据一致性）
+	holdingAssets := positionsValue(portfolio) // 使用updatePortfolioValue已更新的市值
+
+	return &models.Trade{
+		ID:            fmt.Sprintf("%s_%s_%d", backtest.ID, symbol, time.Now().UnixNano()),
+		BacktestID:    backtest.ID,
+		StrategyID:    strategyID,
+		Symbol:        symbol,
+		Side:          models.TradeSideBuy,
+		Quantity:      quantity,
+		Price:         fillPrice,
+		Commission:    tradeCost.Commission,
+		TransferFee:   tradeCost.TransferFee,
+		SlippageCost:  tradeCost.Slippage,
+		TotalCost:     tradeCost.Total(),
+		SignalType:    string(signal.SignalType),
+		HoldingAssets: holdingAssets,
+		CashBalance:   portfolio.Cash,
+		Timestamp:     marketData.Date,
+		CreatedAt:     time.Now(),
+	}, nil
+}
 
-		// 计算交易后的持仓资产（使用已更新的市值，确保数据一致性）
-		holdingAssets := 0.0
-		for _, pos := range portfolio.Positions {
-			holdingAssets += pos.MarketValue // 使用updatePortfolioValue已更新的市值
-		}
+// executeSell 按指定申报价卖出持仓，price 为未加滑点的申报价
+// 策略卖出信号以收盘价申报，风控退出以触发价申报；signalType 记录在成交记录中用于区分退出原因
+func (s *BacktestService) executeSell(bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string, signalType models.SignalType, price float64) (*models.Trade, *models.RejectedOrder) {
+	return s.executePartialSell(bar, portfolio, backtest, strategyID, signalType, price, 0)
+}
 
-		return &models.Trade{
-			ID:            fmt.Sprintf("%s_%s_%d", backtest.ID, symbol, time.Now().UnixNano()),
-			BacktestID:    backtest.ID,
-			StrategyID:    strategyID,
-			Symbol:        symbol,
-			Side:          models.TradeSideBuy,
-			Quantity:      quantity,
-			Price:         price,
-			Commission:    commission,
-			SignalType:    string(signal.SignalType),
-			HoldingAssets: holdingAssets,
-			CashBalance:   portfolio.Cash,
-			Timestamp:     marketData.Date,
-			CreatedAt:     time.Now(),
-		}
+// executePartialSell 按指定申报价卖出部分持仓，quantity<=0 或超过持仓数量时卖出全部
+// 启用交易规则时，少于可卖数量的部分卖出向下取整到整手（零股只能随剩余可卖股份一起卖出）
+func (s *BacktestService) executePartialSell(bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string, signalType models.SignalType, price float64, quantity int) (*models.Trade, *models.RejectedOrder) {
+	marketData := bar.marketData
+	symbol := marketData.Symbol
+	applyRules := !backtest.DisableTradingRules
+	costModel := costModelForBacktest(backtest)
 
-	case models.SignalTypeSell:
-		// 卖出逻辑
-		position, exists := portfolio.Positions[symbol]
-		if !exists || position.Quantity <= 0 {
-			return nil
-		}
+	position, exists := portfolio.Positions[symbol]
+	if !exists || position.Quantity <= 0 {
+		return nil, nil
+	}
 
-		// 记录卖出前的持仓资产用于异常检测
-		holdingAssetsBeforeSell := 0.0
-		for _, pos := range portfolio.Positions {
-			holdingAssetsBeforeSell += pos.MarketValue
+	if quantity <= 0 || quantity > position.Quantity {
+		quantity = position.Quantity
+	}
+	if applyRules {
+		if reason := s.tradingRules.CheckSell(bar, price, position); reason != "" {
+			return nil, newRejectedOrder(backtest, strategyID, marketData, models.TradeSideSell, quantity, price, reason)
 		}
-		soldStockValue := position.MarketValue // 被卖出股票的市值
+		// T+1：当日新买入的部分不可卖出，最多卖出可卖数量
+		if sellable := s.tradingRules.SellableQuantity(position, marketData.Date); quantity >= sellable {
+			quantity = sellable
+		} else if quantity = quantity / boardLotSize * boardLotSize; quantity <= 0 {
+			return nil, nil
+		}
+	}
 
-		quantity := position.Quantity
-		revenue := float64(quantity) * price
-		commission := revenue * backtest.Commission
-		netRevenue := revenue - commission
+	// 记录卖出前的持仓资产用于异常检测
+	holdingAssetsBeforeSell := positionsValue(portfolio)
+	soldStockValue := position.MarketValue // 被卖出股票的市值
 
-		// 计算盈亏
-		pnl := netRevenue - (position.AvgPrice * float64(quantity))
+	fillPrice := s.fillPrice(costModel, bar, models.TradeSideSell, price, applyRules)
+	revenue := float64(quantity) * fillPrice
+	tradeCost := costModel.Calculate(models.TradeSideSell, quantity, fillPrice, price)
+	netRevenue := revenue - tradeCost.Fees()
 
-		// 执行卖出
-		portfolio.Cash += netRevenue
+	// 计算盈亏
+	pnl := netRevenue - (position.AvgPrice * float64(quantity))
+
+	// 执行卖出
+	portfolio.Cash += netRevenue
+	if quantity < position.Quantity {
+		position.Quantity -= quantity
+		position.MarketValue = float64(position.Quantity) * marketData.Close
+		position.UnrealizedPL = position.MarketValue - position.AvgPrice*float64(position.Quantity)
+		portfolio.Positions[symbol] = position
+	} else {
 		delete(portfolio.Positions, symbol)
+	}
 
-		// 计算交易后的持仓资产（使用一致的市场数据）
-		holdingAssetsAfterSell := 0.0
-		for _, pos := range portfolio.Positions {
-			holdingAssetsAfterSell += pos.MarketValue
-		}
+	// 计算交易后的持仓资产（使用一致的市场数据）
+	holdingAssetsAfterSell := positionsValue(portfolio)
 
-		// 🚨 异常检测：卖出后持仓资产不应该增加
-		if holdingAssetsAfterSell > holdingAssetsBeforeSell {
-			s.logger.Error("🚨 卖出交易异常：卖出后持仓资产增加",
-				logger.String("backtest_id", backtest.ID),
-				logger.String("strategy_id", strategyID),
-				logger.String("symbol", symbol),
-				logger.Float64("sold_quantity", float64(quantity)),
-				logger.Float64("sold_price", price),
-				logger.Float64("sold_stock_value", soldStockValue),
-				logger.Float64("holding_before_sell", holdingAssetsBeforeSell),
-				logger.Float64("holding_after_sell", holdingAssetsAfterSell),
-				logger.Float64("abnormal_increase", holdingAssetsAfterSell-holdingAssetsBeforeSell),
-				logger.String("timestamp", marketData.Date.Format("2006-01-02")),
-			)
+	// 🚨 异常检测：卖出后持仓资产不应该增加
+	if holdingAssetsAfterSell > holdingAssetsBeforeSell {
+		s.logger.Error("🚨 卖出交易异常：卖出后持仓资产增加",
+			logger.String("backtest_id", backtest.ID),
+			logger.String("strategy_id", strategyID),
+			logger.String("symbol", symbol),
+			logger.Float64("sold_quantity", float64(quantity)),
+			logger.Float64("sold_price", price),
+			logger.Float64("sold_stock_value", soldStockValue),
+			logger.Float64("holding_before_sell", holdingAssetsBeforeSell),
+			logger.Float64("holding_after_sell", holdingAssetsAfterSell),
+			logger.Float64("abnormal_increase", holdingAssetsAfterSell-holdingAssetsBeforeSell),
+			logger.String("timestamp", marketData.Date.Format("2006-01-02")),
+		)
 
-			// 打印剩余持仓详情
-			s.logger.Error("剩余持仓详情",
-				logger.String("backtest_id", backtest.ID),
-				logger.String("strategy_id", strategyID),
+		// 打印剩余持仓详情
+		s.logger.Error("剩余持仓详情",
+			logger.String("backtest_id", backtest.ID),
+			logger.String("strategy_id", strategyID),
+		)
+		for sym, pos := range portfolio.Positions {
+			s.logger.Error("持仓明细",
+				logger.String("symbol", sym),
+				logger.Int("quantity", pos.Quantity),
+				logger.Float64("avg_price", pos.AvgPrice),
+				logger.Float64("market_value", pos.MarketValue),
+				logger.Float64("unrealized_pl", pos.UnrealizedPL),
 			)
-			for sym, pos := range portfolio.Positions {
-				s.logger.Error("持仓明细",
-					logger.String("symbol", sym),
-					logger.Int("quantity", pos.Quantity),
-					logger.Float64("avg_price", pos.AvgPrice),
-					logger.Float64("market_value", pos.MarketValue),
-					logger.Float64("unrealized_pl", pos.UnrealizedPL),
-				)
-			}
 		}
+	}
 
-		return &models.Trade{
-			ID:            fmt.Sprintf("%s_%s_%d", backtest.ID, symbol, time.Now().UnixNano()),
-			BacktestID:    backtest.ID,
-			StrategyID:    strategyID,
-			Symbol:        symbol,
-			Side:          models.TradeSideSell,
-			Quantity:      quantity,
-			Price:         price,
-			Commission:    commission,
-			PnL:           pnl,
-			SignalType:    string(signal.SignalType),
-			HoldingAssets: holdingAssetsAfterSell,
-			CashBalance:   portfolio.Cash,
-			Timestamp:     marketData.Date,
-			CreatedAt:     time.Now(),
-		}
+	return &models.Trade{
+		ID:            fmt.Sprintf("%s_%s_%d", backtest.ID, symbol, time.Now().UnixNano()),
+		BacktestID:    backtest.ID,
+		StrategyID:    strategyID,
+		Symbol:        symbol,
+		Side:          models.TradeSideSell,
+		Quantity:      quantity,
+		Price:         fillPrice,
+		Commission:    tradeCost.Commission,
+		StampDuty:     tradeCost.StampDuty,
+		TransferFee:   tradeCost.TransferFee,
+		SlippageCost:  tradeCost.Slippage,
+		TotalCost:     tradeCost.Total(),
+		PnL:           pnl,
+		SignalType:    string(signalType),
+		HoldingAssets: holdingAssetsAfterSell,
+		CashBalance:   portfolio.Cash,
+		Timestamp:     marketData.Date,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// fillPrice 计算考虑滑点后的成交价，启用交易规则时对齐最小报价单位并限制在涨跌停价之内
+func (s *BacktestService) fillPrice(costModel CostModel, bar *orderBar, side models.TradeSide, price float64, applyRules bool) float64 {
+	fill := costModel.FillPrice(side, price)
+	if applyRules {
+		fill = s.tradingRules.ClampToPriceLimits(bar, s.tradingRules.RoundToTick(fill))
 	}
+	return fill
+}
 
-	return nil
+// newRejectedOrder 构造被交易规则拒绝的订单记录
+func newRejectedOrder(backtest *models.Backtest, strategyID string, marketData *models.MarketData, side models.TradeSide, quantity int, price float64, reason models.OrderRejectReason) *models.RejectedOrder {
+	return &models.RejectedOrder{
+		ID:         fmt.Sprintf("%s_%s_%d", backtest.ID, marketData.Symbol, time.Now().UnixNano()),
+		BacktestID: backtest.ID,
+		StrategyID: strategyID,
+		Symbol:     marketData.Symbol,
+		Side:       side,
+		Quantity:   quantity,
+		Price:      price,
+		Reason:     reason,
+		Message:    reason.Description(),
+		Timestamp:  marketData.Date,
+	}
 }
 
 // calculateCombinedMetrics 计算多策略组合的整体指标
@@ -1877,8 +2745,8 @@ func (s *BacktestService) calculateCombinedMetrics(results []models.BacktestResu
 		CreatedAt:    time.Now(),
 	}
 
-	var totalReturn, annualReturn, maxDrawdown, sharpeRatio, sortinoRatio, winRate, profitFactor, avgTradeReturn, benchmarkReturn, alpha, beta float64
-	var totalTrades int
+	var totalReturn, annualReturn, maxDrawdown, sharpeRatio, sortinoRatio, winRate, profitFactor, avgTradeReturn, benchmarkReturn, alpha, beta, trackingError, informationRatio float64
+	var totalTrades, rejectedOrders int
 
 	for _, result := range results {
 		totalReturn += result.TotalReturn
@@ -1892,7 +2760,17 @@ func (s *BacktestService) calculateCombinedMetrics(results []models.BacktestResu
 		benchmarkReturn += result.BenchmarkReturn
 		alpha += result.Alpha
 		beta += result.Beta
+		trackingError += result.TrackingError
+		informationRatio += result.InformationRatio
 		totalTrades += result.TotalTrades
+		rejectedOrders += result.RejectedOrders
+		combined.TotalCommission += result.TotalCommission
+		combined.TotalStampDuty += result.TotalStampDuty
+		combined.TotalTransferFee += result.TotalTransferFee
+		combined.TotalSlippage += result.TotalSlippage
+		combined.TotalCosts += result.TotalCosts
+		combined.DividendIncome += result.DividendIncome
+		combined.BonusShares += result.BonusShares
 	}
 
 	count := float64(len(results))
@@ -1907,11 +2785,33 @@ func (s *BacktestService) calculateCombinedMetrics(results []models.BacktestResu
 	combined.BenchmarkReturn = benchmarkReturn / count
 	combined.Alpha = alpha / count
 	combined.Beta = beta / count
+	combined.TrackingError = trackingError / count
+	combined.InformationRatio = informationRatio / count
 	combined.TotalTrades = totalTrades
+	combined.RejectedOrders = rejectedOrders
 
 	return combined
 }
 
+// calculateAccountMetrics 按共享资金账户的权益曲线计算组合整体指标
+func (s *BacktestService) calculateAccountMetrics(backtest *models.Backtest, equityCurve []models.EquityPoint, trades []models.Trade) *models.BacktestResult {
+	metrics := &models.PerformanceMetrics{
+		Returns:          equityCurveReturns(equityCurve, func(p models.EquityPoint) float64 { return p.PortfolioValue }),
+		BenchmarkReturns: equityCurveReturns(equityCurve, func(p models.EquityPoint) float64 { return p.BenchmarkValue }),
+		RiskFreeRate:     0.03 / 252,
+		Trades:           trades,
+	}
+
+	combined := metrics.CalculateMetrics()
+	combined.ID = "combined"
+	combined.BacktestID = backtest.ID
+	combined.StrategyID = "combined"
+	combined.StrategyName = "组合账户"
+	combined.RejectedOrders = len(s.backtestRejectedOrders[backtest.ID])
+	combined.CreatedAt = time.Now()
+	return combined
+}
+
 // validateTradesData 验证交易记录数据的完整性
 // 检查卖出记录的持仓资产是否合理（卖出操作不应该导致总持仓资产异常增加）
 func (s *BacktestService) validateTradesData(trades []models.Trade, backtestID string) error {
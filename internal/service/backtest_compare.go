@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidComparison = errors.New("回测对比参数无效")
+
+const (
+	minComparedBacktests = 2
+	maxComparedBacktests = 10
+	normalizedCurveBase  = 100.0
+)
+
+// comparedMetrics 参与差值计算的指标
+var comparedMetrics = []struct {
+	name  string
+	value func(*models.BacktestResult) float64
+}{
+	{"total_return", func(r *models.BacktestResult) float64 { return r.TotalReturn }},
+	{"annual_return", func(r *models.BacktestResult) float64 { return r.AnnualReturn }},
+	{"max_drawdown", func(r *models.BacktestResult) float64 { return r.MaxDrawdown }},
+	{"sharpe_ratio", func(r *models.BacktestResult) float64 { return r.SharpeRatio }},
+	{"sortino_ratio", func(r *models.BacktestResult) float64 { return r.SortinoRatio }},
+	{"win_rate", func(r *models.BacktestResult) float64 { return r.WinRate }},
+	{"profit_factor", func(r *models.BacktestResult) float64 { return r.ProfitFactor }},
+	{"total_trades", func(r *models.BacktestResult) float64 { return float64(r.TotalTrades) }},
+	{"avg_trade_return", func(r *models.BacktestResult) float64 { return r.AvgTradeReturn }},
+	{"alpha", func(r *models.BacktestResult) float64 { return r.Alpha }},
+	{"beta", func(r *models.BacktestResult) float64 { return r.Beta }},
+	{"information_ratio", func(r *models.BacktestResult) float64 { return r.InformationRatio }},
+	{"total_costs", func(r *models.BacktestResult) float64 { return r.TotalCosts }},
+	{"dividend_income", func(r *models.BacktestResult) float64 { return r.DividendIncome }},
+}
+
+// CompareBacktests 对比2-10个已完成的回测，第一个回测作为基准
+func (s *BacktestService) CompareBacktests(ctx context.Context, backtestIDs []string) (*models.BacktestComparison, error) {
+	if len(backtestIDs) < minComparedBacktests || len(backtestIDs) > maxComparedBacktests {
+		return nil, fmt.Errorf("%w: 需要%d-%d个回测ID", ErrInvalidComparison, minComparedBacktests, maxComparedBacktests)
+	}
+	seen := make(map[string]bool, len(backtestIDs))
+	for _, id := range backtestIDs {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: 回测ID %s 重复", ErrInvalidComparison, id)
+		}
+		seen[id] = true
+	}
+
+	results := make([]*models.BacktestResultsResponse, len(backtestIDs))
+	for i, id := range backtestIDs {
+		result, err := s.GetBacktestResults(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("回测 %s: %w", id, err)
+		}
+		results[i] = result
+	}
+
+	comparison := &models.BacktestComparison{BaselineID: backtestIDs[0]}
+	for _, result := range results {
+		comparison.Backtests = append(comparison.Backtests, models.ComparedBacktest{
+			BacktestID: result.BacktestID,
+			Name:       result.BacktestConfig.Name,
+			StartDate:  result.BacktestConfig.StartDate,
+			EndDate:    result.BacktestConfig.EndDate,
+			Metrics:    overallMetrics(result),
+		})
+	}
+	comparison.MetricDeltas = metricDeltas(comparison.Backtests)
+	comparison.Dates, comparison.EquityCurves = alignEquityCurves(results)
+	comparison.Correlation = returnCorrelations(comparison.EquityCurves)
+	comparison.TradeDivergences = tradeDivergences(results, comparison.Dates)
+
+	s.logger.Info("回测对比完成",
+		logger.String("baseline_id", comparison.BaselineID),
+		logger.Int("backtests", len(backtestIDs)),
+		logger.Int("common_days", len(comparison.Dates)),
+		logger.Int("trade_divergences", len(comparison.TradeDivergences)),
+	)
+	return comparison, nil
+}
+
+// overallMetrics 回测的整体指标：多策略时取组合指标，否则取唯一策略的指标
+func overallMetrics(result *models.BacktestResultsResponse) models.BacktestResult {
+	if result.CombinedMetrics != nil {
+		return *result.CombinedMetrics
+	}
+	if len(result.Performance) > 0 {
+		return result.Performance[0]
+	}
+	return models.BacktestResult{BacktestID: result.BacktestID}
+}
+
+// metricDeltas 计算每个回测相对基准（第一个回测）的指标差值
+func metricDeltas(backtests []models.ComparedBacktest) []models.MetricDelta {
+	baseline := &backtests[0].Metrics
+	deltas := make([]models.MetricDelta, 0, len(backtests)-1)
+	for i := 1; i < len(backtests); i++ {
+		delta := models.MetricDelta{BacktestID: backtests[i].BacktestID, Deltas: make(map[string]float64, len(comparedMetrics))}
+		for _, metric := range comparedMetrics {
+			delta.Deltas[metric.name] = metric.value(&backtests[i].Metrics) - metric.value(baseline)
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// alignEquityCurves 取所有回测共有的交易日，把权益曲线归一化为从同一起点出发
+func alignEquityCurves(results []*models.BacktestResultsResponse) ([]string, []models.NormalizedEquityCurve) {
+	values := make([]map[string]float64, len(results))
+	for i, result := range results {
+		values[i] = make(map[string]float64, len(result.EquityCurve))
+		for _, point := range result.EquityCurve {
+			values[i][point.Date] = point.PortfolioValue
+		}
+	}
+
+	var dates []string
+	for _, point := range results[0].EquityCurve {
+		common := true
+		for _, curve := range values[1:] {
+			if _, ok := curve[point.Date]; !ok {
+				common = false
+				break
+			}
+		}
+		if common {
+			dates = append(dates, point.Date)
+		}
+	}
+	sort.Strings(dates)
+
+	curves := make([]models.NormalizedEquityCurve, len(results))
+	for i, result := range results {
+		curves[i] = models.NormalizedEquityCurve{BacktestID: result.BacktestID, Values: make([]float64, len(dates))}
+		if len(dates) == 0 {
+			continue
+		}
+		base := values[i][dates[0]]
+		for j, date := range dates {
+			if base > 0 {
+				curves[i].Values[j] = values[i][date] / base * normalizedCurveBase
+			}
+		}
+	}
+	return dates, curves
+}
+
+// returnCorrelations 计算对齐后各权益曲线日收益率的相关系数矩阵
+func returnCorrelations(curves []models.NormalizedEquityCurve) [][]float64 {
+	returns := make([][]float64, len(curves))
+	for i, curve := range curves {
+		for j := 1; j < len(curve.Values); j++ {
+			if curve.Values[j-1] > 0 {
+				returns[i] = append(returns[i], curve.Values[j]/curve.Values[j-1]-1)
+			} else {
+				returns[i] = append(returns[i], 0)
+			}
+		}
+	}
+
+	matrix := make([][]float64, len(curves))
+	for i := range matrix {
+		matrix[i] = make([]float64, len(curves))
+		for j := range matrix[i] {
+			if i == j {
+				matrix[i][j] = 1
+			} else if j < i {
+				matrix[i][j] = matrix[j][i]
+			} else {
+				matrix[i][j] = pearsonCorrelation(returns[i], returns[j])
+			}
+		}
+	}
+	return matrix
+}
+
+// pearsonCorrelation 皮尔逊相关系数，任一序列无波动时返回0
+func pearsonCorrelation(x, y []float64) float64 {
+	n := minInt(len(x), len(y))
+	if n < 2 {
+		return 0
+	}
+	var meanX, meanY float64
+	for i := 0; i < n; i++ {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var cov, varX, varY float64
+	for i := 0; i < n; i++ {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// tradeDivergences 找出各回测在同一日期、同一股票上交易动作不一致的地方
+// 只比较共有交易日内的交易；没有共有交易日时比较全部交易
+func tradeDivergences(results []*models.BacktestResultsResponse, dates []string) []models.TradeDivergence {
+	inRange := make(map[string]bool, len(dates))
+	for _, date := range dates {
+		inRange[date] = true
+	}
+
+	type tradeKey struct{ date, symbol string }
+	actions := make(map[tradeKey][]map[models.TradeSide]bool)
+	for i, result := range results {
+		for _, trade := range result.Trades {
+			key := tradeKey{date: trade.Timestamp.Format("2006-01-02"), symbol: trade.Symbol}
+			if len(dates) > 0 && !inRange[key.date] {
+				continue
+			}
+			if actions[key] == nil {
+				actions[key] = make([]map[models.TradeSide]bool, len(results))
+			}
+			if actions[key][i] == nil {
+				actions[key][i] = make(map[models.TradeSide]bool)
+			}
+			actions[key][i][trade.Side] = true
+		}
+	}
+
+	var divergences []models.TradeDivergence
+	for key, sides := range actions {
+		labels := make([]string, len(results))
+		for i, side := range sides {
+			labels[i] = tradeActionLabel(side)
+		}
+		diverged := false
+		for _, label := range labels[1:] {
+			if label != labels[0] {
+				diverged = true
+				break
+			}
+		}
+		if !diverged {
+			continue
+		}
+
+		divergence := models.TradeDivergence{Date: key.date, Symbol: key.symbol, Actions: make(map[string]string, len(results))}
+		for i, result := range results {
+			divergence.Actions[result.BacktestID] = labels[i]
+		}
+		divergences = append(divergences, divergence)
+	}
+
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].Date != divergences[j].Date {
+			return divergences[i].Date < divergences[j].Date
+		}
+		return divergences[i].Symbol < divergences[j].Symbol
+	})
+	return divergences
+}
+
+// tradeActionLabel 某回测某日某股票的交易动作：buy、sell、buy+sell（多策略同日反向交易）或 none
+func tradeActionLabel(sides map[models.TradeSide]bool) string {
+	var labels []string
+	for _, side := range []models.TradeSide{models.TradeSideBuy, models.TradeSideSell} {
+		if sides[side] {
+			labels = append(labels, string(side))
+		}
+	}
+	if len(labels) == 0 {
+		return "none"
+	}
+	return strings.Join(labels, "+")
+}
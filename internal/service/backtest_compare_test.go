@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// addComparedBacktest 以 bt1 为模板添加一个回测：权益曲线从第10天开始、净值翻倍，并修改部分交易
+func addComparedBacktest(service *BacktestService, id string) {
+	source := *service.backtests["bt1"]
+	source.ID = id
+	service.backtests[id] = &source
+
+	var curve []models.EquityPoint
+	for _, point := range service.backtestEquityCurves["bt1"][10:] {
+		point.PortfolioValue *= 2
+		curve = append(curve, point)
+	}
+	service.backtestEquityCurves[id] = curve
+	service.backtestStrategyEquityCurves[id] = map[string][]models.EquityPoint{"s1": curve}
+
+	trades := append([]models.Trade(nil), service.backtestTrades["bt1"]...)
+	trades[len(trades)-1].Side = models.TradeSideSell
+	service.backtestTrades[id] = trades
+
+	result := *service.backtestResults["bt1"]
+	result.BacktestID = id
+	result.TotalReturn = 0.08
+	result.TotalTrades = 10
+	service.backtestResults[id] = &result
+	service.backtestMultiResults[id] = []models.BacktestResult{result}
+}
+
+func TestCompareBacktests(t *testing.T) {
+	service := newReportTestService()
+	addComparedBacktest(service, "bt3")
+
+	comparison, err := service.CompareBacktests(context.Background(), []string{"bt1", "bt3"})
+	if err != nil {
+		t.Fatalf("回测对比失败: %v", err)
+	}
+
+	if comparison.BaselineID != "bt1" || len(comparison.MetricDeltas) != 1 {
+		t.Fatalf("对比结果结构错误: %+v", comparison)
+	}
+	deltas := comparison.MetricDeltas[0].Deltas
+	if math.Abs(deltas["total_return"]-0.03) > 1e-9 || deltas["total_trades"] != -2 {
+		t.Errorf("指标差值错误: %v", deltas)
+	}
+
+	// 共同日期从 bt3 的第一天开始，两条曲线都归一化到100，且走势相同
+	if len(comparison.Dates) != 50 || comparison.Dates[0] != service.backtestEquityCurves["bt3"][0].Date {
+		t.Fatalf("共同日期轴错误: %d 天, 起点 %v", len(comparison.Dates), comparison.Dates[0])
+	}
+	for _, curve := range comparison.EquityCurves {
+		if curve.Values[0] != 100 || len(curve.Values) != len(comparison.Dates) {
+			t.Errorf("%s 曲线未归一化: %v", curve.BacktestID, curve.Values[:3])
+		}
+	}
+	last := len(comparison.Dates) - 1
+	if math.Abs(comparison.EquityCurves[0].Values[last]-comparison.EquityCurves[1].Values[last]) > 1e-9 {
+		t.Error("净值等比例放大的曲线归一化后应相同")
+	}
+	if math.Abs(comparison.Correlation[0][1]-1) > 1e-9 || comparison.Correlation[1][0] != comparison.Correlation[0][1] {
+		t.Errorf("相关系数矩阵错误: %v", comparison.Correlation)
+	}
+
+	// 最后一笔交易方向不同
+	if len(comparison.TradeDivergences) != 1 {
+		t.Fatalf("应有1处交易分歧, 实际 %+v", comparison.TradeDivergences)
+	}
+	divergence := comparison.TradeDivergences[0]
+	if divergence.Date != time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC).Format("2006-01-02") ||
+		divergence.Actions["bt1"] != "buy" || divergence.Actions["bt3"] != "sell" {
+		t.Errorf("交易分歧错误: %+v", divergence)
+	}
+}
+
+func TestCompareBacktests_Errors(t *testing.T) {
+	service := newReportTestService()
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		ids       []string
+		wantError error
+	}{
+		{"回测数量不足", []string{"bt1"}, ErrInvalidComparison},
+		{"回测ID重复", []string{"bt1", "bt1"}, ErrInvalidComparison},
+		{"回测不存在", []string{"bt1", "missing"}, ErrBacktestNotFound},
+		{"回测未完成", []string{"bt1", "bt2"}, ErrBacktestNotCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CompareBacktests(ctx, tt.ids); !errors.Is(err, tt.wantError) {
+				t.Errorf("期望错误 %v, 实际 %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestPearsonCorrelation(t *testing.T) {
+	x := []float64{0.01, -0.02, 0.03, 0.00}
+	if got := pearsonCorrelation(x, []float64{-0.01, 0.02, -0.03, 0.00}); math.Abs(got+1) > 1e-9 {
+		t.Errorf("完全负相关应为-1, 实际 %v", got)
+	}
+	if got := pearsonCorrelation(x, []float64{0, 0, 0, 0}); got != 0 {
+		t.Errorf("无波动序列的相关系数应为0, 实际 %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"stock-a-future/internal/models"
+)
+
+// backtestLiveRun 运行中回测已产生的成交和组合权益，供中途订阅的客户端获取当前状态
+type backtestLiveRun struct {
+	trades      []models.Trade
+	equityCurve []models.EquityPoint
+}
+
+// SubscribeBacktest 订阅回测的进度、状态、成交和权益事件
+// 第一个事件为当前状态快照；回测结束后通道关闭，已结束的回测只推送快照
+func (s *BacktestService) SubscribeBacktest(backtestID string) (<-chan models.ProgressEvent, func(), error) {
+	if err := s.ensureRunDataLoaded(backtestID); err != nil {
+		return nil, nil, err
+	}
+
+	// 持有读锁期间不会有新事件发布，保证快照与后续事件之间不重不漏
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	backtest, exists := s.backtests[backtestID]
+	if !exists {
+		return nil, nil, ErrBacktestNotFound
+	}
+
+	snapshot := &models.BacktestSnapshot{Progress: s.backtestProgressLocked(backtest)}
+	if live, ok := s.liveRuns[backtestID]; ok {
+		snapshot.Trades = append([]models.Trade(nil), live.trades...)
+		snapshot.EquityCurve = append([]models.EquityPoint(nil), live.equityCurve...)
+	} else {
+		snapshot.Trades = s.backtestTrades[backtestID]
+		snapshot.EquityCurve = s.backtestEquityCurves[backtestID]
+	}
+
+	events, cancel := s.events.subscribe(backtestID, models.ProgressEvent{Type: models.ProgressEventSnapshot, Data: snapshot}, backtestFinished(backtest.Status))
+	return events, cancel, nil
+}
+
+// backtestFinished 回测是否已结束
+func backtestFinished(status models.BacktestStatus) bool {
+	return status == models.BacktestStatusCompleted || status == models.BacktestStatusFailed || status == models.BacktestStatusCancelled
+}
+
+// publishProgressLocked 推送回测的当前进度，调用方需持有写锁
+func (s *BacktestService) publishProgressLocked(backtestID string, eventType models.ProgressEventType) {
+	backtest, exists := s.backtests[backtestID]
+	if !exists {
+		return
+	}
+	s.events.publish(backtestID, models.ProgressEvent{Type: eventType, Data: s.backtestProgressLocked(backtest)})
+
+	if eventType == models.ProgressEventStatus && backtestFinished(backtest.Status) {
+		delete(s.liveRuns, backtestID)
+		s.events.closeJob(backtestID)
+	}
+}
+
+// recordLiveTrade 记录并推送运行中回测的新成交
+func (s *BacktestService) recordLiveTrade(backtestID string, trade models.Trade) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if live, ok := s.liveRuns[backtestID]; ok {
+		live.trades = append(live.trades, trade)
+	}
+	s.events.publish(backtestID, models.ProgressEvent{Type: models.ProgressEventTrade, Data: trade})
+}
+
+// recordLiveEquity 记录并推送运行中回测的新组合权益点
+func (s *BacktestService) recordLiveEquity(backtestID string, point models.EquityPoint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if live, ok := s.liveRuns[backtestID]; ok {
+		live.equityCurve = append(live.equityCurve, point)
+	}
+	s.events.publish(backtestID, models.ProgressEvent{Type: models.ProgressEventEquity, Data: point})
+}
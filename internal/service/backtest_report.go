@@ -0,0 +1,654 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrUnsupportedReportFormat = errors.New("不支持的报告格式")
+
+// 回测报告格式
+const (
+	ReportFormatExcel = "xlsx"
+	ReportFormatHTML  = "html"
+)
+
+// BacktestReport 导出的回测报告文件
+type BacktestReport struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// reportPosition 回测结束时的未平仓持仓
+type reportPosition struct {
+	StrategyID string
+	Symbol     string
+	Quantity   int
+	AvgPrice   float64
+	OpenedAt   time.Time
+}
+
+// Cost 持仓的买入成本
+func (p reportPosition) Cost() float64 {
+	return p.AvgPrice * float64(p.Quantity)
+}
+
+// monthlyReturnRow 月度收益矩阵的一行（一个自然年）
+type monthlyReturnRow struct {
+	Year   int
+	Months [12]monthlyReturn
+	Annual float64
+}
+
+// monthlyReturn 单月收益，回测区间外的月份 Valid 为false
+type monthlyReturn struct {
+	Return float64
+	Valid  bool
+}
+
+// ExportBacktestReport 将已完成回测的结果导出为 Excel 工作簿或单文件 HTML 报告
+func (s *BacktestService) ExportBacktestReport(ctx context.Context, backtestID, format string) (*BacktestReport, error) {
+	if format != ReportFormatExcel && format != ReportFormatHTML {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedReportFormat, format)
+	}
+
+	results, err := s.GetBacktestResults(ctx, backtestID)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("backtest_%s_%s.%s", backtestID, time.Now().Format("20060102"), format)
+	if format == ReportFormatHTML {
+		data, err := renderHTMLReport(results)
+		if err != nil {
+			return nil, err
+		}
+		return &BacktestReport{Filename: filename, ContentType: "text/html; charset=utf-8", Data: data}, nil
+	}
+
+	data, err := renderExcelReport(results)
+	if err != nil {
+		return nil, err
+	}
+	return &BacktestReport{
+		Filename:    filename,
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Data:        data,
+	}, nil
+}
+
+// reportMetrics 报告中展示的策略指标，多策略时最后一行为组合整体指标
+func reportMetrics(results *models.BacktestResultsResponse) []models.BacktestResult {
+	names := make(map[string]string, len(results.Strategies))
+	for _, strategy := range results.Strategies {
+		if strategy != nil {
+			names[strategy.ID] = strategy.Name
+		}
+	}
+
+	metrics := make([]models.BacktestResult, 0, len(results.Performance)+1)
+	for _, metric := range results.Performance {
+		if metric.StrategyName == "" {
+			metric.StrategyName = names[metric.StrategyID]
+		}
+		metrics = append(metrics, metric)
+	}
+	if results.CombinedMetrics != nil {
+		combined := *results.CombinedMetrics
+		if combined.StrategyName == "" {
+			combined.StrategyName = "组合"
+		}
+		metrics = append(metrics, combined)
+	}
+	return metrics
+}
+
+// reportConfigRows 回测配置的键值对
+func reportConfigRows(results *models.BacktestResultsResponse) [][2]string {
+	config := results.BacktestConfig
+	rows := [][2]string{
+		{"回测ID", results.BacktestID},
+		{"回测名称", config.Name},
+		{"开始日期", config.StartDate},
+		{"结束日期", config.EndDate},
+		{"初始资金", fmt.Sprintf("%.2f", config.InitialCash)},
+		{"股票", strings.Join(config.Symbols, ", ")},
+		{"佣金费率", fmt.Sprintf("%.4f%%", config.Commission*100)},
+		{"基准", config.Benchmark},
+		{"交易规则", map[bool]string{true: "关闭", false: "开启"}[config.DisableTradingRules]},
+		{"创建时间", config.CreatedAt},
+	}
+	if config.PositionSizing != nil {
+		rows = append(rows, [2]string{"仓位管理", string(config.PositionSizing.Method)})
+	}
+	if config.Execution != nil && config.Execution.Timing != "" {
+		rows = append(rows, [2]string{"成交时机", string(config.Execution.Timing)})
+	}
+	if config.Portfolio != nil && config.Portfolio.Mode != "" {
+		rows = append(rows, [2]string{"资金模式", string(config.Portfolio.Mode)})
+	}
+	if config.Universe != nil {
+		rows = append(rows, [2]string{"股票池", describeUniverse(config.Universe)})
+	}
+	if config.PriceAdjust == models.PriceAdjustNone {
+		rows = append(rows, [2]string{"复权方式", "不复权（计入分红送转）"})
+	}
+	for _, warning := range config.Warnings {
+		rows = append(rows, [2]string{"警告", warning})
+	}
+	for _, strategy := range results.Strategies {
+		if strategy != nil {
+			rows = append(rows, [2]string{"策略", fmt.Sprintf("%s (%s)", strategy.Name, strategy.ID)})
+		}
+	}
+	return rows
+}
+
+// openPositions 回测结束时各策略仍未平仓的持仓
+// 使用回测引擎记录的持仓，其中包含不复权回测的送转股和除权后的成本价；
+// 没有记录持仓的策略（引入该记录之前完成的回测）回放交易记录得到
+func openPositions(results *models.BacktestResultsResponse) []reportPosition {
+	var positions []reportPosition
+	recorded := make(map[string]bool)
+	for _, result := range results.Performance {
+		if result.OpenPositions == nil {
+			continue
+		}
+		recorded[result.StrategyID] = true
+		for _, position := range result.OpenPositions {
+			positions = append(positions, reportPosition{
+				StrategyID: result.StrategyID,
+				Symbol:     position.Symbol,
+				Quantity:   position.Quantity,
+				AvgPrice:   position.AvgPrice,
+				OpenedAt:   position.Timestamp,
+			})
+		}
+	}
+
+	var trades []models.Trade
+	for _, trade := range results.Trades {
+		if !recorded[trade.StrategyID] {
+			trades = append(trades, trade)
+		}
+	}
+	return append(positions, replayOpenPositions(trades)...)
+}
+
+// replayOpenPositions 回放交易记录，得到各策略仍未平仓的持仓及平均买入价，不包含分红送转的调整
+func replayOpenPositions(trades []models.Trade) []reportPosition {
+	positions := make(map[string]*reportPosition)
+	var keys []string
+	for _, trade := range trades {
+		key := trade.StrategyID + "|" + trade.Symbol
+		position, ok := positions[key]
+		if !ok {
+			position = &reportPosition{StrategyID: trade.StrategyID, Symbol: trade.Symbol}
+			positions[key] = position
+			keys = append(keys, key)
+		}
+
+		switch trade.Side {
+		case models.TradeSideBuy:
+			if trade.Quantity <= 0 {
+				continue
+			}
+			if position.Quantity == 0 {
+				position.OpenedAt = trade.Timestamp
+			}
+			cost := position.AvgPrice*float64(position.Quantity) + trade.Price*float64(trade.Quantity)
+			position.Quantity += trade.Quantity
+			position.AvgPrice = cost / float64(position.Quantity)
+		case models.TradeSideSell:
+			position.Quantity -= trade.Quantity
+			if position.Quantity <= 0 {
+				position.Quantity = 0
+				position.AvgPrice = 0
+			}
+		}
+	}
+
+	var result []reportPosition
+	for _, key := range keys {
+		if positions[key].Quantity > 0 {
+			result = append(result, *positions[key])
+		}
+	}
+	return result
+}
+
+// monthlyReturns 按自然月计算权益曲线的收益率，首月以初始资金为基准，其余月份以上月末净值为基准
+func monthlyReturns(curve []models.EquityPoint, initialCash float64) []monthlyReturnRow {
+	type monthEnd struct {
+		year  int
+		month time.Month
+		value float64
+	}
+	var ends []monthEnd
+	for _, point := range curve {
+		date, err := time.Parse("2006-01-02", point.Date)
+		if err != nil {
+			continue
+		}
+		if n := len(ends); n > 0 && ends[n-1].year == date.Year() && ends[n-1].month == date.Month() {
+			ends[n-1].value = point.PortfolioValue
+			continue
+		}
+		ends = append(ends, monthEnd{year: date.Year(), month: date.Month(), value: point.PortfolioValue})
+	}
+
+	var rows []monthlyReturnRow
+	base := initialCash
+	yearBase := initialCash
+	for _, end := range ends {
+		if len(rows) == 0 || rows[len(rows)-1].Year != end.year {
+			rows = append(rows, monthlyReturnRow{Year: end.year})
+			yearBase = base
+		}
+		row := &rows[len(rows)-1]
+		if base > 0 {
+			row.Months[end.month-1] = monthlyReturn{Return: end.value/base - 1, Valid: true}
+		}
+		if yearBase > 0 {
+			row.Annual = end.value/yearBase - 1
+		}
+		base = end.value
+	}
+	return rows
+}
+
+// drawdownSeries 权益曲线每日相对历史高点的回撤（负数）
+func drawdownSeries(curve []models.EquityPoint) []float64 {
+	drawdowns := make([]float64, len(curve))
+	peak := 0.0
+	for i, point := range curve {
+		peak = math.Max(peak, point.PortfolioValue)
+		if peak > 0 {
+			drawdowns[i] = point.PortfolioValue/peak - 1
+		}
+	}
+	return drawdowns
+}
+
+// ==================== Excel ====================
+
+const (
+	sheetConfig    = "回测配置"
+	sheetMetrics   = "策略指标"
+	sheetTrades    = "交易记录"
+	sheetPositions = "持仓"
+	sheetEquity    = "权益曲线"
+	sheetMonthly   = "月度收益"
+)
+
+// renderExcelReport 生成包含配置、指标、交易、持仓、权益曲线和月度收益的工作簿
+func renderExcelReport(results *models.BacktestResultsResponse) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", sheetConfig); err != nil {
+		return nil, err
+	}
+	for _, sheet := range []string{sheetMetrics, sheetTrades, sheetPositions, sheetEquity, sheetMonthly} {
+		if _, err := f.NewSheet(sheet); err != nil {
+			return nil, err
+		}
+	}
+
+	percentStyle, err := f.NewStyle(&excelize.Style{NumFmt: 10})
+	if err != nil {
+		return nil, err
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	sheets := []struct {
+		name    string
+		header  []interface{}
+		rows    [][]interface{}
+		percent []string // 百分比格式的列
+	}{
+		{sheetConfig, []interface{}{"项目", "值"}, excelConfigRows(results), nil},
+		{sheetMetrics, excelMetricsHeader, excelMetricsRows(results), []string{"C", "D", "E", "H", "K", "L", "M"}},
+		{sheetTrades, excelTradesHeader, excelTradesRows(results.Trades), nil},
+		{sheetPositions, []interface{}{"策略ID", "股票", "数量", "平均买入价", "买入成本", "建仓日期"}, excelPositionRows(results), nil},
+		{sheetEquity, []interface{}{"日期", "组合净值", "基准净值", "现金", "持仓市值", "回撤"}, excelEquityRows(results.EquityCurve), []string{"F"}},
+		{sheetMonthly, excelMonthlyHeader(), excelMonthlyRows(results), []string{"B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N"}},
+	}
+	for _, sheet := range sheets {
+		for _, col := range sheet.percent {
+			if err := f.SetColStyle(sheet.name, col, percentStyle); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeExcelSheet(f, sheet.name, sheet.header, sheet.rows, headerStyle); err != nil {
+			return nil, fmt.Errorf("写入工作表 %s 失败: %w", sheet.name, err)
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("生成Excel报告失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeExcelSheet 写入表头和数据行
+func writeExcelSheet(f *excelize.File, sheet string, header []interface{}, rows [][]interface{}, headerStyle int) error {
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	lastCol, err := excelize.ColumnNumberToName(len(header))
+	if err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, "A1", lastCol+"1", headerStyle); err != nil {
+		return err
+	}
+	for i := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, cell, &rows[i]); err != nil {
+			return err
+		}
+	}
+	return f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+}
+
+func excelConfigRows(results *models.BacktestResultsResponse) [][]interface{} {
+	var rows [][]interface{}
+	for _, row := range reportConfigRows(results) {
+		rows = append(rows, []interface{}{row[0], row[1]})
+	}
+	return rows
+}
+
+var excelMetricsHeader = []interface{}{
+	"策略ID", "策略名称", "总收益率", "年化收益率", "最大回撤", "夏普比率", "索提诺比率", "胜率", "盈亏比",
+	"交易次数", "平均交易收益", "基准收益", "Alpha", "Beta", "信息比率", "被拒订单", "交易成本", "分红收入",
+}
+
+func excelMetricsRows(results *models.BacktestResultsResponse) [][]interface{} {
+	var rows [][]interface{}
+	for _, m := range reportMetrics(results) {
+		rows = append(rows, []interface{}{
+			m.StrategyID, m.StrategyName, m.TotalReturn, m.AnnualReturn, m.MaxDrawdown, m.SharpeRatio, m.SortinoRatio, m.WinRate, m.ProfitFactor,
+			m.TotalTrades, m.AvgTradeReturn, m.BenchmarkReturn, m.Alpha, m.Beta, m.InformationRatio, m.RejectedOrders, m.TotalCosts, m.DividendIncome,
+		})
+	}
+	return rows
+}
+
+var excelTradesHeader = []interface{}{
+	"时间", "策略ID", "股票", "方向", "数量", "价格", "佣金", "印花税", "过户费", "滑点成本", "盈亏", "信号", "交易后总资产", "交易后现金",
+}
+
+func excelTradesRows(trades []models.Trade) [][]interface{} {
+	rows := make([][]interface{}, 0, len(trades))
+	for _, t := range trades {
+		rows = append(rows, []interface{}{
+			t.Timestamp.Format("2006-01-02"), t.StrategyID, t.Symbol, string(t.Side), t.Quantity, t.Price,
+			t.Commission, t.StampDuty, t.TransferFee, t.SlippageCost, t.PnL, t.SignalType, t.TotalAssets, t.CashBalance,
+		})
+	}
+	return rows
+}
+
+func excelPositionRows(results *models.BacktestResultsResponse) [][]interface{} {
+	var rows [][]interface{}
+	for _, p := range openPositions(results) {
+		rows = append(rows, []interface{}{
+			p.StrategyID, p.Symbol, p.Quantity, p.AvgPrice, p.Cost(), p.OpenedAt.Format("2006-01-02"),
+		})
+	}
+	return rows
+}
+
+func excelEquityRows(curve []models.EquityPoint) [][]interface{} {
+	drawdowns := drawdownSeries(curve)
+	rows := make([][]interface{}, 0, len(curve))
+	for i, p := range curve {
+		rows = append(rows, []interface{}{p.Date, p.PortfolioValue, p.BenchmarkValue, p.Cash, p.Holdings, drawdowns[i]})
+	}
+	return rows
+}
+
+func excelMonthlyHeader() []interface{} {
+	header := []interface{}{"年份"}
+	for month := 1; month <= 12; month++ {
+		header = append(header, fmt.Sprintf("%d月", month))
+	}
+	return append(header, "全年")
+}
+
+func excelMonthlyRows(results *models.BacktestResultsResponse) [][]interface{} {
+	var rows [][]interface{}
+	for _, row := range monthlyReturns(results.EquityCurve, results.BacktestConfig.InitialCash) {
+		cells := []interface{}{row.Year}
+		for _, month := range row.Months {
+			if month.Valid {
+				cells = append(cells, month.Return)
+			} else {
+				cells = append(cells, nil)
+			}
+		}
+		rows = append(rows, append(cells, row.Annual))
+	}
+	return rows
+}
+
+// ==================== HTML ====================
+
+const (
+	chartWidth  = 960
+	chartHeight = 260
+)
+
+// svgLine 图表中的一条折线
+type svgLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// svgChart 内嵌到 HTML 报告中的 SVG 折线图
+type svgChart struct {
+	Title    string
+	Width    int
+	Height   int
+	Lines    []svgLine
+	MaxLabel string
+	MinLabel string
+	Start    string
+	End      string
+}
+
+// buildSVGChart 将多条序列按同一纵轴缩放为折线坐标
+func buildSVGChart(title string, dates []string, series []svgLine, values [][]float64, format func(float64) string) *svgChart {
+	if len(dates) < 2 {
+		return nil
+	}
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, vs := range values {
+		for _, v := range vs {
+			minValue = math.Min(minValue, v)
+			maxValue = math.Max(maxValue, v)
+		}
+	}
+	if maxValue == minValue {
+		maxValue = minValue + 1
+	}
+
+	chart := &svgChart{
+		Title:    title,
+		Width:    chartWidth,
+		Height:   chartHeight,
+		MaxLabel: format(maxValue),
+		MinLabel: format(minValue),
+		Start:    dates[0],
+		End:      dates[len(dates)-1],
+	}
+	for i, line := range series {
+		var points strings.Builder
+		for j, v := range values[i] {
+			x := float64(j) / float64(len(values[i])-1) * chartWidth
+			y := (maxValue - v) / (maxValue - minValue) * chartHeight
+			fmt.Fprintf(&points, "%.1f,%.1f ", x, y)
+		}
+		line.Points = strings.TrimSpace(points.String())
+		chart.Lines = append(chart.Lines, line)
+	}
+	return chart
+}
+
+// htmlReportData HTML 报告模板数据
+type htmlReportData struct {
+	Title          string
+	GeneratedAt    string
+	Config         [][2]string
+	Metrics        []models.BacktestResult
+	EquityChart    *svgChart
+	DrawdownChart  *svgChart
+	Monthly        []monthlyReturnRow
+	Positions      []reportPosition
+	Trades         []models.Trade
+	RejectedOrders int
+}
+
+// renderHTMLReport 生成不依赖外部资源的单文件 HTML 报告，图表以内联 SVG 绘制
+func renderHTMLReport(results *models.BacktestResultsResponse) ([]byte, error) {
+	curve := results.EquityCurve
+	dates := make([]string, len(curve))
+	portfolio := make([]float64, len(curve))
+	benchmark := make([]float64, len(curve))
+	hasBenchmark := false
+	for i, point := range curve {
+		dates[i] = point.Date
+		portfolio[i] = point.PortfolioValue
+		benchmark[i] = point.BenchmarkValue
+		hasBenchmark = hasBenchmark || point.BenchmarkValue > 0
+	}
+
+	money := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	equityLines := []svgLine{{Name: "组合净值", Color: "#1f77b4"}}
+	equityValues := [][]float64{portfolio}
+	if hasBenchmark {
+		equityLines = append(equityLines, svgLine{Name: "基准", Color: "#ff7f0e"})
+		equityValues = append(equityValues, benchmark)
+	}
+
+	data := htmlReportData{
+		Title:          results.BacktestConfig.Name,
+		GeneratedAt:    time.Now().Format("2006-01-02 15:04:05"),
+		Config:         reportConfigRows(results),
+		Metrics:        reportMetrics(results),
+		EquityChart:    buildSVGChart("权益曲线", dates, equityLines, equityValues, money),
+		DrawdownChart:  buildSVGChart("回撤", dates, []svgLine{{Name: "回撤", Color: "#d62728"}}, [][]float64{drawdownSeries(curve)}, formatPercent),
+		Monthly:        monthlyReturns(curve, results.BacktestConfig.InitialCash),
+		Positions:      openPositions(results),
+		Trades:         append([]models.Trade(nil), results.Trades...),
+		RejectedOrders: len(results.RejectedOrders),
+	}
+	sort.SliceStable(data.Trades, func(i, j int) bool { return data.Trades[i].Timestamp.Before(data.Trades[j].Timestamp) })
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("生成HTML报告失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatPercent(v float64) string {
+	return fmt.Sprintf("%.2f%%", v*100)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct":   formatPercent,
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"ratio": func(v float64) string { return fmt.Sprintf("%.3f", v) },
+	"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+	"cls": func(v float64) string {
+		if v > 0 {
+			return "up"
+		}
+		if v < 0 {
+			return "down"
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>回测报告 - {{.Title}}</title>
+<style>
+body{font-family:-apple-system,"Microsoft YaHei",sans-serif;margin:24px auto;max-width:1040px;color:#222}
+h1{font-size:22px}h2{font-size:17px;margin-top:32px;border-bottom:1px solid #ddd;padding-bottom:4px}
+table{border-collapse:collapse;width:100%;font-size:13px}
+th,td{border:1px solid #e3e3e3;padding:4px 6px;text-align:right}
+th{background:#f5f5f5}td:first-child,th:first-child{text-align:left}
+.up{color:#c0392b}.down{color:#27ae60}.muted{color:#888;font-size:12px}
+svg{background:#fafafa;border:1px solid #eee}
+.legend span{display:inline-block;margin-right:16px;font-size:12px}
+</style>
+</head>
+<body>
+<h1>回测报告 - {{.Title}}</h1>
+<p class="muted">生成时间：{{.GeneratedAt}}</p>
+
+<h2>回测配置</h2>
+<table>{{range .Config}}<tr><th>{{index . 0}}</th><td style="text-align:left">{{index . 1}}</td></tr>{{end}}</table>
+
+<h2>策略指标</h2>
+<table>
+<tr><th>策略</th><th>总收益率</th><th>年化收益率</th><th>最大回撤</th><th>夏普比率</th><th>索提诺比率</th><th>胜率</th><th>盈亏比</th><th>交易次数</th><th>基准收益</th><th>Alpha</th><th>Beta</th><th>交易成本</th><th>分红收入</th></tr>
+{{range .Metrics}}<tr><td>{{.StrategyName}} <span class="muted">{{.StrategyID}}</span></td><td class="{{cls .TotalReturn}}">{{pct .TotalReturn}}</td><td class="{{cls .AnnualReturn}}">{{pct .AnnualReturn}}</td><td>{{pct .MaxDrawdown}}</td><td>{{ratio .SharpeRatio}}</td><td>{{ratio .SortinoRatio}}</td><td>{{pct .WinRate}}</td><td>{{ratio .ProfitFactor}}</td><td>{{.TotalTrades}}</td><td>{{pct .BenchmarkReturn}}</td><td>{{pct .Alpha}}</td><td>{{ratio .Beta}}</td><td>{{money .TotalCosts}}</td><td>{{money .DividendIncome}}</td></tr>
+{{end}}</table>
+{{if .RejectedOrders}}<p class="muted">被交易规则拒绝的订单：{{.RejectedOrders}} 笔</p>{{end}}
+
+{{with .EquityChart}}{{template "chart" .}}{{end}}
+{{with .DrawdownChart}}{{template "chart" .}}{{end}}
+
+<h2>月度收益</h2>
+<table>
+<tr><th>年份</th><th>1月</th><th>2月</th><th>3月</th><th>4月</th><th>5月</th><th>6月</th><th>7月</th><th>8月</th><th>9月</th><th>10月</th><th>11月</th><th>12月</th><th>全年</th></tr>
+{{range .Monthly}}<tr><td>{{.Year}}</td>{{range .Months}}{{if .Valid}}<td class="{{cls .Return}}">{{pct .Return}}</td>{{else}}<td></td>{{end}}{{end}}<td class="{{cls .Annual}}"><b>{{pct .Annual}}</b></td></tr>
+{{end}}</table>
+
+<h2>期末持仓</h2>
+{{if .Positions}}<table>
+<tr><th>策略ID</th><th>股票</th><th>数量</th><th>平均买入价</th><th>买入成本</th><th>建仓日期</th></tr>
+{{range .Positions}}<tr><td>{{.StrategyID}}</td><td>{{.Symbol}}</td><td>{{.Quantity}}</td><td>{{money .AvgPrice}}</td><td>{{money .Cost}}</td><td>{{date .OpenedAt}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">回测结束时无持仓</p>{{end}}
+
+<h2>交易记录（{{len .Trades}} 笔）</h2>
+<table>
+<tr><th>日期</th><th>策略ID</th><th>股票</th><th>方向</th><th>数量</th><th>价格</th><th>交易成本</th><th>盈亏</th><th>信号</th></tr>
+{{range .Trades}}<tr><td>{{date .Timestamp}}</td><td>{{.StrategyID}}</td><td>{{.Symbol}}</td><td>{{.Side}}</td><td>{{.Quantity}}</td><td>{{money .Price}}</td><td>{{money .TotalCost}}</td><td class="{{cls .PnL}}">{{money .PnL}}</td><td>{{.SignalType}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+{{define "chart"}}
+<h2>{{.Title}}</h2>
+<div class="legend">{{range .Lines}}<span style="color:{{.Color}}">■ {{.Name}}</span>{{end}}<span class="muted">最高 {{.MaxLabel}} / 最低 {{.MinLabel}}</span></div>
+<svg viewBox="0 0 {{.Width}} {{.Height}}" width="100%" preserveAspectRatio="none" xmlns="http://www.w3.org/2000/svg">
+{{range .Lines}}<polyline fill="none" stroke="{{.Color}}" stroke-width="1.5" vector-effect="non-scaling-stroke" points="{{.Points}}"/>{{end}}
+</svg>
+<div class="muted" style="display:flex;justify-content:space-between"><span>{{.Start}}</span><span>{{.End}}</span></div>
+{{end}}`))
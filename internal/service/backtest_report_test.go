@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"stock-a-future/internal/models"
+)
+
+// newReportTestService 在蒙特卡洛测试数据的基础上补充回测结果，使 GetBacktestResults 可用
+func newReportTestService() *BacktestService {
+	service := newMonteCarloTestService()
+	backtest := service.backtests["bt1"]
+	backtest.Name = "报告测试"
+	backtest.StrategyIDs = []string{"s1"}
+	backtest.Symbols = []string{"000001.SZ"}
+	backtest.StartDate = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	backtest.EndDate = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	result := models.BacktestResult{BacktestID: "bt1", StrategyID: "s1", TotalReturn: 0.05, TotalTrades: 12}
+	service.backtestResults["bt1"] = &result
+	service.backtestMultiResults["bt1"] = []models.BacktestResult{result}
+
+	// 增加一笔未平仓的买入
+	service.backtestTrades["bt1"] = append(service.backtestTrades["bt1"], models.Trade{
+		ID: "open", StrategyID: "s1", Symbol: "000001.SZ", Side: models.TradeSideBuy, Quantity: 200, Price: 12.5,
+		Timestamp: time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+	})
+	return service
+}
+
+func TestExportBacktestReport_Excel(t *testing.T) {
+	service := newReportTestService()
+
+	report, err := service.ExportBacktestReport(context.Background(), "bt1", ReportFormatExcel)
+	if err != nil {
+		t.Fatalf("导出Excel失败: %v", err)
+	}
+	if !strings.HasSuffix(report.Filename, ".xlsx") {
+		t.Errorf("文件名错误: %s", report.Filename)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(report.Data))
+	if err != nil {
+		t.Fatalf("无法读取导出的工作簿: %v", err)
+	}
+	defer f.Close()
+
+	want := []string{sheetConfig, sheetMetrics, sheetTrades, sheetPositions, sheetEquity, sheetMonthly}
+	if sheets := f.GetSheetList(); strings.Join(sheets, ",") != strings.Join(want, ",") {
+		t.Fatalf("工作表列表错误: %v", sheets)
+	}
+
+	trades, _ := f.GetRows(sheetTrades)
+	if len(trades) != 14 {
+		t.Errorf("交易记录应有13笔加表头, 实际 %d 行", len(trades))
+	}
+	positions, _ := f.GetRows(sheetPositions)
+	if len(positions) != 2 || positions[1][1] != "000001.SZ" || positions[1][2] != "200" {
+		t.Errorf("持仓工作表错误: %v", positions)
+	}
+	monthly, _ := f.GetRows(sheetMonthly)
+	if len(monthly) != 2 || monthly[1][0] != "2024" {
+		t.Errorf("月度收益工作表错误: %v", monthly)
+	}
+}
+
+func TestExportBacktestReport_HTML(t *testing.T) {
+	service := newReportTestService()
+
+	report, err := service.ExportBacktestReport(context.Background(), "bt1", ReportFormatHTML)
+	if err != nil {
+		t.Fatalf("导出HTML失败: %v", err)
+	}
+	html := string(report.Data)
+	for _, want := range []string{"回测报告 - 报告测试", "<svg", "<polyline", "月度收益", "000001.SZ"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML报告缺少 %q", want)
+		}
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "http://cdn") || strings.Contains(html, "https://") {
+		t.Error("HTML报告不应引用外部资源")
+	}
+}
+
+func TestExportBacktestReport_Errors(t *testing.T) {
+	service := newReportTestService()
+	ctx := context.Background()
+
+	if _, err := service.ExportBacktestReport(ctx, "bt1", "pdf"); !errors.Is(err, ErrUnsupportedReportFormat) {
+		t.Errorf("期望格式错误, 实际 %v", err)
+	}
+	if _, err := service.ExportBacktestReport(ctx, "bt2", ReportFormatHTML); !errors.Is(err, ErrBacktestNotCompleted) {
+		t.Errorf("期望回测未完成错误, 实际 %v", err)
+	}
+}
+
+func TestMonthlyReturns(t *testing.T) {
+	curve := []models.EquityPoint{
+		{Date: "2023-12-28", PortfolioValue: 101000},
+		{Date: "2023-12-29", PortfolioValue: 102000},
+		{Date: "2024-01-31", PortfolioValue: 96900},
+		{Date: "2024-03-01", PortfolioValue: 106590},
+	}
+
+	rows := monthlyReturns(curve, 100000)
+	if len(rows) != 2 || rows[0].Year != 2023 || rows[1].Year != 2024 {
+		t.Fatalf("应按年份分为两行: %+v", rows)
+	}
+	if dec := rows[0].Months[11]; !dec.Valid || math.Abs(dec.Return-0.02) > 1e-9 {
+		t.Errorf("首月应以初始资金为基准: %+v", dec)
+	}
+	if jan := rows[1].Months[0]; math.Abs(jan.Return+0.05) > 1e-9 {
+		t.Errorf("1月收益应为-5%%: %+v", jan)
+	}
+	if rows[1].Months[1].Valid {
+		t.Error("没有数据的月份不应有收益")
+	}
+	if math.Abs(rows[1].Annual-0.045) > 1e-9 {
+		t.Errorf("2024年收益应以上年末净值为基准, 实际 %.6f", rows[1].Annual)
+	}
+}
+
+func TestOpenPositions(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{StrategyID: "s1", Symbol: "A", Side: models.TradeSideBuy, Quantity: 100, Price: 10, Timestamp: day},
+		{StrategyID: "s1", Symbol: "A", Side: models.TradeSideBuy, Quantity: 300, Price: 14, Timestamp: day.AddDate(0, 0, 1)},
+		{StrategyID: "s2", Symbol: "A", Side: models.TradeSideBuy, Quantity: 100, Price: 11, Timestamp: day},
+		{StrategyID: "s2", Symbol: "A", Side: models.TradeSideSell, Quantity: 100, Price: 12, Timestamp: day.AddDate(0, 0, 2)},
+		{StrategyID: "s1", Symbol: "A", Side: models.TradeSideSell, Quantity: 200, Price: 15, Timestamp: day.AddDate(0, 0, 3)},
+	}
+
+	positions := replayOpenPositions(trades)
+	if len(positions) != 1 {
+		t.Fatalf("只有s1仍有持仓: %+v", positions)
+	}
+	if p := positions[0]; p.StrategyID != "s1" || p.Quantity != 200 || p.AvgPrice != 13 || !p.OpenedAt.Equal(day) {
+		t.Errorf("持仓错误: %+v", p)
+	}
+
+	// 回测记录了持仓的策略以记录为准（含送转股），其余策略回放交易记录
+	results := &models.BacktestResultsResponse{
+		Performance: []models.BacktestResult{
+			{StrategyID: "s1", OpenPositions: []models.Position{{Symbol: "A", Quantity: 300, AvgPrice: 8.5, Timestamp: day}}},
+			{StrategyID: "s2"},
+		},
+		Trades: append(trades, models.Trade{StrategyID: "s2", Symbol: "B", Side: models.TradeSideBuy, Quantity: 100, Price: 20, Timestamp: day}),
+	}
+	positions = openPositions(results)
+	if len(positions) != 2 || positions[0].Quantity != 300 || positions[0].AvgPrice != 8.5 || positions[1].Symbol != "B" {
+		t.Errorf("持仓应优先使用回测记录: %+v", positions)
+	}
+}
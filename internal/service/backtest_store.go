@@ -0,0 +1,398 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// BacktestStore 回测数据的SQLite存储，表结构在 DatabaseService.initTables 中创建
+type BacktestStore struct {
+	db *sql.DB
+}
+
+// NewBacktestStore 创建回测存储
+func NewBacktestStore(db *sql.DB) *BacktestStore {
+	return &BacktestStore{db: db}
+}
+
+// backtestRunData 一次回测运行产生的全部结果数据
+type backtestRunData struct {
+	Results              []models.BacktestResult
+	Trades               []models.Trade
+	RejectedOrders       []models.RejectedOrder
+	RoundTrips           []models.RoundTrip
+	EquityCurve          []models.EquityPoint            // 组合权益曲线
+	StrategyEquityCurves map[string][]models.EquityPoint // 每个策略的权益曲线
+	Manifest             *models.BacktestManifest        // 运行清单，引入运行清单之前完成的回测为nil
+	Warnings             []string                        // 降级处理的警告，随回测参数保存，不单独写入数据库
+}
+
+// SaveBacktest 保存回测参数和状态，已存在时覆盖
+func (s *BacktestStore) SaveBacktest(backtest *models.Backtest) error {
+	config, err := json.Marshal(backtest)
+	if err != nil {
+		return fmt.Errorf("序列化回测参数失败: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO backtests (
+			id, name, status, start_date, end_date, config,
+			created_at, completed_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			status = excluded.status,
+			start_date = excluded.start_date,
+			end_date = excluded.end_date,
+			config = excluded.config,
+			completed_at = excluded.completed_at,
+			updated_at = excluded.updated_at
+	`,
+		backtest.ID, backtest.Name, string(backtest.Status),
+		backtest.StartDate.Format("2006-01-02"), backtest.EndDate.Format("2006-01-02"), string(config),
+		backtest.CreatedAt, backtest.CompletedAt, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("保存回测失败: %w", err)
+	}
+	return nil
+}
+
+// LoadBacktests 加载所有回测，按创建时间倒序排列
+func (s *BacktestStore) LoadBacktests() ([]*models.Backtest, error) {
+	rows, err := s.db.Query(`SELECT config FROM backtests ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("查询回测列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	var backtests []*models.Backtest
+	for rows.Next() {
+		var config string
+		if err := rows.Scan(&config); err != nil {
+			return nil, fmt.Errorf("扫描回测记录失败: %w", err)
+		}
+
+		var backtest models.Backtest
+		if err := json.Unmarshal([]byte(config), &backtest); err != nil {
+			return nil, fmt.Errorf("解析回测参数失败: %w", err)
+		}
+		backtests = append(backtests, &backtest)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历回测记录失败: %w", err)
+	}
+	return backtests, nil
+}
+
+// DeleteBacktest 删除回测及其全部结果数据
+func (s *BacktestStore) DeleteBacktest(backtestID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteBacktestRunData(tx, backtestID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM backtests WHERE id = ?`, backtestID); err != nil {
+		return fmt.Errorf("删除回测失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// SaveRunData 保存回测运行结果，覆盖该回测之前保存的结果
+func (s *BacktestStore) SaveRunData(backtestID string, data *backtestRunData) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteBacktestRunData(tx, backtestID); err != nil {
+		return err
+	}
+
+	for i, result := range data.Results {
+		metrics, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("序列化回测结果失败: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO backtest_results (id, backtest_id, strategy_id, sort_order, metrics, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, result.ID, backtestID, result.StrategyID, i, string(metrics), result.CreatedAt); err != nil {
+			return fmt.Errorf("保存回测结果失败: %w", err)
+		}
+	}
+
+	tradeStmt, err := tx.Prepare(`
+		INSERT INTO backtest_trades (backtest_id, strategy_id, symbol, side, trade_time, data)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("准备交易记录语句失败: %w", err)
+	}
+	defer tradeStmt.Close()
+
+	for _, trade := range data.Trades {
+		tradeData, err := json.Marshal(trade)
+		if err != nil {
+			return fmt.Errorf("序列化交易记录失败: %w", err)
+		}
+		if _, err := tradeStmt.Exec(backtestID, trade.StrategyID, trade.Symbol, string(trade.Side), trade.Timestamp, string(tradeData)); err != nil {
+			return fmt.Errorf("保存交易记录失败: %w", err)
+		}
+	}
+
+	for _, order := range data.RejectedOrders {
+		orderData, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("序列化拒单记录失败: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO backtest_rejected_orders (backtest_id, strategy_id, symbol, data)
+			VALUES (?, ?, ?, ?)
+		`, backtestID, order.StrategyID, order.Symbol, string(orderData)); err != nil {
+			return fmt.Errorf("保存拒单记录失败: %w", err)
+		}
+	}
+
+	for _, trip := range data.RoundTrips {
+		tripData, err := json.Marshal(trip)
+		if err != nil {
+			return fmt.Errorf("序列化开平仓记录失败: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO backtest_round_trips (backtest_id, strategy_id, symbol, data)
+			VALUES (?, ?, ?, ?)
+		`, backtestID, trip.StrategyID, trip.Symbol, string(tripData)); err != nil {
+			return fmt.Errorf("保存开平仓记录失败: %w", err)
+		}
+	}
+
+	curveStmt, err := tx.Prepare(`
+		INSERT INTO backtest_equity_curves (
+			backtest_id, strategy_id, date, portfolio_value, benchmark_value, cash, holdings
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("准备权益曲线语句失败: %w", err)
+	}
+	defer curveStmt.Close()
+
+	saveCurve := func(strategyID string, curve []models.EquityPoint) error {
+		for _, point := range curve {
+			if _, err := curveStmt.Exec(backtestID, strategyID, point.Date, point.PortfolioValue, point.BenchmarkValue, point.Cash, point.Holdings); err != nil {
+				return fmt.Errorf("保存权益曲线失败: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := saveCurve("", data.EquityCurve); err != nil {
+		return err
+	}
+	for strategyID, curve := range data.StrategyEquityCurves {
+		if err := saveCurve(strategyID, curve); err != nil {
+			return err
+		}
+	}
+
+	if data.Manifest != nil {
+		manifest, err := json.Marshal(data.Manifest)
+		if err != nil {
+			return fmt.Errorf("序列化运行清单失败: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO backtest_manifests (backtest_id, data) VALUES (?, ?)`, backtestID, string(manifest)); err != nil {
+			return fmt.Errorf("保存运行清单失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// LoadRunData 加载回测运行结果，没有保存过结果时返回 nil
+func (s *BacktestStore) LoadRunData(backtestID string) (*backtestRunData, error) {
+	data := &backtestRunData{StrategyEquityCurves: make(map[string][]models.EquityPoint)}
+
+	if err := s.queryJSON(`SELECT metrics FROM backtest_results WHERE backtest_id = ? ORDER BY sort_order`, backtestID, func(raw []byte) error {
+		var result models.BacktestResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return err
+		}
+		data.Results = append(data.Results, result)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("加载回测结果失败: %w", err)
+	}
+	if len(data.Results) == 0 {
+		return nil, nil
+	}
+
+	if err := s.queryJSON(`SELECT data FROM backtest_trades WHERE backtest_id = ? ORDER BY id`, backtestID, func(raw []byte) error {
+		var trade models.Trade
+		if err := json.Unmarshal(raw, &trade); err != nil {
+			return err
+		}
+		data.Trades = append(data.Trades, trade)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("加载交易记录失败: %w", err)
+	}
+
+	if err := s.queryJSON(`SELECT data FROM backtest_rejected_orders WHERE backtest_id = ? ORDER BY id`, backtestID, func(raw []byte) error {
+		var order models.RejectedOrder
+		if err := json.Unmarshal(raw, &order); err != nil {
+			return err
+		}
+		data.RejectedOrders = append(data.RejectedOrders, order)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("加载拒单记录失败: %w", err)
+	}
+
+	if err := s.queryJSON(`SELECT data FROM backtest_round_trips WHERE backtest_id = ? ORDER BY id`, backtestID, func(raw []byte) error {
+		var trip models.RoundTrip
+		if err := json.Unmarshal(raw, &trip); err != nil {
+			return err
+		}
+		data.RoundTrips = append(data.RoundTrips, trip)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("加载开平仓记录失败: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT strategy_id, date, portfolio_value, benchmark_value, cash, holdings
+		FROM backtest_equity_curves
+		WHERE backtest_id = ?
+		ORDER BY strategy_id, date
+	`, backtestID)
+	if err != nil {
+		return nil, fmt.Errorf("查询权益曲线失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var strategyID string
+		var point models.EquityPoint
+		if err := rows.Scan(&strategyID, &point.Date, &point.PortfolioValue, &point.BenchmarkValue, &point.Cash, &point.Holdings); err != nil {
+			return nil, fmt.Errorf("扫描权益曲线失败: %w", err)
+		}
+		if strategyID == "" {
+			data.EquityCurve = append(data.EquityCurve, point)
+		} else {
+			data.StrategyEquityCurves[strategyID] = append(data.StrategyEquityCurves[strategyID], point)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历权益曲线失败: %w", err)
+	}
+
+	if err := s.queryJSON(`SELECT data FROM backtest_manifests WHERE backtest_id = ?`, backtestID, func(raw []byte) error {
+		data.Manifest = &models.BacktestManifest{}
+		return json.Unmarshal(raw, data.Manifest)
+	}); err != nil {
+		return nil, fmt.Errorf("加载运行清单失败: %w", err)
+	}
+
+	return data, nil
+}
+
+// SaveCorporateActions 保存手工导入的分红送转记录，覆盖该股票之前导入的全部记录
+func (s *BacktestStore) SaveCorporateActions(symbol string, actions []models.CorporateAction) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM corporate_actions WHERE ts_code = ?`, symbol); err != nil {
+		return fmt.Errorf("删除分红送转记录失败: %w", err)
+	}
+	for _, action := range actions {
+		data, err := json.Marshal(action)
+		if err != nil {
+			return fmt.Errorf("序列化分红送转记录失败: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO corporate_actions (ts_code, ex_date, data) VALUES (?, ?, ?)`,
+			symbol, action.ExDate, string(data)); err != nil {
+			return fmt.Errorf("保存分红送转记录失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// LoadCorporateActions 加载全部手工导入的分红送转记录，按股票分组并按除权除息日排序
+func (s *BacktestStore) LoadCorporateActions() (map[string][]models.CorporateAction, error) {
+	rows, err := s.db.Query(`SELECT ts_code, data FROM corporate_actions ORDER BY ts_code, ex_date`)
+	if err != nil {
+		return nil, fmt.Errorf("查询分红送转记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	actions := make(map[string][]models.CorporateAction)
+	for rows.Next() {
+		var symbol, data string
+		if err := rows.Scan(&symbol, &data); err != nil {
+			return nil, fmt.Errorf("扫描分红送转记录失败: %w", err)
+		}
+		var action models.CorporateAction
+		if err := json.Unmarshal([]byte(data), &action); err != nil {
+			return nil, fmt.Errorf("解析分红送转记录失败: %w", err)
+		}
+		actions[symbol] = append(actions[symbol], action)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历分红送转记录失败: %w", err)
+	}
+	return actions, nil
+}
+
+// queryJSON 执行按回测ID查询单列JSON数据的语句，逐行回调
+func (s *BacktestStore) queryJSON(query, backtestID string, handle func(raw []byte) error) error {
+	rows, err := s.db.Query(query, backtestID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		if err := handle([]byte(raw)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// deleteBacktestRunData 在事务中删除回测的全部结果数据
+func deleteBacktestRunData(tx *sql.Tx, backtestID string) error {
+	tables := []string{"backtest_results", "backtest_trades", "backtest_rejected_orders", "backtest_round_trips", "backtest_equity_curves", "backtest_manifests"}
+	for _, table := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE backtest_id = ?", table), backtestID); err != nil {
+			return fmt.Errorf("删除表 %s 的回测数据失败: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestBacktestStore_SurvivesRestart(t *testing.T) {
+	database, err := NewDatabaseService(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	if err := service.SetStore(NewBacktestStore(database.GetDB())); err != nil {
+		t.Fatalf("启用持久化存储失败: %v", err)
+	}
+
+	completed := &models.Backtest{
+		ID:          "bt-completed",
+		Name:        "均线回测",
+		StrategyIDs: []string{"s1"},
+		Symbols:     []string{"600000.SH"},
+		StartDate:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+		Status:      models.BacktestStatusPending,
+		ExitRules:   &models.ExitRulesConfig{StopLossPct: 0.08},
+	}
+	running := &models.Backtest{ID: "bt-running", Name: "运行中", Status: models.BacktestStatusPending}
+	for _, backtest := range []*models.Backtest{completed, running} {
+		if err := service.CreateBacktest(ctx, backtest); err != nil {
+			t.Fatalf("创建回测失败: %v", err)
+		}
+	}
+
+	runData := &backtestRunData{
+		Results: []models.BacktestResult{{ID: "bt-completed_s1", BacktestID: "bt-completed", StrategyID: "s1", TotalReturn: 0.12, Alpha: 0.05}},
+		Trades: []models.Trade{
+			{ID: "t1", StrategyID: "s1", Symbol: "600000.SH", Side: models.TradeSideBuy, Quantity: 1000, Price: 10},
+			{ID: "t2", StrategyID: "s1", Symbol: "600000.SH", Side: models.TradeSideSell, Quantity: 1000, Price: 11, PnL: 950},
+		},
+		RejectedOrders: []models.RejectedOrder{{ID: "r1", StrategyID: "s1", Symbol: "600000.SH", Reason: models.OrderRejectLimitUp}},
+		RoundTrips:     []models.RoundTrip{{StrategyID: "s1", Symbol: "600000.SH", Quantity: 1000, PnL: 950, MAE: -0.02, MFE: 0.12}},
+		EquityCurve:    []models.EquityPoint{{Date: "2024-01-02", PortfolioValue: 100000}, {Date: "2024-01-03", PortfolioValue: 101000}},
+		StrategyEquityCurves: map[string][]models.EquityPoint{
+			"s1": {{Date: "2024-01-02", PortfolioValue: 100000}},
+		},
+		Manifest: &models.BacktestManifest{BacktestID: "bt-completed", DataHash: "abc", ResultHashes: map[string]string{"results": "def"}},
+	}
+	if err := service.store.SaveRunData(completed.ID, runData); err != nil {
+		t.Fatalf("保存回测结果失败: %v", err)
+	}
+	service.updateBacktestStatus(completed.ID, models.BacktestStatusCompleted, "")
+	service.updateBacktestStatus(running.ID, models.BacktestStatusRunning, "")
+
+	// 模拟服务重启
+	restarted := NewBacktestService(nil, nil, nil, &noopLogger{})
+	if err := restarted.SetStore(NewBacktestStore(database.GetDB())); err != nil {
+		t.Fatalf("重新加载回测失败: %v", err)
+	}
+
+	list, total, err := restarted.GetBacktestsList(ctx, &models.BacktestListRequest{Page: 1, Size: 10})
+	if err != nil || total != 2 || len(list) != 2 {
+		t.Fatalf("重启后应查询到2个回测, 实际 total=%d err=%v", total, err)
+	}
+
+	loaded, err := restarted.GetBacktest(ctx, completed.ID)
+	if err != nil {
+		t.Fatalf("获取回测失败: %v", err)
+	}
+	if loaded.Status != models.BacktestStatusCompleted || loaded.ExitRules == nil || loaded.ExitRules.StopLossPct != 0.08 {
+		t.Errorf("回测参数未完整恢复: %+v", loaded)
+	}
+
+	interrupted, _ := restarted.GetBacktest(ctx, running.ID)
+	if interrupted.Status != models.BacktestStatusFailed {
+		t.Errorf("重启前运行中的回测应标记为失败, 实际 %s", interrupted.Status)
+	}
+
+	if err := restarted.ensureRunDataLoaded(completed.ID); err != nil {
+		t.Fatalf("加载回测结果失败: %v", err)
+	}
+	if result := restarted.backtestResults[completed.ID]; result == nil || result.Alpha != 0.05 {
+		t.Errorf("回测结果未恢复: %+v", result)
+	}
+	if trades := restarted.backtestTrades[completed.ID]; len(trades) != 2 || trades[1].ID != "t2" {
+		t.Errorf("交易记录未按顺序恢复: %+v", trades)
+	}
+	if len(restarted.backtestRejectedOrders[completed.ID]) != 1 || len(restarted.backtestEquityCurves[completed.ID]) != 2 ||
+		len(restarted.backtestStrategyEquityCurves[completed.ID]["s1"]) != 1 {
+		t.Error("拒单记录或权益曲线未恢复")
+	}
+	if trips := restarted.backtestRoundTrips[completed.ID]; len(trips) != 1 || trips[0].MFE != 0.12 {
+		t.Errorf("开平仓记录未恢复: %+v", trips)
+	}
+	if manifest, err := restarted.GetBacktestManifest(ctx, completed.ID); err != nil || manifest.DataHash != "abc" || manifest.ResultHashes["results"] != "def" {
+		t.Errorf("运行清单未恢复: %+v err=%v", manifest, err)
+	}
+
+	// 删除后不再出现在列表中
+	if err := restarted.DeleteBacktest(ctx, completed.ID); err != nil {
+		t.Fatalf("删除回测失败: %v", err)
+	}
+	if data, err := restarted.store.LoadRunData(completed.ID); err != nil || data != nil {
+		t.Errorf("删除后不应再有结果数据, 实际 %+v err=%v", data, err)
+	}
+	backtests, _ := restarted.store.LoadBacktests()
+	if len(backtests) != 1 {
+		t.Errorf("删除后应剩余1个回测, 实际 %d", len(backtests))
+	}
+}
+
+func TestBacktestStore_CorporateActions(t *testing.T) {
+	database, err := NewDatabaseService(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	if err := service.SetStore(NewBacktestStore(database.GetDB())); err != nil {
+		t.Fatalf("启用持久化存储失败: %v", err)
+	}
+	actions := []models.CorporateAction{
+		{ExDate: "20240620", CashDividend: 0.5},
+		{ExDate: "20230615", BonusShares: 0.3},
+	}
+	if err := service.ImportCorporateActions(ctx, "600000.SH", actions); err != nil {
+		t.Fatalf("导入分红送转记录失败: %v", err)
+	}
+
+	// 重启后导入的记录仍然有效，并按除权除息日排序
+	restarted := NewBacktestService(nil, nil, nil, &noopLogger{})
+	if err := restarted.SetStore(NewBacktestStore(database.GetDB())); err != nil {
+		t.Fatalf("重新加载存储失败: %v", err)
+	}
+	loaded, err := restarted.GetCorporateActions(ctx, "600000.SH", "20240101", "")
+	if err != nil || len(loaded) != 1 || loaded[0].ExDate != "20240620" || loaded[0].TSCode != "600000.SH" {
+		t.Fatalf("导入的记录未恢复: %+v err=%v", loaded, err)
+	}
+
+	// 导入空列表清除记录
+	if err := restarted.ImportCorporateActions(ctx, "600000.SH", nil); err != nil {
+		t.Fatalf("清除分红送转记录失败: %v", err)
+	}
+	if stored, _ := restarted.store.LoadCorporateActions(); len(stored) != 0 {
+		t.Errorf("清除后不应再有导入记录: %+v", stored)
+	}
+}
+
+func TestBacktestService_SaveRunDataFailureKeepsNoResults(t *testing.T) {
+	database, err := NewDatabaseService(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer database.Close()
+
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	if err := service.SetStore(NewBacktestStore(database.GetDB())); err != nil {
+		t.Fatalf("启用持久化存储失败: %v", err)
+	}
+	if _, err := database.GetDB().Exec(`DROP TABLE backtest_trades`); err != nil {
+		t.Fatalf("删除交易表失败: %v", err)
+	}
+
+	runData := &backtestRunData{
+		Results: []models.BacktestResult{{ID: "bt_s1", BacktestID: "bt", StrategyID: "s1"}},
+		Trades:  []models.Trade{{ID: "t1", StrategyID: "s1", Symbol: "600000.SH", Side: models.TradeSideBuy, Quantity: 100, Price: 10}},
+	}
+	if err := service.saveRunData("bt", runData); err == nil {
+		t.Fatal("写入数据库失败时应返回错误")
+	}
+	if _, exists := service.backtestResults["bt"]; exists {
+		t.Error("写入数据库失败时不应在内存中保留结果")
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestBenchmarkSeries_ValueOn(t *testing.T) {
+	bars := buildTestDailyBars(DefaultBenchmark, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), []float64{100, 102, 101, 105})
+
+	series, err := newBenchmarkSeries(bars, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("构建基准序列失败: %v", err)
+	}
+
+	tests := []struct {
+		date     time.Time
+		expected float64
+	}{
+		{time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), 102000},
+		{time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), 105000},
+		{time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), 105000}, // 非交易日沿用最近收盘价
+	}
+	for _, tt := range tests {
+		if value := series.valueOn(tt.date, 100000); math.Abs(value-tt.expected) > 1e-6 {
+			t.Errorf("%s 基准净值应为 %.2f, 实际 %.2f", tt.date.Format("20060102"), tt.expected, value)
+		}
+	}
+
+	var missing *benchmarkSeries
+	if value := missing.valueOn(tests[0].date, 100000); value != 0 {
+		t.Errorf("未加载基准时净值应为0, 实际 %.2f", value)
+	}
+
+	if _, err := newBenchmarkSeries(nil, tests[0].date); err == nil {
+		t.Error("无基准数据时应返回错误")
+	}
+}
+
+func TestBenchmarkSymbol(t *testing.T) {
+	if symbol := benchmarkSymbol(&models.Backtest{}); symbol != DefaultBenchmark {
+		t.Errorf("未设置基准时应使用 %s, 实际 %s", DefaultBenchmark, symbol)
+	}
+	if symbol := benchmarkSymbol(&models.Backtest{Benchmark: "000905.SH"}); symbol != "000905.SH" {
+		t.Errorf("应使用设置的基准, 实际 %s", symbol)
+	}
+}
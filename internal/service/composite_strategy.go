@@ -0,0 +1,537 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"stock-a-future/internal/models"
+)
+
+var (
+	ErrInvalidComposite = errors.New("复合策略参数无效")
+	ErrStrategyInUse    = errors.New("策略被复合策略引用")
+)
+
+const (
+	defaultCompositeThreshold = 0.3
+	defaultFilterLookback     = 20 // filter 模式过滤策略信号的默认有效期（交易日）
+	maxCompositeDepth         = 5  // 复合策略最多嵌套层数
+)
+
+// compositeDepthKey 执行嵌套复合策略时在 context 中记录当前层数
+type compositeDepthKey struct{}
+
+// compositeChildrenKey 回测时在 context 中记录子策略定义的快照: strategyID -> 定义
+type compositeChildrenKey struct{}
+
+// ParseCompositeParams 解析并校验复合策略参数，不检查子策略是否存在
+func ParseCompositeParams(params map[string]interface{}) (*models.CompositeStrategyParams, error) {
+	config := &models.CompositeStrategyParams{
+		Mode:      models.CompositeMode(getStringParameter(params, "mode", "")),
+		Threshold: getFloatParameter(params, "threshold", defaultCompositeThreshold),
+		Filter:    getStringParameter(params, "filter", ""),
+		Trigger:   getStringParameter(params, "trigger", ""),
+
+		FilterLookback: getIntParameter(params, "filter_lookback", defaultFilterLookback),
+	}
+
+	switch raw := params["strategies"].(type) {
+	case nil:
+	case []string:
+		config.Strategies = append(config.Strategies, raw...)
+	case []interface{}:
+		for _, item := range raw {
+			id, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: strategies 应为策略ID列表", ErrInvalidComposite)
+			}
+			config.Strategies = append(config.Strategies, id)
+		}
+	default:
+		return nil, fmt.Errorf("%w: strategies 应为策略ID列表", ErrInvalidComposite)
+	}
+
+	switch raw := params["weights"].(type) {
+	case nil:
+	case map[string]float64:
+		config.Weights = make(map[string]float64, len(raw))
+		for id, weight := range raw {
+			config.Weights[id] = weight
+		}
+	case map[string]interface{}:
+		config.Weights = make(map[string]float64, len(raw))
+		for id := range raw {
+			weight := getFloatParameter(raw, id, math.NaN())
+			if math.IsNaN(weight) {
+				return nil, fmt.Errorf("%w: 子策略 %s 的权重应为数值", ErrInvalidComposite, id)
+			}
+			config.Weights[id] = weight
+		}
+	default:
+		return nil, fmt.Errorf("%w: weights 应为 策略ID->权重 的映射", ErrInvalidComposite)
+	}
+
+	switch config.Mode {
+	case models.CompositeModeAnd, models.CompositeModeOr, models.CompositeModeWeighted:
+		if len(config.Strategies) < 2 {
+			return nil, fmt.Errorf("%w: 至少需要2个子策略", ErrInvalidComposite)
+		}
+		seen := make(map[string]bool, len(config.Strategies))
+		for _, id := range config.Strategies {
+			if strings.TrimSpace(id) == "" {
+				return nil, fmt.Errorf("%w: 子策略ID不能为空", ErrInvalidComposite)
+			}
+			if seen[id] {
+				return nil, fmt.Errorf("%w: 子策略 %s 重复", ErrInvalidComposite, id)
+			}
+			seen[id] = true
+		}
+		for id, weight := range config.Weights {
+			if !seen[id] {
+				return nil, fmt.Errorf("%w: 权重中的 %s 不在子策略列表中", ErrInvalidComposite, id)
+			}
+			if weight <= 0 {
+				return nil, fmt.Errorf("%w: 子策略 %s 的权重必须大于0", ErrInvalidComposite, id)
+			}
+		}
+		if config.Threshold <= 0 || config.Threshold > 1 {
+			return nil, fmt.Errorf("%w: threshold 必须在0-1之间", ErrInvalidComposite)
+		}
+	case models.CompositeModeFilter:
+		if config.Filter == "" || config.Trigger == "" {
+			return nil, fmt.Errorf("%w: filter 模式需要设置 filter 和 trigger", ErrInvalidComposite)
+		}
+		if config.Filter == config.Trigger {
+			return nil, fmt.Errorf("%w: filter 和 trigger 不能是同一个策略", ErrInvalidComposite)
+		}
+		if config.FilterLookback < 1 || config.FilterLookback > StrategyLookbackDays {
+			return nil, fmt.Errorf("%w: filter_lookback 必须在1-%d之间", ErrInvalidComposite, StrategyLookbackDays)
+		}
+	default:
+		return nil, fmt.Errorf("%w: 不支持的组合方式 %q，可选 and、or、weighted、filter", ErrInvalidComposite, config.Mode)
+	}
+
+	return config, nil
+}
+
+// compositeChildren 复合策略引用的子策略ID
+func compositeChildren(config *models.CompositeStrategyParams) []string {
+	if config.Mode == models.CompositeModeFilter {
+		return []string{config.Filter, config.Trigger}
+	}
+	return config.Strategies
+}
+
+// compositeWeight 子策略在加权投票中的权重
+func compositeWeight(config *models.CompositeStrategyParams, id string) float64 {
+	if weight, ok := config.Weights[id]; ok {
+		return weight
+	}
+	return 1
+}
+
+// validateCompositeStrategyParameters 验证复合策略参数，子策略必须存在且不能形成循环引用，调用方需持有锁
+func (s *StrategyService) validateCompositeStrategyParameters(strategy *models.Strategy) error {
+	config, err := ParseCompositeParams(strategy.Parameters)
+	if err != nil {
+		return err
+	}
+	children := compositeChildren(config)
+	for _, id := range children {
+		child, exists := s.strategies[id]
+		if !exists && id != strategy.ID {
+			return fmt.Errorf("%w: 子策略 %s 不存在", ErrInvalidComposite, id)
+		}
+		// 定期调仓和基本面策略需要在回测中按股票池截面执行，不能逐个股票组合
+		if exists && (child.Type == models.StrategyTypeRebalance || child.Type == models.StrategyTypeFundamental) {
+			return fmt.Errorf("%w: 子策略 %s 需要按股票池执行，不能组合", ErrInvalidComposite, id)
+		}
+	}
+	return s.checkCompositeReferences(strategy.ID, children, 1)
+}
+
+// checkCompositeReferences 沿复合策略的引用检查是否回到 rootID 以及嵌套层数，调用方需持有锁
+func (s *StrategyService) checkCompositeReferences(rootID string, children []string, depth int) error {
+	if depth > maxCompositeDepth {
+		return fmt.Errorf("%w: 复合策略嵌套超过%d层", ErrInvalidComposite, maxCompositeDepth)
+	}
+	for _, id := range children {
+		if id == rootID {
+			return fmt.Errorf("%w: 引用子策略 %s 形成循环", ErrInvalidComposite, id)
+		}
+		child, exists := s.strategies[id]
+		if !exists || child.Type != models.StrategyTypeComposite {
+			continue
+		}
+		config, err := ParseCompositeParams(child.Parameters)
+		if err != nil {
+			continue
+		}
+		if err := s.checkCompositeReferences(rootID, compositeChildren(config), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compositeReferrers 引用了指定策略的复合策略ID，调用方需持有锁
+func (s *StrategyService) compositeReferrers(strategyID string) []string {
+	var referrers []string
+	for id, strategy := range s.strategies {
+		if strategy.Type != models.StrategyTypeComposite {
+			continue
+		}
+		config, err := ParseCompositeParams(strategy.Parameters)
+		if err != nil {
+			continue
+		}
+		for _, child := range compositeChildren(config) {
+			if child == strategyID {
+				referrers = append(referrers, id)
+				break
+			}
+		}
+	}
+	sort.Strings(referrers)
+	return referrers
+}
+
+// validateCompositeParams 验证复合策略参数，供参数校验接口使用
+func (s *StrategyService) validateCompositeParams(parameters map[string]interface{}) []map[string]string {
+	var errors []map[string]string
+
+	config, err := ParseCompositeParams(parameters)
+	if err != nil {
+		return append(errors, map[string]string{
+			"field":   "parameters",
+			"message": err.Error(),
+		})
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, id := range compositeChildren(config) {
+		if _, exists := s.strategies[id]; !exists {
+			errors = append(errors, map[string]string{
+				"field":   "strategies",
+				"message": fmt.Sprintf("子策略 %s 不存在", id),
+			})
+		}
+	}
+	return errors
+}
+
+// compositeChildSignal 子策略及其信号
+type compositeChildSignal struct {
+	strategy *models.Strategy
+	signal   *models.Signal
+}
+
+// direction 买入为1，卖出为-1，其他为0
+func (c compositeChildSignal) direction() float64 {
+	switch c.signal.SignalType {
+	case models.SignalTypeBuy:
+		return 1
+	case models.SignalTypeSell:
+		return -1
+	}
+	return 0
+}
+
+// describe 子策略信号在复合信号原因中的描述
+func (c compositeChildSignal) describe(prefix, extra string) string {
+	label := map[models.SignalType]string{
+		models.SignalTypeBuy:  "买入",
+		models.SignalTypeSell: "卖出",
+	}[c.signal.SignalType]
+	if label == "" {
+		label = "持有"
+	}
+	return fmt.Sprintf("%s%s[%s] %s 强度%.2f 置信度%.2f%s: %s",
+		prefix, c.strategy.Name, c.strategy.ID, label, c.signal.Strength, c.signal.Confidence, extra, c.signal.Reason)
+}
+
+// withCompositeChildren 在 context 中记录子策略定义的快照，执行复合策略时优先使用快照中的定义
+func withCompositeChildren(ctx context.Context, children map[string]*models.Strategy) context.Context {
+	return context.WithValue(ctx, compositeChildrenKey{}, children)
+}
+
+// resolveCompositeChild 获取子策略定义：context 中的快照有该策略时使用快照，否则使用当前注册的策略
+func (s *StrategyService) resolveCompositeChild(ctx context.Context, id string) (*models.Strategy, error) {
+	if children, ok := ctx.Value(compositeChildrenKey{}).(map[string]*models.Strategy); ok {
+		if child, ok := children[id]; ok {
+			return child, nil
+		}
+	}
+	return s.GetStrategy(ctx, id)
+}
+
+// collectCompositeChildren 递归收集复合策略引用的全部子策略定义
+// known 中已有的定义（运行清单中的快照）优先，缺失的使用当前注册的策略
+func (s *StrategyService) collectCompositeChildren(ctx context.Context, strategies []*models.Strategy, known map[string]*models.Strategy) (map[string]*models.Strategy, error) {
+	children := make(map[string]*models.Strategy)
+	var collect func(strategy *models.Strategy) error
+	collect = func(strategy *models.Strategy) error {
+		if strategy.Type != models.StrategyTypeComposite {
+			return nil
+		}
+		config, err := ParseCompositeParams(strategy.Parameters)
+		if err != nil {
+			return fmt.Errorf("复合策略 %s: %w", strategy.ID, err)
+		}
+		for _, id := range compositeChildren(config) {
+			if _, ok := children[id]; ok {
+				continue
+			}
+			child, ok := known[id]
+			if !ok {
+				if child, err = s.GetStrategy(ctx, id); err != nil {
+					return fmt.Errorf("复合策略 %s 的子策略 %s: %w", strategy.ID, id, err)
+				}
+			}
+			children[id] = child
+			if err := collect(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, strategy := range strategies {
+		if err := collect(strategy); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
+
+// executeCompositeStrategy 执行全部子策略并按组合方式合并信号，信号原因列出每个子策略的贡献
+func (s *StrategyService) executeCompositeStrategy(ctx context.Context, strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	config, err := ParseCompositeParams(strategy.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	depth, _ := ctx.Value(compositeDepthKey{}).(int)
+	if depth >= maxCompositeDepth {
+		return nil, fmt.Errorf("%w: 复合策略嵌套超过%d层", ErrInvalidComposite, maxCompositeDepth)
+	}
+	childCtx := context.WithValue(ctx, compositeDepthKey{}, depth+1)
+
+	children := compositeChildren(config)
+	results := make([]compositeChildSignal, len(children))
+	for i, id := range children {
+		child, err := s.resolveCompositeChild(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("复合策略 %s 的子策略 %s: %w", strategy.ID, id, err)
+		}
+		childSignal, err := s.ExecuteStrategyWith(childCtx, child, marketData, history)
+		if err != nil {
+			return nil, fmt.Errorf("执行复合策略 %s 的子策略 %s 失败: %w", strategy.ID, id, err)
+		}
+		results[i] = compositeChildSignal{strategy: child, signal: childSignal}
+	}
+
+	signal := newStrategySignal(strategy, marketData)
+	switch config.Mode {
+	case models.CompositeModeAnd:
+		combineUnanimous(signal, results)
+	case models.CompositeModeOr:
+		combineAnyOf(signal, results)
+	case models.CompositeModeWeighted:
+		combineWeighted(signal, results, config)
+	case models.CompositeModeFilter:
+		filter := filterState{direction: results[0].direction()}
+		if results[1].direction() == 1 && filter.direction == 0 {
+			if filter, err = s.recentFilterState(childCtx, results[0].strategy, marketData, history, config.FilterLookback); err != nil {
+				return nil, fmt.Errorf("执行复合策略 %s 的过滤策略 %s 失败: %w", strategy.ID, config.Filter, err)
+			}
+		}
+		combineFilter(signal, results[0], results[1], filter)
+	}
+	return signal, nil
+}
+
+// filterState 过滤策略当前所处的状态
+type filterState struct {
+	direction float64 // 最近一次买入为1，卖出为-1，有效期内没有信号为0
+	barsAgo   int     // 该信号距当日的交易日数，当日为0
+}
+
+// recentFilterState 过滤策略当日持有时，向前逐日重新执行过滤策略，取 lookback 个交易日内最近一次买入或卖出信号
+// 均线交叉等策略只在交叉当日发出信号，之后的持有表示维持原状态，只看当日信号几乎不会与触发策略的买入同时出现；
+// 按截至当时的历史重新计算，不在执行之间保存状态，并行回测和按运行清单复现的结果不受执行顺序影响
+func (s *StrategyService) recentFilterState(ctx context.Context, filter *models.Strategy, marketData *models.MarketData, history []models.StockDaily, lookback int) (filterState, error) {
+	for barsAgo := 1; barsAgo < lookback && barsAgo < len(history); barsAgo++ {
+		end := len(history) - barsAgo
+		signal, err := s.ExecuteStrategyWith(ctx, filter, marketDataAtBar(marketData, history[len(history)-1], history[end-1]), history[:end])
+		if err != nil {
+			return filterState{}, err
+		}
+		if direction := (compositeChildSignal{strategy: filter, signal: signal}).direction(); direction != 0 {
+			return filterState{direction: direction, barsAgo: barsAgo}, nil
+		}
+	}
+	return filterState{}, nil
+}
+
+// marketDataAtBar 以历史中的一根K线构造行情，成交量和成交额按与当日K线的比例换算，保持与当日行情相同的单位
+func marketDataAtBar(current *models.MarketData, currentBar, bar models.StockDaily) *models.MarketData {
+	data := *current
+	if date, err := parseTradeDate(bar.TradeDate); err == nil {
+		data.Date = date
+	}
+	data.Open = bar.Open.InexactFloat64()
+	data.High = bar.High.InexactFloat64()
+	data.Low = bar.Low.InexactFloat64()
+	data.Close = bar.Close.InexactFloat64()
+	data.AdjClose = data.Close
+	data.Volume, data.Amount = 0, 0
+	if vol := currentBar.Vol.InexactFloat64(); vol > 0 {
+		data.Volume = int64(float64(current.Volume) * bar.Vol.InexactFloat64() / vol)
+	}
+	if amount := currentBar.Amount.InexactFloat64(); amount > 0 {
+		data.Amount = current.Amount * bar.Amount.InexactFloat64() / amount
+	}
+	return &data
+}
+
+// setCompositeSignal 设置复合信号的方向、强度和置信度
+func setCompositeSignal(signal *models.Signal, direction, strength, confidence float64) {
+	if direction > 0 {
+		signal.SignalType = models.SignalTypeBuy
+		signal.Side = models.TradeSideBuy
+	} else {
+		signal.SignalType = models.SignalTypeSell
+		signal.Side = models.TradeSideSell
+	}
+	signal.Strength = math.Min(strength, 1)
+	signal.Confidence = math.Min(confidence, 1)
+}
+
+// describeChildren 逐个描述子策略信号
+func describeChildren(results []compositeChildSignal) string {
+	parts := make([]string, len(results))
+	for i, result := range results {
+		parts[i] = result.describe("", "")
+	}
+	return strings.Join(parts, "；")
+}
+
+// combineUnanimous 全部子策略方向一致时跟随，强度取平均，置信度取最低
+func combineUnanimous(signal *models.Signal, results []compositeChildSignal) {
+	direction := results[0].direction()
+	strength, confidence := 0.0, 1.0
+	for _, result := range results {
+		if result.direction() != direction {
+			direction = 0
+			break
+		}
+		strength += result.signal.Strength / float64(len(results))
+		confidence = math.Min(confidence, result.signal.Confidence)
+	}
+
+	if direction == 0 {
+		holdSignal(signal, "子策略未一致，持有；"+describeChildren(results))
+		return
+	}
+	setCompositeSignal(signal, direction, strength, confidence)
+	signal.Reason = "全部子策略一致；" + describeChildren(results)
+}
+
+// combineAnyOf 任一子策略发出信号即跟随，取 强度×置信度 最高的子策略的强度和置信度；买卖冲突时持有
+func combineAnyOf(signal *models.Signal, results []compositeChildSignal) {
+	var buys, sells int
+	var strongest *compositeChildSignal
+	for i := range results {
+		switch results[i].direction() {
+		case 1:
+			buys++
+		case -1:
+			sells++
+		default:
+			continue
+		}
+		if strongest == nil || results[i].signal.Strength*results[i].signal.Confidence > strongest.signal.Strength*strongest.signal.Confidence {
+			strongest = &results[i]
+		}
+	}
+
+	switch {
+	case buys > 0 && sells > 0:
+		holdSignal(signal, "子策略买卖信号冲突，持有；"+describeChildren(results))
+	case strongest == nil:
+		holdSignal(signal, "没有子策略发出信号；"+describeChildren(results))
+	default:
+		setCompositeSignal(signal, strongest.direction(), strongest.signal.Strength, strongest.signal.Confidence)
+		signal.Reason = fmt.Sprintf("%d个子策略发出信号；%s", buys+sells, describeChildren(results))
+	}
+}
+
+// combineWeighted 加权投票：得分 = Σ 权重×方向×强度×置信度 / Σ 权重，绝对值达到阈值时发出信号
+// 强度为得分的绝对值，置信度为同方向子策略按权重平均的置信度
+func combineWeighted(signal *models.Signal, results []compositeChildSignal, config *models.CompositeStrategyParams) {
+	totalWeight := 0.0
+	for _, result := range results {
+		totalWeight += compositeWeight(config, result.strategy.ID)
+	}
+
+	score := 0.0
+	contributions := make([]float64, len(results))
+	for i, result := range results {
+		contributions[i] = compositeWeight(config, result.strategy.ID) * result.direction() *
+			result.signal.Strength * result.signal.Confidence / totalWeight
+		score += contributions[i]
+	}
+
+	parts := make([]string, len(results))
+	for i, result := range results {
+		parts[i] = result.describe("", fmt.Sprintf(" 权重%g 贡献%+.3f", compositeWeight(config, result.strategy.ID), contributions[i]))
+	}
+	summary := fmt.Sprintf("加权投票得分%+.3f（阈值%.2f）；%s", score, config.Threshold, strings.Join(parts, "；"))
+
+	if math.Abs(score) < config.Threshold {
+		holdSignal(signal, summary)
+		return
+	}
+
+	direction := math.Copysign(1, score)
+	agreeingWeight, weightedConfidence := 0.0, 0.0
+	for _, result := range results {
+		if result.direction() == direction {
+			weight := compositeWeight(config, result.strategy.ID)
+			agreeingWeight += weight
+			weightedConfidence += weight * result.signal.Confidence
+		}
+	}
+	setCompositeSignal(signal, direction, math.Abs(score), weightedConfidence/agreeingWeight)
+	signal.Reason = summary
+}
+
+// combineFilter 过滤策略处于买入状态（当日或有效期内最近一次信号为买入）时放行触发策略的买入；
+// 触发策略的卖出不受过滤，避免无法离场
+func combineFilter(signal *models.Signal, filter, trigger compositeChildSignal, state filterState) {
+	reason := filter.describe("过滤 ", "") + "；" + trigger.describe("触发 ", "")
+	if state.barsAgo > 0 {
+		label := map[float64]string{1: "买入", -1: "卖出"}[state.direction]
+		reason = fmt.Sprintf("过滤策略%d个交易日前发出%s信号；%s", state.barsAgo, label, reason)
+	}
+
+	switch trigger.direction() {
+	case 1:
+		if state.direction != 1 {
+			holdSignal(signal, "过滤策略未放行买入；"+reason)
+			return
+		}
+		setCompositeSignal(signal, 1, trigger.signal.Strength, trigger.signal.Confidence)
+		signal.Reason = "过滤策略放行买入；" + reason
+	case -1:
+		setCompositeSignal(signal, -1, trigger.signal.Strength, trigger.signal.Confidence)
+		signal.Reason = "触发策略卖出；" + reason
+	default:
+		holdSignal(signal, "触发策略未发出信号；"+reason)
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// createConstantRuleStrategies 创建恒定买入、恒定卖出和恒定持有的规则策略，信号强度和置信度均为0.7
+func createConstantRuleStrategies(t *testing.T, service *StrategyService) {
+	t.Helper()
+	rules := map[string]string{
+		"always-buy":  "ENTRY: CLOSE > 0",
+		"always-sell": "ENTRY: CLOSE < 0\nEXIT: CLOSE > 0",
+		"never":       "ENTRY: CLOSE < 0",
+	}
+	for id, code := range rules {
+		strategy := &models.Strategy{ID: id, Name: id, Type: models.StrategyTypeTechnical, Code: code}
+		if err := service.CreateStrategy(context.Background(), strategy); err != nil {
+			t.Fatalf("创建规则策略 %s 失败: %v", id, err)
+		}
+	}
+}
+
+func TestExecuteStrategy_Composite(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	createConstantRuleStrategies(t, service)
+
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 10+float64(i)*0.1)
+	}
+	history := buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), closes)
+	marketData := lastBarMarketData(t, history)
+
+	tests := []struct {
+		name       string
+		params     map[string]interface{}
+		want       models.SignalType
+		strength   float64
+		confidence float64
+		reason     []string
+	}{
+		{"AND一致", map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy", "always-buy-2"}}, models.SignalTypeBuy, 0.7, 0.7, []string{"全部子策略一致", "always-buy[always-buy] 买入 强度0.70 置信度0.70"}},
+		{"AND不一致", map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy", "never"}}, models.SignalTypeHold, 0.5, 0.5, []string{"子策略未一致", "never[never] 持有"}},
+		{"OR任一", map[string]interface{}{"mode": "or", "strategies": []interface{}{"never", "always-sell"}}, models.SignalTypeSell, 0.7, 0.7, []string{"1个子策略发出信号", "always-sell[always-sell] 卖出"}},
+		{"OR冲突", map[string]interface{}{"mode": "or", "strategies": []interface{}{"always-buy", "always-sell"}}, models.SignalTypeHold, 0.5, 0.5, []string{"买卖信号冲突"}},
+		{"加权未达阈值", map[string]interface{}{"mode": "weighted", "strategies": []interface{}{"always-buy", "always-buy-2", "always-sell"}}, models.SignalTypeHold, 0.5, 0.5, []string{"加权投票得分+0.163", "always-sell[always-sell] 卖出 强度0.70 置信度0.70 权重1 贡献-0.163"}},
+		{"加权买入", map[string]interface{}{"mode": "weighted", "strategies": []interface{}{"always-buy", "always-buy-2", "always-sell"}, "weights": map[string]interface{}{"always-buy": 2.0}, "threshold": 0.2}, models.SignalTypeBuy, 0.245, 0.7, []string{"加权投票得分+0.245", "always-buy[always-buy] 买入 强度0.70 置信度0.70 权重2 贡献+0.245"}},
+		{"过滤放行", map[string]interface{}{"mode": "filter", "filter": "always-buy", "trigger": "always-buy-2"}, models.SignalTypeBuy, 0.7, 0.7, []string{"过滤策略放行买入", "过滤 always-buy[always-buy]", "触发 always-buy-2[always-buy-2]"}},
+		{"过滤拦截", map[string]interface{}{"mode": "filter", "filter": "never", "trigger": "always-buy"}, models.SignalTypeHold, 0.5, 0.5, []string{"过滤策略未放行买入"}},
+		{"过滤不拦截卖出", map[string]interface{}{"mode": "filter", "filter": "never", "trigger": "always-sell"}, models.SignalTypeSell, 0.7, 0.7, []string{"触发策略卖出"}},
+	}
+
+	second := &models.Strategy{ID: "always-buy-2", Name: "always-buy-2", Type: models.StrategyTypeTechnical, Code: "ENTRY: CLOSE > 1"}
+	if err := service.CreateStrategy(ctx, second); err != nil {
+		t.Fatalf("创建规则策略失败: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &models.Strategy{Name: tt.name, Type: models.StrategyTypeComposite, Parameters: tt.params}
+			strategy.ID = "composite-" + tt.name
+			if err := service.CreateStrategy(ctx, strategy); err != nil {
+				t.Fatalf("创建复合策略失败: %v", err)
+			}
+			signal, err := service.ExecuteStrategy(ctx, strategy.ID, marketData, history)
+			if err != nil {
+				t.Fatalf("执行复合策略失败: %v", err)
+			}
+			if signal.SignalType != tt.want || math.Abs(signal.Strength-tt.strength) > 1e-9 || math.Abs(signal.Confidence-tt.confidence) > 1e-9 {
+				t.Errorf("信号应为 %s 强度%.3f 置信度%.3f, 实际 %s 强度%.3f 置信度%.3f",
+					tt.want, tt.strength, tt.confidence, signal.SignalType, signal.Strength, signal.Confidence)
+			}
+			for _, want := range tt.reason {
+				if !strings.Contains(signal.Reason, want) {
+					t.Errorf("信号原因应包含 %q, 实际 %q", want, signal.Reason)
+				}
+			}
+		})
+	}
+
+	// 复合策略可以嵌套引用复合策略
+	nested := &models.Strategy{ID: "nested", Name: "嵌套", Type: models.StrategyTypeComposite,
+		Parameters: map[string]interface{}{"mode": "and", "strategies": []interface{}{"composite-AND一致", "always-buy"}}}
+	if err := service.CreateStrategy(ctx, nested); err != nil {
+		t.Fatalf("创建嵌套复合策略失败: %v", err)
+	}
+	if signal, err := service.ExecuteStrategy(ctx, nested.ID, marketData, history); err != nil || signal.SignalType != models.SignalTypeBuy {
+		t.Errorf("嵌套复合策略应买入: %+v, %v", signal, err)
+	}
+}
+
+// TestCompositeStrategy_FilterWithCrossover 均线交叉策略只在交叉当日发出信号，作为过滤策略时按有效期内最近一次信号判断状态
+func TestCompositeStrategy_FilterWithCrossover(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	createConstantRuleStrategies(t, service)
+
+	// 先下跌后上涨形成金叉，再下跌形成死叉
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 20-float64(i)*0.2)
+	}
+	for i := 1; i <= 20; i++ {
+		closes = append(closes, 14+float64(i)*0.5)
+	}
+	for i := 1; i <= 20; i++ {
+		closes = append(closes, 24-float64(i)*0.6)
+	}
+	history := buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), closes)
+
+	crossover, err := service.GetStrategy(ctx, "ma_crossover")
+	if err != nil {
+		t.Fatalf("获取均线交叉策略失败: %v", err)
+	}
+	goldenCross, deathCross := -1, -1
+	for end := 1; end <= len(history); end++ {
+		signal, err := service.ExecuteStrategyWith(ctx, crossover, lastBarMarketData(t, history[:end]), history[:end])
+		if err != nil {
+			t.Fatalf("执行均线交叉策略失败: %v", err)
+		}
+		switch {
+		case signal.SignalType == models.SignalTypeBuy && goldenCross < 0:
+			goldenCross = end
+		case signal.SignalType == models.SignalTypeSell && goldenCross > 0 && deathCross < 0:
+			deathCross = end
+		}
+	}
+	if goldenCross < 0 || deathCross < 0 || deathCross-goldenCross < 5 || deathCross+3 > len(history) {
+		t.Fatalf("测试数据应先金叉后死叉: 金叉 %d, 死叉 %d", goldenCross, deathCross)
+	}
+
+	execute := func(id string, lookback int, end int) *models.Signal {
+		t.Helper()
+		strategy := &models.Strategy{ID: id, Name: id, Type: models.StrategyTypeComposite,
+			Parameters: map[string]interface{}{"mode": "filter", "filter": "ma_crossover", "trigger": "always-buy", "filter_lookback": float64(lookback)}}
+		if _, err := service.GetStrategy(ctx, id); err != nil {
+			if err := service.CreateStrategy(ctx, strategy); err != nil {
+				t.Fatalf("创建复合策略失败: %v", err)
+			}
+		}
+		signal, err := service.ExecuteStrategy(ctx, id, lastBarMarketData(t, history[:end]), history[:end])
+		if err != nil {
+			t.Fatalf("执行复合策略失败: %v", err)
+		}
+		return signal
+	}
+
+	// 金叉后3个交易日均线仍为多头排列，过滤策略当日持有，沿用金叉的买入状态放行
+	if signal := execute("filter-trend", 20, goldenCross+3); signal.SignalType != models.SignalTypeBuy || !strings.Contains(signal.Reason, "过滤策略3个交易日前发出买入信号") {
+		t.Errorf("金叉后应放行触发策略的买入: %s %s", signal.SignalType, signal.Reason)
+	}
+	// 只看当日信号时，金叉之后的持有拦截买入
+	if signal := execute("filter-same-bar", 1, goldenCross+3); signal.SignalType != models.SignalTypeHold {
+		t.Errorf("有效期为1时只在金叉当日放行: %s %s", signal.SignalType, signal.Reason)
+	}
+	// 死叉之后最近一次信号为卖出，拦截买入
+	if signal := execute("filter-trend", 20, deathCross+2); signal.SignalType != models.SignalTypeHold || !strings.Contains(signal.Reason, "过滤策略2个交易日前发出卖出信号") {
+		t.Errorf("死叉后应拦截触发策略的买入: %s %s", signal.SignalType, signal.Reason)
+	}
+}
+
+func TestCompositeStrategy_Validation(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	createConstantRuleStrategies(t, service)
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"缺少参数", nil, "不支持的组合方式"},
+		{"未知方式", map[string]interface{}{"mode": "xor", "strategies": []interface{}{"always-buy", "never"}}, "不支持的组合方式"},
+		{"子策略不足", map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy"}}, "至少需要2个子策略"},
+		{"子策略重复", map[string]interface{}{"mode": "or", "strategies": []interface{}{"always-buy", "always-buy"}}, "子策略 always-buy 重复"},
+		{"子策略不存在", map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy", "missing"}}, "子策略 missing 不存在"},
+		{"权重无效", map[string]interface{}{"mode": "weighted", "strategies": []interface{}{"always-buy", "never"}, "weights": map[string]interface{}{"never": 0.0}}, "权重必须大于0"},
+		{"权重多余", map[string]interface{}{"mode": "weighted", "strategies": []interface{}{"always-buy", "never"}, "weights": map[string]interface{}{"always-sell": 1.0}}, "不在子策略列表中"},
+		{"阈值越界", map[string]interface{}{"mode": "weighted", "strategies": []interface{}{"always-buy", "never"}, "threshold": 1.5}, "threshold 必须在0-1之间"},
+		{"过滤相同", map[string]interface{}{"mode": "filter", "filter": "never", "trigger": "never"}, "不能是同一个策略"},
+		{"过滤有效期无效", map[string]interface{}{"mode": "filter", "filter": "never", "trigger": "always-buy", "filter_lookback": 0.0}, "filter_lookback 必须在1-"},
+		{"引用自身", map[string]interface{}{"mode": "or", "strategies": []interface{}{"always-buy", "self"}}, "形成循环"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &models.Strategy{ID: "self", Name: tt.name, Type: models.StrategyTypeComposite, Parameters: tt.params}
+			err := service.CreateStrategy(ctx, strategy)
+			if !errors.Is(err, ErrInvalidComposite) {
+				t.Fatalf("应返回 ErrInvalidComposite, 实际 %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误信息应包含 %q, 实际 %q", tt.want, err.Error())
+			}
+		})
+	}
+
+	// A 引用 B 后，再把 B 改为引用 A 会形成循环
+	a := &models.Strategy{ID: "a", Name: "A", Type: models.StrategyTypeComposite, Parameters: map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy", "never"}}}
+	b := &models.Strategy{ID: "b", Name: "B", Type: models.StrategyTypeComposite, Parameters: map[string]interface{}{"mode": "or", "strategies": []interface{}{"a", "never"}}}
+	for _, strategy := range []*models.Strategy{a, b} {
+		if err := service.CreateStrategy(ctx, strategy); err != nil {
+			t.Fatalf("创建复合策略失败: %v", err)
+		}
+	}
+	cyclic := map[string]interface{}{"mode": "and", "strategies": []interface{}{"always-buy", "b"}}
+	if err := service.UpdateStrategy(ctx, "a", &models.UpdateStrategyRequest{Parameters: &cyclic}); !errors.Is(err, ErrInvalidComposite) || !strings.Contains(err.Error(), "形成循环") {
+		t.Errorf("循环引用应校验失败, 实际 %v", err)
+	}
+
+	// 被复合策略引用的策略不能删除
+	if err := service.DeleteStrategy(ctx, "never"); !errors.Is(err, ErrStrategyInUse) || !strings.Contains(err.Error(), "a, b") {
+		t.Errorf("删除被引用的策略应返回 ErrStrategyInUse, 实际 %v", err)
+	}
+	if err := service.DeleteStrategy(ctx, "b"); err != nil {
+		t.Errorf("未被引用的复合策略应能删除: %v", err)
+	}
+
+	if errs := service.ValidateParameters(models.StrategyTypeComposite, map[string]interface{}{"mode": "filter", "filter": "never", "trigger": "missing"}); len(errs) != 1 || errs[0]["field"] != "strategies" {
+		t.Errorf("参数校验接口应报告不存在的子策略: %v", errs)
+	}
+}
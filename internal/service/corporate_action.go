@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var (
+	// ErrInvalidPriceAdjust 回测的复权方式无效
+	ErrInvalidPriceAdjust = errors.New("复权方式无效")
+	// ErrInvalidCorporateAction 导入的分红送转记录无效
+	ErrInvalidCorporateAction = errors.New("分红送转记录无效")
+)
+
+// ValidatePriceAdjust 校验回测的复权方式，为空表示前复权
+func ValidatePriceAdjust(mode models.PriceAdjustMode) error {
+	switch mode {
+	case "", models.PriceAdjustForward, models.PriceAdjustNone:
+		return nil
+	default:
+		return fmt.Errorf("%w: 不支持的复权方式 %q", ErrInvalidPriceAdjust, mode)
+	}
+}
+
+// priceAdjust 返回回测的复权方式，未设置时使用前复权
+func priceAdjust(backtest *models.Backtest) models.PriceAdjustMode {
+	if backtest.PriceAdjust == "" {
+		return models.PriceAdjustForward
+	}
+	return backtest.PriceAdjust
+}
+
+// ValidateCorporateActions 校验导入的分红送转记录：除权除息日为 YYYYMMDD 且不重复，派息和送转不能为负且不能全为0
+func ValidateCorporateActions(actions []models.CorporateAction) error {
+	seen := make(map[string]bool, len(actions))
+	for i, action := range actions {
+		if _, err := time.Parse("20060102", action.ExDate); err != nil {
+			return fmt.Errorf("%w: 第%d条记录的除权除息日 %q 格式应为 YYYYMMDD", ErrInvalidCorporateAction, i+1, action.ExDate)
+		}
+		if seen[action.ExDate] {
+			return fmt.Errorf("%w: 除权除息日 %s 重复", ErrInvalidCorporateAction, action.ExDate)
+		}
+		seen[action.ExDate] = true
+		if action.CashDividend < 0 || action.BonusShares < 0 || action.TransferShares < 0 {
+			return fmt.Errorf("%w: 除权除息日 %s 的派息和送转不能为负数", ErrInvalidCorporateAction, action.ExDate)
+		}
+		if action.CashDividend == 0 && action.ShareRatio() == 0 {
+			return fmt.Errorf("%w: 除权除息日 %s 没有派息或送转", ErrInvalidCorporateAction, action.ExDate)
+		}
+	}
+	return nil
+}
+
+// ImportCorporateActions 导入股票的分红送转记录，覆盖之前导入的记录；actions 为空时清除导入记录，回测改用数据源的记录
+func (s *BacktestService) ImportCorporateActions(ctx context.Context, symbol string, actions []models.CorporateAction) error {
+	symbol = strings.TrimSpace(symbol)
+	if symbol == "" {
+		return fmt.Errorf("%w: 股票代码不能为空", ErrInvalidCorporateAction)
+	}
+	if err := ValidateCorporateActions(actions); err != nil {
+		return err
+	}
+
+	imported := make([]models.CorporateAction, len(actions))
+	copy(imported, actions)
+	for i := range imported {
+		imported[i].TSCode = symbol
+	}
+	sort.Slice(imported, func(i, j int) bool {
+		return imported[i].ExDate < imported[j].ExDate
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.store != nil {
+		if err := s.store.SaveCorporateActions(symbol, imported); err != nil {
+			return err
+		}
+	}
+	if len(imported) == 0 {
+		delete(s.corporateActions, symbol)
+	} else {
+		s.corporateActions[symbol] = imported
+	}
+
+	s.logger.Info("导入分红送转记录",
+		logger.String("symbol", symbol),
+		logger.Int("count", len(imported)),
+	)
+	return nil
+}
+
+// GetCorporateActions 获取股票在日期区间（YYYYMMDD，为空时不限制）内已实施的分红送转记录
+// 有导入记录时只使用导入的记录，否则从数据源获取
+func (s *BacktestService) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]models.CorporateAction, error) {
+	s.mutex.RLock()
+	imported, ok := s.corporateActions[symbol]
+	s.mutex.RUnlock()
+
+	if !ok {
+		if s.dataSourceService == nil {
+			return nil, errors.New("数据源服务未配置")
+		}
+		dataClient, err := s.dataSourceService.GetClient()
+		if err != nil {
+			return nil, fmt.Errorf("获取数据源客户端失败: %w", err)
+		}
+		return dataClient.GetCorporateActions(symbol, startDate, endDate)
+	}
+
+	actions := make([]models.CorporateAction, 0, len(imported))
+	for _, action := range imported {
+		if (startDate == "" || action.ExDate >= startDate) && (endDate == "" || action.ExDate <= endDate) {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// corporateActionSchedule 回测期间按除权除息日排序的分红送转事件
+type corporateActionSchedule struct {
+	actions []models.CorporateAction
+	next    int
+}
+
+// loadCorporateActions 加载回测股票在回测期间的分红送转记录，获取失败的股票按没有分红送转处理
+func (s *BacktestService) loadCorporateActions(ctx context.Context, backtest *models.Backtest, symbols []string) *corporateActionSchedule {
+	startDate, endDate := backtest.StartDate.Format("20060102"), backtest.EndDate.Format("20060102")
+
+	schedule := &corporateActionSchedule{}
+	for _, symbol := range symbols {
+		if ctx.Err() != nil {
+			break
+		}
+		actions, err := s.GetCorporateActions(ctx, symbol, startDate, endDate)
+		if err != nil {
+			s.logger.Warn("获取分红送转记录失败，按无分红送转处理",
+				logger.String("backtest_id", backtest.ID),
+				logger.String("symbol", symbol),
+				logger.ErrorField(err),
+			)
+			continue
+		}
+		for _, action := range actions {
+			action.TSCode = symbol
+			schedule.actions = append(schedule.actions, action)
+		}
+	}
+
+	sort.SliceStable(schedule.actions, func(i, j int) bool {
+		return schedule.actions[i].ExDate < schedule.actions[j].ExDate
+	})
+	s.logger.Info("已加载分红送转记录",
+		logger.String("backtest_id", backtest.ID),
+		logger.Int("count", len(schedule.actions)),
+	)
+	return schedule
+}
+
+// due 返回除权除息日不晚于指定交易日且尚未处理的事件
+func (c *corporateActionSchedule) due(date time.Time) []models.CorporateAction {
+	if c == nil {
+		return nil
+	}
+	day := date.Format("20060102")
+	start := c.next
+	for c.next < len(c.actions) && c.actions[c.next].ExDate <= day {
+		c.next++
+	}
+	return c.actions[start:c.next]
+}
+
+// lotAdjustment 除权除息对某个策略持仓的调整，用于开平仓配对时同步调整未平仓的买入
+type lotAdjustment struct {
+	strategyID   string
+	symbol       string
+	date         time.Time
+	cashDividend float64 // 每股派息
+	shareRatio   float64 // 每股送转
+}
+
+// applyCorporateAction 在除权除息日开盘前将送转股和现金分红记入持仓和现金，返回分红金额和送转获得的股数
+// 送转不足1股的部分舍去；成本价、持仓期最高价和建仓ATR按除权除息后的价格调整，使止损止盈比例保持不变
+func applyCorporateAction(portfolio *models.Portfolio, action models.CorporateAction) (float64, int) {
+	position, ok := portfolio.Positions[action.TSCode]
+	if !ok || position.Quantity <= 0 {
+		return 0, 0
+	}
+
+	dividend := math.Round(float64(position.Quantity)*action.CashDividend*100) / 100
+	shares := int(math.Floor(float64(position.Quantity)*action.ShareRatio() + 1e-9))
+	scale := float64(position.Quantity) / float64(position.Quantity+shares)
+
+	position.Quantity += shares
+	position.AvgPrice = math.Max(position.AvgPrice-action.CashDividend, 0) * scale
+	if position.PeakPrice > 0 {
+		position.PeakPrice = math.Max(position.PeakPrice-action.CashDividend, 0) * scale
+	}
+	position.EntryATR *= scale
+	portfolio.Positions[action.TSCode] = position
+	portfolio.Cash += dividend
+
+	return dividend, shares
+}
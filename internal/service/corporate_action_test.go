@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+func TestValidateCorporateActions(t *testing.T) {
+	valid := []models.CorporateAction{
+		{ExDate: "20240620", CashDividend: 0.5},
+		{ExDate: "20230615", BonusShares: 0.3, TransferShares: 0.2},
+	}
+	if err := ValidateCorporateActions(valid); err != nil {
+		t.Errorf("记录应有效: %v", err)
+	}
+
+	invalid := [][]models.CorporateAction{
+		{{ExDate: "2024-06-20", CashDividend: 0.5}},
+		{{ExDate: "20240620", CashDividend: 0.5}, {ExDate: "20240620", BonusShares: 0.1}},
+		{{ExDate: "20240620", CashDividend: -0.5}},
+		{{ExDate: "20240620"}},
+	}
+	for _, actions := range invalid {
+		if err := ValidateCorporateActions(actions); !errors.Is(err, ErrInvalidCorporateAction) {
+			t.Errorf("记录 %+v 应返回 ErrInvalidCorporateAction, 实际 %v", actions, err)
+		}
+	}
+
+	if err := ValidatePriceAdjust("hfq"); !errors.Is(err, ErrInvalidPriceAdjust) {
+		t.Errorf("后复权暂不支持, 实际 %v", err)
+	}
+}
+
+func TestApplyCorporateAction(t *testing.T) {
+	portfolio := &models.Portfolio{
+		Cash: 1000,
+		Positions: map[string]models.Position{
+			"600000.SH": {Symbol: "600000.SH", Quantity: 1050, AvgPrice: 10.5, PeakPrice: 12.5, EntryATR: 0.6},
+		},
+	}
+
+	// 10送3转2派5元：1050股获得525股和525元分红
+	dividend, shares := applyCorporateAction(portfolio, models.CorporateAction{
+		TSCode: "600000.SH", ExDate: "20240620", CashDividend: 0.5, BonusShares: 0.3, TransferShares: 0.2,
+	})
+	if dividend != 525 || shares != 525 {
+		t.Fatalf("分红和送转股数错误: %.2f, %d", dividend, shares)
+	}
+
+	position := portfolio.Positions["600000.SH"]
+	if position.Quantity != 1575 || portfolio.Cash != 1525 {
+		t.Errorf("持仓或现金错误: %d, %.2f", position.Quantity, portfolio.Cash)
+	}
+	if math.Abs(position.AvgPrice-20.0/3) > 1e-9 || math.Abs(position.PeakPrice-8) > 1e-9 || math.Abs(position.EntryATR-0.4) > 1e-9 {
+		t.Errorf("成本价、最高价和ATR应按除权价调整: %+v", position)
+	}
+
+	// 没有持仓的股票不受影响
+	if dividend, shares := applyCorporateAction(portfolio, models.CorporateAction{TSCode: "000001.SZ", CashDividend: 1}); dividend != 0 || shares != 0 {
+		t.Errorf("未持仓时不应分红: %.2f, %d", dividend, shares)
+	}
+}
+
+func TestBuildRoundTrips_CorporateActions(t *testing.T) {
+	start := time.Date(2024, 6, 17, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{StrategyID: "s1", Symbol: "600000.SH", Side: models.TradeSideBuy, Quantity: 1000, Price: 10.5, Timestamp: start},
+		{StrategyID: "s1", Symbol: "600000.SH", Side: models.TradeSideSell, Quantity: 1500, Price: 7, Timestamp: start.AddDate(0, 0, 4)},
+	}
+	adjustments := []lotAdjustment{{strategyID: "s1", symbol: "600000.SH", date: start.AddDate(0, 0, 2), cashDividend: 0.5, shareRatio: 0.5}}
+
+	trips := buildRoundTrips(trades, nil, adjustments)
+	if len(trips) != 1 || trips[0].Quantity != 1500 {
+		t.Fatalf("送转股应与原持仓一起平仓: %+v", trips)
+	}
+	// 除权后建仓价 (10.5-0.5)/1.5，盈亏包含分红
+	if math.Abs(trips[0].EntryPrice-20.0/3) > 1e-9 || math.Abs(trips[0].PnL-500) > 1e-6 {
+		t.Errorf("除权后的建仓价或盈亏错误: %+v", trips[0])
+	}
+}
+
+func TestSimulateBacktest_CorporateActions(t *testing.T) {
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	exDate := "20240220"
+
+	// 不复权行情：除权除息日起价格按10送5派5元除权
+	bars := buildTestDailyBars("600000.SH", start, steadyCloses(120, 0.001))
+	closes := make([]float64, len(bars))
+	for i, bar := range bars {
+		closes[i] = bar.Close.InexactFloat64()
+		if bar.TradeDate >= exDate {
+			closes[i] = (closes[i] - 0.5) / 1.5
+		}
+	}
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars:                 map[string][]models.StockDaily{"600000.SH": buildTestDailyBars("600000.SH", start, closes)},
+	}
+	dataClient.CorporateActionData = []models.CorporateAction{{TSCode: "600000.SH", ExDate: exDate, CashDividend: 0.5, BonusShares: 0.5}}
+	service := NewBacktestService(newTestStrategyService(t), &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	strategies := []*models.Strategy{{
+		ID:         "momentum_rotation",
+		Type:       models.StrategyTypeRebalance,
+		Parameters: map[string]interface{}{"frequency": "monthly", "top_n": 1.0, "lookback": 5.0},
+	}}
+	backtest := &models.Backtest{
+		ID:          "bt-corporate-actions",
+		StrategyIDs: []string{"momentum_rotation"},
+		Symbols:     []string{"600000.SH"},
+		StartDate:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		InitialCash: 1000000,
+		PriceAdjust: models.PriceAdjustNone,
+	}
+
+	runData, err := service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) != 1 {
+		t.Fatalf("应只在首日建仓, 实际 %+v", runData.Trades)
+	}
+	bought := runData.Trades[0].Quantity
+	result := runData.Results[0]
+	if result.BonusShares != bought/2 || math.Abs(result.DividendIncome-float64(bought)*0.5) > 0.01 {
+		t.Errorf("送转股数或分红收入错误: %d, %.2f (买入 %d 股)", result.BonusShares, result.DividendIncome, bought)
+	}
+
+	// 报告中的持仓包含送转股，与回测引擎一致
+	positions := openPositions(&models.BacktestResultsResponse{Performance: runData.Results, Trades: runData.Trades})
+	if len(positions) != 1 || positions[0].Quantity != bought+result.BonusShares {
+		t.Errorf("报告持仓应包含送转股, 实际 %+v (买入 %d 股, 送转 %d 股)", positions, bought, result.BonusShares)
+	}
+
+	// 除权除息当日总资产不应因价格除权而下跌
+	curve := runData.EquityCurve
+	for i := 1; i < len(curve); i++ {
+		if change := curve[i].PortfolioValue/curve[i-1].PortfolioValue - 1; math.Abs(change) > 0.01 {
+			t.Errorf("%s 总资产异常变化 %.2f%%", curve[i].Date, change*100)
+		}
+	}
+
+	// 导入的记录优先于数据源：导入只有派息的记录后不再使用数据源的送转
+	if err := service.ImportCorporateActions(context.Background(), "600000.SH", []models.CorporateAction{{ExDate: exDate, CashDividend: 0.5}}); err != nil {
+		t.Fatalf("导入记录失败: %v", err)
+	}
+	runData, err = service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if result := runData.Results[0]; result.BonusShares != 0 || result.DividendIncome == 0 {
+		t.Errorf("应只使用导入的派息记录: %+v", result)
+	}
+
+	// 前复权回测不处理分红送转
+	backtest.PriceAdjust = ""
+	runData, err = service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if result := runData.Results[0]; result.BonusShares != 0 || result.DividendIncome != 0 {
+		t.Errorf("前复权回测不应计入分红送转: %+v", result)
+	}
+}
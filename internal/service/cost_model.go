@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"stock-a-future/internal/models"
+)
+
+var (
+	ErrUnknownCostProfile = errors.New("未知的交易成本方案")
+	ErrInvalidCostConfig  = errors.New("交易成本参数无效")
+)
+
+// 预设交易成本方案名称
+const (
+	CostProfileStandard      = "standard"       // 普通券商：万2.5佣金，最低5元
+	CostProfileLowCommission = "low_commission" // 低佣账户：万1佣金，免五
+	CostProfileLegacy        = "legacy"         // 2023年8月印花税减半前的费率
+	CostProfileZero          = "zero"           // 无交易成本，用于对比成本对收益的影响
+	CostProfileCustom        = "custom"         // 自定义参数
+)
+
+// costProfiles 预设交易成本方案
+var costProfiles = map[string]models.CostConfig{
+	CostProfileStandard: {
+		CommissionRate:  0.00025,
+		MinCommission:   5,
+		StampDutyRate:   0.0005,
+		TransferFeeRate: 0.00001,
+	},
+	CostProfileLowCommission: {
+		CommissionRate:  0.0001,
+		StampDutyRate:   0.0005,
+		TransferFeeRate: 0.00001,
+	},
+	CostProfileLegacy: {
+		CommissionRate:  0.0003,
+		MinCommission:   5,
+		StampDutyRate:   0.001,
+		TransferFeeRate: 0.00002,
+	},
+	CostProfileZero: {},
+}
+
+// CostProfileNames 返回所有预设成本方案名称
+func CostProfileNames() []string {
+	names := make([]string, 0, len(costProfiles))
+	for name := range costProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveCostConfig 根据请求参数确定回测使用的交易成本参数
+// 优先级：自定义参数 > 预设方案 > 标准方案；未使用自定义参数时，
+// 旧的 commission/slippage 字段大于0时覆盖方案中的佣金费率和滑点
+func ResolveCostConfig(profile string, custom *models.CostConfig, commission, slippage float64) (*models.CostConfig, error) {
+	if custom != nil {
+		config := *custom
+		config.Profile = CostProfileCustom
+		if err := validateCostConfig(&config); err != nil {
+			return nil, err
+		}
+		return &config, nil
+	}
+
+	if profile == "" {
+		profile = CostProfileStandard
+	}
+	base, ok := costProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCostProfile, profile)
+	}
+
+	config := base
+	config.Profile = profile
+	if commission > 0 {
+		config.CommissionRate = commission
+	}
+	if slippage > 0 {
+		config.SlippageRate = slippage
+	}
+	if err := validateCostConfig(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// validateCostConfig 校验成本参数范围
+func validateCostConfig(config *models.CostConfig) error {
+	rates := []float64{config.CommissionRate, config.StampDutyRate, config.TransferFeeRate, config.SlippageRate}
+	for _, rate := range rates {
+		if rate < 0 || rate > 0.01 {
+			return fmt.Errorf("%w: 费率必须在0-1%%之间", ErrInvalidCostConfig)
+		}
+	}
+	if config.MinCommission < 0 || config.MinCommission > 100 {
+		return fmt.Errorf("%w: 最低佣金必须在0-100元之间", ErrInvalidCostConfig)
+	}
+	return nil
+}
+
+// CostModel 交易成本模型
+type CostModel interface {
+	// FillPrice 计算考虑滑点后的成交价
+	FillPrice(side models.TradeSide, price float64) float64
+	// Calculate 计算一笔成交的成本明细，refPrice 为未加滑点的参考价
+	Calculate(side models.TradeSide, quantity int, fillPrice, refPrice float64) models.TradeCost
+}
+
+// BrokerageCostModel A股券商交易成本模型：佣金（含最低佣金）、卖出印花税、过户费和滑点
+type BrokerageCostModel struct {
+	config models.CostConfig
+}
+
+// NewBrokerageCostModel 创建券商交易成本模型
+func NewBrokerageCostModel(config models.CostConfig) *BrokerageCostModel {
+	return &BrokerageCostModel{config: config}
+}
+
+// FillPrice 买入价按滑点上浮，卖出价按滑点下浮
+func (m *BrokerageCostModel) FillPrice(side models.TradeSide, price float64) float64 {
+	if side == models.TradeSideBuy {
+		return price * (1 + m.config.SlippageRate)
+	}
+	return price * (1 - m.config.SlippageRate)
+}
+
+// Calculate 计算成本明细
+func (m *BrokerageCostModel) Calculate(side models.TradeSide, quantity int, fillPrice, refPrice float64) models.TradeCost {
+	amount := float64(quantity) * fillPrice
+
+	commission := amount * m.config.CommissionRate
+	if commission < m.config.MinCommission {
+		commission = m.config.MinCommission
+	}
+
+	cost := models.TradeCost{
+		Commission:  commission,
+		TransferFee: amount * m.config.TransferFeeRate,
+		Slippage:    math.Abs(fillPrice-refPrice) * float64(quantity),
+	}
+	if side == models.TradeSideSell {
+		cost.StampDuty = amount * m.config.StampDutyRate
+	}
+	return cost
+}
+
+// costModelForBacktest 获取回测使用的成本模型，兼容未配置成本参数的旧回测
+func costModelForBacktest(backtest *models.Backtest) CostModel {
+	if backtest.CostConfig != nil {
+		return NewBrokerageCostModel(*backtest.CostConfig)
+	}
+	return NewBrokerageCostModel(models.CostConfig{
+		CommissionRate: backtest.Commission,
+		SlippageRate:   backtest.Slippage,
+	})
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestResolveCostConfig(t *testing.T) {
+	config, err := ResolveCostConfig("", nil, 0, 0)
+	if err != nil {
+		t.Fatalf("解析默认成本方案失败: %v", err)
+	}
+	if config.Profile != CostProfileStandard || config.MinCommission != 5 || config.StampDutyRate != 0.0005 {
+		t.Errorf("默认应使用标准方案, 实际: %+v", config)
+	}
+
+	config, err = ResolveCostConfig(CostProfileLowCommission, nil, 0.0002, 0.001)
+	if err != nil {
+		t.Fatalf("解析成本方案失败: %v", err)
+	}
+	if config.CommissionRate != 0.0002 || config.SlippageRate != 0.001 {
+		t.Errorf("commission/slippage字段应覆盖方案参数, 实际: %+v", config)
+	}
+
+	custom := &models.CostConfig{CommissionRate: 0.0001, StampDutyRate: 0.001}
+	config, err = ResolveCostConfig(CostProfileStandard, custom, 0.0003, 0)
+	if err != nil {
+		t.Fatalf("解析自定义成本参数失败: %v", err)
+	}
+	if config.Profile != CostProfileCustom || config.CommissionRate != 0.0001 || config.MinCommission != 0 {
+		t.Errorf("自定义参数应优先于方案, 实际: %+v", config)
+	}
+
+	if _, err := ResolveCostConfig("unknown", nil, 0, 0); !errors.Is(err, ErrUnknownCostProfile) {
+		t.Errorf("未知方案应返回 ErrUnknownCostProfile, 实际: %v", err)
+	}
+	if _, err := ResolveCostConfig("", &models.CostConfig{StampDutyRate: 0.5}, 0, 0); !errors.Is(err, ErrInvalidCostConfig) {
+		t.Errorf("超出范围的费率应返回 ErrInvalidCostConfig, 实际: %v", err)
+	}
+}
+
+func TestBrokerageCostModel_Calculate(t *testing.T) {
+	model := NewBrokerageCostModel(models.CostConfig{
+		CommissionRate:  0.00025,
+		MinCommission:   5,
+		StampDutyRate:   0.0005,
+		TransferFeeRate: 0.00001,
+		SlippageRate:    0.001,
+	})
+
+	// 小额买入触发最低佣金，买入不收印花税
+	buyPrice := model.FillPrice(models.TradeSideBuy, 10)
+	if math.Abs(buyPrice-10.01) > 1e-9 {
+		t.Errorf("买入成交价应上浮滑点, 实际 %v", buyPrice)
+	}
+	buy := model.Calculate(models.TradeSideBuy, 100, buyPrice, 10)
+	if buy.Commission != 5 {
+		t.Errorf("应收取最低佣金5元, 实际 %v", buy.Commission)
+	}
+	if buy.StampDuty != 0 {
+		t.Errorf("买入不应收取印花税, 实际 %v", buy.StampDuty)
+	}
+	if math.Abs(buy.Slippage-1) > 1e-9 {
+		t.Errorf("滑点成本应为1元, 实际 %v", buy.Slippage)
+	}
+
+	// 大额卖出按费率收取佣金和印花税
+	sellPrice := model.FillPrice(models.TradeSideSell, 10)
+	sell := model.Calculate(models.TradeSideSell, 100000, sellPrice, 10)
+	amount := 100000 * sellPrice
+	if math.Abs(sell.Commission-amount*0.00025) > 1e-6 {
+		t.Errorf("佣金计算错误: %v", sell.Commission)
+	}
+	if math.Abs(sell.StampDuty-amount*0.0005) > 1e-6 {
+		t.Errorf("印花税计算错误: %v", sell.StampDuty)
+	}
+	if math.Abs(sell.TransferFee-amount*0.00001) > 1e-6 {
+		t.Errorf("过户费计算错误: %v", sell.TransferFee)
+	}
+	if math.Abs(sell.Total()-(sell.Fees()+sell.Slippage)) > 1e-9 {
+		t.Error("成本合计应等于税费加滑点")
+	}
+}
+
+func TestExecuteSignalForStrategy_RecordsCostBreakdown(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	costConfig, err := ResolveCostConfig(CostProfileStandard, nil, 0, 0.001)
+	if err != nil {
+		t.Fatalf("解析成本方案失败: %v", err)
+	}
+	backtest := &models.Backtest{ID: "bt", CostConfig: costConfig}
+	buyDate := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	portfolio := &models.Portfolio{Cash: 100000, Positions: make(map[string]models.Position)}
+
+	buyBar := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: buyDate, Close: 10}, prevClose: 10}
+	buy, _ := service.executeSignalForStrategy(&models.Signal{SignalType: models.SignalTypeBuy}, buyBar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if buy == nil {
+		t.Fatal("期望买入成交")
+	}
+	if buy.Price != 10.01 || buy.StampDuty != 0 || buy.Commission != 5 {
+		t.Errorf("买入成本明细错误: %+v", buy)
+	}
+	expectedCash := 100000 - float64(buy.Quantity)*buy.Price - buy.Fees()
+	if math.Abs(portfolio.Cash-expectedCash) > 1e-6 {
+		t.Errorf("买入后现金应扣除成交额和税费: 期望 %.2f, 实际 %.2f", expectedCash, portfolio.Cash)
+	}
+
+	sellBar := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: buyDate.AddDate(0, 0, 1), Close: 10}, prevClose: 10}
+	sell, _ := service.executeSignalForStrategy(&models.Signal{SignalType: models.SignalTypeSell}, sellBar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if sell == nil {
+		t.Fatal("期望卖出成交")
+	}
+	if sell.Price != 9.99 || sell.StampDuty <= 0 || sell.SlippageCost <= 0 {
+		t.Errorf("卖出成本明细错误: %+v", sell)
+	}
+
+	result := (&models.PerformanceMetrics{Returns: []float64{0}, Trades: []models.Trade{*buy, *sell}}).CalculateMetrics()
+	if math.Abs(result.TotalCosts-(buy.TotalCost+sell.TotalCost)) > 1e-9 || result.TotalStampDuty != sell.StampDuty {
+		t.Errorf("成本汇总错误: %+v", result)
+	}
+}
@@ -122,6 +122,34 @@ func (s *DataSourceService) TestConnection() error {
 	return client.TestConnection()
 }
 
+// CurrentSource 返回当前数据源的类型和基础URL，用于记录回测的运行清单
+func (s *DataSourceService) CurrentSource() (string, string, error) {
+	client, err := s.GetClient()
+	if err != nil {
+		return "", "", fmt.Errorf("获取数据源客户端失败: %w", err)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var sourceType string
+	if s.config != nil {
+		sourceType = s.config.DataSourceType
+	}
+	return sourceType, client.GetBaseURL(), nil
+}
+
+// SourceType 返回当前配置的数据源类型，未配置时为空
+func (s *DataSourceService) SourceType() client.DataSourceType {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.config == nil {
+		return ""
+	}
+	return client.DataSourceType(s.config.DataSourceType)
+}
+
 // GetDataSourceInfo 获取当前数据源信息
 func (s *DataSourceService) GetDataSourceInfo() map[string]interface{} {
 	s.mutex.RLock()
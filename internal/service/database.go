@@ -134,6 +134,121 @@ func (s *DatabaseService) initTables() error {
 		UNIQUE(ts_code)
 	);`
 
+	// 创建回测表，完整参数以JSON格式保存
+	createBacktestsTable := `
+	CREATE TABLE IF NOT EXISTS backtests (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		status TEXT NOT NULL,               -- 回测状态: pending, running, completed, failed, cancelled
+		start_date TEXT NOT NULL,
+		end_date TEXT NOT NULL,
+		config TEXT NOT NULL,               -- 回测参数(JSON格式)
+		created_at DATETIME NOT NULL,
+		completed_at DATETIME,
+		updated_at DATETIME NOT NULL
+	);`
+
+	// 创建回测结果表（每个策略一条记录）
+	createBacktestResultsTable := `
+	CREATE TABLE IF NOT EXISTS backtest_results (
+		id TEXT PRIMARY KEY,
+		backtest_id TEXT NOT NULL,
+		strategy_id TEXT NOT NULL,
+		sort_order INTEGER DEFAULT 0,       -- 策略在回测中的顺序
+		metrics TEXT NOT NULL,              -- 性能指标(JSON格式)
+		created_at DATETIME NOT NULL
+	);`
+
+	// 创建回测交易记录表
+	createBacktestTradesTable := `
+	CREATE TABLE IF NOT EXISTS backtest_trades (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, -- 自增ID保持成交顺序
+		backtest_id TEXT NOT NULL,
+		strategy_id TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		side TEXT NOT NULL,
+		trade_time DATETIME NOT NULL,
+		data TEXT NOT NULL                  -- 交易记录(JSON格式)
+	);`
+
+	// 创建回测拒单记录表
+	createBacktestRejectedOrdersTable := `
+	CREATE TABLE IF NOT EXISTS backtest_rejected_orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		backtest_id TEXT NOT NULL,
+		strategy_id TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		data TEXT NOT NULL                  -- 拒单记录(JSON格式)
+	);`
+
+	// 创建回测开平仓记录表
+	createBacktestRoundTripsTable := `
+	CREATE TABLE IF NOT EXISTS backtest_round_trips (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, -- 自增ID保持平仓顺序
+		backtest_id TEXT NOT NULL,
+		strategy_id TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		data TEXT NOT NULL                  -- 开平仓记录(JSON格式)
+	);`
+
+	// 创建回测权益曲线表
+	createBacktestEquityCurvesTable := `
+	CREATE TABLE IF NOT EXISTS backtest_equity_curves (
+		backtest_id TEXT NOT NULL,
+		strategy_id TEXT NOT NULL DEFAULT '', -- 空字符串表示组合权益曲线
+		date TEXT NOT NULL,
+		portfolio_value REAL NOT NULL,
+		benchmark_value REAL DEFAULT 0,
+		cash REAL DEFAULT 0,
+		holdings REAL DEFAULT 0,
+		PRIMARY KEY (backtest_id, strategy_id, date)
+	);`
+
+	// 创建回测运行清单表，记录复现回测结果所需的输入和结果哈希
+	createBacktestManifestsTable := `
+	CREATE TABLE IF NOT EXISTS backtest_manifests (
+		backtest_id TEXT PRIMARY KEY,
+		data TEXT NOT NULL                  -- 运行清单(JSON格式)
+	);`
+
+	// 创建手工导入的分红送转表，回测时优先于数据源的记录
+	createCorporateActionsTable := `
+	CREATE TABLE IF NOT EXISTS corporate_actions (
+		ts_code TEXT NOT NULL,
+		ex_date TEXT NOT NULL,              -- 除权除息日 YYYYMMDD
+		data TEXT NOT NULL,                 -- 分红送转记录(JSON格式)
+		PRIMARY KEY (ts_code, ex_date)
+	);`
+
+	// 创建策略表，保存策略的当前定义
+	createStrategiesTable := `
+	CREATE TABLE IF NOT EXISTS strategies (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		data TEXT NOT NULL,                 -- 策略定义(JSON格式)
+		created_at DATETIME,
+		updated_at DATETIME
+	);`
+
+	// 创建策略版本表，每次创建、更新和回滚策略时追加一条
+	createStrategyVersionsTable := `
+	CREATE TABLE IF NOT EXISTS strategy_versions (
+		id TEXT PRIMARY KEY,
+		strategy_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		data TEXT NOT NULL,                 -- 版本快照(JSON格式)
+		created_at DATETIME,
+		UNIQUE (strategy_id, version)
+	);`
+
+	// 创建机器学习模型表，每个策略保留最近一次训练的模型
+	createMLModelsTable := `
+	CREATE TABLE IF NOT EXISTS ml_models (
+		strategy_id TEXT PRIMARY KEY,
+		data TEXT NOT NULL,                 -- 模型参数和交叉验证结果(JSON格式)
+		trained_at DATETIME
+	);`
+
 	// 创建索引
 	createIndexes := []string{
 		// 收藏股票索引
@@ -153,10 +268,23 @@ func (s *DatabaseService) initTables() error {
 		"CREATE INDEX IF NOT EXISTS idx_recent_views_ts_code ON recent_views(ts_code);",
 		"CREATE INDEX IF NOT EXISTS idx_recent_views_viewed_at ON recent_views(viewed_at DESC);",
 		"CREATE INDEX IF NOT EXISTS idx_recent_views_expires_at ON recent_views(expires_at);",
+
+		// 回测索引
+		"CREATE INDEX IF NOT EXISTS idx_backtests_created_at ON backtests(created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_backtest_results_backtest_id ON backtest_results(backtest_id);",
+		"CREATE INDEX IF NOT EXISTS idx_backtest_trades_backtest_id ON backtest_trades(backtest_id);",
+		"CREATE INDEX IF NOT EXISTS idx_backtest_rejected_orders_backtest_id ON backtest_rejected_orders(backtest_id);",
+		"CREATE INDEX IF NOT EXISTS idx_backtest_round_trips_backtest_id ON backtest_round_trips(backtest_id);",
 	}
 
 	// 执行建表语句
-	statements := append([]string{createGroupsTable, createStocksTable, createSignalsTable, createRecentViewsTable}, createIndexes...)
+	statements := append([]string{
+		createGroupsTable, createStocksTable, createSignalsTable, createRecentViewsTable,
+		createBacktestsTable, createBacktestResultsTable, createBacktestTradesTable,
+		createBacktestRejectedOrdersTable, createBacktestRoundTripsTable, createBacktestEquityCurvesTable,
+		createBacktestManifestsTable, createCorporateActionsTable,
+		createStrategiesTable, createStrategyVersionsTable, createMLModelsTable,
+	}, createIndexes...)
 
 	for _, stmt := range statements {
 		if _, err := s.db.Exec(stmt); err != nil {
@@ -391,7 +519,7 @@ func (s *DatabaseService) GetDatabaseStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// 获取各表的记录数
-	tables := []string{"favorite_groups", "favorite_stocks", "stock_signals"}
+	tables := []string{"favorite_groups", "favorite_stocks", "stock_signals", "backtests", "backtest_trades"}
 
 	for _, table := range tables {
 		var count int
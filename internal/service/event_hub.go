@@ -0,0 +1,85 @@
+package service
+
+import (
+	"sync"
+
+	"stock-a-future/internal/models"
+)
+
+// eventSubscriberBuffer 每个订阅者的事件缓冲区大小
+const eventSubscriberBuffer = 256
+
+// eventHub 按任务ID分发进度事件，每个任务可以有多个订阅者
+// 发布不会阻塞：订阅者的缓冲区满时断开该订阅者，客户端重连后会重新收到当前状态
+type eventHub struct {
+	mutex       sync.Mutex
+	subscribers map[string]map[chan models.ProgressEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[string]map[chan models.ProgressEvent]struct{})}
+}
+
+// subscribe 订阅任务事件，snapshot 作为第一个事件；任务已结束（done）时只推送 snapshot 后关闭
+// 返回的取消函数可重复调用
+func (h *eventHub) subscribe(jobID string, snapshot models.ProgressEvent, done bool) (<-chan models.ProgressEvent, func()) {
+	ch := make(chan models.ProgressEvent, eventSubscriberBuffer)
+	ch <- snapshot
+	if done {
+		close(ch)
+		return ch, func() {}
+	}
+
+	h.mutex.Lock()
+	if h.subscribers[jobID] == nil {
+		h.subscribers[jobID] = make(map[chan models.ProgressEvent]struct{})
+	}
+	h.subscribers[jobID][ch] = struct{}{}
+	h.mutex.Unlock()
+
+	return ch, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.remove(jobID, ch)
+	}
+}
+
+// publish 向任务的所有订阅者推送事件
+func (h *eventHub) publish(jobID string, event models.ProgressEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ch := range h.subscribers[jobID] {
+		select {
+		case ch <- event:
+		default:
+			h.remove(jobID, ch)
+		}
+	}
+}
+
+// closeJob 任务结束，关闭所有订阅者的事件通道
+func (h *eventHub) closeJob(jobID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ch := range h.subscribers[jobID] {
+		h.remove(jobID, ch)
+	}
+}
+
+// remove 移除并关闭订阅者，调用方需持有锁
+func (h *eventHub) remove(jobID string, ch chan models.ProgressEvent) {
+	subscribers, ok := h.subscribers[jobID]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, jobID)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+	snapshot := models.ProgressEvent{Type: models.ProgressEventSnapshot}
+
+	first, cancelFirst := hub.subscribe("job", snapshot, false)
+	second, _ := hub.subscribe("job", snapshot, false)
+	hub.publish("job", models.ProgressEvent{Type: models.ProgressEventProgress, Data: 50})
+	hub.publish("other", models.ProgressEvent{Type: models.ProgressEventProgress, Data: 10})
+
+	for _, ch := range []<-chan models.ProgressEvent{first, second} {
+		if event := <-ch; event.Type != models.ProgressEventSnapshot {
+			t.Errorf("第一个事件应为快照, 实际 %s", event.Type)
+		}
+		if event := <-ch; event.Data != 50 {
+			t.Errorf("应收到本任务的进度事件, 实际 %+v", event)
+		}
+	}
+
+	// 取消订阅后通道关闭，重复取消不会panic
+	cancelFirst()
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Error("取消订阅后通道应关闭")
+	}
+
+	hub.closeJob("job")
+	if _, ok := <-second; ok {
+		t.Error("任务结束后通道应关闭")
+	}
+
+	// 已结束的任务只推送快照
+	done, _ := hub.subscribe("finished", snapshot, true)
+	if event, ok := <-done; !ok || event.Type != models.ProgressEventSnapshot {
+		t.Error("已结束的任务应先推送快照")
+	}
+	if _, ok := <-done; ok {
+		t.Error("已结束的任务推送快照后应关闭通道")
+	}
+}
+
+func TestEventHub_SlowSubscriberDropped(t *testing.T) {
+	hub := newEventHub()
+	ch, _ := hub.subscribe("job", models.ProgressEvent{Type: models.ProgressEventSnapshot}, false)
+	for i := 0; i < eventSubscriberBuffer+10; i++ {
+		hub.publish("job", models.ProgressEvent{Type: models.ProgressEventProgress, Data: i})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != eventSubscriberBuffer {
+		t.Errorf("缓冲区满时应断开订阅者, 收到 %d 个事件", received)
+	}
+}
+
+func TestSubscribeBacktest(t *testing.T) {
+	bars := buildTestDailyBars("000001.SZ", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), trendingCloses(140, 8, 0.02))
+	service := newSimulationTestService(t, bars)
+
+	strategies := []*models.Strategy{{ID: "ma_crossover", Version: "3", Parameters: map[string]interface{}{"short_period": 3.0, "long_period": 10.0}}}
+	backtest := &models.Backtest{
+		ID:          "bt-events",
+		StrategyIDs: []string{"ma_crossover"},
+		Symbols:     []string{"000001.SZ"},
+		StartDate:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+		Status:      models.BacktestStatusPending,
+	}
+	service.backtests[backtest.ID] = backtest
+
+	events, cancel, err := service.SubscribeBacktest(backtest.ID)
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	defer cancel()
+
+	if err := service.StartBacktest(context.Background(), backtest, strategies); err != nil {
+		t.Fatalf("启动回测失败: %v", err)
+	}
+	if backtest.StrategyVersions["ma_crossover"] != "3" {
+		t.Errorf("回测应记录运行时的策略版本: %v", backtest.StrategyVersions)
+	}
+
+	counts := make(map[models.ProgressEventType]int)
+	var last models.ProgressEvent
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				done = true
+				break
+			}
+			counts[event.Type]++
+			last = event
+		case <-timeout:
+			t.Fatal("等待回测事件超时")
+		}
+	}
+
+	if counts[models.ProgressEventSnapshot] != 1 || counts[models.ProgressEventProgress] == 0 {
+		t.Errorf("事件数量错误: %v", counts)
+	}
+	if counts[models.ProgressEventTrade] != len(service.backtestTrades[backtest.ID]) || counts[models.ProgressEventTrade] == 0 {
+		t.Errorf("应推送每笔成交: 推送 %d, 实际 %d", counts[models.ProgressEventTrade], len(service.backtestTrades[backtest.ID]))
+	}
+	if counts[models.ProgressEventEquity] != len(service.backtestEquityCurves[backtest.ID]) {
+		t.Errorf("应推送每个权益点: 推送 %d, 实际 %d", counts[models.ProgressEventEquity], len(service.backtestEquityCurves[backtest.ID]))
+	}
+	if progress, ok := last.Data.(*models.BacktestProgress); last.Type != models.ProgressEventStatus || !ok || progress.Status != string(models.BacktestStatusCompleted) {
+		t.Errorf("最后一个事件应为完成状态: %+v", last)
+	}
+
+	// 回测结束后订阅只收到包含完整结果的快照
+	late, _, err := service.SubscribeBacktest(backtest.ID)
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	event := <-late
+	snapshot, ok := event.Data.(*models.BacktestSnapshot)
+	if !ok || snapshot.Progress.Status != string(models.BacktestStatusCompleted) || len(snapshot.EquityCurve) != counts[models.ProgressEventEquity] {
+		t.Errorf("晚加入的订阅者应收到当前状态: %+v", event)
+	}
+	if _, ok := <-late; ok {
+		t.Error("已结束的回测推送快照后应关闭通道")
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidExecutionConfig = errors.New("成交时机参数无效")
+
+// defaultOrderValidDays 限价单默认有效交易日数
+const defaultOrderValidDays = 1
+
+// ValidateExecutionConfig 校验信号成交时机参数
+func ValidateExecutionConfig(config *models.ExecutionConfig) error {
+	if config == nil {
+		return nil
+	}
+
+	switch config.Timing {
+	case "", models.ExecutionSameBarClose, models.ExecutionNextBarOpen, models.ExecutionNextBarVWAP, models.ExecutionNextBarLimit:
+	default:
+		return fmt.Errorf("%w: 不支持的成交时机 %q", ErrInvalidExecutionConfig, config.Timing)
+	}
+	if config.LimitOffsetPct < 0 || config.LimitOffsetPct >= 0.1 {
+		return fmt.Errorf("%w: limit_offset_pct 必须在0-10%%之间", ErrInvalidExecutionConfig)
+	}
+	if config.OrderValidDays < 0 {
+		return fmt.Errorf("%w: order_valid_days 不能为负数", ErrInvalidExecutionConfig)
+	}
+	return nil
+}
+
+// executionTiming 返回回测的成交时机，未设置时按信号当日收盘价成交
+func executionTiming(backtest *models.Backtest) models.ExecutionTiming {
+	if backtest.Execution == nil || backtest.Execution.Timing == "" {
+		return models.ExecutionSameBarClose
+	}
+	return backtest.Execution.Timing
+}
+
+// newPendingOrder 根据信号日的K线生成次日起执行的挂单，持有信号不生成订单
+// 调仓信号的买卖方向由信号的 Side 决定
+func (s *BacktestService) newPendingOrder(signal *models.Signal, marketData *models.MarketData, backtest *models.Backtest, strategyID string) *models.Order {
+	if signal == nil {
+		return nil
+	}
+
+	var side models.TradeSide
+	switch signal.SignalType {
+	case models.SignalTypeBuy:
+		side = models.TradeSideBuy
+	case models.SignalTypeSell:
+		side = models.TradeSideSell
+	case models.SignalTypeRebalance:
+		side = signal.Side
+	default:
+		return nil
+	}
+
+	order := &models.Order{
+		ID:            fmt.Sprintf("%s_%s_%d", backtest.ID, marketData.Symbol, time.Now().UnixNano()),
+		StrategyID:    strategyID,
+		Symbol:        marketData.Symbol,
+		Side:          side,
+		Type:          models.OrderTypeMarket,
+		Timing:        executionTiming(backtest),
+		Status:        models.OrderStatusPending,
+		Signal:        signal,
+		RemainingDays: 1,
+		CreatedAt:     marketData.Date,
+	}
+
+	if order.Timing == models.ExecutionNextBarLimit {
+		config := backtest.Execution
+		offset := config.LimitOffsetPct
+		if side == models.TradeSideBuy {
+			offset = -offset
+		}
+		order.Type = models.OrderTypeLimit
+		order.Price = marketData.Close * (1 + offset)
+		if !backtest.DisableTradingRules {
+			order.Price = s.tradingRules.RoundToTick(order.Price)
+		}
+		order.RemainingDays = config.OrderValidDays
+		if order.RemainingDays == 0 {
+			order.RemainingDays = defaultOrderValidDays
+		}
+	}
+	return order
+}
+
+// orderExecutionPrice 计算挂单在当日K线上的申报价，限价单未触及限价时返回false
+// 限价单开盘即优于限价时按开盘价成交；成交均价（成交额/成交量）超出当日最高最低价时说明单位或数据有误，按开盘价成交
+func orderExecutionPrice(order *models.Order, marketData *models.MarketData) (float64, bool) {
+	if order.Type == models.OrderTypeLimit {
+		if order.Side == models.TradeSideBuy {
+			if marketData.Low > order.Price {
+				return 0, false
+			}
+			return math.Min(marketData.Open, order.Price), true
+		}
+		if marketData.High < order.Price {
+			return 0, false
+		}
+		return math.Max(marketData.Open, order.Price), true
+	}
+
+	if order.Timing == models.ExecutionNextBarVWAP && marketData.Volume > 0 && marketData.Amount > 0 {
+		if vwap := marketData.Amount / float64(marketData.Volume); vwap >= marketData.Low && vwap <= marketData.High {
+			return vwap, true
+		}
+	}
+	return marketData.Open, true
+}
+
+// executePendingOrder 在当日K线上撮合挂单
+// 返回的 keep 表示订单仍然有效，需要带到下一个交易日继续撮合
+func (s *BacktestService) executePendingOrder(order *models.Order, bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, sizer PositionSizer) (trade *models.Trade, rejected *models.RejectedOrder, keep bool) {
+	marketData := bar.marketData
+	price, triggered := orderExecutionPrice(order, marketData)
+	if !triggered || (bar.suspended && order.Type == models.OrderTypeLimit) {
+		order.RemainingDays--
+		if order.RemainingDays > 0 {
+			return nil, nil, true
+		}
+		order.Status = models.OrderStatusExpired
+		return nil, newRejectedOrder(backtest, order.StrategyID, marketData, order.Side, order.Quantity, order.Price, models.OrderRejectExpired), false
+	}
+
+	if !backtest.DisableTradingRules {
+		price = s.tradingRules.RoundToTick(price)
+	}
+	if order.Side == models.TradeSideBuy {
+		if order.Amount > 0 {
+			sizer = withTargetAmount(sizer, order.Amount)
+		}
+		trade, rejected = s.executeBuy(order.Signal, bar, portfolio, backtest, order.StrategyID, sizer, price)
+	} else {
+		trade, rejected = s.executePartialSell(bar, portfolio, backtest, order.StrategyID, order.Signal.SignalType, price, order.Quantity)
+	}
+
+	if trade != nil {
+		order.Status = models.OrderStatusFilled
+		executedAt := marketData.Date
+		order.ExecutedAt = &executedAt
+	}
+	return trade, rejected, false
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stock-a-future/config"
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestOrderExecutionPrice(t *testing.T) {
+	bar := &models.MarketData{Open: 10.2, High: 10.6, Low: 9.9, Close: 10.4, Volume: 100000, Amount: 1030000}
+
+	tests := []struct {
+		name      string
+		order     models.Order
+		price     float64
+		triggered bool
+	}{
+		{"次日开盘价", models.Order{Type: models.OrderTypeMarket, Timing: models.ExecutionNextBarOpen}, 10.2, true},
+		{"次日成交均价", models.Order{Type: models.OrderTypeMarket, Timing: models.ExecutionNextBarVWAP}, 10.3, true},
+		{"限价买入触及", models.Order{Type: models.OrderTypeLimit, Side: models.TradeSideBuy, Price: 10}, 10, true},
+		{"限价买入开盘低于限价", models.Order{Type: models.OrderTypeLimit, Side: models.TradeSideBuy, Price: 10.3}, 10.2, true},
+		{"限价买入未触及", models.Order{Type: models.OrderTypeLimit, Side: models.TradeSideBuy, Price: 9.8}, 0, false},
+		{"限价卖出触及", models.Order{Type: models.OrderTypeLimit, Side: models.TradeSideSell, Price: 10.5}, 10.5, true},
+		{"限价卖出未触及", models.Order{Type: models.OrderTypeLimit, Side: models.TradeSideSell, Price: 10.8}, 0, false},
+	}
+
+	for _, tt := range tests {
+		price, triggered := orderExecutionPrice(&tt.order, bar)
+		if triggered != tt.triggered || math.Abs(price-tt.price) > 1e-9 {
+			t.Errorf("%s: 期望 %.2f/%v, 实际 %.2f/%v", tt.name, tt.price, tt.triggered, price, triggered)
+		}
+	}
+
+	// 成交额单位错误（放大1000倍）时成交均价超出当日价格区间，按开盘价成交
+	badUnits := *bar
+	badUnits.Amount *= 1000
+	if price, _ := orderExecutionPrice(&models.Order{Type: models.OrderTypeMarket, Timing: models.ExecutionNextBarVWAP}, &badUnits); price != bar.Open {
+		t.Errorf("成交均价超出价格区间时应按开盘价%.2f成交, 实际 %.2f", bar.Open, price)
+	}
+}
+
+func TestPreloadBacktestData_AKToolsAmountUnits(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bars := buildTestDailyBars("600000.SH", start, steadyCloses(20, 0.01))
+	// AKTools的成交量为手、成交额为元：按收盘价成交10000手
+	for i := range bars {
+		close := bars[i].Close.InexactFloat64()
+		bars[i].Amount = models.NewJSONDecimal(decimal.NewFromFloat(close * 10000 * 100))
+	}
+	dataClient := &perSymbolDataClient{MockDataSourceClient: client.NewMockDataSourceClient(), bars: map[string][]models.StockDaily{"600000.SH": bars}}
+	dataSource := &DataSourceService{config: &config.Config{DataSourceType: string(client.DataSourceAKTools)}, currentClient: dataClient}
+	service := NewBacktestService(nil, dataSource, nil, &noopLogger{})
+
+	histories, err := service.preloadBacktestData(context.Background(), []string{"600000.SH"}, start, start.AddDate(0, 1, 0), models.PriceAdjustForward)
+	if err != nil {
+		t.Fatalf("预加载行情失败: %v", err)
+	}
+	history := histories["600000.SH"]
+	last := history.bars[len(history.bars)-1]
+	marketData, _ := service.convertStockDailyToMarketData(last, "600000.SH", history.dates[len(history.dates)-1], history.units)
+
+	order := &models.Order{Type: models.OrderTypeMarket, Timing: models.ExecutionNextBarVWAP}
+	price, _ := orderExecutionPrice(order, marketData)
+	if math.Abs(price-last.Close.InexactFloat64()) > 1e-6 {
+		t.Errorf("AKTools行情的成交均价应为收盘价%.4f, 实际 %.4f (成交额 %.0f, 成交量 %d)", last.Close.InexactFloat64(), price, marketData.Amount, marketData.Volume)
+	}
+}
+
+// countingStockInfoClient 统计股票基本信息和简称变更历史请求次数的模拟数据源
+type countingStockInfoClient struct {
+	*perSymbolDataClient
+	basicCalls, nameCalls atomic.Int64
+}
+
+func (c *countingStockInfoClient) GetStockBasic(symbol string) (*models.StockBasic, error) {
+	c.basicCalls.Add(1)
+	return c.perSymbolDataClient.GetStockBasic(symbol)
+}
+
+func (c *countingStockInfoClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	c.nameCalls.Add(1)
+	return c.perSymbolDataClient.GetNameChanges(symbol)
+}
+
+func TestPreloadBacktestData_CachesStockInfo(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	symbols := []string{"600000.SH", "000001.SZ", "300750.SZ", "688981.SH", "600519.SH"}
+	dataClient := &countingStockInfoClient{perSymbolDataClient: &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars:                 make(map[string][]models.StockDaily),
+		nameChanges:          map[string][]models.NameChange{"600000.SH": {{TSCode: "600000.SH", Name: "ST浦发", StartDate: "20240101"}}},
+	}}
+	dataClient.StockBasicData = &models.StockBasic{Name: "测试股票", ListDate: "20000101"}
+	for _, symbol := range symbols {
+		dataClient.bars[symbol] = buildTestDailyBars(symbol, start, steadyCloses(20, 0.01))
+	}
+	service := NewBacktestService(nil, &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	// 第二次预加载日线命中缓存，股票基本信息和简称变更历史也不再请求数据源
+	for run := 0; run < 2; run++ {
+		histories, err := service.preloadBacktestData(context.Background(), symbols, start, start.AddDate(0, 1, 0), models.PriceAdjustForward)
+		if err != nil || len(histories) != len(symbols) {
+			t.Fatalf("预加载行情失败: %d 只, err=%v", len(histories), err)
+		}
+		if history := histories["600000.SH"]; !history.nameHistory || len(history.nameChanges) != 1 || !history.listDate.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("第%d次预加载的基本信息错误: %+v", run+1, history)
+		}
+	}
+	if basic, names := dataClient.basicCalls.Load(), dataClient.nameCalls.Load(); basic != int64(len(symbols)) || names != int64(len(symbols)) {
+		t.Errorf("每只股票只应请求一次基本信息和简称变更历史: basic=%d, names=%d", basic, names)
+	}
+}
+
+func TestPreloadBacktestData_NoSymbolLoaded(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	dataClient := client.NewMockDataSourceClient()
+	service := NewBacktestService(nil, &DataSourceService{currentClient: dataClient}, nil, &noopLogger{})
+	symbols := []string{"600000.SH", "000001.SZ"}
+
+	// 所有股票都加载失败（如复权参数不被数据源接受）或没有行情时，回测应失败而不是零交易完成
+	dataClient.ShouldFail = true
+	if _, err := service.preloadBacktestData(context.Background(), symbols, start, start.AddDate(0, 1, 0), models.PriceAdjustNone); !errors.Is(err, ErrNoMarketData) {
+		t.Errorf("全部股票加载失败时应返回 ErrNoMarketData, 实际 %v", err)
+	}
+	dataClient.ShouldFail = false
+	if _, err := service.preloadBacktestData(context.Background(), symbols, start, start.AddDate(0, 1, 0), models.PriceAdjustNone); !errors.Is(err, ErrNoMarketData) {
+		t.Errorf("全部股票没有行情时应返回 ErrNoMarketData, 实际 %v", err)
+	}
+}
+
+func TestExecutePendingOrder_NextBarOpen(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	backtest := &models.Backtest{ID: "bt", Symbols: []string{"600000.SH"}, Execution: &models.ExecutionConfig{Timing: models.ExecutionNextBarOpen}}
+	signalDay := &models.MarketData{Symbol: "600000.SH", Date: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), Open: 10, High: 10.2, Low: 9.9, Close: 10}
+
+	order := service.newPendingOrder(&models.Signal{SignalType: models.SignalTypeBuy}, signalDay, backtest, "s1")
+	if order == nil || order.Type != models.OrderTypeMarket || order.Status != models.OrderStatusPending {
+		t.Fatalf("买入信号应生成市价挂单, 实际 %+v", order)
+	}
+	if service.newPendingOrder(&models.Signal{SignalType: models.SignalTypeHold}, signalDay, backtest, "s1") != nil {
+		t.Error("持有信号不应生成挂单")
+	}
+
+	portfolio := &models.Portfolio{Cash: 100000, TotalValue: 100000, Positions: make(map[string]models.Position)}
+	nextDay := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: signalDay.Date.AddDate(0, 0, 1), Open: 10.5, High: 10.8, Low: 10.3, Close: 10.6}, prevClose: 10}
+	trade, rejected, keep := service.executePendingOrder(order, nextDay, portfolio, backtest, NewPositionSizer(nil, nil))
+	if trade == nil || rejected != nil || keep {
+		t.Fatalf("期望次日成交, 实际 trade=%v rejected=%v keep=%v", trade, rejected, keep)
+	}
+	if trade.Price != 10.5 || !trade.Timestamp.Equal(nextDay.marketData.Date) {
+		t.Errorf("应以次日开盘价成交: %.2f @ %s", trade.Price, trade.Timestamp.Format("20060102"))
+	}
+	if order.Status != models.OrderStatusFilled || order.ExecutedAt == nil {
+		t.Errorf("订单状态未更新: %+v", order)
+	}
+}
+
+func TestExecutePendingOrder_LimitExpires(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	backtest := &models.Backtest{
+		ID:        "bt",
+		Symbols:   []string{"600000.SH"},
+		Execution: &models.ExecutionConfig{Timing: models.ExecutionNextBarLimit, LimitOffsetPct: 0.02, OrderValidDays: 2},
+	}
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	signalDay := &models.MarketData{Symbol: "600000.SH", Date: date, Open: 10, High: 10.2, Low: 9.9, Close: 10}
+
+	order := service.newPendingOrder(&models.Signal{SignalType: models.SignalTypeBuy}, signalDay, backtest, "s1")
+	if order.Type != models.OrderTypeLimit || order.Price != 9.8 || order.RemainingDays != 2 {
+		t.Fatalf("限价单参数错误: %+v", order)
+	}
+
+	portfolio := &models.Portfolio{Cash: 100000, TotalValue: 100000, Positions: make(map[string]models.Position)}
+	sizer := NewPositionSizer(nil, nil)
+	for day := 1; day <= 2; day++ {
+		bar := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: date.AddDate(0, 0, day), Open: 10.1, High: 10.3, Low: 9.9, Close: 10.2}, prevClose: 10}
+		trade, rejected, keep := service.executePendingOrder(order, bar, portfolio, backtest, sizer)
+		if trade != nil {
+			t.Fatalf("未触及限价不应成交: %+v", trade)
+		}
+		if day == 1 && (!keep || rejected != nil) {
+			t.Fatalf("有效期内应继续挂单, 实际 keep=%v rejected=%v", keep, rejected)
+		}
+		if day == 2 && (keep || rejected == nil || rejected.Reason != models.OrderRejectExpired) {
+			t.Fatalf("到期后应撤单, 实际 keep=%v rejected=%+v", keep, rejected)
+		}
+	}
+	if len(portfolio.Positions) != 0 || portfolio.Cash != 100000 {
+		t.Error("未成交的限价单不应改变组合")
+	}
+}
+
+func TestValidateExecutionConfig(t *testing.T) {
+	if err := ValidateExecutionConfig(&models.ExecutionConfig{Timing: models.ExecutionNextBarVWAP}); err != nil {
+		t.Errorf("合法参数校验失败: %v", err)
+	}
+	if err := ValidateExecutionConfig(&models.ExecutionConfig{Timing: "tomorrow_close"}); !errors.Is(err, ErrInvalidExecutionConfig) {
+		t.Errorf("未知成交时机应校验失败, 实际: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidExitRules = errors.New("退出规则参数无效")
+
+// defaultExitATRPeriod ATR止损默认周期
+const defaultExitATRPeriod = 14
+
+// ValidateExitRulesConfig 校验风控退出规则参数
+func ValidateExitRulesConfig(config *models.ExitRulesConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.StopLossPct < 0 || config.StopLossPct >= 1 {
+		return fmt.Errorf("%w: stop_loss_pct 必须在0-1之间", ErrInvalidExitRules)
+	}
+	if config.TrailingStopPct < 0 || config.TrailingStopPct >= 1 {
+		return fmt.Errorf("%w: trailing_stop_pct 必须在0-1之间", ErrInvalidExitRules)
+	}
+	if config.TakeProfitPct < 0 || config.ATRStopMultiple < 0 || config.ATRPeriod < 0 || config.MaxHoldingDays < 0 {
+		return fmt.Errorf("%w: 参数不能为负数", ErrInvalidExitRules)
+	}
+	return nil
+}
+
+// exitDecision 风控退出决策
+type exitDecision struct {
+	signalType models.SignalType
+	price      float64 // 申报价（未加滑点）
+}
+
+// evaluateExitRules 根据当日K线判断持仓是否触发退出规则
+// 最低价触及止损位即止损，多个止损同时启用时以最高的止损位为准；同一根K线同时触及止损和止盈时保守地按止损处理。
+// 开盘价已越过触发价（跳空）时按开盘价成交，最长持有期到期按收盘价成交。
+func evaluateExitRules(config *models.ExitRulesConfig, position models.Position, marketData *models.MarketData) *exitDecision {
+	if config == nil || position.Quantity <= 0 {
+		return nil
+	}
+
+	var stop *exitDecision
+	setStop := func(signalType models.SignalType, level float64) {
+		if level > 0 && (stop == nil || level > stop.price) {
+			stop = &exitDecision{signalType: signalType, price: level}
+		}
+	}
+	if config.StopLossPct > 0 {
+		setStop(models.SignalTypeStopLoss, position.AvgPrice*(1-config.StopLossPct))
+	}
+	if config.ATRStopMultiple > 0 && position.EntryATR > 0 {
+		setStop(models.SignalTypeATRStop, position.AvgPrice-config.ATRStopMultiple*position.EntryATR)
+	}
+	if config.TrailingStopPct > 0 && position.PeakPrice > 0 {
+		setStop(models.SignalTypeTrailingStop, position.PeakPrice*(1-config.TrailingStopPct))
+	}
+	if stop != nil && marketData.Low <= stop.price {
+		stop.price = math.Min(marketData.Open, stop.price)
+		return stop
+	}
+
+	if config.TakeProfitPct > 0 {
+		target := position.AvgPrice * (1 + config.TakeProfitPct)
+		if marketData.High >= target {
+			return &exitDecision{signalType: models.SignalTypeTakeProfit, price: math.Max(marketData.Open, target)}
+		}
+	}
+
+	if config.MaxHoldingDays > 0 && position.HoldingDays >= config.MaxHoldingDays {
+		return &exitDecision{signalType: models.SignalTypeMaxHolding, price: marketData.Close}
+	}
+	return nil
+}
+
+// applyExitRules 在策略信号执行前检查持仓的风控退出规则
+// 同时维护持仓的持有天数、建仓ATR和持仓期最高价
+func (s *BacktestService) applyExitRules(bar *orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string) (*models.Trade, *models.RejectedOrder) {
+	config := backtest.ExitRules
+	if config == nil || bar.suspended {
+		return nil, nil
+	}
+
+	marketData := bar.marketData
+	symbol := marketData.Symbol
+	position, exists := portfolio.Positions[symbol]
+	if !exists || position.Quantity <= 0 {
+		return nil, nil
+	}
+
+	position.HoldingDays++
+	if position.EntryATR == 0 && config.ATRStopMultiple > 0 && len(bar.history) > 1 {
+		// 使用截至前一交易日的K线：建仓后首次检查时即为建仓当日的ATR
+		position.EntryATR = s.exitATR(config, bar.history[:len(bar.history)-1])
+	}
+	portfolio.Positions[symbol] = position
+
+	var trade *models.Trade
+	var rejected *models.RejectedOrder
+	if decision := evaluateExitRules(config, position, marketData); decision != nil {
+		price := decision.price
+		if !backtest.DisableTradingRules {
+			price = s.tradingRules.RoundToTick(price)
+		}
+		trade, rejected = s.executeSell(bar, portfolio, backtest, strategyID, decision.signalType, price)
+	}
+
+	// 当日最高价在检查之后才计入，避免同一根K线内先涨后跌的顺序假设
+	if position, exists := portfolio.Positions[symbol]; exists && marketData.High > position.PeakPrice {
+		position.PeakPrice = marketData.High
+		portfolio.Positions[symbol] = position
+	}
+	return trade, rejected
+}
+
+// exitATR 计算截至 history 最后一根K线的ATR，数据不足时返回0
+func (s *BacktestService) exitATR(config *models.ExitRulesConfig, history []models.StockDaily) float64 {
+	period := config.ATRPeriod
+	if period == 0 {
+		period = defaultExitATRPeriod
+	}
+	if atrs := s.calculator.CalculateATR(history, period); len(atrs) > 0 {
+		return atrs[len(atrs)-1].ATR14.InexactFloat64()
+	}
+	return 0
+}
+
+// addToPosition 加仓时按数量加权更新持仓的建仓状态：新买入部分的持有天数为0、建仓ATR取买入当日的ATR，
+// 避免ATR止损和最长持有期沿用首次建仓时的状态。须在更新持仓数量之前调用。
+func (s *BacktestService) addToPosition(config *models.ExitRulesConfig, position *models.Position, quantity int, history []models.StockDaily) {
+	if config == nil || position.Quantity <= 0 || quantity <= 0 {
+		return
+	}
+	total := float64(position.Quantity + quantity)
+	held := float64(position.Quantity) / total
+	position.HoldingDays = int(math.Round(float64(position.HoldingDays) * held))
+
+	// 尚未计算建仓ATR时（当日建仓当日加仓）留待下次检查时按建仓当日计算
+	if position.EntryATR > 0 && config.ATRStopMultiple > 0 {
+		if atr := s.exitATR(config, history); atr > 0 {
+			position.EntryATR = position.EntryATR*held + atr*(1-held)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestEvaluateExitRules(t *testing.T) {
+	position := models.Position{Symbol: "600000.SH", Quantity: 1000, AvgPrice: 10, PeakPrice: 12, EntryATR: 0.5}
+	bar := func(open, high, low, close float64) *models.MarketData {
+		return &models.MarketData{Symbol: "600000.SH", Open: open, High: high, Low: low, Close: close}
+	}
+
+	tests := []struct {
+		name       string
+		config     models.ExitRulesConfig
+		marketData *models.MarketData
+		signalType models.SignalType
+		price      float64
+	}{
+		{"固定止损按触发价成交", models.ExitRulesConfig{StopLossPct: 0.05}, bar(9.8, 9.9, 9.4, 9.6), models.SignalTypeStopLoss, 9.5},
+		{"跳空低开按开盘价止损", models.ExitRulesConfig{StopLossPct: 0.05}, bar(9.2, 9.3, 9.0, 9.1), models.SignalTypeStopLoss, 9.2},
+		{"ATR止损", models.ExitRulesConfig{ATRStopMultiple: 2}, bar(9.5, 9.6, 8.9, 9.2), models.SignalTypeATRStop, 9.0},
+		{"移动止损取最高止损位", models.ExitRulesConfig{StopLossPct: 0.05, TrailingStopPct: 0.1}, bar(11, 11, 10.7, 10.9), models.SignalTypeTrailingStop, 10.8},
+		{"止盈", models.ExitRulesConfig{TakeProfitPct: 0.2}, bar(11.5, 12.3, 11.4, 12.1), models.SignalTypeTakeProfit, 12},
+		{"同时触及止损止盈时先止损", models.ExitRulesConfig{StopLossPct: 0.05, TakeProfitPct: 0.2}, bar(10, 12.5, 9.4, 10), models.SignalTypeStopLoss, 9.5},
+		{"未触及", models.ExitRulesConfig{StopLossPct: 0.05, TakeProfitPct: 0.2}, bar(10, 10.5, 9.8, 10.2), "", 0},
+	}
+
+	for _, tt := range tests {
+		decision := evaluateExitRules(&tt.config, position, tt.marketData)
+		if tt.signalType == "" {
+			if decision != nil {
+				t.Errorf("%s: 期望不触发, 实际 %+v", tt.name, decision)
+			}
+			continue
+		}
+		if decision == nil || decision.signalType != tt.signalType || abs(decision.price-tt.price) > 1e-9 {
+			t.Errorf("%s: 期望 %s@%.2f, 实际 %+v", tt.name, tt.signalType, tt.price, decision)
+		}
+	}
+
+	position.HoldingDays = 5
+	decision := evaluateExitRules(&models.ExitRulesConfig{MaxHoldingDays: 5}, position, bar(10, 10.2, 9.9, 10.1))
+	if decision == nil || decision.signalType != models.SignalTypeMaxHolding || decision.price != 10.1 {
+		t.Errorf("超过最长持有期应按收盘价退出, 实际 %+v", decision)
+	}
+}
+
+func TestApplyExitRules_ProducesStopLossTrade(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	backtest := &models.Backtest{
+		ID:        "bt",
+		Symbols:   []string{"600000.SH"},
+		ExitRules: &models.ExitRulesConfig{StopLossPct: 0.05, TrailingStopPct: 0.2},
+	}
+	buyDate := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	portfolio := &models.Portfolio{Cash: 100000, TotalValue: 100000, Positions: make(map[string]models.Position)}
+
+	buyBar := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: buyDate, Open: 10, High: 10.2, Low: 9.9, Close: 10}, prevClose: 10}
+	if trade, _ := service.executeSignalForStrategy(&models.Signal{SignalType: models.SignalTypeBuy}, buyBar, portfolio, backtest, "s1", NewPositionSizer(nil, nil)); trade == nil {
+		t.Fatal("期望买入成交")
+	}
+
+	// 次日冲高未触发，最高价计入移动止损
+	day2 := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: buyDate.AddDate(0, 0, 1), Open: 10.1, High: 10.8, Low: 10, Close: 10.5}, prevClose: 10}
+	if trade, rejected := service.applyExitRules(day2, portfolio, backtest, "s1"); trade != nil || rejected != nil {
+		t.Fatalf("未触及退出条件时不应交易, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+	position := portfolio.Positions["600000.SH"]
+	if position.PeakPrice != 10.8 || position.HoldingDays != 1 {
+		t.Errorf("持仓最高价/持有天数未更新: %+v", position)
+	}
+
+	// 第三天最低价跌破止损位
+	day3 := &orderBar{marketData: &models.MarketData{Symbol: "600000.SH", Date: buyDate.AddDate(0, 0, 2), Open: 10, High: 10, Low: 9.3, Close: 9.4}, prevClose: 10.5}
+	trade, rejected := service.applyExitRules(day3, portfolio, backtest, "s1")
+	if trade == nil || rejected != nil {
+		t.Fatalf("期望止损成交, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+	if trade.SignalType != string(models.SignalTypeStopLoss) || trade.Price != 9.5 {
+		t.Errorf("止损成交记录错误: %s@%.2f", trade.SignalType, trade.Price)
+	}
+	if _, exists := portfolio.Positions["600000.SH"]; exists {
+		t.Error("止损后应清空持仓")
+	}
+}
+
+func TestExecuteBuy_AddToPositionReweightsEntryState(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	backtest := &models.Backtest{
+		ID:        "bt",
+		Symbols:   []string{"600000.SH"},
+		ExitRules: &models.ExitRulesConfig{ATRStopMultiple: 2, MaxHoldingDays: 20},
+	}
+	closes := make([]float64, 30)
+	for i := range closes {
+		closes[i] = 10
+	}
+	bars := buildTestDailyBars("600000.SH", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), closes)
+	bar := &orderBar{marketData: lastBarMarketData(t, bars), prevClose: 10, history: bars}
+
+	portfolio := &models.Portfolio{Cash: 100000, TotalValue: 110000, Positions: map[string]models.Position{
+		"600000.SH": {Symbol: "600000.SH", Quantity: 1000, AvgPrice: 10, EntryATR: 0.5, HoldingDays: 10},
+	}}
+	sizer := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingFixedAmount, Amount: 30000}, nil)
+	trade, _ := service.executeSignalForStrategy(&models.Signal{SignalType: models.SignalTypeBuy}, bar, portfolio, backtest, "s1", sizer)
+	if trade == nil {
+		t.Fatal("期望加仓成交")
+	}
+
+	// 加仓部分持有0天、ATR取加仓当日的0.2，按数量加权
+	held := 1000 / float64(1000+trade.Quantity)
+	position := portfolio.Positions["600000.SH"]
+	if want := int(math.Round(10 * held)); position.HoldingDays != want {
+		t.Errorf("加仓后持有天数应按数量加权为%d, 实际 %d", want, position.HoldingDays)
+	}
+	if want := 0.5*held + 0.2*(1-held); math.Abs(position.EntryATR-want) > 1e-6 {
+		t.Errorf("加仓后建仓ATR应按数量加权为%.4f, 实际 %.4f", want, position.EntryATR)
+	}
+}
+
+func TestValidateExitRulesConfig(t *testing.T) {
+	if err := ValidateExitRulesConfig(&models.ExitRulesConfig{StopLossPct: 0.08, TakeProfitPct: 0.3, MaxHoldingDays: 20}); err != nil {
+		t.Errorf("合法参数校验失败: %v", err)
+	}
+	if err := ValidateExitRulesConfig(&models.ExitRulesConfig{StopLossPct: 1.2}); !errors.Is(err, ErrInvalidExitRules) {
+		t.Errorf("止损比例超过100%%应校验失败, 实际: %v", err)
+	}
+}
@@ -43,19 +43,19 @@ func (s *FundamentalFactorService) CalculateFundamentalFactor(symbol, tradeDate
 	}
 
 	// 2. 获取最新财务报表数据
-	incomeStatement, err := s.getLatestIncomeStatement(symbol)
+	incomeStatement, err := s.getLatestIncomeStatement(symbol, tradeDate)
 	if err != nil {
 		log.Printf("[FundamentalFactorService] 获取利润表数据失败: %v", err)
 		// 继续执行，使用空数据
 	}
 
-	balanceSheet, err := s.getLatestBalanceSheet(symbol)
+	balanceSheet, err := s.getLatestBalanceSheet(symbol, tradeDate)
 	if err != nil {
 		log.Printf("[FundamentalFactorService] 获取资产负债表数据失败: %v", err)
 		// 继续执行，使用空数据
 	}
 
-	cashFlow, err := s.getLatestCashFlow(symbol)
+	cashFlow, err := s.getLatestCashFlow(symbol, tradeDate)
 	if err != nil {
 		log.Printf("[FundamentalFactorService] 获取现金流量表数据失败: %v", err)
 		// 继续执行，使用空数据
@@ -164,9 +164,9 @@ func (s *FundamentalFactorService) GetFactorRanking(factors []models.Fundamental
 
 // 私有方法：获取最新财务报表数据
 
-func (s *FundamentalFactorService) getLatestIncomeStatement(symbol string) (*models.IncomeStatement, error) {
-	// 尝试获取最近几个报告期的数据
-	periods := []string{"20241231", "20240930", "20240630", "20240331", "20231231"}
+func (s *FundamentalFactorService) getLatestIncomeStatement(symbol, tradeDate string) (*models.IncomeStatement, error) {
+	// 尝试获取交易日之前最近几个报告期的数据
+	periods := reportPeriodsBefore(tradeDate, 5)
 
 	log.Printf("[FundamentalFactorService] 开始获取利润表数据: %s", symbol)
 
@@ -181,6 +181,10 @@ func (s *FundamentalFactorService) getLatestIncomeStatement(symbol string) (*mod
 			log.Printf("[FundamentalFactorService] 期间 %s 返回空数据", period)
 			continue
 		}
+		if !publishedBy(statement.FinancialStatement, tradeDate) {
+			log.Printf("[FundamentalFactorService] 期间 %s 的利润表在 %s 之后才公告，跳过", period, tradeDate)
+			continue
+		}
 
 		// 检查关键字段是否有效
 		if statement.OperRevenue.Decimal.IsZero() && statement.NetProfit.Decimal.IsZero() {
@@ -204,6 +208,10 @@ func (s *FundamentalFactorService) getLatestIncomeStatement(symbol string) (*mod
 		log.Printf("[FundamentalFactorService] 最新利润表数据为空")
 		return nil, fmt.Errorf("未找到有效的利润表数据: 最新数据为空")
 	}
+	if !publishedBy(statement.FinancialStatement, tradeDate) {
+		log.Printf("[FundamentalFactorService] 最新利润表在 %s 之后才公告", tradeDate)
+		return nil, fmt.Errorf("未找到有效的利润表数据: 截至 %s 没有已公告的报表", tradeDate)
+	}
 
 	// 检查最新数据的关键字段
 	if statement.OperRevenue.Decimal.IsZero() && statement.NetProfit.Decimal.IsZero() {
@@ -216,9 +224,9 @@ func (s *FundamentalFactorService) getLatestIncomeStatement(symbol string) (*mod
 	return statement, nil
 }
 
-func (s *FundamentalFactorService) getLatestBalanceSheet(symbol string) (*models.BalanceSheet, error) {
-	// 尝试获取最近几个报告期的数据
-	periods := []string{"20241231", "20240930", "20240630", "20240331", "20231231"}
+func (s *FundamentalFactorService) getLatestBalanceSheet(symbol, tradeDate string) (*models.BalanceSheet, error) {
+	// 尝试获取交易日之前最近几个报告期的数据
+	periods := reportPeriodsBefore(tradeDate, 5)
 
 	log.Printf("[FundamentalFactorService] 开始获取资产负债表数据: %s", symbol)
 
@@ -233,6 +241,10 @@ func (s *FundamentalFactorService) getLatestBalanceSheet(symbol string) (*models
 			log.Printf("[FundamentalFactorService] 期间 %s 返回空数据", period)
 			continue
 		}
+		if !publishedBy(sheet.FinancialStatement, tradeDate) {
+			log.Printf("[FundamentalFactorService] 期间 %s 的资产负债表在 %s 之后才公告，跳过", period, tradeDate)
+			continue
+		}
 
 		// 检查关键字段是否有效
 		if sheet.TotalAssets.Decimal.IsZero() && sheet.TotalHldrEqy.Decimal.IsZero() {
@@ -256,6 +268,10 @@ func (s *FundamentalFactorService) getLatestBalanceSheet(symbol string) (*models
 		log.Printf("[FundamentalFactorService] 最新资产负债表数据为空")
 		return nil, fmt.Errorf("未找到有效的资产负债表数据: 最新数据为空")
 	}
+	if !publishedBy(sheet.FinancialStatement, tradeDate) {
+		log.Printf("[FundamentalFactorService] 最新资产负债表在 %s 之后才公告", tradeDate)
+		return nil, fmt.Errorf("未找到有效的资产负债表数据: 截至 %s 没有已公告的报表", tradeDate)
+	}
 
 	// 检查最新数据的关键字段
 	if sheet.TotalAssets.Decimal.IsZero() && sheet.TotalHldrEqy.Decimal.IsZero() {
@@ -268,9 +284,9 @@ func (s *FundamentalFactorService) getLatestBalanceSheet(symbol string) (*models
 	return sheet, nil
 }
 
-func (s *FundamentalFactorService) getLatestCashFlow(symbol string) (*models.CashFlowStatement, error) {
-	// 尝试获取最近几个报告期的数据
-	periods := []string{"20241231", "20240930", "20240630", "20240331", "20231231"}
+func (s *FundamentalFactorService) getLatestCashFlow(symbol, tradeDate string) (*models.CashFlowStatement, error) {
+	// 尝试获取交易日之前最近几个报告期的数据
+	periods := reportPeriodsBefore(tradeDate, 5)
 
 	log.Printf("[FundamentalFactorService] 开始获取现金流量表数据: %s", symbol)
 
@@ -285,6 +301,10 @@ func (s *FundamentalFactorService) getLatestCashFlow(symbol string) (*models.Cas
 			log.Printf("[FundamentalFactorService] 期间 %s 返回空数据", period)
 			continue
 		}
+		if !publishedBy(cashFlow.FinancialStatement, tradeDate) {
+			log.Printf("[FundamentalFactorService] 期间 %s 的现金流量表在 %s 之后才公告，跳过", period, tradeDate)
+			continue
+		}
 
 		// 检查关键字段是否有效
 		if cashFlow.NetCashOperAct.Decimal.IsZero() &&
@@ -310,6 +330,10 @@ func (s *FundamentalFactorService) getLatestCashFlow(symbol string) (*models.Cas
 		log.Printf("[FundamentalFactorService] 最新现金流量表数据为空")
 		return nil, fmt.Errorf("未找到有效的现金流量表数据: 最新数据为空")
 	}
+	if !publishedBy(cashFlow.FinancialStatement, tradeDate) {
+		log.Printf("[FundamentalFactorService] 最新现金流量表在 %s 之后才公告", tradeDate)
+		return nil, fmt.Errorf("未找到有效的现金流量表数据: 截至 %s 没有已公告的报表", tradeDate)
+	}
 
 	// 检查最新数据的关键字段
 	if cashFlow.NetCashOperAct.Decimal.IsZero() &&
@@ -324,6 +348,59 @@ func (s *FundamentalFactorService) getLatestCashFlow(symbol string) (*models.Cas
 	return cashFlow, nil
 }
 
+// reportPeriodsBefore 交易日之前最近的 n 个报告期（季末日期，YYYYMMDD），从近到远排列
+// 交易日无法解析时以当前日期为准
+func reportPeriodsBefore(tradeDate string, n int) []string {
+	date, err := time.Parse("20060102", tradeDate)
+	if err != nil {
+		date = time.Now()
+	}
+	// 从交易日所在季度的上一个季末开始往前推
+	quarterEnd := time.Date(date.Year(), time.Month((int(date.Month())-1)/3*3+1), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	periods := make([]string, 0, n)
+	for len(periods) < n {
+		periods = append(periods, quarterEnd.Format("20060102"))
+		quarterEnd = time.Date(quarterEnd.Year(), quarterEnd.Month()-2, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+	}
+	return periods
+}
+
+// publishedBy 报表是否在交易日当天或之前已公告，避免回测使用未来数据
+// 没有公告日期时按法定披露截止日判断，报告期无法识别时不使用该报表
+func publishedBy(statement models.FinancialStatement, tradeDate string) bool {
+	if tradeDate == "" {
+		return true
+	}
+	if statement.AnnDate != "" {
+		return statement.AnnDate <= tradeDate
+	}
+	deadline := disclosureDeadline(statement.EndDate)
+	return deadline != "" && deadline <= tradeDate
+}
+
+// disclosureDeadline 报告期的法定披露截止日（YYYYMMDD）：一季报4月30日、半年报8月31日、三季报10月31日、年报次年4月30日
+// 报告期期末之后、公告之前，报表内容对市场不可见，不能只以期末日期判断
+func disclosureDeadline(endDate string) string {
+	if len(endDate) != 8 {
+		return ""
+	}
+	year, err := strconv.Atoi(endDate[:4])
+	if err != nil {
+		return ""
+	}
+	switch endDate[4:] {
+	case "0331":
+		return fmt.Sprintf("%04d0430", year)
+	case "0630":
+		return fmt.Sprintf("%04d0831", year)
+	case "0930":
+		return fmt.Sprintf("%04d1031", year)
+	case "1231":
+		return fmt.Sprintf("%04d0430", year+1)
+	}
+	return ""
+}
+
 // 私有方法：计算各类因子
 
 func (s *FundamentalFactorService) calculateValueFactors(factor *models.FundamentalFactor, dailyBasic *models.DailyBasic) {
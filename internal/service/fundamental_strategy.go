@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidFundamental = errors.New("基本面策略参数无效")
+
+// 基本面策略默认参数
+const (
+	defaultFundamentalBuyPercentile  = 80.0
+	defaultFundamentalSellPercentile = 50.0
+	fundamentalSignalConfidence      = 0.7
+)
+
+// ParseFundamentalParams 解析并校验基本面策略参数，未设置的参数使用默认值
+func ParseFundamentalParams(params map[string]interface{}) (*models.FundamentalStrategyParams, error) {
+	config := &models.FundamentalStrategyParams{
+		Frequency:      models.RebalanceFrequency(getStringParameter(params, "frequency", string(models.RebalanceMonthly))),
+		Score:          getStringParameter(params, "score", ""),
+		BuyPercentile:  getFloatParameter(params, "buy_percentile", defaultFundamentalBuyPercentile),
+		SellPercentile: getFloatParameter(params, "sell_percentile", defaultFundamentalSellPercentile),
+		MaxPE:          getFloatParameter(params, "max_pe", 0),
+		MaxPB:          getFloatParameter(params, "max_pb", 0),
+	}
+
+	switch config.Frequency {
+	case models.RebalanceWeekly, models.RebalanceMonthly, models.RebalanceQuarterly:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的评估频率 %q", ErrInvalidFundamental, config.Frequency)
+	}
+	if config.Score != "" {
+		if _, ok := fundamentalScorers[config.Score]; !ok {
+			return nil, fmt.Errorf("%w: 不支持的打分因子 %q，可选 value、growth、quality、profitability、composite", ErrInvalidFundamental, config.Score)
+		}
+	}
+	if config.Score == "" && config.MaxPE == 0 && config.MaxPB == 0 {
+		return nil, fmt.Errorf("%w: 至少需要设置 score、max_pe 或 max_pb 之一", ErrInvalidFundamental)
+	}
+	if config.BuyPercentile < 0 || config.BuyPercentile > 100 || config.SellPercentile < 0 || config.SellPercentile > 100 {
+		return nil, fmt.Errorf("%w: 分位数阈值必须在0-100之间", ErrInvalidFundamental)
+	}
+	if config.SellPercentile > config.BuyPercentile {
+		return nil, fmt.Errorf("%w: sell_percentile 不能大于 buy_percentile", ErrInvalidFundamental)
+	}
+	if config.MaxPE < 0 || config.MaxPB < 0 {
+		return nil, fmt.Errorf("%w: max_pe 和 max_pb 不能为负数", ErrInvalidFundamental)
+	}
+	return config, nil
+}
+
+// fundamentalDecision 基本面策略在评估日对一只股票的结论
+type fundamentalDecision struct {
+	signalType models.SignalType
+	strength   float64
+	reason     string
+}
+
+// signal 按评估结论生成当日信号
+func (d *fundamentalDecision) signal(strategy *models.Strategy, marketData *models.MarketData) *models.Signal {
+	signal := newStrategySignal(strategy, marketData)
+	signal.SignalType = d.signalType
+	switch d.signalType {
+	case models.SignalTypeBuy:
+		signal.Side = models.TradeSideBuy
+	case models.SignalTypeSell:
+		signal.Side = models.TradeSideSell
+	}
+	signal.Strength = d.strength
+	signal.Confidence = fundamentalSignalConfidence
+	signal.Reason = d.reason
+	return signal
+}
+
+// scorePercentiles 计算每只股票得分在截面中的分位数（0-100），相同得分取平均排名；只有一只股票时为50
+func scorePercentiles(scores map[string]float64) map[string]float64 {
+	percentiles := make(map[string]float64, len(scores))
+	if len(scores) == 1 {
+		for symbol := range scores {
+			percentiles[symbol] = 50
+		}
+		return percentiles
+	}
+	for symbol, score := range scores {
+		var below, equal int
+		for _, other := range scores {
+			switch {
+			case other < score:
+				below++
+			case other == score:
+				equal++
+			}
+		}
+		percentiles[symbol] = (float64(below) + float64(equal-1)/2) / float64(len(scores)-1) * 100
+	}
+	return percentiles
+}
+
+// fundamentalDecisions 按评估日的基本面因子对股票池中的每只股票给出买入、持有或卖出结论
+// 得分分位数不低于 buy_percentile 且估值不超限时买入；分位数低于 sell_percentile 或估值超限时卖出；其余持有
+func fundamentalDecisions(params *models.FundamentalStrategyParams, date time.Time, symbols []string, factors map[string]*models.FundamentalFactor) map[string]*fundamentalDecision {
+	var percentiles map[string]float64
+	if params.Score != "" {
+		scorer := fundamentalScorers[params.Score]
+		scores := make(map[string]float64, len(symbols))
+		for _, symbol := range symbols {
+			if factor := factors[symbol]; factor != nil {
+				scores[symbol] = scorer(factor)
+			}
+		}
+		percentiles = scorePercentiles(scores)
+	}
+
+	asOf := date.Format("2006-01-02")
+	decisions := make(map[string]*fundamentalDecision, len(symbols))
+	for _, symbol := range symbols {
+		factor := factors[symbol]
+		if factor == nil {
+			continue
+		}
+
+		var reasons, violations []string
+		buy, sell := true, false
+		strength := fundamentalSignalConfidence
+		if params.Score != "" {
+			percentile := percentiles[symbol]
+			reasons = append(reasons, fmt.Sprintf("%s得分分位数%.1f", params.Score, percentile))
+			buy = percentile >= params.BuyPercentile
+			sell = percentile < params.SellPercentile
+			if buy {
+				strength = percentile / 100
+			} else if sell {
+				strength = 1 - percentile/100
+			}
+		}
+		if params.MaxPE > 0 {
+			pe := factor.PE.InexactFloat64()
+			reasons = append(reasons, fmt.Sprintf("PE %.2f", pe))
+			if pe <= 0 || pe > params.MaxPE {
+				violations = append(violations, fmt.Sprintf("PE超过上限%.2f或亏损", params.MaxPE))
+			}
+		}
+		if params.MaxPB > 0 {
+			pb := factor.PB.InexactFloat64()
+			reasons = append(reasons, fmt.Sprintf("PB %.2f", pb))
+			if pb <= 0 || pb > params.MaxPB {
+				violations = append(violations, fmt.Sprintf("PB超过上限%.2f", params.MaxPB))
+			}
+		}
+		if len(violations) > 0 {
+			if !sell {
+				strength = fundamentalSignalConfidence
+			}
+			buy, sell = false, true
+			reasons = append(reasons, violations...)
+		}
+
+		decision := &fundamentalDecision{signalType: models.SignalTypeHold, strength: 0.5}
+		switch {
+		case buy:
+			decision.signalType, decision.strength = models.SignalTypeBuy, strength
+		case sell:
+			decision.signalType, decision.strength = models.SignalTypeSell, strength
+		}
+		decision.reason = fmt.Sprintf("基于%s的基本面数据: %s", asOf, strings.Join(reasons, "，"))
+		decisions[symbol] = decision
+	}
+	return decisions
+}
+
+// isFundamentalEvaluationDay 基本面策略在回测首日和每个评估周期的第一个交易日重新评估
+func (s *BacktestService) isFundamentalEvaluationDay(params *models.FundamentalStrategyParams, dayIndex int, date time.Time) bool {
+	return dayIndex == 0 || s.tradingCalendar.IsFirstTradingDayOfPeriod(date, params.Frequency)
+}
+
+// evaluateFundamentalStrategies 在评估日计算各基本面策略对股票池的结论，非评估日对应的结论为nil（不产生信号）
+// 只使用截至当日的基本面因子，与定期调仓策略共用按交易日缓存的因子
+func (s *BacktestService) evaluateFundamentalStrategies(params map[string]*models.FundamentalStrategyParams, dayIndex int, date time.Time, members []string, factorCache map[string]map[string]*models.FundamentalFactor) (map[string]map[string]*fundamentalDecision, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(params))
+	for id := range params {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	decisions := make(map[string]map[string]*fundamentalDecision, len(params))
+	for _, id := range ids {
+		decisions[id] = nil
+		if !s.isFundamentalEvaluationDay(params[id], dayIndex, date) {
+			continue
+		}
+		factors, err := s.factorsAt(date, members, factorCache)
+		if err != nil {
+			return decisions, fmt.Errorf("策略 %s: %w", id, err)
+		}
+		decisions[id] = fundamentalDecisions(params[id], date, members, factors)
+	}
+	return decisions, nil
+}
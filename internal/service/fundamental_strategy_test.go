@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// datedFactorSource 按交易日返回基本面因子的模拟数据源，记录被请求的交易日
+type datedFactorSource struct {
+	mu      sync.Mutex
+	dates   []string
+	factors func(symbol, tradeDate string) models.FundamentalFactor
+}
+
+func (d *datedFactorSource) BatchCalculateFundamentalFactors(symbols []string, tradeDate string) ([]models.FundamentalFactor, error) {
+	d.mu.Lock()
+	d.dates = append(d.dates, tradeDate)
+	d.mu.Unlock()
+
+	factors := make([]models.FundamentalFactor, 0, len(symbols))
+	for _, symbol := range symbols {
+		factors = append(factors, d.factors(symbol, tradeDate))
+	}
+	return factors, nil
+}
+
+func testFactor(symbol, tradeDate string, valueScore, pe float64) models.FundamentalFactor {
+	return models.FundamentalFactor{
+		TSCode:     symbol,
+		TradeDate:  tradeDate,
+		PE:         models.NewJSONDecimal(decimal.NewFromFloat(pe)),
+		PB:         models.NewJSONDecimal(decimal.NewFromFloat(1.5)),
+		ValueScore: models.NewJSONDecimal(decimal.NewFromFloat(valueScore)),
+	}
+}
+
+func TestParseFundamentalParams(t *testing.T) {
+	params, err := ParseFundamentalParams(map[string]interface{}{"score": "quality"})
+	if err != nil {
+		t.Fatalf("解析默认参数失败: %v", err)
+	}
+	if params.Frequency != models.RebalanceMonthly || params.BuyPercentile != 80 || params.SellPercentile != 50 {
+		t.Errorf("未设置的参数应使用默认值: %+v", params)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"缺少筛选条件", nil, "至少需要设置"},
+		{"未知因子", map[string]interface{}{"score": "momentum"}, "不支持的打分因子"},
+		{"未知频率", map[string]interface{}{"score": "value", "frequency": "daily"}, "不支持的评估频率"},
+		{"分位数越界", map[string]interface{}{"score": "value", "buy_percentile": 120.0}, "必须在0-100之间"},
+		{"卖出高于买入", map[string]interface{}{"score": "value", "buy_percentile": 40.0}, "不能大于"},
+		{"负的估值上限", map[string]interface{}{"max_pe": -1.0}, "不能为负数"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFundamentalParams(tt.params)
+			if !errors.Is(err, ErrInvalidFundamental) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("应返回包含 %q 的 ErrInvalidFundamental, 实际 %v", tt.want, err)
+			}
+		})
+	}
+
+	service := newTestStrategyService(t)
+	strategy := &models.Strategy{ID: "fundamental-bad", Name: "基本面", Type: models.StrategyTypeFundamental}
+	if err := service.CreateStrategy(context.Background(), strategy); !errors.Is(err, ErrInvalidFundamental) {
+		t.Errorf("创建没有筛选条件的基本面策略应失败, 实际 %v", err)
+	}
+}
+
+func TestFundamentalDecisions(t *testing.T) {
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	symbols := []string{"A", "B", "C", "D", "E"}
+	factors := map[string]*models.FundamentalFactor{}
+	for i, symbol := range symbols {
+		pe := 10.0
+		if symbol == "E" {
+			pe = -3 // 亏损
+		}
+		factor := testFactor(symbol, "20240301", float64(i), pe)
+		factors[symbol] = &factor
+	}
+
+	params := &models.FundamentalStrategyParams{Score: "value", BuyPercentile: 75, SellPercentile: 50, MaxPE: 20}
+	decisions := fundamentalDecisions(params, date, append(symbols, "F"), factors)
+
+	want := map[string]models.SignalType{
+		"A": models.SignalTypeSell, // 分位数0
+		"B": models.SignalTypeSell, // 分位数25
+		"C": models.SignalTypeHold, // 分位数50
+		"D": models.SignalTypeBuy,  // 分位数75
+		"E": models.SignalTypeSell, // 分位数100但亏损
+	}
+	for symbol, signalType := range want {
+		if decisions[symbol] == nil || decisions[symbol].signalType != signalType {
+			t.Errorf("%s 应为 %s, 实际 %+v", symbol, signalType, decisions[symbol])
+		}
+	}
+	if _, ok := decisions["F"]; ok {
+		t.Error("没有基本面数据的股票不应给出结论")
+	}
+	if reason := decisions["E"].reason; !strings.Contains(reason, "基于2024-03-01的基本面数据") || !strings.Contains(reason, "PE超过上限") {
+		t.Errorf("信号原因应说明数据日期和超限原因: %s", reason)
+	}
+	if decisions["D"].strength != 0.75 {
+		t.Errorf("买入强度应为得分分位数: %.2f", decisions["D"].strength)
+	}
+
+	percentiles := scorePercentiles(map[string]float64{"A": 1, "B": 1, "C": 2})
+	if percentiles["A"] != 25 || percentiles["B"] != 25 || percentiles["C"] != 100 {
+		t.Errorf("相同得分应取平均排名: %v", percentiles)
+	}
+}
+
+func TestSimulateBacktest_Fundamental(t *testing.T) {
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, steadyCloses(140, 0.001)),
+			"000002.SZ": buildTestDailyBars("000002.SZ", start, steadyCloses(140, 0.001)),
+			"600000.SH": buildTestDailyBars("600000.SH", start, steadyCloses(140, 0.001)),
+		},
+	}
+	service := NewBacktestService(newTestStrategyService(t), &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	// 2月价值得分 000001 最高，3月起 600000 最高
+	source := &datedFactorSource{factors: func(symbol, tradeDate string) models.FundamentalFactor {
+		scores := map[string]float64{"000001.SZ": 3, "000002.SZ": 2, "600000.SH": 1}
+		if tradeDate >= "20240301" {
+			scores = map[string]float64{"000001.SZ": 1, "000002.SZ": 2, "600000.SH": 3}
+		}
+		return testFactor(symbol, tradeDate, scores[symbol], 10)
+	}}
+
+	strategies := []*models.Strategy{{
+		ID:         "value_picker",
+		Type:       models.StrategyTypeFundamental,
+		Parameters: map[string]interface{}{"frequency": "monthly", "score": "value"},
+	}}
+	backtest := &models.Backtest{
+		ID:          "bt-fundamental",
+		StrategyIDs: []string{"value_picker"},
+		Symbols:     []string{"000001.SZ", "000002.SZ", "600000.SH"},
+		StartDate:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 1000000,
+	}
+
+	if _, err := service.simulateBacktest(context.Background(), backtest, strategies, nil); err == nil {
+		t.Error("未配置基本面因子数据源时应返回错误")
+	}
+	service.SetFundamentalFactorSource(source)
+
+	runData, err := service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+
+	// 只在首日和每月第一个交易日评估，且只请求当日的因子数据
+	sort.Strings(source.dates)
+	if want := []string{"20240201", "20240301", "20240401"}; !reflect.DeepEqual(source.dates, want) {
+		t.Errorf("应只在评估日请求当日的基本面因子, 实际 %v", source.dates)
+	}
+
+	type tradeKey struct{ date, symbol, side string }
+	var trades []tradeKey
+	for _, trade := range runData.Trades {
+		trades = append(trades, tradeKey{trade.Timestamp.Format("20060102"), trade.Symbol, string(trade.Side)})
+		if trade.Symbol == "000002.SZ" {
+			t.Errorf("分位数居中的股票不应交易: %+v", trade)
+		}
+	}
+	want := []tradeKey{
+		{"20240201", "000001.SZ", "buy"},
+		{"20240301", "000001.SZ", "sell"},
+		{"20240301", "600000.SH", "buy"},
+	}
+	if len(trades) < len(want) || !reflect.DeepEqual(trades[:len(want)], want) {
+		t.Fatalf("成交应与评估结论一致: %+v", trades)
+	}
+	for _, trade := range trades[len(want):] {
+		if trade.date != "20240401" || trade.symbol != "600000.SH" {
+			t.Errorf("4月只应继续按评估结论买入 600000.SH: %+v", trade)
+		}
+	}
+}
+
+// previousDay YYYYMMDD 日期的前一天
+func previousDay(date string) string {
+	day, _ := time.Parse("20060102", date)
+	return day.AddDate(0, 0, -1).Format("20060102")
+}
+
+func TestReportPeriodsBefore(t *testing.T) {
+	if got := reportPeriodsBefore("20250831", 5); !reflect.DeepEqual(got, []string{"20250630", "20250331", "20241231", "20240930", "20240630"}) {
+		t.Errorf("报告期不正确: %v", got)
+	}
+	if got := reportPeriodsBefore("20250101", 2); !reflect.DeepEqual(got, []string{"20241231", "20240930"}) {
+		t.Errorf("报告期不正确: %v", got)
+	}
+
+	announced := models.FinancialStatement{EndDate: "20250630", AnnDate: "20250828"}
+	if publishedBy(announced, "20250827") || !publishedBy(announced, "20250828") {
+		t.Error("公告日之前不应使用该报表")
+	}
+	if publishedBy(models.FinancialStatement{EndDate: "20250630"}, "20250630") {
+		t.Error("没有公告日期时报告期结束当天不应使用该报表")
+	}
+
+	// 没有公告日期时按法定披露截止日判断
+	for endDate, deadline := range map[string]string{"20250331": "20250430", "20250630": "20250831", "20250930": "20251031", "20241231": "20250430"} {
+		unannounced := models.FinancialStatement{EndDate: endDate}
+		if publishedBy(unannounced, previousDay(deadline)) || !publishedBy(unannounced, deadline) {
+			t.Errorf("报告期 %s 没有公告日期时应在 %s 起才可使用", endDate, deadline)
+		}
+	}
+	if publishedBy(models.FinancialStatement{}, "20250831") || publishedBy(models.FinancialStatement{EndDate: "20250515"}, "20251231") {
+		t.Error("报告期无法识别且没有公告日期时不应使用该报表")
+	}
+}
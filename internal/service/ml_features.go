@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"stock-a-future/internal/indicators"
+	"stock-a-future/internal/models"
+)
+
+// mlFeatureNames 机器学习策略使用的特征，均为与价格水平无关的相对量，便于在不同股票之间共用一个模型
+var mlFeatureNames = []string{
+	"ret_1",          // 1日收益率
+	"ret_5",          // 5日收益率
+	"ret_20",         // 20日收益率
+	"ma5_gap",        // 收盘价相对MA5的偏离
+	"ma20_gap",       // 收盘价相对MA20的偏离
+	"rsi14",          // RSI(14)/100
+	"macd_hist",      // MACD柱/收盘价
+	"boll_position",  // 收盘价在布林带中的位置，下轨为0、上轨为1
+	"kdj_k",          // KDJ的K值/100
+	"wr14",           // 威廉指标/100
+	"atr14",          // ATR(14)/收盘价
+	"volume_ratio",   // 成交量相对前5日均量的比例-1
+	"pattern_signal", // 当日图形的综合信号：买入为+置信度，卖出为-置信度
+	"pattern_net",    // 当日买入图形数减卖出图形数
+}
+
+// mlFeatureMatrix 计算与 history 逐日对齐的特征矩阵，第 i 行只使用截至第 i 个交易日的数据
+// 指标预热期内无法计算的特征为 NaN
+func mlFeatureMatrix(calculator *indicators.Calculator, history []models.StockDaily) [][]float64 {
+	n := len(history)
+	closes := make([]float64, n)
+	volumes := make([]float64, n)
+	for i, bar := range history {
+		closes[i] = bar.Close.InexactFloat64()
+		volumes[i] = bar.Vol.InexactFloat64()
+	}
+
+	ma5 := calculator.CalculateMA(history, 5)
+	ma20 := calculator.CalculateMA(history, 20)
+	rsi := calculator.CalculateRSI(history, 14)
+	macd := calculator.CalculateMACD(history)
+	boll := calculator.CalculateBollingerBands(history, 20, 2)
+	kdj := calculator.CalculateKDJ(history, 9)
+	wr := calculator.CalculateWilliamsR(history, 14)
+	atr := calculator.CalculateATR(history, 14)
+
+	// closeAt 第 i 个指标值对应的收盘价，指标结果与 history 尾部对齐
+	closeAt := func(count, i int) float64 { return closes[n-count+i] }
+	columns := [][]float64{
+		mlReturns(closes, 1),
+		mlReturns(closes, 5),
+		mlReturns(closes, 20),
+		alignRuleSeries(n, len(ma5), func(i int) float64 { return mlRatio(closeAt(len(ma5), i), ma5[i].InexactFloat64()) - 1 }),
+		alignRuleSeries(n, len(ma20), func(i int) float64 { return mlRatio(closeAt(len(ma20), i), ma20[i].InexactFloat64()) - 1 }),
+		alignRuleSeries(n, len(rsi), func(i int) float64 { return rsi[i].RSI14.InexactFloat64() / 100 }),
+		alignRuleSeries(n, len(macd), func(i int) float64 { return mlRatio(macd[i].Histogram.InexactFloat64(), closeAt(len(macd), i)) }),
+		alignRuleSeries(n, len(boll), func(i int) float64 {
+			upper, lower := boll[i].Upper.InexactFloat64(), boll[i].Lower.InexactFloat64()
+			if upper <= lower {
+				return 0.5
+			}
+			return (closeAt(len(boll), i) - lower) / (upper - lower)
+		}),
+		alignRuleSeries(n, len(kdj), func(i int) float64 { return kdj[i].K.InexactFloat64() / 100 }),
+		alignRuleSeries(n, len(wr), func(i int) float64 { return wr[i].WR14.InexactFloat64() / 100 }),
+		alignRuleSeries(n, len(atr), func(i int) float64 { return mlRatio(atr[i].ATR14.InexactFloat64(), closeAt(len(atr), i)) }),
+		mlVolumeRatio(volumes, 5),
+	}
+
+	patternSignal := make([]float64, n)
+	patternNet := make([]float64, n)
+	dayIndex := make(map[string]int, n)
+	for i, bar := range history {
+		dayIndex[bar.TradeDate] = i
+	}
+	for _, result := range indicators.NewPatternRecognizer().RecognizeAllPatterns(history) {
+		i, ok := dayIndex[result.TradeDate]
+		if !ok {
+			continue
+		}
+		confidence := math.Min(result.OverallConfidence.InexactFloat64()/100, 1)
+		switch result.CombinedSignal {
+		case indicators.SignalBuy:
+			patternSignal[i] = confidence
+		case indicators.SignalSell:
+			patternSignal[i] = -confidence
+		}
+		for _, pattern := range result.Candlestick {
+			patternNet[i] += mlPatternDirection(pattern.Signal)
+		}
+		for _, pattern := range result.VolumePrice {
+			patternNet[i] += mlPatternDirection(pattern.Signal)
+		}
+	}
+	columns = append(columns, patternSignal, patternNet)
+
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		row := make([]float64, len(columns))
+		for j, column := range columns {
+			row[j] = column[i]
+		}
+		matrix[i] = row
+	}
+	return matrix
+}
+
+// mlFeaturesKey 回测时在 context 中记录每只股票预先计算的特征矩阵: symbol -> *mlFeatureTable
+type mlFeaturesKey struct{}
+
+// mlFeatureTable 单只股票在完整预加载历史上计算的特征矩阵，与训练时的计算方式相同
+// 回测中每个交易日只取对应的一行，避免每天在截断的窗口上重新计算：既是O(n²)的开销，
+// 递推的指标（EMA、RSI、KDJ）也会因窗口起点不同而与训练时的特征不一致
+type mlFeatureTable struct {
+	dates []string // 与 rows 逐行对齐的交易日期 YYYYMMDD，升序
+	rows  [][]float64
+}
+
+// newMLFeatureTable 计算 bars 的特征矩阵
+func newMLFeatureTable(calculator *indicators.Calculator, bars []models.StockDaily) *mlFeatureTable {
+	dates := make([]string, len(bars))
+	for i, bar := range bars {
+		dates[i] = bar.TradeDate
+	}
+	return &mlFeatureTable{dates: dates, rows: mlFeatureMatrix(calculator, bars)}
+}
+
+// row 交易日的特征行，不在表中时返回false
+func (t *mlFeatureTable) row(tradeDate string) ([]float64, bool) {
+	i := sort.SearchStrings(t.dates, tradeDate)
+	if i == len(t.dates) || t.dates[i] != tradeDate {
+		return nil, false
+	}
+	return t.rows[i], true
+}
+
+// withMLFeatures 在 context 中记录预先计算的特征矩阵，执行机器学习策略时按交易日期取行
+func withMLFeatures(ctx context.Context, tables map[string]*mlFeatureTable) context.Context {
+	return context.WithValue(ctx, mlFeaturesKey{}, tables)
+}
+
+// mlFeatureRow history 最后一个交易日的特征行：context 中有该股票预先计算的特征矩阵时直接取行，
+// 否则（实时信号等回测之外的调用）在 history 上计算
+func mlFeatureRow(ctx context.Context, calculator *indicators.Calculator, symbol string, history []models.StockDaily) []float64 {
+	last := history[len(history)-1]
+	if tables, ok := ctx.Value(mlFeaturesKey{}).(map[string]*mlFeatureTable); ok {
+		if table, ok := tables[symbol]; ok {
+			if row, ok := table.row(last.TradeDate); ok {
+				return row
+			}
+		}
+	}
+	features := mlFeatureMatrix(calculator, history)
+	return features[len(features)-1]
+}
+
+// mlRowValid 特征行是否完整，预热期或数据异常的行不参与训练和预测
+func mlRowValid(row []float64) bool {
+	for _, value := range row {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// mlLabels 第 i 个交易日之后 horizon 个交易日的收益超过 threshold 时标为1，否则为0；未来数据不足的为 NaN
+func mlLabels(history []models.StockDaily, horizon int, threshold float64) []float64 {
+	labels := make([]float64, len(history))
+	for i := range labels {
+		labels[i] = math.NaN()
+		if i+horizon >= len(history) {
+			continue
+		}
+		base := history[i].Close.InexactFloat64()
+		if base <= 0 {
+			continue
+		}
+		if history[i+horizon].Close.InexactFloat64()/base-1 > threshold {
+			labels[i] = 1
+		} else {
+			labels[i] = 0
+		}
+	}
+	return labels
+}
+
+// mlReturns period 日收益率
+func mlReturns(closes []float64, period int) []float64 {
+	values := make([]float64, len(closes))
+	for i := range values {
+		values[i] = math.NaN()
+		if i >= period {
+			values[i] = mlRatio(closes[i], closes[i-period]) - 1
+		}
+	}
+	return values
+}
+
+// mlVolumeRatio 成交量相对之前 period 日均量的比例-1
+func mlVolumeRatio(volumes []float64, period int) []float64 {
+	values := make([]float64, len(volumes))
+	for i := range values {
+		values[i] = math.NaN()
+		if i < period {
+			continue
+		}
+		sum := 0.0
+		for _, volume := range volumes[i-period : i] {
+			sum += volume
+		}
+		values[i] = mlRatio(volumes[i], sum/float64(period)) - 1
+	}
+	return values
+}
+
+// mlRatio a/b，b 不为正时为 NaN
+func mlRatio(a, b float64) float64 {
+	if b <= 0 || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return a / b
+}
+
+// mlPatternDirection 图形信号的方向
+func mlPatternDirection(signal string) float64 {
+	switch signal {
+	case indicators.SignalBuy:
+		return 1
+	case indicators.SignalSell:
+		return -1
+	}
+	return 0
+}
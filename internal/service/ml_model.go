@@ -0,0 +1,200 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"stock-a-future/internal/models"
+)
+
+// 逻辑回归训练参数：标准化后的特征用全量梯度下降即可稳定收敛，初始权重为0，训练结果是确定的
+const (
+	mlEpochs       = 500
+	mlLearningRate = 0.5
+)
+
+// mlSample 一个训练样本：某只股票在某个交易日的特征和未来收益标签
+type mlSample struct {
+	symbol   string
+	date     string // YYYYMMDD
+	features []float64
+	label    float64
+}
+
+// logisticModel 对标准化特征做逻辑回归
+type logisticModel struct {
+	mean    []float64
+	std     []float64
+	weights []float64
+	bias    float64
+}
+
+// trainLogisticRegression 用带L2正则的逻辑回归拟合样本，特征按训练样本的均值和标准差标准化
+func trainLogisticRegression(samples []mlSample, l2 float64) *logisticModel {
+	dim := len(samples[0].features)
+	model := &logisticModel{
+		mean:    make([]float64, dim),
+		std:     make([]float64, dim),
+		weights: make([]float64, dim),
+	}
+
+	count := float64(len(samples))
+	for _, sample := range samples {
+		for j, value := range sample.features {
+			model.mean[j] += value / count
+		}
+	}
+	for _, sample := range samples {
+		for j, value := range sample.features {
+			model.std[j] += (value - model.mean[j]) * (value - model.mean[j]) / count
+		}
+	}
+	for j := range model.std {
+		model.std[j] = math.Sqrt(model.std[j])
+		if model.std[j] < 1e-12 {
+			model.std[j] = 1 // 常数特征标准化后恒为0，不影响预测
+		}
+	}
+
+	x := make([][]float64, len(samples))
+	for i, sample := range samples {
+		x[i] = model.standardize(sample.features)
+	}
+
+	gradient := make([]float64, dim)
+	for epoch := 0; epoch < mlEpochs; epoch++ {
+		for j := range gradient {
+			gradient[j] = 0
+		}
+		biasGradient := 0.0
+		for i, sample := range samples {
+			diff := sigmoid(model.score(x[i])) - sample.label
+			for j, value := range x[i] {
+				gradient[j] += diff * value
+			}
+			biasGradient += diff
+		}
+		for j := range model.weights {
+			model.weights[j] -= mlLearningRate * (gradient[j]/count + l2*model.weights[j])
+		}
+		model.bias -= mlLearningRate * biasGradient / count
+	}
+	return model
+}
+
+// standardize 按训练样本的均值和标准差标准化特征
+func (m *logisticModel) standardize(features []float64) []float64 {
+	x := make([]float64, len(features))
+	for j, value := range features {
+		x[j] = (value - m.mean[j]) / m.std[j]
+	}
+	return x
+}
+
+// score 标准化特征的线性得分
+func (m *logisticModel) score(x []float64) float64 {
+	z := m.bias
+	for j, value := range x {
+		z += m.weights[j] * value
+	}
+	return z
+}
+
+// probability 预测上涨的概率
+func (m *logisticModel) probability(features []float64) float64 {
+	return sigmoid(m.score(m.standardize(features)))
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+// mlModelFromLogistic 将训练结果转换为可持久化的模型
+func mlModelFromLogistic(model *logisticModel) *models.MLModel {
+	return &models.MLModel{
+		Algorithm: "logistic_regression",
+		Features:  append([]string(nil), mlFeatureNames...),
+		Mean:      model.mean,
+		Std:       model.std,
+		Weights:   model.weights,
+		Bias:      model.bias,
+	}
+}
+
+// logisticFromMLModel 由持久化的模型恢复逻辑回归
+func logisticFromMLModel(model *models.MLModel) *logisticModel {
+	return &logisticModel{mean: model.Mean, std: model.Std, weights: model.Weights, bias: model.Bias}
+}
+
+// evaluateMLModel 计算模型在样本上的准确率、对数损失和上涨比例
+func evaluateMLModel(model *logisticModel, samples []mlSample) (accuracy, logLoss, baseRate float64) {
+	for _, sample := range samples {
+		p := math.Min(math.Max(model.probability(sample.features), 1e-15), 1-1e-15)
+		if (p >= 0.5) == (sample.label == 1) {
+			accuracy++
+		}
+		logLoss -= sample.label*math.Log(p) + (1-sample.label)*math.Log(1-p)
+		baseRate += sample.label
+	}
+	count := float64(len(samples))
+	return accuracy / count, logLoss / count, baseRate / count
+}
+
+// crossValidateML 时间序列交叉验证：按交易日把样本分成 folds+1 段，第 k 折用前 k 段训练、第 k+1 段验证
+// 训练样本与验证段之间空出 horizon 个交易日，避免训练标签用到验证期的行情
+func crossValidateML(samples []mlSample, folds, horizon int, l2 float64) []models.MLFoldMetrics {
+	dateSet := make(map[string]bool)
+	for _, sample := range samples {
+		dateSet[sample.date] = true
+	}
+	dates := make([]string, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	dateIndex := make(map[string]int, len(dates))
+	for i, date := range dates {
+		dateIndex[date] = i
+	}
+
+	var metrics []models.MLFoldMetrics
+	blockSize := len(dates) / (folds + 1)
+	if blockSize == 0 {
+		return metrics
+	}
+	for k := 1; k <= folds; k++ {
+		testStart := k * blockSize
+		testEnd := testStart + blockSize // 不含
+		if k == folds {
+			testEnd = len(dates)
+		}
+
+		var train, test []mlSample
+		for _, sample := range samples {
+			switch i := dateIndex[sample.date]; {
+			case i < testStart-horizon:
+				train = append(train, sample)
+			case i >= testStart && i < testEnd:
+				test = append(test, sample)
+			}
+		}
+		if len(train) == 0 || len(test) == 0 {
+			continue
+		}
+
+		model := trainLogisticRegression(train, l2)
+		accuracy, logLoss, baseRate := evaluateMLModel(model, test)
+		metrics = append(metrics, models.MLFoldMetrics{
+			Fold:         k,
+			TrainEnd:     dates[testStart-horizon-1],
+			TestStart:    dates[testStart],
+			TestEnd:      dates[testEnd-1],
+			TrainSamples: len(train),
+			TestSamples:  len(test),
+			Accuracy:     accuracy,
+			LogLoss:      logLoss,
+			BaseRate:     baseRate,
+		})
+	}
+	return metrics
+}
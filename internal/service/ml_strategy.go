@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var (
+	ErrInvalidML         = errors.New("机器学习策略参数无效")
+	ErrMLModelNotTrained = errors.New("机器学习策略尚未训练模型")
+)
+
+// 机器学习策略默认参数
+const (
+	defaultMLHorizon         = 5
+	defaultMLBuyProbability  = 0.6
+	defaultMLSellProbability = 0.4
+	defaultMLL2              = 0.01
+	defaultMLFolds           = 4
+	minMLFolds               = 2
+	maxMLFolds               = 10
+	maxMLHorizon             = 60
+	minMLTrainingSamples     = 100
+)
+
+// ParseMLParams 解析并校验机器学习策略参数，未设置的参数使用默认值
+func ParseMLParams(params map[string]interface{}) (*models.MLStrategyParams, error) {
+	config := &models.MLStrategyParams{
+		Horizon:         getIntParameter(params, "horizon", defaultMLHorizon),
+		LabelThreshold:  getFloatParameter(params, "label_threshold", 0),
+		BuyProbability:  getFloatParameter(params, "buy_probability", defaultMLBuyProbability),
+		SellProbability: getFloatParameter(params, "sell_probability", defaultMLSellProbability),
+		L2:              getFloatParameter(params, "l2", defaultMLL2),
+		Folds:           getIntParameter(params, "folds", defaultMLFolds),
+	}
+
+	if config.Horizon < 1 || config.Horizon > maxMLHorizon {
+		return nil, fmt.Errorf("%w: horizon 必须在1-%d之间", ErrInvalidML, maxMLHorizon)
+	}
+	if config.BuyProbability < 0 || config.BuyProbability > 1 || config.SellProbability < 0 || config.SellProbability > 1 {
+		return nil, fmt.Errorf("%w: 概率阈值必须在0-1之间", ErrInvalidML)
+	}
+	if config.SellProbability >= config.BuyProbability {
+		return nil, fmt.Errorf("%w: sell_probability 必须小于 buy_probability", ErrInvalidML)
+	}
+	if config.L2 < 0 {
+		return nil, fmt.Errorf("%w: l2 不能为负数", ErrInvalidML)
+	}
+	if config.Folds < minMLFolds || config.Folds > maxMLFolds {
+		return nil, fmt.Errorf("%w: folds 必须在%d-%d之间", ErrInvalidML, minMLFolds, maxMLFolds)
+	}
+	return config, nil
+}
+
+// mlModelsKey 回测时在 context 中记录机器学习模型的快照: strategyID -> 模型
+type mlModelsKey struct{}
+
+// withMLModels 在 context 中记录机器学习模型的快照，执行机器学习策略时优先使用快照中的模型
+func withMLModels(ctx context.Context, mlModels map[string]*models.MLModel) context.Context {
+	return context.WithValue(ctx, mlModelsKey{}, mlModels)
+}
+
+// SaveMLModel 保存策略训练好的模型，替换之前的模型
+func (s *StrategyService) SaveMLModel(model *models.MLModel) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 训练期间策略可能已被删除
+	if _, exists := s.strategies[model.StrategyID]; !exists {
+		return ErrStrategyNotFound
+	}
+	if s.store != nil {
+		if err := s.store.SaveMLModel(model); err != nil {
+			return err
+		}
+	}
+	s.mlModels[model.StrategyID] = model
+	return nil
+}
+
+// GetMLModel 获取策略最近一次训练的模型
+func (s *StrategyService) GetMLModel(ctx context.Context, strategyID string) (*models.MLModel, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.strategies[strategyID]; !exists {
+		return nil, ErrStrategyNotFound
+	}
+	model, exists := s.mlModels[strategyID]
+	if !exists {
+		return nil, ErrMLModelNotTrained
+	}
+	// 模型训练后不再修改，返回结构体副本即可
+	modelCopy := *model
+	return &modelCopy, nil
+}
+
+// checkMLModel 检查模型是否由当前的策略定义训练：特征、策略版本、预测周期或标签阈值不一致时需要重新训练
+func checkMLModel(model *models.MLModel, strategy *models.Strategy, params *models.MLStrategyParams) error {
+	switch {
+	case len(model.Weights) != len(mlFeatureNames):
+		return fmt.Errorf("%w: 模型特征与当前版本不一致，需要重新训练", ErrMLModelNotTrained)
+	case model.StrategyVersion != strategy.Version:
+		return fmt.Errorf("%w: 模型由策略版本 %s 训练，当前策略版本为 %s，需要重新训练", ErrMLModelNotTrained, model.StrategyVersion, strategy.Version)
+	case model.Horizon != params.Horizon || model.LabelThreshold != params.LabelThreshold:
+		return fmt.Errorf("%w: 模型的预测周期或标签阈值与策略参数不一致，需要重新训练", ErrMLModelNotTrained)
+	}
+	return nil
+}
+
+// executeMLStrategy 用训练好的模型预测未来 horizon 日上涨的概率，context 中有模型快照时使用快照中的模型
+// 买入信号的置信度为上涨概率，卖出信号的置信度为不上涨的概率
+func (s *StrategyService) executeMLStrategy(ctx context.Context, strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	snapshot, _ := ctx.Value(mlModelsKey{}).(map[string]*models.MLModel)
+	model, ok := snapshot[strategy.ID]
+	if !ok {
+		s.mutex.RLock()
+		model = s.mlModels[strategy.ID]
+		s.mutex.RUnlock()
+	}
+	if model == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMLModelNotTrained, strategy.ID)
+	}
+	params, err := ParseMLParams(strategy.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMLModel(model, strategy, params); err != nil {
+		return nil, err
+	}
+
+	signal := newStrategySignal(strategy, marketData)
+	if len(history) == 0 {
+		return holdSignal(signal, "没有历史数据，无法计算模型特征"), nil
+	}
+	row := mlFeatureRow(ctx, s.calculator, marketData.Symbol, history)
+	if !mlRowValid(row) {
+		return holdSignal(signal, "历史数据不足，无法计算模型特征"), nil
+	}
+
+	probability := logisticFromMLModel(model).probability(row)
+	reason := fmt.Sprintf("模型预测未来%d日上涨概率 %.1f%%（%s 训练）", model.Horizon, probability*100, model.TrainedAt.Format("2006-01-02"))
+	switch {
+	case probability >= params.BuyProbability:
+		signal.SignalType = models.SignalTypeBuy
+		signal.Side = models.TradeSideBuy
+		signal.Confidence = probability
+	case probability <= params.SellProbability:
+		signal.SignalType = models.SignalTypeSell
+		signal.Side = models.TradeSideSell
+		signal.Confidence = 1 - probability
+	default:
+		return holdSignal(signal, reason), nil
+	}
+	signal.Strength = math.Abs(probability-0.5) * 2
+	signal.Reason = reason
+	return signal, nil
+}
+
+// TrainMLStrategy 在给定股票和日期区间上训练机器学习策略的模型
+// 先做时间序列交叉验证评估样本外表现，再用全部样本训练最终模型并保存
+func (s *BacktestService) TrainMLStrategy(ctx context.Context, strategyID string, req *models.MLTrainRequest) (*models.MLModel, error) {
+	strategy, err := s.strategyService.GetStrategy(ctx, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	if strategy.Type != models.StrategyTypeML {
+		return nil, fmt.Errorf("%w: 策略 %s 不是机器学习策略", ErrInvalidML, strategyID)
+	}
+	params, err := ParseMLParams(strategy.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Symbols) == 0 {
+		return nil, fmt.Errorf("%w: 至少需要一只训练股票", ErrInvalidML)
+	}
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 开始日期格式错误: %v", ErrInvalidML, err)
+	}
+	endDate, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 结束日期格式错误: %v", ErrInvalidML, err)
+	}
+	if !endDate.After(startDate) {
+		return nil, fmt.Errorf("%w: 结束日期必须晚于开始日期", ErrInvalidML)
+	}
+
+	histories, err := s.preloadBacktestData(ctx, req.Symbols, startDate, endDate, models.PriceAdjustForward)
+	if err != nil {
+		return nil, err
+	}
+
+	// 样本日期在区间内，且标签用到的未来行情不晚于结束日期
+	start, end := startDate.Format("20060102"), endDate.Format("20060102")
+	var samples []mlSample
+	for _, symbol := range req.Symbols {
+		history := histories[symbol]
+		if history == nil {
+			continue
+		}
+		features := mlFeatureMatrix(s.strategyService.calculator, history.bars)
+		labels := mlLabels(history.bars, params.Horizon, params.LabelThreshold)
+		for i, bar := range history.bars {
+			if bar.TradeDate < start || bar.TradeDate > end || math.IsNaN(labels[i]) || !mlRowValid(features[i]) {
+				continue
+			}
+			if history.bars[i+params.Horizon].TradeDate > end {
+				continue
+			}
+			samples = append(samples, mlSample{symbol: symbol, date: bar.TradeDate, features: features[i], label: labels[i]})
+		}
+	}
+	if len(samples) < minMLTrainingSamples {
+		return nil, fmt.Errorf("%w: 训练样本不足，需要至少%d个，实际%d个", ErrInvalidML, minMLTrainingSamples, len(samples))
+	}
+
+	// 按日期和股票排序，训练结果与请求中股票的顺序无关
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].date != samples[j].date {
+			return samples[i].date < samples[j].date
+		}
+		return samples[i].symbol < samples[j].symbol
+	})
+	positives := 0.0
+	for _, sample := range samples {
+		positives += sample.label
+	}
+	if positives == 0 || positives == float64(len(samples)) {
+		return nil, fmt.Errorf("%w: 训练样本的标签全部相同，请调整日期区间或 label_threshold", ErrInvalidML)
+	}
+
+	folds := crossValidateML(samples, params.Folds, params.Horizon, params.L2)
+	if len(folds) == 0 {
+		return nil, fmt.Errorf("%w: 交易日太少，无法进行%d折交叉验证", ErrInvalidML, params.Folds)
+	}
+
+	model := mlModelFromLogistic(trainLogisticRegression(samples, params.L2))
+	model.StrategyID = strategy.ID
+	model.StrategyVersion = strategy.Version
+	model.Horizon = params.Horizon
+	model.LabelThreshold = params.LabelThreshold
+	model.Symbols = append([]string(nil), req.Symbols...)
+	model.StartDate = req.StartDate
+	model.EndDate = req.EndDate
+	model.Samples = len(samples)
+	model.PositiveRate = positives / float64(len(samples))
+	model.Folds = folds
+	testSamples := 0
+	for _, fold := range folds {
+		model.CVAccuracy += fold.Accuracy * float64(fold.TestSamples)
+		model.CVLogLoss += fold.LogLoss * float64(fold.TestSamples)
+		testSamples += fold.TestSamples
+	}
+	model.CVAccuracy /= float64(testSamples)
+	model.CVLogLoss /= float64(testSamples)
+	model.TrainedAt = time.Now()
+
+	if err := s.strategyService.SaveMLModel(model); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("机器学习策略训练完成",
+		logger.String("strategy_id", strategy.ID),
+		logger.Int("samples", model.Samples),
+		logger.Int("folds", len(folds)),
+		logger.Float64("cv_accuracy", model.CVAccuracy),
+		logger.Float64("cv_log_loss", model.CVLogLoss),
+	)
+	return model, nil
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+// cyclicalCloses 构造周期波动的收盘价序列，未来收益可以由近期涨跌和布林带位置预测
+func cyclicalCloses(n, period int) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = 10 * (1 + 0.08*math.Sin(2*math.Pi*float64(i)/float64(period)) + 0.0005*float64(i))
+	}
+	return closes
+}
+
+func TestParseMLParams(t *testing.T) {
+	params, err := ParseMLParams(nil)
+	if err != nil {
+		t.Fatalf("默认参数应有效: %v", err)
+	}
+	want := &models.MLStrategyParams{Horizon: 5, BuyProbability: 0.6, SellProbability: 0.4, L2: 0.01, Folds: 4}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("默认参数错误: %+v", params)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"预测周期越界", map[string]interface{}{"horizon": 0.0}, "horizon 必须在"},
+		{"概率越界", map[string]interface{}{"buy_probability": 1.2}, "必须在0-1之间"},
+		{"卖出概率不低于买入概率", map[string]interface{}{"buy_probability": 0.5, "sell_probability": 0.5}, "必须小于"},
+		{"负的正则系数", map[string]interface{}{"l2": -0.1}, "不能为负数"},
+		{"折数过少", map[string]interface{}{"folds": 1.0}, "folds 必须在"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMLParams(tt.params)
+			if !errors.Is(err, ErrInvalidML) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("应返回包含 %q 的 ErrInvalidML, 实际 %v", tt.want, err)
+			}
+		})
+	}
+
+	service := newTestStrategyService(t)
+	strategy := &models.Strategy{ID: "ml-bad", Name: "机器学习", Type: models.StrategyTypeML, Parameters: map[string]interface{}{"folds": 20.0}}
+	if err := service.CreateStrategy(context.Background(), strategy); !errors.Is(err, ErrInvalidML) {
+		t.Errorf("创建参数无效的机器学习策略应失败, 实际 %v", err)
+	}
+}
+
+func TestMLFeaturesAndLabels(t *testing.T) {
+	history := buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), cyclicalCloses(80, 20))
+
+	labels := mlLabels(history, 5, 0)
+	for i, label := range labels {
+		if i+5 >= len(history) {
+			if !math.IsNaN(label) {
+				t.Errorf("第%d行没有足够的未来数据, 标签应为 NaN: %v", i, label)
+			}
+			continue
+		}
+		rising := history[i+5].Close.InexactFloat64() > history[i].Close.InexactFloat64()
+		if (label == 1) != rising {
+			t.Errorf("第%d行标签应对应未来5日的涨跌: %v", i, label)
+		}
+	}
+
+	calculator := newTestStrategyService(t).calculator
+	full := mlFeatureMatrix(calculator, history)
+	if len(full) != len(history) || len(full[0]) != len(mlFeatureNames) {
+		t.Fatalf("特征矩阵应与历史数据逐日对齐: %dx%d", len(full), len(full[0]))
+	}
+	if mlRowValid(full[5]) {
+		t.Error("指标预热期内的特征行应无效")
+	}
+	table := newMLFeatureTable(calculator, history)
+	if row, ok := table.row(history[40].TradeDate); !ok || !reflect.DeepEqual(row, full[40]) {
+		t.Errorf("应按交易日期取得特征行: %v", row)
+	}
+	if _, ok := table.row("19900101"); ok {
+		t.Error("不在历史中的交易日不应有特征行")
+	}
+	// 每一行只能使用截至当日的数据：用前缀计算的最后一行应与完整历史中的同一行一致
+	for _, k := range []int{40, 60, 79} {
+		prefix := mlFeatureMatrix(calculator, history[:k+1])
+		if !mlRowValid(full[k]) || !reflect.DeepEqual(prefix[k], full[k]) {
+			t.Errorf("第%d行特征使用了未来数据:\n前缀 %v\n完整 %v", k, prefix[k], full[k])
+		}
+	}
+}
+
+func TestTrainMLStrategy(t *testing.T) {
+	ctx := context.Background()
+	database, err := NewDatabaseService(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer database.Close()
+
+	strategyService := newTestStrategyService(t)
+	if err := strategyService.SetStore(NewStrategyStore(database.GetDB())); err != nil {
+		t.Fatalf("启用持久化存储失败: %v", err)
+	}
+	strategy := &models.Strategy{ID: "ml_cycle", Name: "周期预测", Type: models.StrategyTypeML}
+	if err := strategyService.CreateStrategy(ctx, strategy); err != nil {
+		t.Fatalf("创建机器学习策略失败: %v", err)
+	}
+
+	// 数据源返回的行情超出训练区间，超出部分不能用于标签
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, cyclicalCloses(400, 20)),
+			"600000.SH": buildTestDailyBars("600000.SH", start, cyclicalCloses(400, 24)),
+		},
+	}
+	backtestService := NewBacktestService(strategyService, &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	req := &models.MLTrainRequest{Symbols: []string{"000001.SZ", "600000.SH"}, StartDate: "2023-03-01", EndDate: "2024-03-29"}
+	if _, err := backtestService.TrainMLStrategy(ctx, "ma_crossover", req); !errors.Is(err, ErrInvalidML) {
+		t.Errorf("训练非机器学习策略应失败, 实际 %v", err)
+	}
+	if _, err := strategyService.GetMLModel(ctx, "ml_cycle"); !errors.Is(err, ErrMLModelNotTrained) {
+		t.Errorf("训练前不应有模型, 实际 %v", err)
+	}
+
+	model, err := backtestService.TrainMLStrategy(ctx, "ml_cycle", req)
+	if err != nil {
+		t.Fatalf("训练失败: %v", err)
+	}
+
+	if len(model.Folds) != 4 {
+		t.Fatalf("应有4折交叉验证结果: %+v", model.Folds)
+	}
+	for i, fold := range model.Folds {
+		if fold.TrainEnd >= fold.TestStart || fold.TestStart > fold.TestEnd {
+			t.Errorf("第%d折训练样本应早于验证样本: %+v", fold.Fold, fold)
+		}
+		if i > 0 && fold.TrainSamples <= model.Folds[i-1].TrainSamples {
+			t.Errorf("训练窗口应逐折扩大: %+v", model.Folds)
+		}
+	}
+	if model.Folds[len(model.Folds)-1].TestEnd > "20240322" {
+		t.Errorf("验证样本的标签不应使用结束日期之后的行情: %+v", model.Folds[len(model.Folds)-1])
+	}
+	if model.CVAccuracy < 0.7 {
+		t.Errorf("周期行情的样本外准确率应明显高于随机: %.3f", model.CVAccuracy)
+	}
+	if model.StrategyVersion != "1" || model.Samples == 0 || len(model.Weights) != len(mlFeatureNames) {
+		t.Errorf("模型信息不完整: %+v", model)
+	}
+
+	// 信号的置信度为模型给出的概率
+	history := dataClient.bars["000001.SZ"][:320]
+	signal, err := strategyService.ExecuteStrategy(ctx, "ml_cycle", lastBarMarketData(t, history), history)
+	if err != nil {
+		t.Fatalf("执行策略失败: %v", err)
+	}
+	features := mlFeatureMatrix(strategyService.calculator, history)
+	probability := logisticFromMLModel(model).probability(features[len(features)-1])
+	switch signal.SignalType {
+	case models.SignalTypeBuy:
+		if signal.Confidence != probability {
+			t.Errorf("买入信号的置信度应为上涨概率 %.4f: %.4f", probability, signal.Confidence)
+		}
+	case models.SignalTypeSell:
+		if signal.Confidence != 1-probability {
+			t.Errorf("卖出信号的置信度应为不上涨的概率 %.4f: %.4f", 1-probability, signal.Confidence)
+		}
+	default:
+		if probability >= 0.6 || probability <= 0.4 {
+			t.Errorf("概率 %.4f 超过阈值时不应持有", probability)
+		}
+	}
+	if !strings.Contains(signal.Reason, "上涨概率") {
+		t.Errorf("信号原因应说明预测概率: %s", signal.Reason)
+	}
+
+	// 回测时使用在完整历史上预先计算的特征矩阵，按交易日取行，与训练时的特征一致
+	full := newMLFeatureTable(strategyService.calculator, dataClient.bars["000001.SZ"])
+	tableCtx := withMLFeatures(ctx, map[string]*mlFeatureTable{"000001.SZ": full})
+	window := history[len(history)-60:]
+	if windowed := mlFeatureMatrix(strategyService.calculator, window); reflect.DeepEqual(windowed[len(windowed)-1], full.rows[len(history)-1]) {
+		t.Error("递推指标依赖计算起点，截断窗口上的特征应与完整历史不同")
+	}
+	if row := mlFeatureRow(tableCtx, strategyService.calculator, "000001.SZ", window); !reflect.DeepEqual(row, full.rows[len(history)-1]) {
+		t.Errorf("截断窗口上应取完整历史的特征行: %v", row)
+	}
+	windowSignal, err := strategyService.ExecuteStrategy(tableCtx, "ml_cycle", lastBarMarketData(t, window), window)
+	if err != nil {
+		t.Fatalf("执行策略失败: %v", err)
+	}
+	if want := fmt.Sprintf("上涨概率 %.1f%%", probability*100); !strings.Contains(windowSignal.Reason, want) {
+		t.Errorf("截断窗口上的信号应与完整历史一致（%s）: %s", want, windowSignal.Reason)
+	}
+
+	// 模型与当前策略定义不一致时需要重新训练
+	stale := *strategy
+	stale.Version = model.StrategyVersion
+	stale.Parameters = map[string]interface{}{"horizon": 10.0}
+	params, _ := ParseMLParams(stale.Parameters)
+	if err := checkMLModel(model, &stale, params); !errors.Is(err, ErrMLModelNotTrained) {
+		t.Errorf("预测周期与模型不一致时应要求重新训练, 实际 %v", err)
+	}
+	parameters := map[string]interface{}{"buy_probability": 0.7}
+	if err := strategyService.UpdateStrategy(ctx, "ml_cycle", &models.UpdateStrategyRequest{Parameters: &parameters}); err != nil {
+		t.Fatalf("更新策略失败: %v", err)
+	}
+	if _, err := strategyService.ExecuteStrategy(ctx, "ml_cycle", lastBarMarketData(t, history), history); !errors.Is(err, ErrMLModelNotTrained) || !strings.Contains(err.Error(), "需要重新训练") {
+		t.Errorf("策略更新后应要求重新训练模型, 实际 %v", err)
+	}
+
+	// 模型随策略持久化，删除策略时一并删除
+	restarted := newTestStrategyService(t)
+	if err := restarted.SetStore(NewStrategyStore(database.GetDB())); err != nil {
+		t.Fatalf("重新加载策略失败: %v", err)
+	}
+	reloaded, err := restarted.GetMLModel(ctx, "ml_cycle")
+	if err != nil || !reflect.DeepEqual(reloaded.Weights, model.Weights) || reloaded.CVAccuracy != model.CVAccuracy {
+		t.Errorf("重启后应恢复训练好的模型: %v", err)
+	}
+	if err := restarted.DeleteStrategy(ctx, "ml_cycle"); err != nil {
+		t.Fatalf("删除策略失败: %v", err)
+	}
+	remaining, err := NewStrategyStore(database.GetDB()).LoadMLModels()
+	if err != nil || len(remaining) != 0 {
+		t.Errorf("删除策略后模型应一并删除: %v, %v", remaining, err)
+	}
+}
+
+func TestSimulateBacktest_MLRequiresModel(t *testing.T) {
+	strategyService := newTestStrategyService(t)
+	strategy := &models.Strategy{ID: "ml_untrained", Name: "未训练", Type: models.StrategyTypeML}
+	if err := strategyService.CreateStrategy(context.Background(), strategy); err != nil {
+		t.Fatalf("创建机器学习策略失败: %v", err)
+	}
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), steadyCloses(60, 0.001)),
+		},
+	}
+	service := NewBacktestService(strategyService, &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+	backtest := &models.Backtest{
+		ID:          "bt-ml",
+		StrategyIDs: []string{"ml_untrained"},
+		Symbols:     []string{"000001.SZ"},
+		StartDate:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+	}
+	if _, err := service.simulateBacktest(context.Background(), backtest, []*models.Strategy{strategy}, nil); !errors.Is(err, ErrMLModelNotTrained) {
+		t.Errorf("未训练模型的机器学习策略不能回测, 实际 %v", err)
+	}
+}
+
+func TestReplayBacktest_MLModelSnapshot(t *testing.T) {
+	ctx := context.Background()
+	strategyService := newTestStrategyService(t)
+	strategy := &models.Strategy{ID: "ml_replay", Name: "周期预测", Type: models.StrategyTypeML}
+	if err := strategyService.CreateStrategy(ctx, strategy); err != nil {
+		t.Fatalf("创建机器学习策略失败: %v", err)
+	}
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, cyclicalCloses(400, 20)),
+			"600000.SH": buildTestDailyBars("600000.SH", start, cyclicalCloses(400, 24)),
+		},
+	}
+	service := NewBacktestService(strategyService, &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	symbols := []string{"000001.SZ", "600000.SH"}
+	model, err := service.TrainMLStrategy(ctx, "ml_replay", &models.MLTrainRequest{Symbols: symbols, StartDate: "2023-03-01", EndDate: "2023-12-29"})
+	if err != nil {
+		t.Fatalf("训练失败: %v", err)
+	}
+
+	backtest := &models.Backtest{
+		ID:          "bt-ml-replay",
+		StrategyIDs: []string{"ml_replay"},
+		Symbols:     symbols[:1],
+		StartDate:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		InitialCash: 1000000,
+	}
+	registered, _ := strategyService.GetStrategy(ctx, "ml_replay")
+	runData, err := service.simulateBacktest(ctx, backtest, []*models.Strategy{registered}, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("测试数据应产生交易")
+	}
+	if snapshot := runData.Manifest.MLModels; len(snapshot) != 1 || !reflect.DeepEqual(snapshot[0].Weights, model.Weights) {
+		t.Fatalf("运行清单应记录回测使用的模型: %+v", snapshot)
+	}
+
+	backtest.Status = models.BacktestStatusCompleted
+	service.backtests[backtest.ID] = backtest
+	service.backtestManifests[backtest.ID] = runData.Manifest
+
+	// 重新训练替换模型后，重新运行仍使用清单中的模型
+	retrained, err := service.TrainMLStrategy(ctx, "ml_replay", &models.MLTrainRequest{Symbols: symbols[:1], StartDate: "2023-06-01", EndDate: "2023-12-29"})
+	if err != nil {
+		t.Fatalf("重新训练失败: %v", err)
+	}
+	if reflect.DeepEqual(retrained.Weights, model.Weights) {
+		t.Fatal("重新训练应得到不同的模型")
+	}
+	report, err := service.ReplayBacktest(ctx, backtest.ID)
+	if err != nil {
+		t.Fatalf("重新运行失败: %v", err)
+	}
+	if !report.Match {
+		t.Errorf("按清单中的模型重新运行应与原结果一致: %+v", report.Mismatches)
+	}
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidMonteCarlo = errors.New("蒙特卡洛分析参数无效")
+
+const (
+	defaultMonteCarloSimulations  = 1000
+	maxMonteCarloSimulations      = 10000
+	defaultMonteCarloSkipFraction = 0.1
+	defaultMonteCarloConfidence   = 0.95
+	monteCarloHistogramBins       = 20
+)
+
+// monteCarloInput 蒙特卡洛模拟的输入数据
+// 交易类模拟（打乱顺序、随机跳过）基于已平仓交易的收益率重建权益曲线，持仓的浮动盈亏不计入
+type monteCarloInput struct {
+	dailyReturns []float64 // 权益曲线的日收益率，用于重抽样
+	pnls         []float64 // 已平仓交易的盈亏，按平仓日排序
+	rates        []float64 // 每笔交易盈亏占平仓前已实现权益的比例
+	exitDays     []int     // 每笔交易平仓日在权益曲线中的下标
+	days         int
+	initialCash  float64
+}
+
+// monteCarloParams 填充默认值后的模拟参数
+type monteCarloParams struct {
+	simulations     int
+	skipFraction    float64
+	confidenceLevel float64
+	seed            int64
+}
+
+// normalizeMonteCarloRequest 填充默认值并校验参数
+// 未设置模拟次数时使用默认值，显式设为0视为无效；未设置随机种子时按当前时间生成
+func normalizeMonteCarloRequest(req *models.MonteCarloRequest) (*monteCarloParams, error) {
+	params := &monteCarloParams{
+		simulations:     defaultMonteCarloSimulations,
+		skipFraction:    req.SkipFraction,
+		confidenceLevel: req.ConfidenceLevel,
+		seed:            time.Now().UnixNano(),
+	}
+	if req.Simulations != nil {
+		params.simulations = *req.Simulations
+	}
+	if req.Seed != nil {
+		params.seed = *req.Seed
+	}
+	if req.SkipFraction == 0 {
+		params.skipFraction = defaultMonteCarloSkipFraction
+	}
+	if req.ConfidenceLevel == 0 {
+		params.confidenceLevel = defaultMonteCarloConfidence
+	}
+
+	if params.simulations <= 0 || params.simulations > maxMonteCarloSimulations {
+		return nil, fmt.Errorf("%w: simulations 必须在1-%d之间", ErrInvalidMonteCarlo, maxMonteCarloSimulations)
+	}
+	if params.skipFraction < 0 || params.skipFraction >= 1 {
+		return nil, fmt.Errorf("%w: skip_fraction 必须在0-1之间", ErrInvalidMonteCarlo)
+	}
+	if params.confidenceLevel <= 0 || params.confidenceLevel >= 1 {
+		return nil, fmt.Errorf("%w: confidence_level 必须在0-1之间", ErrInvalidMonteCarlo)
+	}
+	return params, nil
+}
+
+// RunMonteCarlo 对已完成的回测进行蒙特卡洛稳健性分析
+func (s *BacktestService) RunMonteCarlo(ctx context.Context, backtestID string, req *models.MonteCarloRequest) (*models.MonteCarloResult, error) {
+	params, err := normalizeMonteCarloRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureRunDataLoaded(backtestID); err != nil {
+		s.logger.Error("从数据库加载回测结果失败",
+			logger.String("backtest_id", backtestID),
+			logger.ErrorField(err),
+		)
+	}
+
+	input, err := s.monteCarloInput(backtestID, req.StrategyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(params.seed))
+
+	result := &models.MonteCarloResult{
+		BacktestID:      backtestID,
+		StrategyID:      req.StrategyID,
+		Simulations:     params.simulations,
+		ConfidenceLevel: params.confidenceLevel,
+		SkipFraction:    params.skipFraction,
+		Seed:            params.seed,
+		TradeCount:      len(input.pnls),
+		CreatedAt:       time.Now(),
+	}
+
+	methods := []models.MonteCarloMethod{models.MonteCarloTradeShuffle, models.MonteCarloBootstrap, models.MonteCarloTradeSkip}
+	for _, method := range methods {
+		methodResult, err := runMonteCarloMethod(ctx, method, input, params, rng)
+		if err != nil {
+			return nil, err
+		}
+		result.Methods = append(result.Methods, *methodResult)
+	}
+
+	s.logger.Info("蒙特卡洛分析完成",
+		logger.String("backtest_id", backtestID),
+		logger.Int("simulations", params.simulations),
+		logger.Int64("seed", params.seed),
+		logger.Int("trades", len(input.pnls)),
+	)
+	return result, nil
+}
+
+// monteCarloInput 从回测结果中提取模拟所需的收益率和交易盈亏
+// 未指定策略时：单策略回测直接分析该策略；多策略回测分析组合曲线，独立资金模式下组合曲线是各策略的平均值，交易盈亏按策略数等比例缩小
+func (s *BacktestService) monteCarloInput(backtestID, strategyID string) (*monteCarloInput, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	backtest, exists := s.backtests[backtestID]
+	if !exists {
+		return nil, ErrBacktestNotFound
+	}
+	if backtest.Status != models.BacktestStatusCompleted {
+		return nil, ErrBacktestNotCompleted
+	}
+
+	strategyCurves := s.backtestStrategyEquityCurves[backtestID]
+	curve := s.backtestEquityCurves[backtestID]
+	pnlScale := 1.0
+	switch {
+	case strategyID != "":
+		strategyCurve, ok := strategyCurves[strategyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: 回测中不存在策略 %s", ErrInvalidMonteCarlo, strategyID)
+		}
+		curve = strategyCurve
+	case len(strategyCurves) == 1:
+		for id, strategyCurve := range strategyCurves {
+			strategyID, curve = id, strategyCurve
+		}
+	case len(strategyCurves) > 1 && !sharedPortfolioMode(backtest):
+		pnlScale = 1 / float64(len(strategyCurves))
+	}
+	if len(curve) < 2 {
+		return nil, fmt.Errorf("%w: 权益曲线数据不足", ErrInvalidMonteCarlo)
+	}
+
+	dayIndex := make(map[string]int, len(curve))
+	for i, point := range curve {
+		dayIndex[point.Date] = i
+	}
+
+	input := &monteCarloInput{
+		dailyReturns: equityCurveReturns(curve, func(p models.EquityPoint) float64 { return p.PortfolioValue }),
+		days:         len(curve),
+		initialCash:  backtest.InitialCash,
+	}
+	if strategyID != "" && sharedPortfolioMode(backtest) {
+		input.initialCash *= strategyWeights(backtest.Portfolio, backtest.StrategyIDs)[strategyID]
+	}
+	for _, trade := range s.backtestTrades[backtestID] {
+		if trade.Side != models.TradeSideSell || (strategyID != "" && trade.StrategyID != strategyID) {
+			continue
+		}
+		day, ok := dayIndex[trade.Timestamp.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		input.pnls = append(input.pnls, trade.PnL*pnlScale)
+		input.exitDays = append(input.exitDays, day)
+	}
+	input.sortTrades()
+	input.rates = input.tradeRates()
+	return input, nil
+}
+
+// runMonteCarloMethod 按指定方法运行多次模拟并统计指标分布
+func runMonteCarloMethod(ctx context.Context, method models.MonteCarloMethod, input *monteCarloInput, params *monteCarloParams, rng *rand.Rand) (*models.MonteCarloMethodResult, error) {
+	original := input.dailyReturns
+	if method != models.MonteCarloBootstrap {
+		original = input.tradeReturns(input.rates)
+	}
+	originalMetrics := monteCarloMetrics(original)
+
+	totalReturns := make([]float64, params.simulations)
+	maxDrawdowns := make([]float64, params.simulations)
+	sharpeRatios := make([]float64, params.simulations)
+	rates := make([]float64, len(input.rates))
+	for i := 0; i < params.simulations; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var returns []float64
+		switch method {
+		case models.MonteCarloTradeShuffle:
+			copy(rates, input.rates)
+			rng.Shuffle(len(rates), func(a, b int) { rates[a], rates[b] = rates[b], rates[a] })
+			returns = input.tradeReturns(rates)
+		case models.MonteCarloTradeSkip:
+			for j, rate := range input.rates {
+				rates[j] = rate
+				if rng.Float64() < params.skipFraction {
+					rates[j] = 0
+				}
+			}
+			returns = input.tradeReturns(rates)
+		case models.MonteCarloBootstrap:
+			returns = make([]float64, len(input.dailyReturns))
+			for j := range returns {
+				returns[j] = input.dailyReturns[rng.Intn(len(input.dailyReturns))]
+			}
+		}
+
+		metrics := monteCarloMetrics(returns)
+		totalReturns[i] = metrics.TotalReturn
+		maxDrawdowns[i] = metrics.MaxDrawdown
+		sharpeRatios[i] = metrics.SharpeRatio
+	}
+
+	result := &models.MonteCarloMethodResult{
+		Method:      method,
+		Simulations: params.simulations,
+		MaxDrawdown: metricDistribution(originalMetrics.MaxDrawdown, maxDrawdowns, params.confidenceLevel),
+		SharpeRatio: metricDistribution(originalMetrics.SharpeRatio, sharpeRatios, params.confidenceLevel),
+	}
+	// 收益率连乘与顺序无关，打乱顺序后总收益恒等于原始值，没有分布可言
+	if method != models.MonteCarloTradeShuffle {
+		distribution := metricDistribution(originalMetrics.TotalReturn, totalReturns, params.confidenceLevel)
+		result.TotalReturn = &distribution
+	}
+	return result, nil
+}
+
+// sortTrades 将交易按平仓日稳定排序，同一天平仓的交易保持成交顺序
+func (in *monteCarloInput) sortTrades() {
+	order := make([]int, len(in.pnls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return in.exitDays[order[a]] < in.exitDays[order[b]] })
+
+	pnls := make([]float64, len(order))
+	exitDays := make([]int, len(order))
+	for i, j := range order {
+		pnls[i], exitDays[i] = in.pnls[j], in.exitDays[j]
+	}
+	in.pnls, in.exitDays = pnls, exitDays
+}
+
+// tradeRates 按平仓顺序计算每笔交易盈亏占平仓前已实现权益的比例
+func (in *monteCarloInput) tradeRates() []float64 {
+	rates := make([]float64, len(in.pnls))
+	equity := in.initialCash
+	for i, pnl := range in.pnls {
+		if equity <= 0 {
+			rates[i] = -1
+			continue
+		}
+		rates[i] = pnl / equity
+		equity += pnl
+	}
+	return rates
+}
+
+// tradeReturns 将交易收益率按平仓日在当时的已实现权益上复利记入，返回已实现权益曲线的日收益率
+// 交易的平仓日保持不变，模拟改变的是各平仓日上实现的收益率
+func (in *monteCarloInput) tradeReturns(rates []float64) []float64 {
+	returns := make([]float64, in.days)
+	equity := in.initialCash
+	for i := 0; i < len(rates) && equity > 0; {
+		day := in.exitDays[i]
+		dayStart := equity
+		for ; i < len(rates) && in.exitDays[i] == day; i++ {
+			equity *= 1 + rates[i]
+		}
+		returns[day] = equity/dayStart - 1
+	}
+	return returns
+}
+
+// monteCarloMetrics 用与回测结果相同的算法计算收益序列的指标
+func monteCarloMetrics(returns []float64) *models.BacktestResult {
+	return (&models.PerformanceMetrics{
+		Returns:      returns,
+		RiskFreeRate: 0.03 / 252,
+	}).CalculateMetrics()
+}
+
+// metricDistribution 统计模拟值的分布、分位数和置信区间
+func metricDistribution(original float64, values []float64, confidence float64) models.MetricDistribution {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	distribution := models.MetricDistribution{Original: original}
+	if len(sorted) == 0 {
+		return distribution
+	}
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	distribution.Mean = sum / float64(len(sorted))
+	var variance float64
+	for _, v := range sorted {
+		variance += (v - distribution.Mean) * (v - distribution.Mean)
+	}
+	distribution.StdDev = math.Sqrt(variance / float64(len(sorted)))
+
+	distribution.Min = sorted[0]
+	distribution.Max = sorted[len(sorted)-1]
+	distribution.P5 = percentile(sorted, 0.05)
+	distribution.P25 = percentile(sorted, 0.25)
+	distribution.Median = percentile(sorted, 0.5)
+	distribution.P75 = percentile(sorted, 0.75)
+	distribution.P95 = percentile(sorted, 0.95)
+	tail := (1 - confidence) / 2
+	distribution.CILower = percentile(sorted, tail)
+	distribution.CIUpper = percentile(sorted, 1-tail)
+	distribution.Histogram = histogram(sorted, monteCarloHistogramBins)
+	return distribution
+}
+
+// percentile 对已排序的数据按线性插值计算分位数
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// histogram 将已排序的数据等宽分组，所有值相同时只有一个区间
+func histogram(sorted []float64, bins int) []models.HistogramBin {
+	minValue, maxValue := sorted[0], sorted[len(sorted)-1]
+	if maxValue == minValue {
+		return []models.HistogramBin{{Lower: minValue, Upper: maxValue, Count: len(sorted)}}
+	}
+
+	width := (maxValue - minValue) / float64(bins)
+	result := make([]models.HistogramBin, bins)
+	for i := range result {
+		result[i].Lower = minValue + width*float64(i)
+		result[i].Upper = minValue + width*float64(i+1)
+	}
+	for _, v := range sorted {
+		i := minInt(int((v-minValue)/width), bins-1)
+		result[i].Count++
+	}
+	return result
+}
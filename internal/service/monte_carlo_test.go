@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// newMonteCarloTestService 构造一个已完成的单策略回测：60个交易日、6笔平仓交易
+func newMonteCarloTestService() *BacktestService {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var curve []models.EquityPoint
+	value := 100000.0
+	for i := 0; i < 60; i++ {
+		value *= 1 + 0.01*math.Sin(float64(i))
+		curve = append(curve, models.EquityPoint{Date: start.AddDate(0, 0, i).Format("2006-01-02"), PortfolioValue: value})
+	}
+
+	var trades []models.Trade
+	for i, pnl := range []float64{5000, -2000, 3000, -4000, 6000, -1000} {
+		day := start.AddDate(0, 0, 5+i*9)
+		trades = append(trades,
+			models.Trade{ID: fmt.Sprintf("b%d", i), StrategyID: "s1", Side: models.TradeSideBuy, Timestamp: day.AddDate(0, 0, -3)},
+			models.Trade{ID: fmt.Sprintf("s%d", i), StrategyID: "s1", Side: models.TradeSideSell, PnL: pnl, Timestamp: day},
+		)
+	}
+
+	service.backtests["bt1"] = &models.Backtest{ID: "bt1", InitialCash: 100000, Status: models.BacktestStatusCompleted}
+	service.backtests["bt2"] = &models.Backtest{ID: "bt2", Status: models.BacktestStatusRunning}
+	service.backtestEquityCurves["bt1"] = curve
+	service.backtestStrategyEquityCurves["bt1"] = map[string][]models.EquityPoint{"s1": curve}
+	service.backtestTrades["bt1"] = trades
+	return service
+}
+
+func TestRunMonteCarlo(t *testing.T) {
+	service := newMonteCarloTestService()
+	ctx := context.Background()
+
+	simulations, seed := 500, int64(42)
+	result, err := service.RunMonteCarlo(ctx, "bt1", &models.MonteCarloRequest{Simulations: &simulations, Seed: &seed})
+	if err != nil {
+		t.Fatalf("蒙特卡洛分析失败: %v", err)
+	}
+	if result.TradeCount != 6 || result.SkipFraction != 0.1 || result.ConfidenceLevel != 0.95 || len(result.Methods) != 3 {
+		t.Fatalf("默认参数或结果结构错误: %+v", result)
+	}
+
+	for _, method := range result.Methods {
+		distributions := map[string]models.MetricDistribution{
+			"max_drawdown": method.MaxDrawdown,
+			"sharpe_ratio": method.SharpeRatio,
+		}
+		if method.TotalReturn != nil {
+			distributions["total_return"] = *method.TotalReturn
+		}
+		for name, dist := range distributions {
+			if !(dist.Min <= dist.CILower && dist.CILower <= dist.Median && dist.Median <= dist.CIUpper && dist.CIUpper <= dist.Max) {
+				t.Errorf("%s/%s 分位数顺序错误: %+v", method.Method, name, dist)
+			}
+			count := 0
+			for _, bin := range dist.Histogram {
+				count += bin.Count
+			}
+			if count != 500 {
+				t.Errorf("%s/%s 直方图计数应为500, 实际 %d", method.Method, name, count)
+			}
+		}
+	}
+
+	// 打乱交易收益率的顺序不改变总收益，不返回总收益分布，只改变回撤路径
+	shuffle := result.Methods[0]
+	if shuffle.Method != models.MonteCarloTradeShuffle || shuffle.TotalReturn != nil {
+		t.Errorf("打乱顺序不应返回总收益分布: %+v", shuffle.TotalReturn)
+	}
+	if shuffle.MaxDrawdown.Min == shuffle.MaxDrawdown.Max {
+		t.Error("打乱顺序应产生不同的最大回撤")
+	}
+	skip := result.Methods[2]
+	if skip.TotalReturn == nil || math.Abs(skip.TotalReturn.Original-0.07) > 1e-9 || skip.TotalReturn.StdDev == 0 {
+		t.Errorf("随机跳过交易的原始总收益应为已实现的7%%且有分布: %+v", skip.TotalReturn)
+	}
+
+	// 交易收益率在当时的已实现权益上复利计入：原始顺序复现已实现权益，打乱后每日的盈亏随当时的权益缩放
+	input, err := service.monteCarloInput("bt1", "")
+	if err != nil {
+		t.Fatalf("提取模拟输入失败: %v", err)
+	}
+	equity := input.initialCash
+	for _, r := range input.tradeReturns(input.rates) {
+		equity *= 1 + r
+	}
+	if math.Abs(equity-107000) > 1e-6 {
+		t.Errorf("按原始顺序复利应得到已实现权益107000: %.6f", equity)
+	}
+	reversed := make([]float64, len(input.rates))
+	for i, rate := range input.rates {
+		reversed[len(reversed)-1-i] = rate
+	}
+	returns := input.tradeReturns(reversed)
+	if first := returns[input.exitDays[0]]; math.Abs(first-input.rates[len(input.rates)-1]) > 1e-12 {
+		t.Errorf("第一笔平仓应按其收益率计入: %.6f", first)
+	}
+
+	// 重抽样的原始值与权益曲线一致
+	bootstrap := result.Methods[1]
+	curveMetrics := monteCarloMetrics(equityCurveReturns(service.backtestEquityCurves["bt1"], func(p models.EquityPoint) float64 { return p.PortfolioValue }))
+	if bootstrap.TotalReturn == nil || bootstrap.TotalReturn.Original != curveMetrics.TotalReturn || bootstrap.TotalReturn.StdDev == 0 {
+		t.Errorf("重抽样结果错误: %+v", bootstrap.TotalReturn)
+	}
+
+	// 相同种子结果可复现
+	again, err := service.RunMonteCarlo(ctx, "bt1", &models.MonteCarloRequest{Simulations: &simulations, Seed: &seed})
+	if err != nil {
+		t.Fatalf("蒙特卡洛分析失败: %v", err)
+	}
+	if !reflect.DeepEqual(again.Methods, result.Methods) {
+		t.Error("相同随机种子的模拟结果应一致")
+	}
+
+	// 未设置种子时结果中记录实际使用的种子，传入该种子可复现
+	random, err := service.RunMonteCarlo(ctx, "bt1", &models.MonteCarloRequest{Simulations: &simulations})
+	if err != nil {
+		t.Fatalf("蒙特卡洛分析失败: %v", err)
+	}
+	replayed, err := service.RunMonteCarlo(ctx, "bt1", &models.MonteCarloRequest{Simulations: &simulations, Seed: &random.Seed})
+	if err != nil {
+		t.Fatalf("蒙特卡洛分析失败: %v", err)
+	}
+	if !reflect.DeepEqual(replayed.Methods, random.Methods) {
+		t.Error("使用结果中记录的随机种子应复现模拟结果")
+	}
+}
+
+func TestRunMonteCarlo_Errors(t *testing.T) {
+	service := newMonteCarloTestService()
+	ctx := context.Background()
+
+	tooMany, zero := maxMonteCarloSimulations+1, 0
+	tests := []struct {
+		name      string
+		backtest  string
+		req       models.MonteCarloRequest
+		wantError error
+	}{
+		{"回测不存在", "missing", models.MonteCarloRequest{}, ErrBacktestNotFound},
+		{"回测未完成", "bt2", models.MonteCarloRequest{}, ErrBacktestNotCompleted},
+		{"模拟次数过多", "bt1", models.MonteCarloRequest{Simulations: &tooMany}, ErrInvalidMonteCarlo},
+		{"模拟次数为0", "bt1", models.MonteCarloRequest{Simulations: &zero}, ErrInvalidMonteCarlo},
+		{"跳过比例无效", "bt1", models.MonteCarloRequest{SkipFraction: 1}, ErrInvalidMonteCarlo},
+		{"策略不存在", "bt1", models.MonteCarloRequest{StrategyID: "s2"}, ErrInvalidMonteCarlo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if _, err := service.RunMonteCarlo(ctx, tt.backtest, &req); !errors.Is(err, tt.wantError) {
+				t.Errorf("期望错误 %v, 实际 %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	for p, want := range map[float64]float64{0: 1, 0.5: 3, 1: 5, 0.1: 1.4} {
+		if got := percentile(sorted, p); math.Abs(got-want) > 1e-9 {
+			t.Errorf("percentile(%v) = %v, 期望 %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// OptimizationProgress 优化任务的进度快照
+type OptimizationProgress struct {
+	OptimizationID string                 `json:"optimization_id"`
+	StrategyID     string                 `json:"strategy_id"`
+	Status         string                 `json:"status"`
+	Progress       int                    `json:"progress"`
+	CurrentCombo   int                    `json:"current_combo"`
+	TotalCombos    int                    `json:"total_combos"`
+	CurrentParams  map[string]interface{} `json:"current_params"`
+	BestParams     map[string]interface{} `json:"best_params"`
+	BestScore      float64                `json:"best_score"`
+	StartTime      time.Time              `json:"start_time"`
+	EstimatedEnd   time.Time              `json:"estimated_end"`
+}
+
+// progressSnapshot 返回任务当前进度，调用方需持有 tasksMutex
+func (t *OptimizationTask) progressSnapshot() *OptimizationProgress {
+	return &OptimizationProgress{
+		OptimizationID: t.ID,
+		StrategyID:     t.StrategyID,
+		Status:         t.Status,
+		Progress:       t.Progress,
+		CurrentCombo:   t.CurrentCombo,
+		TotalCombos:    t.TotalCombos,
+		CurrentParams:  t.CurrentParams,
+		BestParams:     t.BestParams,
+		BestScore:      t.BestScore,
+		StartTime:      t.StartTime,
+		EstimatedEnd:   t.EstimatedEndTime,
+	}
+}
+
+// finished 任务是否已结束
+func (t *OptimizationTask) finished() bool {
+	return t.Status != "running"
+}
+
+// SubscribeOptimization 订阅优化任务的进度事件
+// 第一个事件为当前进度快照；任务结束后通道关闭，已结束的任务只推送快照
+func (s *ParameterOptimizer) SubscribeOptimization(optimizationID string) (<-chan models.ProgressEvent, func(), error) {
+	s.tasksMutex.RLock()
+	defer s.tasksMutex.RUnlock()
+
+	task, exists := s.runningTasks[optimizationID]
+	if !exists {
+		return nil, nil, fmt.Errorf("优化任务不存在: %s", optimizationID)
+	}
+
+	snapshot := models.ProgressEvent{Type: models.ProgressEventSnapshot, Data: task.progressSnapshot()}
+	events, cancel := s.events.subscribe(optimizationID, snapshot, task.finished())
+	return events, cancel, nil
+}
+
+// publishTaskLocked 推送任务的当前进度，任务结束时推送状态事件并关闭订阅，调用方需持有 tasksMutex 写锁
+func (s *ParameterOptimizer) publishTaskLocked(task *OptimizationTask) {
+	if !task.finished() {
+		s.events.publish(task.ID, models.ProgressEvent{Type: models.ProgressEventProgress, Data: task.progressSnapshot()})
+		return
+	}
+	s.events.publish(task.ID, models.ProgressEvent{Type: models.ProgressEventStatus, Data: task.progressSnapshot()})
+	s.events.closeJob(task.ID)
+}
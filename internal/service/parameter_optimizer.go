@@ -26,6 +26,7 @@ type ParameterOptimizer struct {
 	// 运行中的优化任务
 	runningTasks map[string]*OptimizationTask
 	tasksMutex   sync.RWMutex
+	events       *eventHub // 任务进度事件推送
 }
 
 // NewParameterOptimizer 创建参数优化器
@@ -35,6 +36,7 @@ func NewParameterOptimizer(backtestService *BacktestService, strategyService *St
 		strategyService: strategyService,
 		logger:          log,
 		runningTasks:    make(map[string]*OptimizationTask),
+		events:          newEventHub(),
 	}
 }
 
@@ -55,6 +57,7 @@ type OptimizationTask struct {
 	EstimatedEndTime    time.Time
 	CancelFunc          context.CancelFunc
 	Results             []ParameterTestResult
+	WalkForward         *WalkForwardResult // 前向分析结果（仅前向分析模式）
 }
 
 // OptimizationConfig 优化配置
@@ -71,6 +74,9 @@ type OptimizationConfig struct {
 	Algorithm          string                    `json:"algorithm"` // grid_search, genetic
 	MaxCombinations    int                       `json:"max_combinations"`
 	GeneticConfig      *GeneticAlgorithmConfig   `json:"genetic_config,omitempty"`
+	WalkForward        *WalkForwardConfig        `json:"walk_forward,omitempty"` // 前向分析，为空时在整个区间上优化
+
+	skipBaseline bool // 前向分析的各窗口不重复测试原始参数
 }
 
 // ParameterRange 参数范围
@@ -103,6 +109,7 @@ type OptimizationResult struct {
 	StartTime           time.Time              `json:"start_time"`
 	EndTime             time.Time              `json:"end_time"`
 	Duration            string                 `json:"duration"`
+	WalkForward         *WalkForwardResult     `json:"walk_forward,omitempty"` // 前向分析结果
 }
 
 // ParameterTestResult 参数测试结果
@@ -146,13 +153,10 @@ func (s *ParameterOptimizer) StartOptimization(ctx context.Context, config *Opti
 		var result *OptimizationResult
 		var err error
 
-		switch config.Algorithm {
-		case "grid_search", "":
-			result, err = s.gridSearchOptimization(optimizationCtx, task, config)
-		case "genetic":
-			result, err = s.geneticAlgorithmOptimization(optimizationCtx, task, config)
-		default:
-			err = fmt.Errorf("不支持的优化算法: %s", config.Algorithm)
+		if config.WalkForward != nil {
+			result, err = s.walkForwardOptimization(optimizationCtx, task, config)
+		} else {
+			result, err = s.runOptimization(optimizationCtx, task, config)
 		}
 
 		s.tasksMutex.Lock()
@@ -164,24 +168,37 @@ func (s *ParameterOptimizer) StartOptimization(ctx context.Context, config *Opti
 			task.BestParams = result.BestParameters
 			task.BestScore = result.BestScore
 			task.Results = result.AllResults
+			task.WalkForward = result.WalkForward
 			s.logger.Info("参数优化完成",
 				logger.String("optimization_id", optimizationID),
 				logger.Float64("best_score", result.BestScore),
 			)
 		}
+		s.publishTaskLocked(task)
 		s.tasksMutex.Unlock()
 	}()
 
 	return optimizationID, nil
 }
 
+// runOptimization 按配置的算法在 config 的整个区间上优化参数
+func (s *ParameterOptimizer) runOptimization(ctx context.Context, task *OptimizationTask, config *OptimizationConfig) (*OptimizationResult, error) {
+	switch config.Algorithm {
+	case "grid_search", "":
+		return s.gridSearchOptimization(ctx, task, config)
+	case "genetic":
+		return s.geneticAlgorithmOptimization(ctx, task, config)
+	}
+	return nil, fmt.Errorf("不支持的优化算法: %s", config.Algorithm)
+}
+
 // gridSearchOptimization 网格搜索优化
 func (s *ParameterOptimizer) gridSearchOptimization(ctx context.Context, task *OptimizationTask, config *OptimizationConfig) (*OptimizationResult, error) {
 	startTime := time.Now()
 
 	// 🔧 新增：获取原始策略并测试baseline性能
 	originalStrategy, err := s.strategyService.GetStrategy(ctx, config.StrategyID)
-	if err == nil && originalStrategy != nil {
+	if err == nil && originalStrategy != nil && !config.skipBaseline {
 		s.logger.Info("⏳ 测试原始参数性能作为baseline",
 			logger.String("strategy_id", config.StrategyID),
 		)
@@ -194,7 +211,7 @@ func (s *ParameterOptimizer) gridSearchOptimization(ctx context.Context, task *O
 			logger.String("strategy_id", config.StrategyID),
 			logger.Float64("baseline_score", baselineResult.Score),
 		)
-	} else {
+	} else if !config.skipBaseline {
 		s.logger.Warn("无法获取原始策略，跳过baseline测试",
 			logger.String("strategy_id", config.StrategyID),
 		)
@@ -238,6 +255,7 @@ func (s *ParameterOptimizer) gridSearchOptimization(ctx context.Context, task *O
 			task.CurrentCombo = idx + 1
 			task.CurrentParams = parameters
 			task.Progress = int(float64(idx+1) / float64(task.TotalCombos) * 100)
+			s.publishTaskLocked(task)
 			s.tasksMutex.Unlock()
 
 			// 测试这组参数
@@ -250,6 +268,7 @@ func (s *ParameterOptimizer) gridSearchOptimization(ctx context.Context, task *O
 			if result.Score > task.BestScore {
 				task.BestScore = result.Score
 				task.BestParams = parameters
+				s.publishTaskLocked(task)
 			}
 			s.tasksMutex.Unlock()
 
@@ -306,7 +325,7 @@ func (s *ParameterOptimizer) geneticAlgorithmOptimization(ctx context.Context, t
 
 	// 🔧 新增：获取原始策略并测试baseline性能
 	originalStrategy, err := s.strategyService.GetStrategy(ctx, config.StrategyID)
-	if err == nil && originalStrategy != nil {
+	if err == nil && originalStrategy != nil && !config.skipBaseline {
 		s.logger.Info("⏳ 测试原始参数性能作为baseline",
 			logger.String("strategy_id", config.StrategyID),
 		)
@@ -319,7 +338,7 @@ func (s *ParameterOptimizer) geneticAlgorithmOptimization(ctx context.Context, t
 			logger.String("strategy_id", config.StrategyID),
 			logger.Float64("baseline_score", baselineResult.Score),
 		)
-	} else {
+	} else if !config.skipBaseline {
 		s.logger.Warn("无法获取原始策略，跳过baseline测试",
 			logger.String("strategy_id", config.StrategyID),
 		)
@@ -358,6 +377,7 @@ func (s *ParameterOptimizer) geneticAlgorithmOptimization(ctx context.Context, t
 			task.Progress = int(float64(task.CurrentCombo) / float64(task.TotalCombos) * 100)
 			task.BestScore = bestScore
 			task.BestParams = bestIndividual
+			s.publishTaskLocked(task)
 			s.tasksMutex.Unlock()
 		}
 
@@ -394,17 +414,8 @@ func (s *ParameterOptimizer) geneticAlgorithmOptimization(ctx context.Context, t
 
 // testParameters 测试一组参数
 func (s *ParameterOptimizer) testParameters(ctx context.Context, config *OptimizationConfig, parameters map[string]interface{}) ParameterTestResult {
-	// 创建临时策略
-	strategy := &models.Strategy{
-		ID:         fmt.Sprintf("temp_opt_strategy_%d", time.Now().UnixNano()),
-		Name:       "临时优化策略",
-		Type:       config.StrategyType,
-		Parameters: parameters,
-		Status:     models.StrategyStatusInactive,
-	}
-
 	// 运行快速回测
-	performance := s.runQuickBacktest(ctx, config, strategy)
+	performance := s.runQuickBacktest(ctx, config, s.optimizationStrategy(config, parameters))
 
 	// 根据优化目标计算得分
 	score := s.calculateScore(performance, config.OptimizationTarget)
@@ -416,30 +427,51 @@ func (s *ParameterOptimizer) testParameters(ctx context.Context, config *Optimiz
 	}
 }
 
-// runQuickBacktest 运行快速回测
+// runQuickBacktest 运行快速回测，回测失败时返回nil
 func (s *ParameterOptimizer) runQuickBacktest(ctx context.Context, config *OptimizationConfig, strategy *models.Strategy) *models.BacktestResult {
-	// 简化的回测执行（这里需要调用实际的回测服务）
-	// 为了简化，这里返回模拟结果
-	// 实际实现时应该调用 backtestService.RunBacktest
-
-	// TODO: 实际调用回测服务
-	// 可以参考 BacktestService.RunBacktest 的实现
-
-	// 临时返回模拟数据
-	return &models.BacktestResult{
-		ID:             uuid.New().String(),
-		BacktestID:     uuid.New().String(),
-		StrategyID:     strategy.ID,
-		TotalReturn:    rand.Float64()*0.4 - 0.2, // -20% to +20%
-		AnnualReturn:   rand.Float64()*0.4 - 0.2,
-		MaxDrawdown:    -rand.Float64() * 0.3, // 0 to -30%
-		SharpeRatio:    rand.Float64() * 3,
-		WinRate:        0.4 + rand.Float64()*0.3, // 40% to 70%
-		TotalTrades:    50 + rand.Intn(150),
-		ProfitFactor:   1 + rand.Float64()*2,
-		AvgTradeReturn: rand.Float64()*0.1 - 0.05,
-		CreatedAt:      time.Now(),
+	runData, err := s.runBacktest(ctx, config, strategy)
+	if err != nil {
+		s.logger.Warn("参数测试回测失败",
+			logger.String("strategy_id", strategy.ID),
+			logger.ErrorField(err),
+		)
+		return nil
+	}
+	return &runData.Results[0]
+}
+
+// runBacktest 在 config 的日期区间上用给定策略运行一次回测（不保存到回测列表）
+func (s *ParameterOptimizer) runBacktest(ctx context.Context, config *OptimizationConfig, strategy *models.Strategy) (*backtestRunData, error) {
+	startDate, err := time.Parse("2006-01-02", config.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("开始日期格式错误: %w", err)
+	}
+	endDate, err := time.Parse("2006-01-02", config.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("结束日期格式错误: %w", err)
+	}
+
+	backtest := &models.Backtest{
+		ID:          fmt.Sprintf("opt_%s", uuid.New().String()),
+		Name:        "参数优化回测",
+		StrategyIDs: []string{strategy.ID},
+		Symbols:     config.Symbols,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		InitialCash: config.InitialCash,
+		Commission:  config.Commission,
+		Status:      models.BacktestStatusRunning,
+		CreatedAt:   time.Now(),
+	}
+
+	runData, err := s.backtestService.simulateBacktest(ctx, backtest, []*models.Strategy{strategy}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(runData.Results) == 0 {
+		return nil, errors.New("回测没有产生结果")
 	}
+	return runData, nil
 }
 
 // calculateScore 根据优化目标计算得分
@@ -686,6 +718,7 @@ func (s *ParameterOptimizer) GetOptimizationResult(optimizationID string) (*Opti
 		TotalTested:         len(task.Results),
 		StartTime:           task.StartTime,
 		EndTime:             time.Now(),
+		WalkForward:         task.WalkForward,
 	}, nil
 }
 
@@ -705,6 +738,7 @@ func (s *ParameterOptimizer) CancelOptimization(optimizationID string) error {
 
 	task.CancelFunc()
 	task.Status = "cancelled"
+	s.publishTaskLocked(task)
 
 	s.logger.Info("优化任务已取消", logger.String("optimization_id", optimizationID))
 	return nil
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"stock-a-future/internal/indicators"
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidPositionSizing = errors.New("仓位管理参数无效")
+
+// 仓位管理默认参数
+const (
+	defaultSizingFraction  = 0.2  // 每次投入可用现金的20%
+	defaultSizingMinAmount = 1000 // 最小下单金额（元）
+	defaultRiskPerTrade    = 0.01
+	defaultSizingATRPeriod = 14
+	defaultATRMultiple     = 2.0
+	defaultKellyFraction   = 0.5
+	defaultKellyMinTrades  = 10
+)
+
+// SizingInput 计算下单金额所需的上下文
+type SizingInput struct {
+	Signal        *models.Signal
+	Price         float64             // 预估成交价
+	Cash          float64             // 可用现金
+	TotalValue    float64             // 组合总资产
+	PositionValue float64             // 该股票当前持仓市值
+	SymbolCount   int                 // 回测股票数量
+	History       []models.StockDaily // 截至当日的历史K线
+}
+
+// PositionSizer 仓位计算器
+type PositionSizer interface {
+	// TargetAmount 返回本次买入的目标金额（元），返回0表示不下单
+	TargetAmount(input *SizingInput) float64
+}
+
+// tradeObserver 需要根据已成交交易调整仓位的计算器（如凯利公式）实现该接口
+type tradeObserver interface {
+	ObserveTrade(trade *models.Trade)
+}
+
+// ValidatePositionSizingConfig 校验仓位管理参数
+func ValidatePositionSizingConfig(config *models.PositionSizingConfig) error {
+	if config == nil {
+		return nil
+	}
+
+	switch config.Method {
+	case "", models.PositionSizingFixedFraction, models.PositionSizingEqualWeight,
+		models.PositionSizingVolatility, models.PositionSizingKelly:
+	case models.PositionSizingFixedAmount:
+		if config.Amount <= 0 {
+			return fmt.Errorf("%w: fixed_amount 需要设置大于0的 amount", ErrInvalidPositionSizing)
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的仓位计算方法 %q", ErrInvalidPositionSizing, config.Method)
+	}
+
+	if config.Fraction < 0 || config.Fraction > 1 {
+		return fmt.Errorf("%w: fraction 必须在0-1之间", ErrInvalidPositionSizing)
+	}
+	if config.RiskPerTrade < 0 || config.RiskPerTrade > 0.1 {
+		return fmt.Errorf("%w: risk_per_trade 必须在0-10%%之间", ErrInvalidPositionSizing)
+	}
+	if config.KellyFraction < 0 || config.KellyFraction > 1 {
+		return fmt.Errorf("%w: kelly_fraction 必须在0-1之间", ErrInvalidPositionSizing)
+	}
+	if config.ATRPeriod < 0 || config.ATRMultiple < 0 || config.KellyMinTrades < 0 || config.MinAmount < 0 {
+		return fmt.Errorf("%w: 参数不能为负数", ErrInvalidPositionSizing)
+	}
+	return nil
+}
+
+// NewPositionSizer 根据配置创建仓位计算器，配置为空时使用固定比例（20%现金）
+// 计算器可能持有状态（如凯利公式的历史盈亏），每个策略应使用独立的实例
+func NewPositionSizer(config *models.PositionSizingConfig, calculator *indicators.Calculator) PositionSizer {
+	cfg := models.PositionSizingConfig{Method: models.PositionSizingFixedFraction}
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.Fraction == 0 {
+		cfg.Fraction = defaultSizingFraction
+	}
+	if cfg.MinAmount == 0 {
+		cfg.MinAmount = defaultSizingMinAmount
+	}
+	if cfg.RiskPerTrade == 0 {
+		cfg.RiskPerTrade = defaultRiskPerTrade
+	}
+	if cfg.ATRPeriod == 0 {
+		cfg.ATRPeriod = defaultSizingATRPeriod
+	}
+	if cfg.ATRMultiple == 0 {
+		cfg.ATRMultiple = defaultATRMultiple
+	}
+	if cfg.KellyFraction == 0 {
+		cfg.KellyFraction = defaultKellyFraction
+	}
+	if cfg.KellyMinTrades == 0 {
+		cfg.KellyMinTrades = defaultKellyMinTrades
+	}
+
+	var sizer PositionSizer
+	switch cfg.Method {
+	case models.PositionSizingFixedAmount:
+		sizer = &fixedAmountSizer{amount: cfg.Amount}
+	case models.PositionSizingEqualWeight:
+		sizer = &equalWeightSizer{}
+	case models.PositionSizingVolatility:
+		sizer = &volatilityTargetSizer{
+			calculator:   calculator,
+			riskPerTrade: cfg.RiskPerTrade,
+			atrPeriod:    cfg.ATRPeriod,
+			atrMultiple:  cfg.ATRMultiple,
+		}
+	case models.PositionSizingKelly:
+		sizer = &kellySizer{
+			kellyFraction:    cfg.KellyFraction,
+			minTrades:        cfg.KellyMinTrades,
+			fallbackFraction: cfg.Fraction,
+		}
+	default:
+		sizer = &fixedFractionSizer{fraction: cfg.Fraction}
+	}
+
+	return &constrainedSizer{
+		sizer:         sizer,
+		minAmount:     cfg.MinAmount,
+		scaleBySignal: cfg.ScaleBySignal,
+	}
+}
+
+// constrainedSizer 对具体仓位算法的结果统一施加信号缩放、现金上限和最小下单金额
+type constrainedSizer struct {
+	sizer         PositionSizer
+	minAmount     float64
+	scaleBySignal bool
+}
+
+func (c *constrainedSizer) TargetAmount(input *SizingInput) float64 {
+	amount := c.sizer.TargetAmount(input)
+	if c.scaleBySignal {
+		amount *= signalScale(input.Signal)
+	}
+	amount = math.Min(amount, input.Cash)
+	if amount < c.minAmount {
+		return 0
+	}
+	return amount
+}
+
+func (c *constrainedSizer) ObserveTrade(trade *models.Trade) {
+	if observer, ok := c.sizer.(tradeObserver); ok {
+		observer.ObserveTrade(trade)
+	}
+}
+
+// signalScale 根据信号强度和置信度计算缩放系数，未设置的字段按1处理
+func signalScale(signal *models.Signal) float64 {
+	if signal == nil {
+		return 1
+	}
+	scale := 1.0
+	if signal.Strength > 0 {
+		scale *= math.Min(signal.Strength, 1)
+	}
+	if signal.Confidence > 0 {
+		scale *= math.Min(signal.Confidence, 1)
+	}
+	return scale
+}
+
+// fixedFractionSizer 每次投入可用现金的固定比例
+type fixedFractionSizer struct {
+	fraction float64
+}
+
+func (f *fixedFractionSizer) TargetAmount(input *SizingInput) float64 {
+	return input.Cash * f.fraction
+}
+
+// fixedAmountSizer 每次投入固定金额
+type fixedAmountSizer struct {
+	amount float64
+}
+
+func (f *fixedAmountSizer) TargetAmount(input *SizingInput) float64 {
+	return f.amount
+}
+
+// equalWeightSizer 将总资产平均分配给所有股票，只补足到目标仓位
+type equalWeightSizer struct{}
+
+func (e *equalWeightSizer) TargetAmount(input *SizingInput) float64 {
+	if input.SymbolCount <= 0 {
+		return 0
+	}
+	target := input.TotalValue / float64(input.SymbolCount)
+	return math.Max(target-input.PositionValue, 0)
+}
+
+// volatilityTargetSizer 按ATR计算仓位，使价格反向波动 atrMultiple 个ATR时亏损为总资产的 riskPerTrade
+type volatilityTargetSizer struct {
+	calculator   *indicators.Calculator
+	riskPerTrade float64
+	atrPeriod    int
+	atrMultiple  float64
+}
+
+func (v *volatilityTargetSizer) TargetAmount(input *SizingInput) float64 {
+	atrs := v.calculator.CalculateATR(input.History, v.atrPeriod)
+	if len(atrs) == 0 {
+		return 0
+	}
+	atr := atrs[len(atrs)-1].ATR14.InexactFloat64()
+	if atr <= 0 {
+		return 0
+	}
+	shares := input.TotalValue * v.riskPerTrade / (atr * v.atrMultiple)
+	return shares * input.Price
+}
+
+// kellySizer 分数凯利公式：f = W - (1-W)/R，W为胜率，R为平均盈利/平均亏损
+// 平仓次数不足 minTrades 时使用 fallbackFraction；盈亏为零的平仓既不算盈利也不算亏损，不参与统计
+type kellySizer struct {
+	kellyFraction    float64
+	minTrades        int
+	fallbackFraction float64
+
+	wins, losses        int
+	totalWin, totalLoss float64
+}
+
+func (k *kellySizer) ObserveTrade(trade *models.Trade) {
+	if trade.Side != models.TradeSideSell {
+		return
+	}
+	switch {
+	case trade.PnL > 0:
+		k.wins++
+		k.totalWin += trade.PnL
+	case trade.PnL < 0:
+		k.losses++
+		k.totalLoss += -trade.PnL
+	}
+}
+
+func (k *kellySizer) TargetAmount(input *SizingInput) float64 {
+	closed := k.wins + k.losses
+	if closed < k.minTrades {
+		return input.Cash * k.fallbackFraction
+	}
+	if k.wins == 0 {
+		return 0
+	}
+	if k.losses == 0 || k.totalLoss == 0 {
+		return input.TotalValue * k.kellyFraction
+	}
+
+	winRate := float64(k.wins) / float64(closed)
+	payoff := (k.totalWin / float64(k.wins)) / (k.totalLoss / float64(k.losses))
+	kelly := winRate - (1-winRate)/payoff
+	if kelly <= 0 {
+		return 0
+	}
+	return input.TotalValue * math.Min(kelly, 1) * k.kellyFraction
+}
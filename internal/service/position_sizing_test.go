@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/indicators"
+	"stock-a-future/internal/models"
+)
+
+func TestPositionSizer_Methods(t *testing.T) {
+	calculator := indicators.NewCalculator()
+	input := &SizingInput{
+		Signal:      &models.Signal{SignalType: models.SignalTypeBuy, Strength: 0.5, Confidence: 0.8},
+		Price:       10,
+		Cash:        100000,
+		TotalValue:  200000,
+		SymbolCount: 4,
+	}
+
+	if amount := NewPositionSizer(nil, calculator).TargetAmount(input); amount != 20000 {
+		t.Errorf("默认应投入20%%现金, 实际 %.2f", amount)
+	}
+
+	fixed := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingFixedAmount, Amount: 30000}, calculator)
+	if amount := fixed.TargetAmount(input); amount != 30000 {
+		t.Errorf("固定金额应为30000, 实际 %.2f", amount)
+	}
+
+	equal := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingEqualWeight}, calculator)
+	input.PositionValue = 20000
+	if amount := equal.TargetAmount(input); amount != 30000 {
+		t.Errorf("等权应补足到总资产的1/4, 实际 %.2f", amount)
+	}
+	input.PositionValue = 0
+
+	scaled := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingFixedFraction, ScaleBySignal: true}, calculator)
+	if amount := scaled.TargetAmount(input); math.Abs(amount-20000*0.4) > 1e-9 {
+		t.Errorf("按信号缩放后应为8000, 实际 %.2f", amount)
+	}
+
+	tooSmall := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingFixedAmount, Amount: 500}, calculator)
+	if amount := tooSmall.TargetAmount(input); amount != 0 {
+		t.Errorf("低于最小下单金额时不应下单, 实际 %.2f", amount)
+	}
+}
+
+func TestPositionSizer_VolatilityTarget(t *testing.T) {
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 10)
+	}
+	// 高低价为收盘价±1%，ATR约为0.2
+	bars := buildTestDailyBars("600000.SH", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), closes)
+
+	sizer := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingVolatility}, indicators.NewCalculator())
+	amount := sizer.TargetAmount(&SizingInput{Price: 10, Cash: 1000000, TotalValue: 100000, History: bars})
+
+	// 风险预算 100000*1% = 1000元，止损距离 2*ATR = 0.4元，约2500股
+	if math.Abs(amount-25000) > 1 {
+		t.Errorf("波动率目标仓位应约为25000元, 实际 %.2f", amount)
+	}
+
+	if amount := sizer.TargetAmount(&SizingInput{Price: 10, Cash: 1000000, TotalValue: 100000}); amount != 0 {
+		t.Errorf("无历史数据时不应下单, 实际 %.2f", amount)
+	}
+}
+
+func TestPositionSizer_Kelly(t *testing.T) {
+	sizer := NewPositionSizer(&models.PositionSizingConfig{Method: models.PositionSizingKelly, KellyMinTrades: 4}, nil)
+	input := &SizingInput{Price: 10, Cash: 100000, TotalValue: 100000}
+
+	if amount := sizer.TargetAmount(input); amount != 20000 {
+		t.Errorf("样本不足时应使用默认比例, 实际 %.2f", amount)
+	}
+
+	observer := sizer.(tradeObserver)
+	// 盈亏为零的平仓不计入胜负
+	for _, pnl := range []float64{200, 0, 200, 0, 200, -100} {
+		observer.ObserveTrade(&models.Trade{Side: models.TradeSideSell, PnL: pnl})
+	}
+	// 胜率75%，盈亏比2：f = 0.75 - 0.25/2 = 0.625，半凯利为0.3125
+	if amount := sizer.TargetAmount(input); math.Abs(amount-31250) > 1e-6 {
+		t.Errorf("半凯利仓位应为31250, 实际 %.2f", amount)
+	}
+}
+
+func TestValidatePositionSizingConfig(t *testing.T) {
+	if err := ValidatePositionSizingConfig(nil); err != nil {
+		t.Errorf("空配置应合法: %v", err)
+	}
+	invalid := []*models.PositionSizingConfig{
+		{Method: "martingale"},
+		{Method: models.PositionSizingFixedAmount},
+		{Method: models.PositionSizingFixedFraction, Fraction: 1.5},
+		{Method: models.PositionSizingKelly, KellyFraction: -0.1},
+	}
+	for _, config := range invalid {
+		if err := ValidatePositionSizingConfig(config); !errors.Is(err, ErrInvalidPositionSizing) {
+			t.Errorf("%+v 应校验失败, 实际: %v", config, err)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidRebalance = errors.New("调仓策略参数无效")
+
+// 定期调仓策略默认参数
+const (
+	defaultRebalanceTopN     = 5
+	defaultRebalanceLookback = 20
+	defaultRebalanceScore    = "momentum"
+)
+
+// FundamentalFactorSource 为调仓打分提供指定交易日的基本面因子，FundamentalFactorService 实现该接口
+type FundamentalFactorSource interface {
+	BatchCalculateFundamentalFactors(symbols []string, tradeDate string) ([]models.FundamentalFactor, error)
+}
+
+// technicalScorers 基于截至调仓日的K线打分，分数越高越优先入选；数据不足时返回false
+var technicalScorers = map[string]func(history []models.StockDaily, lookback int) (float64, bool){
+	"momentum":       momentumScore,
+	"low_volatility": lowVolatilityScore,
+	"trend":          trendScore,
+}
+
+// fundamentalScorers 使用基本面因子的标准化得分打分
+var fundamentalScorers = map[string]func(factor *models.FundamentalFactor) float64{
+	"value":         func(f *models.FundamentalFactor) float64 { return f.ValueScore.InexactFloat64() },
+	"growth":        func(f *models.FundamentalFactor) float64 { return f.GrowthScore.InexactFloat64() },
+	"quality":       func(f *models.FundamentalFactor) float64 { return f.QualityScore.InexactFloat64() },
+	"profitability": func(f *models.FundamentalFactor) float64 { return f.ProfitabilityScore.InexactFloat64() },
+	"composite":     func(f *models.FundamentalFactor) float64 { return f.CompositeScore.InexactFloat64() },
+}
+
+// ParseRebalanceParams 解析并校验定期调仓策略参数，未设置的参数使用默认值
+func ParseRebalanceParams(params map[string]interface{}) (*models.RebalanceStrategyParams, error) {
+	config := &models.RebalanceStrategyParams{
+		Frequency:   models.RebalanceFrequency(getStringParameter(params, "frequency", string(models.RebalanceMonthly))),
+		TopN:        getIntParameter(params, "top_n", defaultRebalanceTopN),
+		Score:       getStringParameter(params, "score", defaultRebalanceScore),
+		Lookback:    getIntParameter(params, "lookback", defaultRebalanceLookback),
+		Weighting:   models.RebalanceWeighting(getStringParameter(params, "weighting", string(models.RebalanceWeightEqual))),
+		MaxTurnover: getFloatParameter(params, "max_turnover", 0),
+	}
+
+	switch config.Frequency {
+	case models.RebalanceWeekly, models.RebalanceMonthly, models.RebalanceQuarterly:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的调仓频率 %q", ErrInvalidRebalance, config.Frequency)
+	}
+	if _, technical := technicalScorers[config.Score]; !technical {
+		if _, fundamental := fundamentalScorers[config.Score]; !fundamental {
+			return nil, fmt.Errorf("%w: 不支持的打分方法 %q", ErrInvalidRebalance, config.Score)
+		}
+	}
+	switch config.Weighting {
+	case models.RebalanceWeightEqual, models.RebalanceWeightRank:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的权重分配方式 %q", ErrInvalidRebalance, config.Weighting)
+	}
+	if config.TopN < 1 {
+		return nil, fmt.Errorf("%w: top_n 必须大于0", ErrInvalidRebalance)
+	}
+	if config.Lookback < 2 || config.Lookback >= StrategyLookbackDays {
+		return nil, fmt.Errorf("%w: lookback 必须在2-%d之间", ErrInvalidRebalance, StrategyLookbackDays-1)
+	}
+	if config.MaxTurnover < 0 || config.MaxTurnover > 2 {
+		return nil, fmt.Errorf("%w: max_turnover 必须在0-2之间", ErrInvalidRebalance)
+	}
+	return config, nil
+}
+
+// usesFundamentalScore 是否使用基本面因子打分
+func usesFundamentalScore(params *models.RebalanceStrategyParams) bool {
+	_, ok := fundamentalScorers[params.Score]
+	return ok
+}
+
+// momentumScore 回看期收益率
+func momentumScore(history []models.StockDaily, lookback int) (float64, bool) {
+	if len(history) <= lookback {
+		return 0, false
+	}
+	base := history[len(history)-1-lookback].Close.InexactFloat64()
+	if base <= 0 {
+		return 0, false
+	}
+	return history[len(history)-1].Close.InexactFloat64()/base - 1, true
+}
+
+// lowVolatilityScore 回看期日收益率标准差的相反数，波动越低得分越高
+func lowVolatilityScore(history []models.StockDaily, lookback int) (float64, bool) {
+	if len(history) <= lookback {
+		return 0, false
+	}
+	window := history[len(history)-1-lookback:]
+	returns := make([]float64, 0, lookback)
+	for i := 1; i < len(window); i++ {
+		prev := window[i-1].Close.InexactFloat64()
+		if prev <= 0 {
+			return 0, false
+		}
+		returns = append(returns, window[i].Close.InexactFloat64()/prev-1)
+	}
+
+	avg := 0.0
+	for _, r := range returns {
+		avg += r
+	}
+	avg /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - avg) * (r - avg)
+	}
+	return -math.Sqrt(variance / float64(len(returns))), true
+}
+
+// trendScore 收盘价相对回看期均线的偏离度
+func trendScore(history []models.StockDaily, lookback int) (float64, bool) {
+	if len(history) < lookback {
+		return 0, false
+	}
+	sum := 0.0
+	for _, bar := range history[len(history)-lookback:] {
+		sum += bar.Close.InexactFloat64()
+	}
+	ma := sum / float64(lookback)
+	if ma <= 0 {
+		return 0, false
+	}
+	return history[len(history)-1].Close.InexactFloat64()/ma - 1, true
+}
+
+// rebalanceScores 计算调仓日各股票的打分，停牌或数据不足的股票不参与打分
+// factorCache 缓存每个交易日的基本面因子，多个调仓策略在同一天调仓时只计算一次
+func (s *BacktestService) rebalanceScores(params *models.RebalanceStrategyParams, date time.Time, symbols []string, bars map[string]*orderBar, factorCache map[string]map[string]*models.FundamentalFactor) (map[string]float64, error) {
+	scores := make(map[string]float64, len(symbols))
+
+	if scorer, ok := technicalScorers[params.Score]; ok {
+		for _, symbol := range symbols {
+			bar := bars[symbol]
+			if bar == nil || bar.suspended {
+				continue
+			}
+			if score, ok := scorer(bar.history, params.Lookback); ok {
+				scores[symbol] = score
+			}
+		}
+		return scores, nil
+	}
+
+	factors, err := s.factorsAt(date, symbols, factorCache)
+	if err != nil {
+		return nil, err
+	}
+
+	scorer := fundamentalScorers[params.Score]
+	for _, symbol := range symbols {
+		bar, factor := bars[symbol], factors[symbol]
+		if bar == nil || bar.suspended || factor == nil {
+			continue
+		}
+		scores[symbol] = scorer(factor)
+	}
+	return scores, nil
+}
+
+// factorsAt 获取指定交易日股票池的基本面因子（股票代码 -> 因子），按交易日缓存在 factorCache 中
+func (s *BacktestService) factorsAt(date time.Time, symbols []string, factorCache map[string]map[string]*models.FundamentalFactor) (map[string]*models.FundamentalFactor, error) {
+	tradeDate := date.Format("20060102")
+	if factors, cached := factorCache[tradeDate]; cached {
+		return factors, nil
+	}
+	if s.factorSource == nil {
+		return nil, errors.New("未配置基本面因子数据源")
+	}
+	list, err := s.factorSource.BatchCalculateFundamentalFactors(symbols, tradeDate)
+	if err != nil {
+		return nil, fmt.Errorf("计算基本面因子失败: %w", err)
+	}
+	factors := make(map[string]*models.FundamentalFactor, len(list))
+	for i := range list {
+		factors[list[i].TSCode] = &list[i]
+	}
+	factorCache[tradeDate] = factors
+	return factors, nil
+}
+
+// rebalanceTargetWeights 按打分从高到低选出前N只股票并分配目标权重，分数相同时按代码排序保证结果稳定
+func rebalanceTargetWeights(params *models.RebalanceStrategyParams, scores map[string]float64) map[string]float64 {
+	ranked := make([]string, 0, len(scores))
+	for symbol := range scores {
+		ranked = append(ranked, symbol)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) > params.TopN {
+		ranked = ranked[:params.TopN]
+	}
+
+	weights := make(map[string]float64, len(ranked))
+	n := len(ranked)
+	for i, symbol := range ranked {
+		if params.Weighting == models.RebalanceWeightRank {
+			weights[symbol] = float64(n-i) / float64(n*(n+1)/2)
+		} else {
+			weights[symbol] = 1 / float64(n)
+		}
+	}
+	return weights
+}
+
+// rebalanceOrder 调仓需要的一笔买卖，amount 为正表示买入金额，为负表示卖出金额
+type rebalanceOrder struct {
+	symbol string
+	amount float64
+	price  float64
+}
+
+// rebalanceOrders 计算从当前持仓调整到目标权重所需的订单（先卖后买）
+// 买卖金额合计超过 maxTurnover×总资产时所有订单按同一比例缩减；maxTurnover 为0表示不限制
+func rebalanceOrders(portfolio *models.Portfolio, targets map[string]float64, prices map[string]float64, maxTurnover float64) []rebalanceOrder {
+	symbols := make([]string, 0, len(targets)+len(portfolio.Positions))
+	for symbol := range targets {
+		symbols = append(symbols, symbol)
+	}
+	for symbol := range portfolio.Positions {
+		if _, ok := targets[symbol]; !ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	var orders []rebalanceOrder
+	gross := 0.0
+	for _, symbol := range symbols {
+		price := prices[symbol]
+		if price <= 0 {
+			continue
+		}
+		amount := targets[symbol]*portfolio.TotalValue - portfolio.Positions[symbol].MarketValue
+		if math.Abs(amount) < price {
+			continue
+		}
+		orders = append(orders, rebalanceOrder{symbol: symbol, amount: amount, price: price})
+		gross += math.Abs(amount)
+	}
+
+	if limit := maxTurnover * portfolio.TotalValue; maxTurnover > 0 && gross > limit {
+		scale := limit / gross
+		for i := range orders {
+			orders[i].amount *= scale
+		}
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].amount < 0 && orders[j].amount >= 0
+	})
+	return orders
+}
+
+// withTargetAmount 按固定金额买入，共享资金模式下仍受策略可用资金的限制
+func withTargetAmount(sizer PositionSizer, amount float64) PositionSizer {
+	fixed := &fixedAmountSizer{amount: amount}
+	if allocation, ok := sizer.(*allocationSizer); ok {
+		return &allocationSizer{PositionSizer: fixed, account: allocation.account, strategyID: allocation.strategyID}
+	}
+	return fixed
+}
+
+// rebalancePortfolio 在调仓日将策略组合调整到目标权重，订单数量按当日收盘价计算
+// 按当日收盘价成交时直接撮合，其他成交时机与信号策略一样生成挂单，在后续交易日按成交时机撮合
+func (s *BacktestService) rebalancePortfolio(params *models.RebalanceStrategyParams, targets map[string]float64, bars map[string]*orderBar, portfolio *models.Portfolio, backtest *models.Backtest, strategyID string, sizer PositionSizer, account *sharedAccount, pending map[string]*models.Order, record func(strategyID, symbol string, trade *models.Trade, rejected *models.RejectedOrder)) {
+	applyRules := !backtest.DisableTradingRules
+	sameBarClose := executionTiming(backtest) == models.ExecutionSameBarClose
+	portfolio.TotalValue = portfolio.Cash + positionsValue(portfolio)
+	prices := make(map[string]float64, len(bars))
+	for symbol, bar := range bars {
+		price := bar.marketData.Close
+		if applyRules {
+			price = s.tradingRules.RoundToTick(price)
+		}
+		prices[symbol] = price
+	}
+
+	for _, order := range rebalanceOrders(portfolio, targets, prices, params.MaxTurnover) {
+		bar := bars[order.symbol]
+		signal := &models.Signal{
+			StrategyID: strategyID,
+			Symbol:     order.symbol,
+			SignalType: models.SignalTypeRebalance,
+			Side:       models.TradeSideBuy,
+			Price:      order.price,
+			Timestamp:  bar.marketData.Date,
+		}
+
+		if order.amount < 0 {
+			// 目标权重为0且未被换手率限制缩减时清仓
+			quantity := int(-order.amount / order.price)
+			if targets[order.symbol] == 0 && -order.amount >= portfolio.Positions[order.symbol].MarketValue {
+				quantity = 0
+			}
+			signal.Side = models.TradeSideSell
+			if !sameBarClose {
+				if pendingOrder := s.newPendingOrder(signal, bar.marketData, backtest, strategyID); pendingOrder != nil {
+					pendingOrder.Quantity = quantity
+					pending[order.symbol] = pendingOrder
+				}
+				continue
+			}
+			account.acquire(strategyID)
+			trade, rejected := s.executePartialSell(bar, portfolio, backtest, strategyID, models.SignalTypeRebalance, order.price, quantity)
+			record(strategyID, order.symbol, trade, rejected)
+			account.release(strategyID)
+			continue
+		}
+
+		if quantity := int(order.amount / order.price); applyRules && s.tradingRules.NormalizeBuyQuantity(order.symbol, quantity) <= 0 {
+			continue
+		}
+		if !sameBarClose {
+			if pendingOrder := s.newPendingOrder(signal, bar.marketData, backtest, strategyID); pendingOrder != nil {
+				pendingOrder.Amount = order.amount
+				pending[order.symbol] = pendingOrder
+			}
+			continue
+		}
+		account.acquire(strategyID)
+		trade, rejected := s.executeBuy(signal, bar, portfolio, backtest, strategyID, withTargetAmount(sizer, order.amount), order.price)
+		record(strategyID, order.symbol, trade, rejected)
+		account.release(strategyID)
+	}
+}
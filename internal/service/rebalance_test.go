@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+// perSymbolDataClient 按股票代码返回不同日线数据和简称变更历史的模拟数据源
+type perSymbolDataClient struct {
+	*client.MockDataSourceClient
+	bars        map[string][]models.StockDaily
+	nameChanges map[string][]models.NameChange
+}
+
+func (c *perSymbolDataClient) GetDailyData(symbol, startDate, endDate, adjust string) ([]models.StockDaily, error) {
+	return c.bars[symbol], nil
+}
+
+func (c *perSymbolDataClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	return c.nameChanges[symbol], nil
+}
+
+// steadyCloses 构造每日固定涨跌幅的收盘价序列
+func steadyCloses(n int, step float64) []float64 {
+	closes := make([]float64, n)
+	price := 10.0
+	for i := range closes {
+		price *= 1 + step
+		closes[i] = price
+	}
+	return closes
+}
+
+func TestParseRebalanceParams(t *testing.T) {
+	params, err := ParseRebalanceParams(nil)
+	if err != nil {
+		t.Fatalf("默认参数应有效: %v", err)
+	}
+	if params.Frequency != models.RebalanceMonthly || params.TopN != defaultRebalanceTopN || params.Score != "momentum" ||
+		params.Weighting != models.RebalanceWeightEqual || params.MaxTurnover != 0 {
+		t.Errorf("默认参数错误: %+v", params)
+	}
+
+	// JSON反序列化得到的数字为float64
+	params, err = ParseRebalanceParams(map[string]interface{}{"frequency": "weekly", "top_n": 3.0, "score": "quality", "max_turnover": 0.5})
+	if err != nil || params.TopN != 3 || params.Frequency != models.RebalanceWeekly || !usesFundamentalScore(params) {
+		t.Errorf("参数解析错误: %+v, err=%v", params, err)
+	}
+
+	invalid := []map[string]interface{}{
+		{"frequency": "daily"},
+		{"score": "unknown"},
+		{"weighting": "score"},
+		{"top_n": 0},
+		{"lookback": 1},
+		{"lookback": StrategyLookbackDays},
+		{"max_turnover": -0.1},
+	}
+	for _, p := range invalid {
+		if _, err := ParseRebalanceParams(p); !errors.Is(err, ErrInvalidRebalance) {
+			t.Errorf("参数 %v 应返回 ErrInvalidRebalance, 实际 %v", p, err)
+		}
+	}
+}
+
+func TestRebalanceTargetWeights(t *testing.T) {
+	scores := map[string]float64{"A": 0.3, "B": 0.1, "C": 0.2, "D": 0.1}
+
+	equal := rebalanceTargetWeights(&models.RebalanceStrategyParams{TopN: 3, Weighting: models.RebalanceWeightEqual}, scores)
+	if len(equal) != 3 || equal["A"] != 1.0/3 || equal["C"] != 1.0/3 || equal["B"] != 1.0/3 {
+		t.Errorf("等权目标错误（同分按代码排序）: %v", equal)
+	}
+
+	rank := rebalanceTargetWeights(&models.RebalanceStrategyParams{TopN: 3, Weighting: models.RebalanceWeightRank}, scores)
+	if math.Abs(rank["A"]-0.5) > 1e-12 || math.Abs(rank["C"]-1.0/3) > 1e-12 || math.Abs(rank["B"]-1.0/6) > 1e-12 {
+		t.Errorf("排名加权目标错误: %v", rank)
+	}
+
+	// 可选股票少于N只时全部入选
+	if few := rebalanceTargetWeights(&models.RebalanceStrategyParams{TopN: 5}, map[string]float64{"A": 1}); few["A"] != 1 {
+		t.Errorf("只有一只股票时权重应为1: %v", few)
+	}
+}
+
+func TestRebalanceOrders(t *testing.T) {
+	portfolio := &models.Portfolio{
+		Cash:       20000,
+		TotalValue: 100000,
+		Positions: map[string]models.Position{
+			"A": {Symbol: "A", Quantity: 5000, MarketValue: 50000},
+			"B": {Symbol: "B", Quantity: 3000, MarketValue: 30000},
+		},
+	}
+	prices := map[string]float64{"A": 10, "B": 10, "C": 10}
+	targets := map[string]float64{"A": 0.5, "C": 0.5}
+
+	orders := rebalanceOrders(portfolio, targets, prices, 0)
+	if len(orders) != 2 || orders[0].symbol != "B" || orders[0].amount != -30000 || orders[1].symbol != "C" || orders[1].amount != 50000 {
+		t.Fatalf("应先卖出B再买入C（A已在目标权重）: %+v", orders)
+	}
+
+	// 换手率上限40%：买卖合计8万按比例缩减到4万
+	limited := rebalanceOrders(portfolio, targets, prices, 0.4)
+	if limited[0].amount != -15000 || limited[1].amount != 25000 {
+		t.Errorf("换手率限制应按比例缩减订单: %+v", limited)
+	}
+}
+
+func TestSimulateBacktest_Rebalance(t *testing.T) {
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, steadyCloses(140, 0.004)),
+			"000002.SZ": buildTestDailyBars("000002.SZ", start, steadyCloses(140, -0.004)),
+			"600000.SH": buildTestDailyBars("600000.SH", start, steadyCloses(140, 0.001)),
+		},
+	}
+	service := NewBacktestService(newTestStrategyService(t), &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	strategies := []*models.Strategy{{
+		ID:         "momentum_rotation",
+		Type:       models.StrategyTypeRebalance,
+		Parameters: map[string]interface{}{"frequency": "monthly", "top_n": 2.0, "lookback": 10.0},
+	}}
+	backtest := &models.Backtest{
+		ID:          "bt-rebalance",
+		StrategyIDs: []string{"momentum_rotation"},
+		Symbols:     []string{"000001.SZ", "000002.SZ", "600000.SH"},
+		StartDate:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 1000000,
+	}
+
+	runData, err := service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("调仓策略应产生交易")
+	}
+
+	calendar := NewTradingCalendar()
+	for _, trade := range runData.Trades {
+		if trade.SignalType != string(models.SignalTypeRebalance) {
+			t.Errorf("成交应标记为调仓: %+v", trade)
+		}
+		if trade.Symbol == "000002.SZ" {
+			t.Errorf("下跌的股票不应入选: %+v", trade)
+		}
+		if !trade.Timestamp.Equal(backtest.StartDate) && !calendar.IsFirstTradingDayOfPeriod(trade.Timestamp, models.RebalanceMonthly) {
+			t.Errorf("只应在每月第一个交易日调仓: %s", trade.Timestamp.Format("2006-01-02"))
+		}
+	}
+
+	// 首日建仓后两只股票各占约一半资金
+	var first []models.Trade
+	for _, trade := range runData.Trades {
+		if trade.Timestamp.Equal(backtest.StartDate) {
+			first = append(first, trade)
+		}
+	}
+	if len(first) != 2 {
+		t.Fatalf("首日应买入两只股票, 实际 %+v", first)
+	}
+	for _, trade := range first {
+		if value := float64(trade.Quantity) * trade.Price; value < 450000 || value > 500000 {
+			t.Errorf("首日买入金额应接近目标权重: %s %.0f", trade.Symbol, value)
+		}
+	}
+
+	// 次日开盘成交时调仓与信号策略一样生成挂单，在调仓日的下一个交易日按开盘价成交
+	for symbol, bars := range dataClient.bars {
+		for i := 1; i < len(bars); i++ {
+			bars[i].Open = models.NewJSONDecimal(bars[i-1].Close.Decimal.Mul(decimal.NewFromFloat(1.003)).Round(2))
+		}
+		dataClient.bars[symbol] = bars
+	}
+	nextOpen := *backtest
+	nextOpen.ID = "bt-rebalance-next-open"
+	nextOpen.Execution = &models.ExecutionConfig{Timing: models.ExecutionNextBarOpen}
+	runData, err = service.simulateBacktest(context.Background(), &nextOpen, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("次日开盘成交时调仓策略应产生交易")
+	}
+	for _, trade := range runData.Trades {
+		signalDay := calendar.GetPreviousTradingDay(trade.Timestamp)
+		if trade.SignalType != string(models.SignalTypeRebalance) ||
+			(!signalDay.Equal(backtest.StartDate) && !calendar.IsFirstTradingDayOfPeriod(signalDay, models.RebalanceMonthly)) {
+			t.Errorf("调仓订单应在调仓日的下一个交易日成交: %+v", trade)
+		}
+		for _, bar := range dataClient.bars[trade.Symbol] {
+			if bar.TradeDate == trade.Timestamp.Format("20060102") && math.Abs(trade.Price-bar.Open.InexactFloat64()) > 0.011 {
+				t.Errorf("调仓订单应按成交日开盘价成交: %s %.2f, 开盘价 %s", trade.Symbol, trade.Price, bar.Open.String())
+			}
+		}
+	}
+
+	// 基本面打分需要配置因子数据源
+	strategies[0].Parameters["score"] = "value"
+	if _, err := service.simulateBacktest(context.Background(), backtest, strategies, nil); err == nil {
+		t.Error("未配置基本面因子数据源时应返回错误")
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+// holdingPeriodBuckets 持有时间分布的区间划分（交易日），MaxDays 为0表示不设上限
+var holdingPeriodBuckets = []models.HoldingPeriodBucket{
+	{Label: "1天以内", MinDays: 0, MaxDays: 1},
+	{Label: "2-5天", MinDays: 2, MaxDays: 5},
+	{Label: "6-10天", MinDays: 6, MaxDays: 10},
+	{Label: "11-20天", MinDays: 11, MaxDays: 20},
+	{Label: "21-60天", MinDays: 21, MaxDays: 60},
+	{Label: "60天以上", MinDays: 61},
+}
+
+// roundTripLot 尚未平仓的一笔买入
+type roundTripLot struct {
+	entry       models.Trade
+	quantity    int // 剩余未平仓数量
+	feePerShare float64
+}
+
+// GetRoundTrips 获取回测的开平仓记录及汇总统计，strategyID 非空时只统计该策略
+func (s *BacktestService) GetRoundTrips(ctx context.Context, backtestID, strategyID string) (*models.RoundTripAnalysis, error) {
+	if err := s.ensureRunDataLoaded(backtestID); err != nil {
+		s.logger.Error("从数据库加载回测结果失败",
+			logger.String("backtest_id", backtestID),
+			logger.ErrorField(err),
+		)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	backtest, exists := s.backtests[backtestID]
+	if !exists {
+		return nil, ErrBacktestNotFound
+	}
+	if backtest.Status != models.BacktestStatusCompleted {
+		return nil, ErrBacktestNotCompleted
+	}
+
+	trips := make([]models.RoundTrip, 0)
+	byStrategy := make(map[string][]models.RoundTrip)
+	for _, trip := range s.backtestRoundTrips[backtestID] {
+		if strategyID != "" && trip.StrategyID != strategyID {
+			continue
+		}
+		trips = append(trips, trip)
+		byStrategy[trip.StrategyID] = append(byStrategy[trip.StrategyID], trip)
+	}
+
+	analysis := &models.RoundTripAnalysis{
+		BacktestID:    backtestID,
+		RoundTrips:    trips,
+		Stats:         summarizeRoundTrips(trips),
+		StrategyStats: make(map[string]models.RoundTripStats, len(byStrategy)),
+	}
+	for id, strategyTrips := range byStrategy {
+		analysis.StrategyStats[id] = summarizeRoundTrips(strategyTrips)
+	}
+	return analysis, nil
+}
+
+// buildRoundTrips 按策略和股票将买入与卖出先进先出配对为开平仓记录，结果按平仓时间排序
+// 持有天数、MAE、MFE 使用建仓次日至平仓日的日线计算，并以建仓价和平仓价为边界；未平仓的买入不计入
+// adjustments 为不复权回测中的除权除息调整（按日期排序），未平仓的买入按送转增加数量并调低建仓价，因此开平仓盈亏包含持有期间的分红
+func buildRoundTrips(trades []models.Trade, histories map[string]*symbolHistory, adjustments []lotAdjustment) []models.RoundTrip {
+	openLots := make(map[string][]roundTripLot)
+	pending := make(map[string][]lotAdjustment)
+	for _, adjustment := range adjustments {
+		key := adjustment.strategyID + "|" + adjustment.symbol
+		pending[key] = append(pending[key], adjustment)
+	}
+	var trips []models.RoundTrip
+
+	for _, trade := range trades {
+		if trade.Quantity <= 0 {
+			continue
+		}
+		key := trade.StrategyID + "|" + trade.Symbol
+		feePerShare := trade.Fees() / float64(trade.Quantity)
+
+		// 除权除息在当日开盘前处理，先于当日及之后的成交
+		for len(pending[key]) > 0 && (pending[key][0].date.Before(trade.Timestamp) || sameTradingDay(pending[key][0].date, trade.Timestamp)) {
+			adjustLots(openLots[key], pending[key][0])
+			pending[key] = pending[key][1:]
+		}
+
+		if trade.Side == models.TradeSideBuy {
+			openLots[key] = append(openLots[key], roundTripLot{
+				entry:       trade,
+				quantity:    trade.Quantity,
+				feePerShare: feePerShare,
+			})
+			continue
+		}
+
+		remaining := trade.Quantity
+		lots := openLots[key]
+		for remaining > 0 && len(lots) > 0 {
+			lot := &lots[0]
+			quantity := minInt(remaining, lot.quantity)
+			trips = append(trips, newRoundTrip(*lot, trade, quantity, feePerShare, histories[trade.Symbol]))
+
+			remaining -= quantity
+			lot.quantity -= quantity
+			if lot.quantity == 0 {
+				lots = lots[1:]
+			}
+		}
+		openLots[key] = lots
+	}
+
+	sort.SliceStable(trips, func(i, j int) bool {
+		return trips[i].ExitTime.Before(trips[j].ExitTime)
+	})
+	return trips
+}
+
+// adjustLots 按除权除息调整未平仓买入的数量、建仓价和每股费用，与持仓调整一致地舍去不足1股的送转
+func adjustLots(lots []roundTripLot, adjustment lotAdjustment) {
+	for i := range lots {
+		lot := &lots[i]
+		quantity := lot.quantity + int(math.Floor(float64(lot.quantity)*adjustment.shareRatio+1e-9))
+		if quantity <= 0 {
+			continue
+		}
+		scale := float64(lot.quantity) / float64(quantity)
+		lot.entry.Price = math.Max(lot.entry.Price-adjustment.cashDividend, 0) * scale
+		lot.feePerShare *= scale
+		lot.quantity = quantity
+	}
+}
+
+// newRoundTrip 由一笔建仓和平仓中配对的数量生成开平仓记录
+func newRoundTrip(lot roundTripLot, exit models.Trade, quantity int, exitFeePerShare float64, history *symbolHistory) models.RoundTrip {
+	entry := lot.entry
+	trip := models.RoundTrip{
+		StrategyID: entry.StrategyID,
+		Symbol:     entry.Symbol,
+		Quantity:   quantity,
+		EntryTime:  entry.Timestamp,
+		ExitTime:   exit.Timestamp,
+		EntryPrice: entry.Price,
+		ExitPrice:  exit.Price,
+		Fees:       (lot.feePerShare + exitFeePerShare) * float64(quantity),
+	}
+	trip.PnL = (trip.ExitPrice-trip.EntryPrice)*float64(quantity) - trip.Fees
+	if cost := trip.EntryPrice * float64(quantity); cost > 0 {
+		trip.Return = trip.PnL / cost
+	}
+
+	lowest := math.Min(trip.EntryPrice, trip.ExitPrice)
+	highest := math.Max(trip.EntryPrice, trip.ExitPrice)
+	if history != nil {
+		start, end := history.indexAfter(entry.Timestamp), history.indexAfter(exit.Timestamp)
+		for _, bar := range history.bars[start:maxInt(start, end)] {
+			lowest = math.Min(lowest, bar.Low.InexactFloat64())
+			highest = math.Max(highest, bar.High.InexactFloat64())
+		}
+		trip.HoldingDays = maxInt(end-start, 0)
+	}
+	if trip.EntryPrice > 0 {
+		trip.MAE = lowest/trip.EntryPrice - 1
+		trip.MFE = highest/trip.EntryPrice - 1
+	}
+	return trip
+}
+
+// summarizeRoundTrips 计算开平仓的汇总统计，连续盈亏按传入顺序（平仓时间）计算，盈亏为0的交易中断连续
+func summarizeRoundTrips(trips []models.RoundTrip) models.RoundTripStats {
+	stats := models.RoundTripStats{
+		Count:          len(trips),
+		HoldingPeriods: make([]models.HoldingPeriodBucket, len(holdingPeriodBuckets)),
+	}
+	copy(stats.HoldingPeriods, holdingPeriodBuckets)
+	if len(trips) == 0 {
+		return stats
+	}
+
+	var totalWin, totalLoss, totalPnL, totalReturn float64
+	var totalDays, totalMAE, totalMFE float64
+	winStreak, lossStreak := 0, 0
+	bucketReturns := make([]float64, len(stats.HoldingPeriods))
+	bucketWins := make([]int, len(stats.HoldingPeriods))
+
+	for _, trip := range trips {
+		switch {
+		case trip.PnL > 0:
+			stats.Wins++
+			totalWin += trip.PnL
+			winStreak, lossStreak = winStreak+1, 0
+		case trip.PnL < 0:
+			stats.Losses++
+			totalLoss += trip.PnL
+			winStreak, lossStreak = 0, lossStreak+1
+		default:
+			winStreak, lossStreak = 0, 0
+		}
+		stats.LongestWinStreak = maxInt(stats.LongestWinStreak, winStreak)
+		stats.LongestLossStreak = maxInt(stats.LongestLossStreak, lossStreak)
+
+		totalPnL += trip.PnL
+		totalReturn += trip.Return
+		totalDays += float64(trip.HoldingDays)
+		totalMAE += trip.MAE
+		totalMFE += trip.MFE
+
+		for i, bucket := range stats.HoldingPeriods {
+			if trip.HoldingDays >= bucket.MinDays && (bucket.MaxDays == 0 || trip.HoldingDays <= bucket.MaxDays) {
+				stats.HoldingPeriods[i].Count++
+				bucketReturns[i] += trip.Return
+				if trip.PnL > 0 {
+					bucketWins[i]++
+				}
+				break
+			}
+		}
+	}
+
+	count := float64(len(trips))
+	stats.WinRate = float64(stats.Wins) / count
+	if stats.Wins > 0 {
+		stats.AverageWin = totalWin / float64(stats.Wins)
+	}
+	if stats.Losses > 0 {
+		stats.AverageLoss = totalLoss / float64(stats.Losses)
+	}
+	if stats.AverageLoss < 0 {
+		stats.PayoffRatio = stats.AverageWin / -stats.AverageLoss
+	}
+	stats.Expectancy = totalPnL / count
+	stats.ExpectancyReturn = totalReturn / count
+	stats.AverageHoldingDays = totalDays / count
+	stats.AverageMAE = totalMAE / count
+	stats.AverageMFE = totalMFE / count
+
+	for i := range stats.HoldingPeriods {
+		if n := stats.HoldingPeriods[i].Count; n > 0 {
+			stats.HoldingPeriods[i].WinRate = float64(bucketWins[i]) / float64(n)
+			stats.HoldingPeriods[i].AverageReturn = bucketReturns[i] / float64(n)
+		}
+	}
+	return stats
+}
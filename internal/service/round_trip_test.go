@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestBuildRoundTrips(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(i int) time.Time { return start.AddDate(0, 0, i) }
+	histories := map[string]*symbolHistory{
+		"000001.SZ": newSymbolHistory(buildTestDailyBars("000001.SZ", start, []float64{10, 11, 9, 12, 9})),
+	}
+
+	trades := []models.Trade{
+		{StrategyID: "s1", Symbol: "000001.SZ", Side: models.TradeSideBuy, Quantity: 200, Price: 10, Commission: 5, Timestamp: day(0)},
+		{StrategyID: "s1", Symbol: "000001.SZ", Side: models.TradeSideBuy, Quantity: 100, Price: 11, Commission: 5, Timestamp: day(1)},
+		{StrategyID: "s1", Symbol: "000001.SZ", Side: models.TradeSideSell, Quantity: 250, Price: 12, Commission: 5, StampDuty: 5, Timestamp: day(3)},
+		{StrategyID: "s1", Symbol: "000001.SZ", Side: models.TradeSideSell, Quantity: 50, Price: 9, Commission: 2, Timestamp: day(4)},
+		// 另一策略交易同一股票，不与 s1 的持仓配对；未平仓的买入不计入
+		{StrategyID: "s2", Symbol: "000001.SZ", Side: models.TradeSideBuy, Quantity: 100, Price: 9, Timestamp: day(2)},
+		{StrategyID: "s2", Symbol: "000001.SZ", Side: models.TradeSideSell, Quantity: 100, Price: 12, Timestamp: day(3)},
+		{StrategyID: "s2", Symbol: "000001.SZ", Side: models.TradeSideBuy, Quantity: 100, Price: 9, Timestamp: day(4)},
+	}
+
+	trips := buildRoundTrips(trades, histories, nil)
+	if len(trips) != 4 {
+		t.Fatalf("应配对出4笔开平仓, 实际 %d: %+v", len(trips), trips)
+	}
+
+	expected := []struct {
+		strategyID  string
+		quantity    int
+		entryPrice  float64
+		exitPrice   float64
+		pnl         float64
+		holdingDays int
+	}{
+		{"s1", 200, 10, 12, 387, 3},
+		{"s1", 50, 11, 12, 45.5, 2},
+		{"s2", 100, 9, 12, 300, 1},
+		{"s1", 50, 11, 9, -104.5, 3},
+	}
+	for i, want := range expected {
+		trip := trips[i]
+		if trip.StrategyID != want.strategyID || trip.Quantity != want.quantity || trip.EntryPrice != want.entryPrice || trip.ExitPrice != want.exitPrice {
+			t.Errorf("第%d笔配对错误: %+v", i, trip)
+		}
+		if math.Abs(trip.PnL-want.pnl) > 1e-9 || trip.HoldingDays != want.holdingDays {
+			t.Errorf("第%d笔盈亏或持有天数错误: pnl=%.2f days=%d", i, trip.PnL, trip.HoldingDays)
+		}
+	}
+
+	// 第一笔持有期间（1月2日至4日）最低价 9*0.99，最高价 12*1.01
+	if math.Abs(trips[0].MAE-(8.91/10-1)) > 1e-9 || math.Abs(trips[0].MFE-(12.12/10-1)) > 1e-9 {
+		t.Errorf("MAE/MFE 计算错误: mae=%.4f mfe=%.4f", trips[0].MAE, trips[0].MFE)
+	}
+	if math.Abs(trips[0].Return-387.0/2000) > 1e-9 {
+		t.Errorf("收益率计算错误: %.4f", trips[0].Return)
+	}
+}
+
+func TestSummarizeRoundTrips(t *testing.T) {
+	pnls := []float64{100, 200, -50, 0, 300, -100, -150, 40}
+	trips := make([]models.RoundTrip, len(pnls))
+	for i, pnl := range pnls {
+		trips[i] = models.RoundTrip{PnL: pnl, Return: pnl / 1000, HoldingDays: i * 10}
+	}
+
+	stats := summarizeRoundTrips(trips)
+	if stats.Count != 8 || stats.Wins != 4 || stats.Losses != 3 || stats.WinRate != 0.5 {
+		t.Errorf("盈亏笔数错误: %+v", stats)
+	}
+	if stats.AverageWin != 160 || stats.AverageLoss != -100 || stats.PayoffRatio != 1.6 {
+		t.Errorf("平均盈亏或盈亏比错误: win=%.2f loss=%.2f payoff=%.2f", stats.AverageWin, stats.AverageLoss, stats.PayoffRatio)
+	}
+	if stats.Expectancy != 42.5 || math.Abs(stats.ExpectancyReturn-0.0425) > 1e-12 {
+		t.Errorf("期望值错误: %.2f %.4f", stats.Expectancy, stats.ExpectancyReturn)
+	}
+	// 盈亏为0的交易中断连续盈利
+	if stats.LongestWinStreak != 2 || stats.LongestLossStreak != 2 {
+		t.Errorf("最长连续盈亏错误: win=%d loss=%d", stats.LongestWinStreak, stats.LongestLossStreak)
+	}
+
+	// 持有天数 0,10,20,...,70
+	counts := []int{1, 0, 1, 1, 4, 1}
+	for i, bucket := range stats.HoldingPeriods {
+		if bucket.Count != counts[i] {
+			t.Errorf("持有时间区间 %s 数量错误: %d", bucket.Label, bucket.Count)
+		}
+	}
+	if holdingPeriodBuckets[0].Count != 0 {
+		t.Error("汇总统计不应修改区间定义")
+	}
+
+	if empty := summarizeRoundTrips(nil); empty.Count != 0 || len(empty.HoldingPeriods) != len(holdingPeriodBuckets) {
+		t.Errorf("无交易时应返回空统计: %+v", empty)
+	}
+}
+
+func TestGetRoundTrips(t *testing.T) {
+	bars := buildTestDailyBars("000001.SZ", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), trendingCloses(140, 8, 0.02))
+	service := newSimulationTestService(t, bars)
+
+	strategies := []*models.Strategy{{ID: "ma_crossover", Parameters: map[string]interface{}{"short_period": 3.0, "long_period": 10.0}}}
+	backtest := &models.Backtest{
+		ID:          "bt-round-trips",
+		StrategyIDs: []string{"ma_crossover"},
+		Symbols:     []string{"000001.SZ"},
+		StartDate:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+		Status:      models.BacktestStatusCompleted,
+	}
+	service.backtests[backtest.ID] = backtest
+
+	runData, err := service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	service.backtestRoundTrips[backtest.ID] = runData.RoundTrips
+
+	analysis, err := service.GetRoundTrips(context.Background(), backtest.ID, "")
+	if err != nil {
+		t.Fatalf("获取开平仓分析失败: %v", err)
+	}
+	sells := 0
+	for _, trade := range runData.Trades {
+		if trade.Side == models.TradeSideSell {
+			sells++
+		}
+	}
+	if sells == 0 || analysis.Stats.Count < sells {
+		t.Fatalf("每笔卖出至少对应一笔开平仓: sells=%d trips=%d", sells, analysis.Stats.Count)
+	}
+	for _, trip := range analysis.RoundTrips {
+		if trip.MAE > 0 || trip.MFE < 0 || trip.HoldingDays < 1 || !trip.ExitTime.After(trip.EntryTime) {
+			t.Errorf("开平仓记录不合理: %+v", trip)
+		}
+	}
+	if _, ok := analysis.StrategyStats["ma_crossover"]; !ok {
+		t.Error("应包含每个策略的统计")
+	}
+
+	if filtered, _ := service.GetRoundTrips(context.Background(), backtest.ID, "other"); filtered.Stats.Count != 0 {
+		t.Errorf("按策略过滤后不应包含其他策略的记录: %d", filtered.Stats.Count)
+	}
+	if _, err := service.GetRoundTrips(context.Background(), "missing", ""); err != ErrBacktestNotFound {
+		t.Errorf("回测不存在时应返回 ErrBacktestNotFound, 实际 %v", err)
+	}
+}
@@ -0,0 +1,627 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidRule 策略规则代码无效，错误信息中带有出错的行列位置
+var ErrInvalidRule = errors.New("策略规则无效")
+
+// 策略规则DSL
+//
+// 用户自定义的技术指标策略在 Code 中写买入和卖出规则，例如:
+//
+//	ENTRY: CROSS(MA(CLOSE, 5), MA(CLOSE, 20)) AND RSI(14) < 70
+//	EXIT:  CROSS(MA(CLOSE, 20), MA(CLOSE, 5)) OR RSI(14) > 80
+//
+// ENTRY 必填，EXIT 可省略；# 之后到行尾为注释。关键字、函数名和行情序列不区分大小写，
+// 其他标识符引用策略参数（如 MA(CLOSE, short_period)），参数必须是数值。
+// 运算符优先级从低到高: OR、AND、NOT、比较(< <= > >= == !=)、加减、乘除、取负。
+
+// rulePos 规则代码中的位置，行列均从1开始
+type rulePos struct {
+	line   int
+	column int
+}
+
+func (p rulePos) String() string {
+	return fmt.Sprintf("第%d行第%d列", p.line, p.column)
+}
+
+// ruleErrorf 生成带位置的规则错误
+func ruleErrorf(pos rulePos, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidRule, pos, fmt.Sprintf(format, args...))
+}
+
+// ==================== 词法分析 ====================
+
+type ruleTokenKind int
+
+const (
+	ruleTokenEOF ruleTokenKind = iota
+	ruleTokenNumber
+	ruleTokenIdent
+	ruleTokenSymbol // 运算符和标点: + - * / < <= > >= == != ( ) , :
+)
+
+type ruleToken struct {
+	kind  ruleTokenKind
+	text  string
+	value float64
+	pos   rulePos
+}
+
+// describe 出错信息中对记号的描述
+func (t ruleToken) describe() string {
+	if t.kind == ruleTokenEOF {
+		return "代码结尾"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// lexRule 将规则代码切分为记号
+func lexRule(code string) ([]ruleToken, error) {
+	runes := []rune(code)
+	var tokens []ruleToken
+	line, column := 1, 1
+
+	advance := func(n int) {
+		column += n
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := rulePos{line: line, column: column}
+
+		switch {
+		case r == '\n':
+			line++
+			column = 1
+			i++
+		case unicode.IsSpace(r):
+			advance(1)
+			i++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				advance(1)
+				i++
+			}
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, ruleErrorf(pos, "无效的数字 %s", text)
+			}
+			tokens = append(tokens, ruleToken{kind: ruleTokenNumber, text: text, value: value, pos: pos})
+			advance(i - start)
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: ruleTokenIdent, text: string(runes[start:i]), pos: pos})
+			advance(i - start)
+		default:
+			if i+1 < len(runes) {
+				switch pair := string(runes[i : i+2]); pair {
+				case "<=", ">=", "==", "!=":
+					tokens = append(tokens, ruleToken{kind: ruleTokenSymbol, text: pair, pos: pos})
+					advance(2)
+					i += 2
+					continue
+				}
+			}
+			switch r {
+			case '+', '-', '*', '/', '<', '>', '(', ')', ',', ':':
+				tokens = append(tokens, ruleToken{kind: ruleTokenSymbol, text: string(r), pos: pos})
+				advance(1)
+				i++
+			case '=':
+				return nil, ruleErrorf(pos, "比较相等请使用 ==")
+			default:
+				return nil, ruleErrorf(pos, "无法识别的字符 '%c'", r)
+			}
+		}
+	}
+
+	tokens = append(tokens, ruleToken{kind: ruleTokenEOF, pos: rulePos{line: line, column: column}})
+	return tokens, nil
+}
+
+// ==================== 语法树 ====================
+
+type ruleExprKind int
+
+const (
+	ruleExprNumber ruleExprKind = iota // 数字常量
+	ruleExprParam                      // 策略参数
+	ruleExprSeries                     // 行情序列
+	ruleExprCall                       // 函数调用
+	ruleExprUnary                      // NOT、取负
+	ruleExprBinary                     // 算术、比较和逻辑运算
+)
+
+// ruleType 表达式的值类型
+type ruleType int
+
+const (
+	ruleTypeNumber ruleType = iota
+	ruleTypeBool
+)
+
+// ruleExpr 规则表达式节点
+type ruleExpr struct {
+	kind  ruleExprKind
+	pos   rulePos
+	name  string  // 参数名、序列名、函数名或运算符
+	value float64 // 数字常量的值
+	args  []*ruleExpr
+	typ   ruleType
+}
+
+// String 规范化的表达式文本，用于信号原因和求值缓存
+func (e *ruleExpr) String() string {
+	switch e.kind {
+	case ruleExprNumber:
+		return strconv.FormatFloat(e.value, 'g', -1, 64)
+	case ruleExprParam, ruleExprSeries:
+		return e.name
+	case ruleExprCall:
+		args := make([]string, len(e.args))
+		for i, arg := range e.args {
+			args[i] = arg.String()
+		}
+		return fmt.Sprintf("%s(%s)", e.name, strings.Join(args, ", "))
+	case ruleExprUnary:
+		if e.name == "NOT" {
+			return "NOT " + e.args[0].String()
+		}
+		return e.name + e.args[0].String()
+	default:
+		return fmt.Sprintf("(%s %s %s)", e.args[0], e.name, e.args[1])
+	}
+}
+
+// ruleSeries 可直接引用的行情序列
+var ruleSeries = map[string]bool{
+	"OPEN":   true,
+	"HIGH":   true,
+	"LOW":    true,
+	"CLOSE":  true,
+	"VOL":    true,
+	"VOLUME": true,
+}
+
+// ruleArgKind 函数参数的种类
+type ruleArgKind int
+
+const (
+	ruleArgSeries ruleArgKind = iota // 数值序列，可以是任意数值表达式
+	ruleArgPeriod                    // 周期，正整数常量或策略参数
+	ruleArgFactor                    // 正数常量或策略参数
+)
+
+// ruleFunction 规则函数签名
+type ruleFunction struct {
+	args   []ruleArgKind
+	result ruleType
+}
+
+// ruleFunctions 规则中可用的函数，指标函数基于 indicators.Calculator 计算
+var ruleFunctions = map[string]ruleFunction{
+	"MA":         {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"EMA":        {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"WMA":        {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"REF":        {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"HHV":        {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"LLV":        {args: []ruleArgKind{ruleArgSeries, ruleArgPeriod}},
+	"ABS":        {args: []ruleArgKind{ruleArgSeries}},
+	"RSI":        {args: []ruleArgKind{ruleArgPeriod}},
+	"ATR":        {args: []ruleArgKind{ruleArgPeriod}},
+	"DIF":        {args: []ruleArgKind{ruleArgPeriod, ruleArgPeriod, ruleArgPeriod}},
+	"DEA":        {args: []ruleArgKind{ruleArgPeriod, ruleArgPeriod, ruleArgPeriod}},
+	"MACD":       {args: []ruleArgKind{ruleArgPeriod, ruleArgPeriod, ruleArgPeriod}},
+	"BOLL_UPPER": {args: []ruleArgKind{ruleArgPeriod, ruleArgFactor}},
+	"BOLL_MID":   {args: []ruleArgKind{ruleArgPeriod, ruleArgFactor}},
+	"BOLL_LOWER": {args: []ruleArgKind{ruleArgPeriod, ruleArgFactor}},
+	"KDJ_K":      {args: []ruleArgKind{ruleArgPeriod}},
+	"KDJ_D":      {args: []ruleArgKind{ruleArgPeriod}},
+	"KDJ_J":      {args: []ruleArgKind{ruleArgPeriod}},
+	"CROSS":      {args: []ruleArgKind{ruleArgSeries, ruleArgSeries}, result: ruleTypeBool},
+}
+
+// ruleProgram 解析后的策略规则
+type ruleProgram struct {
+	entry *ruleExpr
+	exit  *ruleExpr // 可为空
+}
+
+// ==================== 语法分析 ====================
+
+type ruleParser struct {
+	tokens []ruleToken
+	index  int
+}
+
+// parseRuleProgram 解析规则代码并检查表达式类型，不检查策略参数
+func parseRuleProgram(code string) (*ruleProgram, error) {
+	tokens, err := lexRule(code)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{tokens: tokens}
+	program := &ruleProgram{}
+
+	if p.peek().kind == ruleTokenEOF {
+		return nil, ruleErrorf(p.peek().pos, "规则为空，至少需要 ENTRY: 买入条件")
+	}
+	for p.peek().kind != ruleTokenEOF {
+		label := p.next()
+		section := strings.ToUpper(label.text)
+		if label.kind != ruleTokenIdent || (section != "ENTRY" && section != "EXIT") {
+			return nil, ruleErrorf(label.pos, "应为 ENTRY: 或 EXIT:，实际为 %s", label.describe())
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if expr.typ != ruleTypeBool {
+			return nil, ruleErrorf(expr.pos, "%s 规则应为条件，实际为数值表达式", section)
+		}
+
+		target := &program.entry
+		if section == "EXIT" {
+			target = &program.exit
+		}
+		if *target != nil {
+			return nil, ruleErrorf(label.pos, "重复的 %s 规则", section)
+		}
+		*target = expr
+	}
+
+	if program.entry == nil {
+		return nil, ruleErrorf(tokens[0].pos, "缺少 ENTRY 买入规则")
+	}
+	return program, nil
+}
+
+func (p *ruleParser) peek() ruleToken {
+	return p.tokens[p.index]
+}
+
+func (p *ruleParser) next() ruleToken {
+	token := p.tokens[p.index]
+	if token.kind != ruleTokenEOF {
+		p.index++
+	}
+	return token
+}
+
+// isKeyword 当前记号是否为指定关键字（不区分大小写）
+func (p *ruleParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == ruleTokenIdent && strings.EqualFold(token.text, keyword)
+}
+
+func (p *ruleParser) isSymbol(symbols ...string) bool {
+	token := p.peek()
+	if token.kind != ruleTokenSymbol {
+		return false
+	}
+	for _, symbol := range symbols {
+		if token.text == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ruleParser) expect(symbol string) error {
+	token := p.next()
+	if token.kind != ruleTokenSymbol || token.text != symbol {
+		return ruleErrorf(token.pos, "应为 '%s'，实际为 %s", symbol, token.describe())
+	}
+	return nil
+}
+
+// parseLogical 解析左结合的 AND/OR 运算
+func (p *ruleParser) parseLogical(keyword string, operand func() (*ruleExpr, error)) (*ruleExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(keyword) {
+		op := p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		for _, side := range []*ruleExpr{left, right} {
+			if side.typ != ruleTypeBool {
+				return nil, ruleErrorf(side.pos, "%s 的操作数应为条件，实际为数值表达式 %s", keyword, side)
+			}
+		}
+		left = &ruleExpr{kind: ruleExprBinary, pos: op.pos, name: keyword, args: []*ruleExpr{left, right}, typ: ruleTypeBool}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseOr() (*ruleExpr, error) {
+	return p.parseLogical("OR", p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (*ruleExpr, error) {
+	return p.parseLogical("AND", p.parseNot)
+}
+
+func (p *ruleParser) parseNot() (*ruleExpr, error) {
+	if !p.isKeyword("NOT") {
+		return p.parseComparison()
+	}
+	op := p.next()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.typ != ruleTypeBool {
+		return nil, ruleErrorf(operand.pos, "NOT 的操作数应为条件，实际为数值表达式 %s", operand)
+	}
+	return &ruleExpr{kind: ruleExprUnary, pos: op.pos, name: "NOT", args: []*ruleExpr{operand}, typ: ruleTypeBool}, nil
+}
+
+func (p *ruleParser) parseComparison() (*ruleExpr, error) {
+	left, err := p.parseArithmetic(p.parseTerm, "+", "-")
+	if err != nil {
+		return nil, err
+	}
+	if !p.isSymbol("<", "<=", ">", ">=", "==", "!=") {
+		return left, nil
+	}
+	op := p.next()
+	right, err := p.parseArithmetic(p.parseTerm, "+", "-")
+	if err != nil {
+		return nil, err
+	}
+	for _, side := range []*ruleExpr{left, right} {
+		if side.typ != ruleTypeNumber {
+			return nil, ruleErrorf(side.pos, "比较运算 %s 的操作数应为数值，实际为条件 %s", op.text, side)
+		}
+	}
+	if p.isSymbol("<", "<=", ">", ">=", "==", "!=") {
+		return nil, ruleErrorf(p.peek().pos, "比较运算不能连写，请用 AND 连接")
+	}
+	return &ruleExpr{kind: ruleExprBinary, pos: op.pos, name: op.text, args: []*ruleExpr{left, right}, typ: ruleTypeBool}, nil
+}
+
+func (p *ruleParser) parseTerm() (*ruleExpr, error) {
+	return p.parseArithmetic(p.parseUnary, "*", "/")
+}
+
+// parseArithmetic 解析左结合的算术运算
+func (p *ruleParser) parseArithmetic(operand func() (*ruleExpr, error), symbols ...string) (*ruleExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isSymbol(symbols...) {
+		op := p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		for _, side := range []*ruleExpr{left, right} {
+			if side.typ != ruleTypeNumber {
+				return nil, ruleErrorf(side.pos, "算术运算 %s 的操作数应为数值，实际为条件 %s", op.text, side)
+			}
+		}
+		left = &ruleExpr{kind: ruleExprBinary, pos: op.pos, name: op.text, args: []*ruleExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseUnary() (*ruleExpr, error) {
+	if !p.isSymbol("-") {
+		return p.parsePrimary()
+	}
+	op := p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if operand.typ != ruleTypeNumber {
+		return nil, ruleErrorf(operand.pos, "取负的操作数应为数值，实际为条件 %s", operand)
+	}
+	if operand.kind == ruleExprNumber {
+		operand.value = -operand.value
+		operand.pos = op.pos
+		return operand, nil
+	}
+	return &ruleExpr{kind: ruleExprUnary, pos: op.pos, name: "-", args: []*ruleExpr{operand}}, nil
+}
+
+func (p *ruleParser) parsePrimary() (*ruleExpr, error) {
+	token := p.next()
+	switch token.kind {
+	case ruleTokenNumber:
+		return &ruleExpr{kind: ruleExprNumber, pos: token.pos, value: token.value}, nil
+	case ruleTokenSymbol:
+		if token.text != "(" {
+			break
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case ruleTokenIdent:
+		upper := strings.ToUpper(token.text)
+		switch upper {
+		case "AND", "OR", "NOT", "ENTRY", "EXIT":
+			return nil, ruleErrorf(token.pos, "此处应为表达式，实际为关键字 %s", upper)
+		}
+		if p.isSymbol("(") {
+			return p.parseCall(token, upper)
+		}
+		if ruleSeries[upper] {
+			if upper == "VOLUME" {
+				upper = "VOL"
+			}
+			return &ruleExpr{kind: ruleExprSeries, pos: token.pos, name: upper}, nil
+		}
+		return &ruleExpr{kind: ruleExprParam, pos: token.pos, name: token.text}, nil
+	}
+	return nil, ruleErrorf(token.pos, "此处应为表达式，实际为 %s", token.describe())
+}
+
+func (p *ruleParser) parseCall(token ruleToken, name string) (*ruleExpr, error) {
+	function, ok := ruleFunctions[name]
+	if !ok {
+		return nil, ruleErrorf(token.pos, "未知函数 %s", token.text)
+	}
+	p.next() // (
+
+	var args []*ruleExpr
+	if !p.isSymbol(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) != len(function.args) {
+		return nil, ruleErrorf(token.pos, "函数 %s 需要%d个参数，实际为%d个", name, len(function.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.typ != ruleTypeNumber {
+			return nil, ruleErrorf(arg.pos, "函数 %s 的第%d个参数应为数值，实际为条件 %s", name, i+1, arg)
+		}
+		if function.args[i] != ruleArgSeries && arg.kind != ruleExprNumber && arg.kind != ruleExprParam {
+			return nil, ruleErrorf(arg.pos, "函数 %s 的第%d个参数应为常数或策略参数", name, i+1)
+		}
+	}
+	return &ruleExpr{kind: ruleExprCall, pos: token.pos, name: name, args: args, typ: function.result}, nil
+}
+
+// ==================== 参数检查 ====================
+
+// resolveRuleConstant 取常数参数的值，策略参数必须存在且为数值
+func resolveRuleConstant(expr *ruleExpr, params map[string]interface{}) (float64, error) {
+	if expr.kind == ruleExprNumber {
+		return expr.value, nil
+	}
+	raw, ok := params[expr.name]
+	if !ok {
+		return 0, ruleErrorf(expr.pos, "未知的标识符 %s，既不是行情序列也不是策略参数", expr.name)
+	}
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	}
+	return 0, ruleErrorf(expr.pos, "策略参数 %s 应为数值", expr.name)
+}
+
+// resolveRulePeriod 取周期参数的值，必须是不超过历史窗口的正整数
+func resolveRulePeriod(expr *ruleExpr, params map[string]interface{}) (int, error) {
+	value, err := resolveRuleConstant(expr, params)
+	if err != nil {
+		return 0, err
+	}
+	if value < 1 || value != math.Trunc(value) || value > StrategyLookbackDays {
+		return 0, ruleErrorf(expr.pos, "周期 %s 应为1-%d之间的整数", expr, StrategyLookbackDays)
+	}
+	return int(value), nil
+}
+
+// checkRuleParameters 按策略参数检查规则中引用的参数和周期
+func checkRuleParameters(expr *ruleExpr, params map[string]interface{}) error {
+	if expr == nil {
+		return nil
+	}
+	switch expr.kind {
+	case ruleExprParam:
+		_, err := resolveRuleConstant(expr, params)
+		return err
+	case ruleExprCall:
+		function := ruleFunctions[expr.name]
+		for i, arg := range expr.args {
+			switch function.args[i] {
+			case ruleArgPeriod:
+				if _, err := resolveRulePeriod(arg, params); err != nil {
+					return err
+				}
+			case ruleArgFactor:
+				value, err := resolveRuleConstant(arg, params)
+				if err != nil {
+					return err
+				}
+				if value <= 0 {
+					return ruleErrorf(arg.pos, "%s 应为正数", arg)
+				}
+			default:
+				if err := checkRuleParameters(arg, params); err != nil {
+					return err
+				}
+			}
+		}
+		switch expr.name {
+		case "DIF", "DEA", "MACD":
+			fast, _ := resolveRulePeriod(expr.args[0], params)
+			slow, _ := resolveRulePeriod(expr.args[1], params)
+			if fast >= slow {
+				return ruleErrorf(expr.pos, "%s 的快线周期应小于慢线周期", expr.name)
+			}
+		}
+		return nil
+	}
+	for _, arg := range expr.args {
+		if err := checkRuleParameters(arg, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileRuleProgram 解析规则代码并按策略参数检查
+func compileRuleProgram(code string, params map[string]interface{}) (*ruleProgram, error) {
+	program, err := parseRuleProgram(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRuleParameters(program.entry, params); err != nil {
+		return nil, err
+	}
+	if err := checkRuleParameters(program.exit, params); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"stock-a-future/internal/indicators"
+	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// builtinStrategyIDs 内置策略，执行逻辑由Go代码实现
+var builtinStrategyIDs = map[string]bool{
+	"macd_strategy":      true,
+	"ma_crossover":       true,
+	"rsi_strategy":       true,
+	"bollinger_strategy": true,
+}
+
+// isRuleStrategy 是否为用规则DSL定义的技术指标策略：非内置策略且填写了策略代码
+func isRuleStrategy(strategy *models.Strategy) bool {
+	return strategy.Type == models.StrategyTypeTechnical &&
+		!builtinStrategyIDs[strategy.ID] &&
+		strings.TrimSpace(strategy.Code) != ""
+}
+
+// ValidateRules 检查规则代码的语法以及引用的策略参数，错误信息带有出错位置
+func (s *StrategyService) ValidateRules(code string, params map[string]interface{}) error {
+	_, err := compileRuleProgram(code, params)
+	return err
+}
+
+// ruleProgram 取解析后的规则，同样的代码只解析一次
+func (s *StrategyService) ruleProgram(code string) (*ruleProgram, error) {
+	if cached, ok := s.rulePrograms.Load(code); ok {
+		return cached.(*ruleProgram), nil
+	}
+	program, err := parseRuleProgram(code)
+	if err != nil {
+		return nil, err
+	}
+	s.rulePrograms.Store(code, program)
+	return program, nil
+}
+
+// executeRuleStrategy 在最后一个交易日上求值买入和卖出规则
+func (s *StrategyService) executeRuleStrategy(strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	program, err := s.ruleProgram(strategy.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	signal := newStrategySignal(strategy, marketData)
+	if len(history) == 0 {
+		return holdSignal(signal, "没有历史数据，无法计算规则"), nil
+	}
+
+	evaluator := &ruleEvaluator{
+		calculator: s.calculator,
+		history:    history,
+		params:     strategy.Parameters,
+		numbers:    make(map[string][]float64),
+	}
+	entry, err := evaluator.holds(program.entry)
+	if err != nil {
+		return nil, err
+	}
+	exit := false
+	if program.exit != nil {
+		if exit, err = evaluator.holds(program.exit); err != nil {
+			return nil, err
+		}
+	}
+
+	// 规则只给出是否满足，不区分强弱
+	switch {
+	case entry && exit:
+		holdSignal(signal, "买入和卖出规则同时满足，不操作")
+	case entry:
+		signal.SignalType = models.SignalTypeBuy
+		signal.Side = models.TradeSideBuy
+		signal.Strength = 0.7
+		signal.Confidence = 0.7
+		signal.Reason = fmt.Sprintf("满足买入规则 %s", program.entry)
+	case exit:
+		signal.SignalType = models.SignalTypeSell
+		signal.Side = models.TradeSideSell
+		signal.Strength = 0.7
+		signal.Confidence = 0.7
+		signal.Reason = fmt.Sprintf("满足卖出规则 %s", program.exit)
+	default:
+		holdSignal(signal, "未满足买入或卖出规则")
+	}
+
+	return signal, nil
+}
+
+// ruleEvaluator 在历史K线上计算规则表达式
+// 数值表达式的结果是与 history 逐日对齐的序列，指标预热期等无法计算的位置为 NaN，与 NaN 比较的条件不成立
+type ruleEvaluator struct {
+	calculator *indicators.Calculator
+	history    []models.StockDaily
+	params     map[string]interface{}
+	numbers    map[string][]float64 // 同一次求值中相同子表达式只计算一次
+}
+
+// holds 条件在最后一个交易日是否成立
+func (e *ruleEvaluator) holds(expr *ruleExpr) (bool, error) {
+	values, err := e.condition(expr)
+	if err != nil {
+		return false, err
+	}
+	return values[len(values)-1], nil
+}
+
+func (e *ruleEvaluator) condition(expr *ruleExpr) ([]bool, error) {
+	n := len(e.history)
+	result := make([]bool, n)
+
+	switch {
+	case expr.kind == ruleExprUnary:
+		operand, err := e.condition(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		for i := range result {
+			result[i] = !operand[i]
+		}
+		return result, nil
+
+	case expr.kind == ruleExprBinary && (expr.name == "AND" || expr.name == "OR"):
+		left, err := e.condition(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.condition(expr.args[1])
+		if err != nil {
+			return nil, err
+		}
+		for i := range result {
+			if expr.name == "AND" {
+				result[i] = left[i] && right[i]
+			} else {
+				result[i] = left[i] || right[i]
+			}
+		}
+		return result, nil
+
+	case expr.kind == ruleExprBinary:
+		left, err := e.number(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.number(expr.args[1])
+		if err != nil {
+			return nil, err
+		}
+		for i := range result {
+			result[i] = compareRuleValues(expr.name, left[i], right[i])
+		}
+		return result, nil
+
+	case expr.kind == ruleExprCall && expr.name == "CROSS":
+		// 上穿：前一日 a <= b，当日 a > b
+		a, err := e.number(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := e.number(expr.args[1])
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < n; i++ {
+			result[i] = a[i-1] <= b[i-1] && a[i] > b[i]
+		}
+		return result, nil
+	}
+
+	return nil, ruleErrorf(expr.pos, "%s 不是条件", expr)
+}
+
+// compareRuleValues 比较两个数值，任一为 NaN 时不成立
+func compareRuleValues(op string, a, b float64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "==":
+		return a == b
+	case "!=":
+		return a != b && !math.IsNaN(a) && !math.IsNaN(b)
+	}
+	return false
+}
+
+func (e *ruleEvaluator) number(expr *ruleExpr) ([]float64, error) {
+	key := expr.String()
+	if cached, ok := e.numbers[key]; ok {
+		return cached, nil
+	}
+	values, err := e.computeNumber(expr)
+	if err != nil {
+		return nil, err
+	}
+	e.numbers[key] = values
+	return values, nil
+}
+
+func (e *ruleEvaluator) computeNumber(expr *ruleExpr) ([]float64, error) {
+	n := len(e.history)
+
+	switch expr.kind {
+	case ruleExprNumber, ruleExprParam:
+		value, err := resolveRuleConstant(expr, e.params)
+		if err != nil {
+			return nil, err
+		}
+		return constantRuleSeries(value, n), nil
+
+	case ruleExprSeries:
+		values := make([]float64, n)
+		for i, bar := range e.history {
+			values[i] = ruleBarValue(bar, expr.name)
+		}
+		return values, nil
+
+	case ruleExprUnary:
+		operand, err := e.number(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, n)
+		for i, v := range operand {
+			values[i] = -v
+		}
+		return values, nil
+
+	case ruleExprBinary:
+		left, err := e.number(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.number(expr.args[1])
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, n)
+		for i := range values {
+			switch expr.name {
+			case "+":
+				values[i] = left[i] + right[i]
+			case "-":
+				values[i] = left[i] - right[i]
+			case "*":
+				values[i] = left[i] * right[i]
+			case "/":
+				if right[i] == 0 {
+					values[i] = math.NaN()
+				} else {
+					values[i] = left[i] / right[i]
+				}
+			}
+		}
+		return values, nil
+
+	case ruleExprCall:
+		return e.call(expr)
+	}
+
+	return nil, ruleErrorf(expr.pos, "%s 不是数值表达式", expr)
+}
+
+// call 计算数值函数
+func (e *ruleEvaluator) call(expr *ruleExpr) ([]float64, error) {
+	n := len(e.history)
+	periods := make([]int, len(expr.args))
+	function := ruleFunctions[expr.name]
+	for i, kind := range function.args {
+		if kind != ruleArgPeriod {
+			continue
+		}
+		period, err := resolveRulePeriod(expr.args[i], e.params)
+		if err != nil {
+			return nil, err
+		}
+		periods[i] = period
+	}
+
+	switch expr.name {
+	case "MA", "EMA", "WMA":
+		bars, err := e.seriesBars(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		var values []decimal.Decimal
+		switch expr.name {
+		case "EMA":
+			values = e.calculator.CalculateEMA(bars, periods[1])
+		case "WMA":
+			values = e.calculator.CalculateWMA(bars, periods[1])
+		default:
+			values = e.calculator.CalculateMA(bars, periods[1])
+		}
+		return alignRuleSeries(n, len(values), func(i int) float64 { return values[i].InexactFloat64() }), nil
+
+	case "REF", "HHV", "LLV", "ABS":
+		source, err := e.number(expr.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return windowRuleSeries(expr.name, source, periods[len(periods)-1]), nil
+
+	case "RSI":
+		values := e.calculator.CalculateRSI(e.history, periods[0])
+		return alignRuleSeries(n, len(values), func(i int) float64 { return values[i].RSI14.InexactFloat64() }), nil
+
+	case "ATR":
+		values := e.calculator.CalculateATR(e.history, periods[0])
+		return alignRuleSeries(n, len(values), func(i int) float64 { return values[i].ATR14.InexactFloat64() }), nil
+
+	case "DIF", "DEA", "MACD":
+		values := e.calculator.CalculateMACDWithPeriods(e.history, periods[0], periods[1], periods[2])
+		return alignRuleSeries(n, len(values), func(i int) float64 {
+			switch expr.name {
+			case "DIF":
+				return values[i].DIF.InexactFloat64()
+			case "DEA":
+				return values[i].DEA.InexactFloat64()
+			}
+			return values[i].Histogram.InexactFloat64()
+		}), nil
+
+	case "BOLL_UPPER", "BOLL_MID", "BOLL_LOWER":
+		multiplier, err := resolveRuleConstant(expr.args[1], e.params)
+		if err != nil {
+			return nil, err
+		}
+		values := e.calculator.CalculateBollingerBands(e.history, periods[0], multiplier)
+		return alignRuleSeries(n, len(values), func(i int) float64 {
+			switch expr.name {
+			case "BOLL_UPPER":
+				return values[i].Upper.InexactFloat64()
+			case "BOLL_LOWER":
+				return values[i].Lower.InexactFloat64()
+			}
+			return values[i].Middle.InexactFloat64()
+		}), nil
+
+	case "KDJ_K", "KDJ_D", "KDJ_J":
+		values := e.calculator.CalculateKDJ(e.history, periods[0])
+		return alignRuleSeries(n, len(values), func(i int) float64 {
+			switch expr.name {
+			case "KDJ_K":
+				return values[i].K.InexactFloat64()
+			case "KDJ_D":
+				return values[i].D.InexactFloat64()
+			}
+			return values[i].J.InexactFloat64()
+		}), nil
+	}
+
+	return nil, ruleErrorf(expr.pos, "函数 %s 不返回数值", expr.name)
+}
+
+// seriesBars 将数值序列转换为K线，供按收盘价计算的均线指标使用
+// 收盘价直接使用原始K线；其他序列取末尾连续的有效值，预热期的 NaN 不参与计算
+func (e *ruleEvaluator) seriesBars(expr *ruleExpr) ([]models.StockDaily, error) {
+	if expr.kind == ruleExprSeries && expr.name == "CLOSE" {
+		return e.history, nil
+	}
+	values, err := e.number(expr)
+	if err != nil {
+		return nil, err
+	}
+	start := len(values)
+	for start > 0 && !math.IsNaN(values[start-1]) && !math.IsInf(values[start-1], 0) {
+		start--
+	}
+	bars := make([]models.StockDaily, len(values)-start)
+	for i := range bars {
+		bars[i].Close = models.NewJSONDecimal(decimal.NewFromFloat(values[start+i]))
+	}
+	return bars, nil
+}
+
+// ruleBarValue 取K线的行情字段
+func ruleBarValue(bar models.StockDaily, name string) float64 {
+	switch name {
+	case "OPEN":
+		return bar.Open.InexactFloat64()
+	case "HIGH":
+		return bar.High.InexactFloat64()
+	case "LOW":
+		return bar.Low.InexactFloat64()
+	case "VOL":
+		return bar.Vol.InexactFloat64()
+	}
+	return bar.Close.InexactFloat64()
+}
+
+// constantRuleSeries 常数序列
+func constantRuleSeries(value float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+// alignRuleSeries 指标结果的最后一个元素对应最后一个交易日，前面不足的位置填 NaN
+func alignRuleSeries(n, count int, value func(i int) float64) []float64 {
+	values := make([]float64, n)
+	offset := n - count
+	for i := range values {
+		if i < offset {
+			values[i] = math.NaN()
+		} else {
+			values[i] = value(i - offset)
+		}
+	}
+	return values
+}
+
+// windowRuleSeries 计算引用、窗口最高/最低值和绝对值
+func windowRuleSeries(name string, source []float64, period int) []float64 {
+	values := make([]float64, len(source))
+	for i := range values {
+		values[i] = math.NaN()
+		switch name {
+		case "ABS":
+			values[i] = math.Abs(source[i])
+		case "REF":
+			if i >= period {
+				values[i] = source[i-period]
+			}
+		case "HHV", "LLV":
+			if i < period-1 {
+				continue
+			}
+			extreme := source[i]
+			for _, v := range source[i-period+1 : i+1] {
+				if math.IsNaN(v) {
+					extreme = math.NaN()
+					break
+				}
+				if (name == "HHV" && v > extreme) || (name == "LLV" && v < extreme) {
+					extreme = v
+				}
+			}
+			values[i] = extreme
+		}
+	}
+	return values
+}
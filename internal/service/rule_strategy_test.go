@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestParseRuleProgram_Errors(t *testing.T) {
+	params := map[string]interface{}{"fast": 5.0, "label": "x"}
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"空代码", "  # 只有注释", "第1行第9列: 规则为空"},
+		{"缺少标签", "RSI(14) < 30", "第1行第1列: 应为 ENTRY: 或 EXIT:"},
+		{"缺少ENTRY", "EXIT: RSI(14) > 70", "第1行第1列: 缺少 ENTRY 买入规则"},
+		{"重复规则", "ENTRY: RSI(14) < 30\nENTRY: RSI(14) < 20", "第2行第1列: 重复的 ENTRY 规则"},
+		{"未知函数", "ENTRY: FOO(CLOSE) > 1", "第1行第8列: 未知函数 FOO"},
+		{"参数个数", "ENTRY: MA(CLOSE) > 1", "第1行第8列: 函数 MA 需要2个参数，实际为1个"},
+		{"数值规则", "ENTRY: MA(CLOSE, 5)", "第1行第8列: ENTRY 规则应为条件"},
+		{"逻辑运算数值", "ENTRY: RSI(14) < 30 AND CLOSE", "第1行第25列: AND 的操作数应为条件"},
+		{"比较条件", "ENTRY:\n  CROSS(CLOSE, OPEN) > 1", "第2行第3列: 比较运算 > 的操作数应为数值"},
+		{"单等号", "ENTRY: CLOSE = 1", "第1行第14列: 比较相等请使用 =="},
+		{"非法字符", "ENTRY: CLOSE > 1 ;", "第1行第18列: 无法识别的字符 ';'"},
+		{"括号不匹配", "ENTRY: (CLOSE > 1", "第1行第18列: 应为 ')'，实际为 代码结尾"},
+		{"周期不是常数", "ENTRY: MA(CLOSE, CLOSE) > 1", "第1行第18列: 函数 MA 的第2个参数应为常数或策略参数"},
+		{"周期非整数", "ENTRY: MA(CLOSE, 2.5) > 1", "第1行第18列: 周期 2.5 应为1-250之间的整数"},
+		{"未知标识符", "ENTRY: MA(CLOSE, slow) > CLSE", "第1行第18列: 未知的标识符 slow"},
+		{"参数不是数值", "ENTRY: MA(CLOSE, label) > 1", "第1行第18列: 策略参数 label 应为数值"},
+		{"MACD周期", "ENTRY: MACD(26, 12, 9) > 0", "第1行第8列: MACD 的快线周期应小于慢线周期"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRuleProgram(tt.code, params)
+			if !errors.Is(err, ErrInvalidRule) {
+				t.Fatalf("应返回 ErrInvalidRule, 实际 %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误信息应包含 %q, 实际 %q", tt.want, err.Error())
+			}
+		})
+	}
+
+	program, err := compileRuleProgram("entry: cross(ma(close, fast), ema(close, 20)) and not rsi(14) >= 70 # 金叉\nexit: close < llv(ref(low, 1), 10) * 0.98 or -atr(14) > -1", params)
+	if err != nil {
+		t.Fatalf("合法规则解析失败: %v", err)
+	}
+	if got := program.entry.String(); got != "(CROSS(MA(CLOSE, fast), EMA(CLOSE, 20)) AND NOT (RSI(14) >= 70))" {
+		t.Errorf("买入规则解析结果不正确: %s", got)
+	}
+	if program.exit == nil {
+		t.Error("应解析出卖出规则")
+	}
+}
+
+func TestRuleEvaluator_MatchesIndicators(t *testing.T) {
+	service := newTestStrategyService(t)
+	var closes []float64
+	for i := 0; i < 80; i++ {
+		closes = append(closes, 10+math.Sin(float64(i)/5)*2+float64(i)*0.05)
+	}
+	bars := buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), closes)
+	evaluator := &ruleEvaluator{calculator: service.calculator, history: bars, params: map[string]interface{}{"n": 5.0}, numbers: make(map[string][]float64)}
+
+	program, err := compileRuleProgram("ENTRY: MA(CLOSE, n) > 0\nEXIT: RSI(14) > 0", evaluator.params)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+
+	ma, err := evaluator.number(program.entry.args[0])
+	if err != nil {
+		t.Fatalf("求值失败: %v", err)
+	}
+	expected := service.calculator.CalculateMA(bars, 5)
+	if !math.IsNaN(ma[3]) || math.Abs(ma[4]-expected[0].InexactFloat64()) > 1e-9 || math.Abs(ma[79]-expected[75].InexactFloat64()) > 1e-9 {
+		t.Errorf("MA 应与指标计算结果按最后一个交易日对齐: %v", ma[:6])
+	}
+
+	rsi, err := evaluator.number(program.exit.args[0])
+	if err != nil {
+		t.Fatalf("求值失败: %v", err)
+	}
+	expectedRSI := service.calculator.CalculateRSI(bars, 14)
+	if math.Abs(rsi[79]-expectedRSI[len(expectedRSI)-1].RSI14.InexactFloat64()) > 1e-9 || !math.IsNaN(rsi[13]) || math.IsNaN(rsi[14]) {
+		t.Errorf("RSI 应与指标计算结果按最后一个交易日对齐")
+	}
+}
+
+func TestExecuteStrategy_RuleStrategy(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	strategy := &models.Strategy{
+		ID:         "user-ma-cross",
+		Name:       "自定义均线交叉",
+		Type:       models.StrategyTypeTechnical,
+		Parameters: map[string]interface{}{"short": 3.0, "long": 10.0},
+		Code:       "ENTRY: CROSS(MA(CLOSE, short), MA(CLOSE, long))\nEXIT: CROSS(MA(CLOSE, long), MA(CLOSE, short))",
+	}
+	if err := service.CreateStrategy(ctx, strategy); err != nil {
+		t.Fatalf("创建规则策略失败: %v", err)
+	}
+
+	invalid := &models.Strategy{ID: "user-invalid", Name: "无效规则", Type: models.StrategyTypeTechnical, Code: "ENTRY: MA(CLOSE, 5) >"}
+	if err := service.CreateStrategy(ctx, invalid); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("规则无效时创建应失败并返回 ErrInvalidRule, 实际 %v", err)
+	}
+	badCode := "ENTRY: CROSS(MA(CLOSE, short), MA(CLOSE, middle))"
+	if err := service.UpdateStrategy(ctx, strategy.ID, &models.UpdateStrategyRequest{Code: &badCode}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("更新为引用未知参数的规则应失败, 实际 %v", err)
+	}
+
+	// 先下跌后上涨产生金叉，再下跌产生死叉；逐日执行，信号应与手工计算的均线交叉一致
+	var closes []float64
+	for i := 0; i < 20; i++ {
+		closes = append(closes, 20-float64(i)*0.3)
+	}
+	for i := 0; i < 12; i++ {
+		closes = append(closes, closes[len(closes)-1]*1.03)
+	}
+	for i := 0; i < 12; i++ {
+		closes = append(closes, closes[len(closes)-1]*0.97)
+	}
+	bars := buildTestDailyBars("000001.SZ", start, closes)
+
+	var buys, sells int
+	for day := 10; day <= len(bars); day++ {
+		history := bars[:day]
+		signal, err := service.ExecuteStrategy(ctx, strategy.ID, lastBarMarketData(t, history), history)
+		if err != nil {
+			t.Fatalf("执行规则策略失败: %v", err)
+		}
+
+		short := service.recentMovingAverage(history, 3, "sma", 2)
+		long := service.recentMovingAverage(history, 10, "sma", 2)
+		want := models.SignalTypeHold
+		if len(long) == 2 {
+			switch {
+			case short[0] <= long[0] && short[1] > long[1]:
+				want = models.SignalTypeBuy
+			case long[0] <= short[0] && long[1] > short[1]:
+				want = models.SignalTypeSell
+			}
+		}
+		if signal.SignalType != want {
+			t.Fatalf("第%d天信号应为 %s, 实际 %s (%s)", day, want, signal.SignalType, signal.Reason)
+		}
+		switch signal.SignalType {
+		case models.SignalTypeBuy:
+			buys++
+		case models.SignalTypeSell:
+			sells++
+		}
+	}
+	if buys == 0 || sells == 0 {
+		t.Errorf("测试数据应同时产生买入和卖出信号: buys=%d sells=%d", buys, sells)
+	}
+}
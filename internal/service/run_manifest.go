@@ -0,0 +1,495 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var (
+	// ErrBacktestManifestNotFound 回测没有运行清单（在引入运行清单之前完成的回测）
+	ErrBacktestManifestNotFound = errors.New("回测没有运行清单")
+	// ErrReplayNotFound 回测没有重新运行的任务
+	ErrReplayNotFound = errors.New("回测没有重新运行的任务")
+	// ErrReplayRunning 回测正在重新运行
+	ErrReplayRunning = errors.New("回测正在重新运行")
+)
+
+// 运行清单中各部分结果数据的名称，按此顺序计算总哈希
+const (
+	resultPartResults              = "results"
+	resultPartTrades               = "trades"
+	resultPartRejectedOrders       = "rejected_orders"
+	resultPartRoundTrips           = "round_trips"
+	resultPartEquityCurve          = "equity_curve"
+	resultPartStrategyEquityCurves = "strategy_equity_curves"
+)
+
+var resultParts = []string{
+	resultPartResults, resultPartTrades, resultPartRejectedOrders,
+	resultPartRoundTrips, resultPartEquityCurve, resultPartStrategyEquityCurves,
+}
+
+// codeVersion 返回构建时嵌入的VCS提交号，工作区有未提交的修改时加 -dirty 后缀；没有VCS信息时返回模块版本
+var codeVersion = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return info.Main.Version
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+})
+
+// contentHasher 按顺序写入数据的JSON编码并计算SHA-256
+// float64 的JSON编码是能还原原值的最短表示，因此哈希相同即数值逐位相同
+type contentHasher struct {
+	hash    hash.Hash
+	encoder *json.Encoder
+	err     error
+}
+
+func newContentHasher() *contentHasher {
+	h := sha256.New()
+	return &contentHasher{hash: h, encoder: json.NewEncoder(h)}
+}
+
+// add 写入数据，出错后忽略之后写入的数据
+func (h *contentHasher) add(values ...interface{}) {
+	for _, value := range values {
+		if h.err != nil {
+			return
+		}
+		h.err = h.encoder.Encode(value)
+	}
+}
+
+// addBars 写入日线数据
+// 价格按十进制原值写入，不经过 JSONDecimal 的JSON编码（需要转换为浮点数，几十万根K线时耗时过长）
+func (h *contentHasher) addBars(bars []models.StockDaily) {
+	if h.err != nil {
+		return
+	}
+	buf := make([]byte, 0, 256)
+	for _, bar := range bars {
+		buf = append(buf[:0], bar.TSCode...)
+		buf = append(buf, ',')
+		buf = append(buf, bar.TradeDate...)
+		for _, value := range []models.JSONDecimal{bar.Open, bar.High, bar.Low, bar.Close, bar.PreClose, bar.Change, bar.PctChg, bar.Vol, bar.Amount} {
+			buf = append(buf, ',')
+			buf = append(buf, value.String()...)
+		}
+		buf = append(buf, '\n')
+		h.hash.Write(buf)
+	}
+}
+
+// sum 返回十六进制的哈希值
+func (h *contentHasher) sum() (string, error) {
+	if h.err != nil {
+		return "", fmt.Errorf("计算数据哈希失败: %w", h.err)
+	}
+	return hex.EncodeToString(h.hash.Sum(nil)), nil
+}
+
+// marketDataHash 计算回测实际使用的数据的哈希：各股票的日线和基本信息、基准指数日线、分红送转记录和调仓打分用到的基本面因子
+func marketDataHash(histories map[string]*symbolHistory, benchmark *benchmarkSeries, actions *corporateActionSchedule, factors map[string]map[string]*models.FundamentalFactor) (string, error) {
+	h := newContentHasher()
+
+	symbols := make([]string, 0, len(histories))
+	for symbol := range histories {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		history := histories[symbol]
+		h.add(symbol, history.isST, history.listDate)
+		if len(history.nameChanges) > 0 {
+			h.add(history.nameChanges)
+		}
+		h.addBars(history.bars)
+	}
+
+	if benchmark != nil {
+		h.add("benchmark")
+		h.addBars(benchmark.history.bars)
+	}
+	if actions != nil {
+		h.add("corporate_actions", actions.actions)
+	}
+
+	dates := make([]string, 0, len(factors))
+	for date := range factors {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		// map 的JSON编码按键排序，结果与遍历顺序无关
+		h.add(date, factors[date])
+	}
+
+	return h.sum()
+}
+
+// runDataHashes 计算各部分结果数据的哈希及总哈希
+// 回测ID、记录ID和创建时间每次运行都不同，不参与计算
+func runDataHashes(data *backtestRunData) (map[string]string, string, error) {
+	results := make([]models.BacktestResult, len(data.Results))
+	for i, result := range data.Results {
+		result.ID, result.BacktestID, result.CreatedAt = "", "", time.Time{}
+		results[i] = result
+	}
+	trades := make([]models.Trade, len(data.Trades))
+	for i, trade := range data.Trades {
+		trade.ID, trade.BacktestID, trade.CreatedAt = "", "", time.Time{}
+		trades[i] = trade
+	}
+	rejected := make([]models.RejectedOrder, len(data.RejectedOrders))
+	for i, order := range data.RejectedOrders {
+		order.ID, order.BacktestID = "", ""
+		rejected[i] = order
+	}
+
+	parts := map[string]interface{}{
+		resultPartResults:              results,
+		resultPartTrades:               trades,
+		resultPartRejectedOrders:       rejected,
+		resultPartRoundTrips:           data.RoundTrips,
+		resultPartEquityCurve:          data.EquityCurve,
+		resultPartStrategyEquityCurves: data.StrategyEquityCurves,
+	}
+
+	hashes := make(map[string]string, len(parts))
+	total := newContentHasher()
+	for _, part := range resultParts {
+		h := newContentHasher()
+		h.add(parts[part])
+		sum, err := h.sum()
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", part, err)
+		}
+		hashes[part] = sum
+		total.add(part, sum)
+	}
+
+	sum, err := total.sum()
+	if err != nil {
+		return nil, "", err
+	}
+	return hashes, sum, nil
+}
+
+// engineOptions 提取回测中决定模拟过程的参数
+func engineOptions(backtest *models.Backtest) models.BacktestEngineOptions {
+	return models.BacktestEngineOptions{
+		Symbols:             backtest.Symbols,
+		StartDate:           backtest.StartDate,
+		EndDate:             backtest.EndDate,
+		InitialCash:         backtest.InitialCash,
+		Commission:          backtest.Commission,
+		Slippage:            backtest.Slippage,
+		Benchmark:           backtest.Benchmark,
+		DisableTradingRules: backtest.DisableTradingRules,
+		CostConfig:          backtest.CostConfig,
+		PositionSizing:      backtest.PositionSizing,
+		ExitRules:           backtest.ExitRules,
+		Execution:           backtest.Execution,
+		Portfolio:           backtest.Portfolio,
+		Universe:            backtest.Universe,
+		PriceAdjust:         backtest.PriceAdjust,
+	}
+}
+
+// copyStrategy 按JSON深拷贝策略定义
+func copyStrategy(strategy *models.Strategy) (models.Strategy, error) {
+	var definition models.Strategy
+	raw, err := json.Marshal(strategy)
+	if err != nil {
+		return definition, fmt.Errorf("序列化策略 %s 失败: %w", strategy.ID, err)
+	}
+	if err := json.Unmarshal(raw, &definition); err != nil {
+		return definition, fmt.Errorf("复制策略 %s 失败: %w", strategy.ID, err)
+	}
+	return definition, nil
+}
+
+// newRunManifest 生成回测运行清单，策略和子策略定义按JSON深拷贝，之后修改策略不影响清单
+// 机器学习模型训练后不再修改，重新训练会替换为新的模型，清单直接引用回测使用的模型
+func (s *BacktestService) newRunManifest(backtest *models.Backtest, strategies []*models.Strategy, children map[string]*models.Strategy, mlModels map[string]*models.MLModel, dataHash string, data *backtestRunData) (*models.BacktestManifest, error) {
+	manifest := &models.BacktestManifest{
+		BacktestID:  backtest.ID,
+		Strategies:  make([]models.Strategy, 0, len(strategies)),
+		CodeVersion: codeVersion(),
+		DataHash:    dataHash,
+		// 模拟过程是确定性的，目前没有随机成分，种子固定为0
+		Seed:      0,
+		Engine:    engineOptions(backtest),
+		CreatedAt: time.Now(),
+	}
+
+	for _, strategy := range strategies {
+		definition, err := copyStrategy(strategy)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Strategies = append(manifest.Strategies, definition)
+	}
+
+	// 子策略按ID排序，清单内容与 map 的遍历顺序无关
+	childIDs := make([]string, 0, len(children))
+	for id := range children {
+		childIDs = append(childIDs, id)
+	}
+	sort.Strings(childIDs)
+	for _, id := range childIDs {
+		definition, err := copyStrategy(children[id])
+		if err != nil {
+			return nil, err
+		}
+		manifest.ChildStrategies = append(manifest.ChildStrategies, definition)
+	}
+
+	modelIDs := make([]string, 0, len(mlModels))
+	for id := range mlModels {
+		modelIDs = append(modelIDs, id)
+	}
+	sort.Strings(modelIDs)
+	for _, id := range modelIDs {
+		manifest.MLModels = append(manifest.MLModels, *mlModels[id])
+	}
+
+	sourceType, baseURL, err := s.dataSourceService.CurrentSource()
+	if err != nil {
+		return nil, err
+	}
+	manifest.DataSourceType, manifest.DataSourceBaseURL = sourceType, baseURL
+
+	manifest.ResultHashes, manifest.ResultHash, err = runDataHashes(data)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// GetBacktestManifest 获取已完成回测的运行清单
+func (s *BacktestService) GetBacktestManifest(ctx context.Context, backtestID string) (*models.BacktestManifest, error) {
+	if err := s.ensureRunDataLoaded(backtestID); err != nil {
+		s.logger.Error("从数据库加载回测结果失败",
+			logger.String("backtest_id", backtestID),
+			logger.ErrorField(err),
+		)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	backtest, exists := s.backtests[backtestID]
+	if !exists {
+		return nil, ErrBacktestNotFound
+	}
+	if backtest.Status != models.BacktestStatusCompleted {
+		return nil, ErrBacktestNotCompleted
+	}
+	manifest, ok := s.backtestManifests[backtestID]
+	if !ok || manifest == nil {
+		return nil, ErrBacktestManifestNotFound
+	}
+	return manifest, nil
+}
+
+// StartReplay 在后台按运行清单重新运行回测，立即返回任务状态，通过 GetReplay 查询对比报告
+// 重新运行与原回测一样耗时，不能在HTTP请求中同步执行；超时时间与原回测相同，同一回测同时只能有一个重新运行任务
+func (s *BacktestService) StartReplay(ctx context.Context, backtestID string) (*models.BacktestReplayTask, error) {
+	original, err := s.GetBacktestManifest(ctx, backtestID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	if task, exists := s.replays[backtestID]; exists && task.Status == models.BacktestStatusRunning {
+		s.mutex.Unlock()
+		return nil, ErrReplayRunning
+	}
+	task := &models.BacktestReplayTask{
+		BacktestID: backtestID,
+		Status:     models.BacktestStatusRunning,
+		StartedAt:  time.Now(),
+	}
+	s.replays[backtestID] = task
+	snapshot := *task
+	s.mutex.Unlock()
+
+	timeout := backtestTimeout(&models.Backtest{StartDate: original.Engine.StartDate, EndDate: original.Engine.EndDate}, len(original.Strategies))
+	go s.runReplayTask(task, timeout)
+	return &snapshot, nil
+}
+
+// runReplayTask 执行重新运行任务并记录结果，panic时任务标记为失败
+func (s *BacktestService) runReplayTask(task *models.BacktestReplayTask, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		report *models.BacktestReplayReport
+		err    error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Error("重新运行回测出现panic",
+					logger.String("backtest_id", task.BacktestID),
+					logger.Any("panic", r),
+				)
+				err = fmt.Errorf("重新运行回测异常: %v", r)
+			}
+		}()
+		report, err = s.ReplayBacktest(ctx, task.BacktestID)
+	}()
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("重新运行回测超时（%v）", timeout)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	task.CompletedAt = &now
+	if err != nil {
+		s.logger.Error("重新运行回测失败",
+			logger.String("backtest_id", task.BacktestID),
+			logger.ErrorField(err),
+		)
+		task.Status = models.BacktestStatusFailed
+		task.Error = err.Error()
+		return
+	}
+	task.Status = models.BacktestStatusCompleted
+	task.Report = report
+}
+
+// GetReplay 获取回测最近一次重新运行的任务状态，完成后包含对比报告
+func (s *BacktestService) GetReplay(ctx context.Context, backtestID string) (*models.BacktestReplayTask, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.backtests[backtestID]; !exists {
+		return nil, ErrBacktestNotFound
+	}
+	task, exists := s.replays[backtestID]
+	if !exists {
+		return nil, ErrReplayNotFound
+	}
+	snapshot := *task
+	return &snapshot, nil
+}
+
+// ReplayBacktest 按运行清单中的策略定义（包括复合策略的子策略）、机器学习模型和引擎选项重新运行回测，对比结果是否与原结果逐位一致
+// 重新运行的结果不保存，也不改变原回测；结果不一致时可根据数据哈希和代码版本判断原因。同步执行，ctx 取消或超时时返回错误
+func (s *BacktestService) ReplayBacktest(ctx context.Context, backtestID string) (*models.BacktestReplayReport, error) {
+	original, err := s.GetBacktestManifest(ctx, backtestID)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := original.Engine
+	backtest := &models.Backtest{
+		ID:                  original.BacktestID,
+		Symbols:             engine.Symbols,
+		StartDate:           engine.StartDate,
+		EndDate:             engine.EndDate,
+		InitialCash:         engine.InitialCash,
+		Commission:          engine.Commission,
+		Slippage:            engine.Slippage,
+		Benchmark:           engine.Benchmark,
+		DisableTradingRules: engine.DisableTradingRules,
+		CostConfig:          engine.CostConfig,
+		PositionSizing:      engine.PositionSizing,
+		ExitRules:           engine.ExitRules,
+		Execution:           engine.Execution,
+		Portfolio:           engine.Portfolio,
+		Universe:            engine.Universe,
+		PriceAdjust:         engine.PriceAdjust,
+	}
+	strategies := make([]*models.Strategy, len(original.Strategies))
+	for i := range original.Strategies {
+		strategy := original.Strategies[i]
+		strategies[i] = &strategy
+		backtest.StrategyIDs = append(backtest.StrategyIDs, strategy.ID)
+	}
+	children := make(map[string]*models.Strategy, len(original.ChildStrategies))
+	for i := range original.ChildStrategies {
+		child := original.ChildStrategies[i]
+		children[child.ID] = &child
+	}
+	ctx = withCompositeChildren(ctx, children)
+	mlModels := make(map[string]*models.MLModel, len(original.MLModels))
+	for i := range original.MLModels {
+		model := original.MLModels[i]
+		mlModels[model.StrategyID] = &model
+	}
+	ctx = withMLModels(ctx, mlModels)
+
+	s.logger.Info("按运行清单重新运行回测",
+		logger.String("backtest_id", backtestID),
+		logger.String("code_version", original.CodeVersion),
+		logger.String("data_hash", original.DataHash),
+	)
+
+	runData, err := s.simulateBacktest(ctx, backtest, strategies, nil)
+	if err != nil {
+		return nil, fmt.Errorf("重新运行回测失败: %w", err)
+	}
+	if runData.Manifest == nil {
+		return nil, errors.New("重新运行回测未能生成运行清单")
+	}
+
+	replay := runData.Manifest
+	report := &models.BacktestReplayReport{
+		BacktestID:       backtestID,
+		Match:            replay.ResultHash == original.ResultHash,
+		CodeVersionMatch: replay.CodeVersion == original.CodeVersion,
+		DataSourceMatch:  replay.DataSourceType == original.DataSourceType && replay.DataSourceBaseURL == original.DataSourceBaseURL,
+		DataHashMatch:    replay.DataHash == original.DataHash,
+		Original:         original,
+		Replay:           replay,
+		ReplayedAt:       time.Now(),
+	}
+	for _, part := range resultParts {
+		if replay.ResultHashes[part] != original.ResultHashes[part] {
+			report.Mismatches = append(report.Mismatches, part)
+		}
+	}
+
+	s.logger.Info("回测重新运行完成",
+		logger.String("backtest_id", backtestID),
+		logger.Bool("match", report.Match),
+		logger.Bool("data_hash_match", report.DataHashMatch),
+		logger.Bool("code_version_match", report.CodeVersionMatch),
+	)
+	return report, nil
+}
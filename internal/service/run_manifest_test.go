@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+func TestReplayBacktest(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	dataClient := &perSymbolDataClient{MockDataSourceClient: client.NewMockDataSourceClient(), bars: make(map[string][]models.StockDaily)}
+	var symbols []string
+	for i := 0; i < 6; i++ {
+		symbol := fmt.Sprintf("%06d.SZ", i+1)
+		symbols = append(symbols, symbol)
+		dataClient.bars[symbol] = buildTestDailyBars(symbol, start, trendingCloses(140, 6+i, 0.013+0.003*float64(i)))
+	}
+	service := NewBacktestService(newTestStrategyService(t), &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	strategies := []*models.Strategy{
+		{ID: "ma_crossover", Parameters: map[string]interface{}{"short_period": 3.0, "long_period": 10.0}},
+		{ID: "macd_strategy", Parameters: map[string]interface{}{"fast_period": 6.0, "slow_period": 13.0, "signal_period": 5.0}},
+	}
+	backtest := &models.Backtest{
+		ID:             "bt-replay",
+		StrategyIDs:    []string{"ma_crossover", "macd_strategy"},
+		Symbols:        symbols,
+		StartDate:      time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC),
+		EndDate:        time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash:    1000000,
+		Portfolio:      &models.PortfolioConfig{Mode: models.PortfolioModeShared},
+		PositionSizing: &models.PositionSizingConfig{Method: models.PositionSizingFixedFraction, Fraction: 0.15},
+	}
+
+	runData, err := service.simulateBacktest(ctx, backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	manifest := runData.Manifest
+	if manifest == nil || manifest.DataHash == "" || manifest.ResultHash == "" || len(manifest.ResultHashes) != len(resultParts) {
+		t.Fatalf("应生成完整的运行清单: %+v", manifest)
+	}
+	if len(manifest.Strategies) != 2 || manifest.Engine.Portfolio == nil || len(manifest.Engine.Symbols) != len(symbols) {
+		t.Errorf("运行清单应记录策略定义和引擎选项: %+v", manifest)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("测试数据应产生交易")
+	}
+
+	// 同样的输入多次运行，结果逐位一致（持仓市值求和与 map 的遍历顺序无关）
+	for i := 0; i < 5; i++ {
+		again, err := service.simulateBacktest(ctx, backtest, strategies, nil)
+		if err != nil {
+			t.Fatalf("回测失败: %v", err)
+		}
+		if again.Manifest.ResultHash != manifest.ResultHash || again.Manifest.DataHash != manifest.DataHash {
+			t.Fatalf("第%d次运行结果与首次不一致: %+v", i+2, again.Manifest.ResultHashes)
+		}
+	}
+
+	backtest.Status = models.BacktestStatusCompleted
+	service.backtests[backtest.ID] = backtest
+	service.backtestManifests[backtest.ID] = manifest
+
+	// 按清单中的策略定义在后台重新运行，之后修改策略参数不影响复现
+	strategies[0].Parameters["short_period"] = 5.0
+	if _, err := service.GetReplay(ctx, backtest.ID); !errors.Is(err, ErrReplayNotFound) {
+		t.Errorf("尚未重新运行时应返回 ErrReplayNotFound, 实际 %v", err)
+	}
+	task, err := service.StartReplay(ctx, backtest.ID)
+	if err != nil || task.Status != models.BacktestStatusRunning {
+		t.Fatalf("启动重新运行失败: %+v, err=%v", task, err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for task.Status == models.BacktestStatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if task, err = service.GetReplay(ctx, backtest.ID); err != nil {
+			t.Fatalf("查询重新运行任务失败: %v", err)
+		}
+	}
+	if task.Status != models.BacktestStatusCompleted || task.Report == nil || task.CompletedAt == nil {
+		t.Fatalf("重新运行任务应完成并包含对比报告: %+v", task)
+	}
+	report := task.Report
+	if !report.Match || len(report.Mismatches) != 0 || !report.DataHashMatch || !report.CodeVersionMatch || !report.DataSourceMatch {
+		t.Errorf("重新运行结果应与原结果一致: %+v", report)
+	}
+
+	// 行情数据变化后结果不一致，数据哈希指出原因
+	for _, symbol := range symbols {
+		bars := dataClient.bars[symbol]
+		closes := make([]float64, len(bars))
+		for i, bar := range bars {
+			closes[i] = bar.Close.InexactFloat64() * 1.01
+		}
+		dataClient.bars[symbol] = buildTestDailyBars(symbol, start, closes)
+	}
+	service.dailyCacheService = NewDailyCacheService(nil)
+	report, err = service.ReplayBacktest(ctx, backtest.ID)
+	if err != nil {
+		t.Fatalf("重新运行失败: %v", err)
+	}
+	if report.Match || report.DataHashMatch || len(report.Mismatches) == 0 {
+		t.Errorf("行情变化后应报告结果和数据不一致: %+v", report)
+	}
+
+	delete(service.backtestManifests, backtest.ID)
+	if _, err := service.ReplayBacktest(ctx, backtest.ID); !errors.Is(err, ErrBacktestManifestNotFound) {
+		t.Errorf("没有运行清单时应返回 ErrBacktestManifestNotFound, 实际 %v", err)
+	}
+}
+
+func TestReplayBacktest_CompositeChildren(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, trendingCloses(140, 8, 0.02)),
+		},
+	}
+	strategyService := newTestStrategyService(t)
+	createConstantRuleStrategies(t, strategyService)
+	inner := &models.Strategy{ID: "inner", Name: "内层", Type: models.StrategyTypeComposite,
+		Parameters: map[string]interface{}{"mode": "or", "strategies": []interface{}{"always-buy", "never"}}}
+	outer := &models.Strategy{ID: "outer", Name: "外层", Type: models.StrategyTypeComposite,
+		Parameters: map[string]interface{}{"mode": "and", "strategies": []interface{}{"inner", "always-buy"}}}
+	for _, strategy := range []*models.Strategy{inner, outer} {
+		if err := strategyService.CreateStrategy(ctx, strategy); err != nil {
+			t.Fatalf("创建复合策略失败: %v", err)
+		}
+	}
+	service := NewBacktestService(strategyService, &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+
+	backtest := &models.Backtest{
+		ID:          "bt-composite-replay",
+		StrategyIDs: []string{"outer"},
+		Symbols:     []string{"000001.SZ"},
+		StartDate:   time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+	}
+	strategy, _ := strategyService.GetStrategy(ctx, "outer")
+	runData, err := service.simulateBacktest(ctx, backtest, []*models.Strategy{strategy}, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("测试数据应产生交易")
+	}
+
+	// 清单递归记录子策略定义，包括内层复合策略引用的子策略
+	var childIDs []string
+	for _, child := range runData.Manifest.ChildStrategies {
+		childIDs = append(childIDs, child.ID)
+	}
+	if !reflect.DeepEqual(childIDs, []string{"always-buy", "inner", "never"}) {
+		t.Fatalf("运行清单应按ID记录全部子策略: %v", childIDs)
+	}
+
+	backtest.Status = models.BacktestStatusCompleted
+	service.backtests[backtest.ID] = backtest
+	service.backtestManifests[backtest.ID] = runData.Manifest
+
+	// 修改子策略后重新运行仍使用清单中的子策略定义
+	code := "ENTRY: CLOSE < 0"
+	if err := strategyService.UpdateStrategy(ctx, "always-buy", &models.UpdateStrategyRequest{Code: &code}); err != nil {
+		t.Fatalf("更新子策略失败: %v", err)
+	}
+	live, err := service.simulateBacktest(ctx, backtest, []*models.Strategy{strategy}, nil)
+	if err != nil || len(live.Trades) != 0 {
+		t.Fatalf("按当前子策略定义运行不应产生交易: %d, %v", len(live.Trades), err)
+	}
+	report, err := service.ReplayBacktest(ctx, backtest.ID)
+	if err != nil {
+		t.Fatalf("重新运行失败: %v", err)
+	}
+	if !report.Match {
+		t.Errorf("按清单中的子策略定义重新运行应与原结果一致: %+v", report.Mismatches)
+	}
+}
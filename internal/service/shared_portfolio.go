@@ -0,0 +1,253 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidPortfolioConfig = errors.New("资金模式参数无效")
+
+// ValidatePortfolioConfig 校验多策略资金模式参数，权重只能设置给参与回测的策略
+func ValidatePortfolioConfig(config *models.PortfolioConfig, strategyIDs []string) error {
+	if config == nil {
+		return nil
+	}
+
+	switch config.Mode {
+	case "", models.PortfolioModeIndependent, models.PortfolioModeShared:
+	default:
+		return fmt.Errorf("%w: 不支持的资金模式 %q", ErrInvalidPortfolioConfig, config.Mode)
+	}
+	switch config.ConflictResolution {
+	case "", models.ConflictSellFirst, models.ConflictPriority, models.ConflictSkip:
+	default:
+		return fmt.Errorf("%w: 不支持的信号冲突处理方式 %q", ErrInvalidPortfolioConfig, config.ConflictResolution)
+	}
+	if config.MaxGrossExposure < 0 || config.MaxGrossExposure > 1 {
+		return fmt.Errorf("%w: max_gross_exposure 必须在0-1之间", ErrInvalidPortfolioConfig)
+	}
+
+	known := make(map[string]bool, len(strategyIDs))
+	for _, id := range strategyIDs {
+		known[id] = true
+	}
+	var total float64
+	for id, weight := range config.Weights {
+		if !known[id] {
+			return fmt.Errorf("%w: 策略 %s 不在回测策略列表中", ErrInvalidPortfolioConfig, id)
+		}
+		if weight < 0 {
+			return fmt.Errorf("%w: 策略 %s 的权重不能为负数", ErrInvalidPortfolioConfig, id)
+		}
+		total += weight
+	}
+	if len(config.Weights) > 0 && total == 0 {
+		return fmt.Errorf("%w: 权重之和必须大于0", ErrInvalidPortfolioConfig)
+	}
+	return nil
+}
+
+// sharedPortfolioMode 回测是否使用共享资金模式
+func sharedPortfolioMode(backtest *models.Backtest) bool {
+	return backtest.Portfolio != nil && backtest.Portfolio.Mode == models.PortfolioModeShared
+}
+
+// strategyWeights 返回归一化后的策略资金权重，未设置权重时等权，设置了权重时未列出的策略权重为0
+func strategyWeights(config *models.PortfolioConfig, strategyIDs []string) map[string]float64 {
+	weights := make(map[string]float64, len(strategyIDs))
+	if config == nil || len(config.Weights) == 0 {
+		for _, id := range strategyIDs {
+			weights[id] = 1 / float64(len(strategyIDs))
+		}
+		return weights
+	}
+
+	var total float64
+	for _, id := range strategyIDs {
+		total += config.Weights[id]
+	}
+	for _, id := range strategyIDs {
+		weights[id] = config.Weights[id] / total
+	}
+	return weights
+}
+
+// sharedAccount 共享资金模式下的账户
+// 现金由所有策略共用；持仓按策略分账（sleeve）记录，以便卖出信号只卖出本策略买入的股票并统计各策略的表现。
+// 分账组合的 Cash 平时记录归属该策略的现金（初始分配资金加上该策略的买卖现金流），
+// 策略下单前通过 acquire 换成账户可用现金，下单后通过 release 把现金变动同时记入账户和分账。
+type sharedAccount struct {
+	cash             float64
+	sleeves          map[string]*models.Portfolio
+	sleeveIDs        []string // 按ID排序的分账，持仓市值按固定顺序累加
+	weights          map[string]float64
+	maxGrossExposure float64
+	ledger           map[string]float64 // acquire 期间暂存的分账现金
+}
+
+// newSharedAccount 创建共享账户，按权重把初始资金记入各策略分账
+func newSharedAccount(initialCash float64, weights map[string]float64, maxGrossExposure float64) *sharedAccount {
+	account := &sharedAccount{
+		cash:             initialCash,
+		sleeves:          make(map[string]*models.Portfolio, len(weights)),
+		weights:          weights,
+		maxGrossExposure: maxGrossExposure,
+		ledger:           make(map[string]float64, len(weights)),
+	}
+	for id, weight := range weights {
+		account.sleeves[id] = &models.Portfolio{
+			Cash:       initialCash * weight,
+			Positions:  make(map[string]models.Position),
+			TotalValue: initialCash * weight,
+		}
+		account.sleeveIDs = append(account.sleeveIDs, id)
+	}
+	sort.Strings(account.sleeveIDs)
+	return account
+}
+
+// acquire 将账户可用现金交给策略分账用于下单，之后必须调用 release；账户为nil（独立模式）时不做处理
+func (a *sharedAccount) acquire(strategyID string) {
+	if a == nil {
+		return
+	}
+	sleeve := a.sleeves[strategyID]
+	a.ledger[strategyID] = sleeve.Cash
+	sleeve.Cash = a.cash
+}
+
+// release 结算 acquire 之后的现金变动
+func (a *sharedAccount) release(strategyID string) {
+	if a == nil {
+		return
+	}
+	sleeve := a.sleeves[strategyID]
+	delta := sleeve.Cash - a.cash
+	a.cash = sleeve.Cash
+	sleeve.Cash = a.ledger[strategyID] + delta
+	sleeve.TotalValue = sleeve.Cash + positionsValue(sleeve)
+}
+
+// holdingsValue 账户全部持仓市值
+func (a *sharedAccount) holdingsValue() float64 {
+	var total float64
+	for _, id := range a.sleeveIDs {
+		total += positionsValue(a.sleeves[id])
+	}
+	return total
+}
+
+// totalValue 账户总资产
+func (a *sharedAccount) totalValue() float64 {
+	return a.cash + a.holdingsValue()
+}
+
+// buyingPower 策略本次最多可投入的金额：不超过账户现金、策略分配资金的剩余额度和账户总敞口上限的剩余额度
+func (a *sharedAccount) buyingPower(strategyID string, cash float64) float64 {
+	total := a.totalValue()
+	power := math.Min(cash, total*a.weights[strategyID]-positionsValue(a.sleeves[strategyID]))
+	if a.maxGrossExposure > 0 {
+		power = math.Min(power, total*a.maxGrossExposure-a.holdingsValue())
+	}
+	return math.Max(power, 0)
+}
+
+// positionsValue 组合的持仓市值
+func positionsValue(portfolio *models.Portfolio) float64 {
+	var total float64
+	for _, symbol := range positionSymbols(portfolio) {
+		total += portfolio.Positions[symbol].MarketValue
+	}
+	return total
+}
+
+// positionSymbols 返回按代码排序的持仓股票
+// 浮点数累加的结果与顺序有关，按 map 的随机遍历顺序求和会使同样的回测每次运行的结果在末位上不同
+func positionSymbols(portfolio *models.Portfolio) []string {
+	symbols := make([]string, 0, len(portfolio.Positions))
+	for symbol := range portfolio.Positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// allocationSizer 共享资金模式下的仓位计算器：把策略的分配资金视为独立组合交给原计算器，
+// 再用账户现金和总敞口上限约束下单金额
+type allocationSizer struct {
+	PositionSizer
+	account    *sharedAccount
+	strategyID string
+}
+
+func (s *allocationSizer) TargetAmount(input *SizingInput) float64 {
+	available := s.account.buyingPower(s.strategyID, input.Cash)
+	if available <= 0 {
+		return 0
+	}
+	sleeveInput := *input
+	sleeveInput.Cash = available
+	sleeveInput.TotalValue = s.account.totalValue() * s.account.weights[s.strategyID]
+	return math.Min(s.PositionSizer.TargetAmount(&sleeveInput), available)
+}
+
+// ObserveTrade 将成交转发给需要历史成交的计算器
+func (s *allocationSizer) ObserveTrade(trade *models.Trade) {
+	if observer, ok := s.PositionSizer.(tradeObserver); ok {
+		observer.ObserveTrade(trade)
+	}
+}
+
+// resolveSignalConflicts 处理同一交易日不同策略对同一股票的相反信号，被放弃的信号置为nil
+// strategies 的顺序即策略优先级（权重相同时）
+func resolveSignalConflicts(config *models.PortfolioConfig, weights map[string]float64, strategies []*models.Strategy, signals map[string]*models.Signal) {
+	var buyers, sellers []string
+	for _, strategy := range strategies {
+		signal := signals[strategy.ID]
+		if signal == nil {
+			continue
+		}
+		switch signal.SignalType {
+		case models.SignalTypeBuy:
+			buyers = append(buyers, strategy.ID)
+		case models.SignalTypeSell:
+			sellers = append(sellers, strategy.ID)
+		}
+	}
+	if len(buyers) == 0 || len(sellers) == 0 {
+		return
+	}
+
+	drop := func(ids []string) {
+		for _, id := range ids {
+			signals[id] = nil
+		}
+	}
+
+	switch config.ConflictResolution {
+	case models.ConflictSkip:
+		drop(buyers)
+		drop(sellers)
+	case models.ConflictPriority:
+		winner := ""
+		for _, strategy := range strategies {
+			if signals[strategy.ID] == nil || signals[strategy.ID].SignalType == models.SignalTypeHold {
+				continue
+			}
+			if winner == "" || weights[strategy.ID] > weights[winner] {
+				winner = strategy.ID
+			}
+		}
+		if signals[winner].SignalType == models.SignalTypeBuy {
+			drop(sellers)
+		} else {
+			drop(buyers)
+		}
+	default:
+		drop(buyers)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+func TestValidatePortfolioConfig(t *testing.T) {
+	strategyIDs := []string{"s1", "s2"}
+	invalid := []*models.PortfolioConfig{
+		{Mode: "margin"},
+		{Mode: models.PortfolioModeShared, ConflictResolution: "random"},
+		{Mode: models.PortfolioModeShared, MaxGrossExposure: 1.5},
+		{Mode: models.PortfolioModeShared, Weights: map[string]float64{"s3": 1}},
+		{Mode: models.PortfolioModeShared, Weights: map[string]float64{"s1": -1, "s2": 2}},
+		{Mode: models.PortfolioModeShared, Weights: map[string]float64{"s1": 0}},
+	}
+	for _, config := range invalid {
+		if err := ValidatePortfolioConfig(config, strategyIDs); !errors.Is(err, ErrInvalidPortfolioConfig) {
+			t.Errorf("参数 %+v 应校验失败, 实际 %v", config, err)
+		}
+	}
+
+	valid := &models.PortfolioConfig{Mode: models.PortfolioModeShared, Weights: map[string]float64{"s1": 3, "s2": 1}, MaxGrossExposure: 0.8}
+	if err := ValidatePortfolioConfig(valid, strategyIDs); err != nil {
+		t.Errorf("合法参数校验失败: %v", err)
+	}
+}
+
+func TestStrategyWeights(t *testing.T) {
+	equal := strategyWeights(nil, []string{"s1", "s2", "s3", "s4"})
+	if equal["s1"] != 0.25 || equal["s4"] != 0.25 {
+		t.Errorf("未设置权重时应等权: %v", equal)
+	}
+
+	weighted := strategyWeights(&models.PortfolioConfig{Weights: map[string]float64{"s1": 3, "s2": 1}}, []string{"s1", "s2", "s3"})
+	if weighted["s1"] != 0.75 || weighted["s2"] != 0.25 || weighted["s3"] != 0 {
+		t.Errorf("权重应归一化, 未列出的策略为0: %v", weighted)
+	}
+}
+
+func TestResolveSignalConflicts(t *testing.T) {
+	strategies := []*models.Strategy{{ID: "s1"}, {ID: "s2"}, {ID: "s3"}}
+	weights := map[string]float64{"s1": 0.2, "s2": 0.5, "s3": 0.3}
+	newSignals := func() map[string]*models.Signal {
+		return map[string]*models.Signal{
+			"s1": {SignalType: models.SignalTypeBuy},
+			"s2": {SignalType: models.SignalTypeSell},
+			"s3": {SignalType: models.SignalTypeBuy},
+		}
+	}
+
+	tests := []struct {
+		resolution models.ConflictResolution
+		kept       map[string]bool
+	}{
+		{"", map[string]bool{"s2": true}},
+		{models.ConflictSellFirst, map[string]bool{"s2": true}},
+		{models.ConflictPriority, map[string]bool{"s2": true}},
+		{models.ConflictSkip, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		signals := newSignals()
+		resolveSignalConflicts(&models.PortfolioConfig{ConflictResolution: tt.resolution}, weights, strategies, signals)
+		for id, signal := range signals {
+			if (signal != nil) != tt.kept[id] {
+				t.Errorf("%q: 策略 %s 的信号保留状态错误", tt.resolution, id)
+			}
+		}
+	}
+
+	// 买入方权重更高时优先执行买入
+	signals := newSignals()
+	weights["s3"] = 0.6
+	resolveSignalConflicts(&models.PortfolioConfig{ConflictResolution: models.ConflictPriority}, weights, strategies, signals)
+	if signals["s1"] == nil || signals["s3"] == nil || signals["s2"] != nil {
+		t.Errorf("权重优先时应执行买入信号: %v", signals)
+	}
+
+	// 没有相反信号时不做处理
+	signals = map[string]*models.Signal{"s1": {SignalType: models.SignalTypeBuy}, "s2": {SignalType: models.SignalTypeHold}}
+	resolveSignalConflicts(&models.PortfolioConfig{ConflictResolution: models.ConflictSkip}, weights, strategies, signals)
+	if signals["s1"] == nil {
+		t.Error("没有冲突时不应放弃信号")
+	}
+}
+
+func TestAllocationSizer(t *testing.T) {
+	account := newSharedAccount(100000, map[string]float64{"s1": 0.6, "s2": 0.4}, 0.7)
+	account.sleeves["s1"].Positions["600000.SH"] = models.Position{Symbol: "600000.SH", Quantity: 3000, MarketValue: 30000}
+	account.cash = 70000
+
+	// s2：分配资金40000，账户总敞口上限70000-30000=40000
+	account.acquire("s2")
+	sizer := &allocationSizer{PositionSizer: &fixedAmountSizer{amount: 50000}, account: account, strategyID: "s2"}
+	if amount := sizer.TargetAmount(&SizingInput{Price: 10, Cash: account.sleeves["s2"].Cash}); amount != 40000 {
+		t.Errorf("下单金额应受策略分配资金约束为40000, 实际 %.2f", amount)
+	}
+	account.sleeves["s2"].Cash -= 20000
+	account.sleeves["s2"].Positions["000001.SZ"] = models.Position{Symbol: "000001.SZ", Quantity: 2000, MarketValue: 20000}
+	account.release("s2")
+	if account.cash != 50000 || account.sleeves["s2"].Cash != 20000 || account.sleeves["s2"].TotalValue != 40000 {
+		t.Errorf("现金结算错误: 账户 %.2f, 分账 %+v", account.cash, account.sleeves["s2"])
+	}
+
+	// s1：分配资金还剩60000-30000=30000，但账户总敞口只剩70000-50000=20000
+	account.acquire("s1")
+	sizer = &allocationSizer{PositionSizer: &fixedAmountSizer{amount: 50000}, account: account, strategyID: "s1"}
+	if amount := sizer.TargetAmount(&SizingInput{Price: 10, Cash: account.sleeves["s1"].Cash}); amount != 20000 {
+		t.Errorf("下单金额应受总敞口上限约束为20000, 实际 %.2f", amount)
+	}
+	account.release("s1")
+}
+
+func TestSimulateBacktest_SharedPortfolio(t *testing.T) {
+	bars := buildTestDailyBars("000001.SZ", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), trendingCloses(140, 15, 0.02))
+	backtestService := newSimulationTestService(t, bars)
+
+	strategies := []*models.Strategy{
+		{ID: "ma_crossover", Parameters: map[string]interface{}{"short_period": 3.0, "long_period": 10.0}},
+		{ID: "macd_strategy", Parameters: map[string]interface{}{"fast_period": 6.0, "slow_period": 13.0, "signal_period": 5.0}},
+	}
+	backtest := &models.Backtest{
+		ID:          "bt-shared",
+		StrategyIDs: []string{"ma_crossover", "macd_strategy"},
+		Symbols:     []string{"000001.SZ"},
+		StartDate:   time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 100000,
+		Portfolio: &models.PortfolioConfig{
+			Mode:             models.PortfolioModeShared,
+			Weights:          map[string]float64{"ma_crossover": 3, "macd_strategy": 1},
+			MaxGrossExposure: 0.5,
+		},
+		PositionSizing: &models.PositionSizingConfig{Method: models.PositionSizingFixedFraction, Fraction: 1},
+	}
+
+	runData, err := backtestService.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+	if len(runData.Trades) == 0 {
+		t.Fatal("测试数据应产生交易")
+	}
+
+	// 组合权益曲线是账户的实际资产，等于各策略分账之和
+	curves := runData.StrategyEquityCurves
+	for i, point := range runData.EquityCurve {
+		sum := curves["ma_crossover"][i].PortfolioValue + curves["macd_strategy"][i].PortfolioValue
+		if math.Abs(point.PortfolioValue-sum) > 1e-6 || math.Abs(point.PortfolioValue-point.Cash-point.Holdings) > 1e-6 {
+			t.Fatalf("%s 账户资产与分账之和不一致: %+v, 分账合计 %.2f", point.Date, point, sum)
+		}
+		if point.Cash < 0 {
+			t.Fatalf("%s 账户现金为负: %.2f", point.Date, point.Cash)
+		}
+	}
+
+	traded := make(map[string]bool)
+	for _, trade := range runData.Trades {
+		traded[trade.StrategyID] = true
+		if trade.Side == models.TradeSideBuy && trade.HoldingAssets > trade.TotalAssets*0.5+trade.Price*boardLotSize {
+			t.Errorf("买入后持仓 %.2f 超过总资产 %.2f 的50%%上限", trade.HoldingAssets, trade.TotalAssets)
+		}
+	}
+
+	if !traded["ma_crossover"] || !traded["macd_strategy"] {
+		t.Errorf("两个策略都应使用共享账户交易: %v", traded)
+	}
+
+	// 分账按权重分配初始资金
+	if first := curves["macd_strategy"][0]; math.Abs(first.Cash+first.Holdings-first.PortfolioValue) > 1e-6 || first.PortfolioValue > 25000*1.1 {
+		t.Errorf("权重为25%%的策略分账资金错误: %+v", first)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// benchmarkSimulation 在 symbols 只股票、years 年的区间上运行双均线策略回测，workers 为日循环的并行度
+func benchmarkSimulation(b *testing.B, symbols, years, workers int) {
+	start := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	warmup := start.AddDate(0, 0, -StrategyLookbackDays*3/2)
+	bars := buildTestDailyBars("bench", warmup, trendingCloses(years*262+StrategyLookbackDays*2, 8, 0.02))
+	service := newSimulationTestService(b, bars)
+	service.simulationWorkers = workers
+
+	backtest := &models.Backtest{
+		ID:          "bt-bench",
+		StrategyIDs: []string{"ma_crossover"},
+		StartDate:   start,
+		EndDate:     start.AddDate(years, 0, -1),
+		InitialCash: 10000000,
+	}
+	for i := 0; i < symbols; i++ {
+		backtest.Symbols = append(backtest.Symbols, fmt.Sprintf("%06d.SZ", i+1))
+	}
+	strategies := []*models.Strategy{{ID: "ma_crossover", Parameters: map[string]interface{}{"short_period": 5.0, "long_period": 20.0}}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := service.simulateBacktest(context.Background(), backtest, strategies, nil); err != nil {
+			b.Fatalf("回测失败: %v", err)
+		}
+	}
+}
+
+// BenchmarkSimulateBacktest_500Symbols5Years 500只股票、5年的回测，对比单个worker与按CPU核数并行准备行情和信号
+// 两者运行同一套代码，只衡量日循环并行的收益；行情来自内存中的模拟数据源，不反映数据加载的耗时
+// 运行: go test ./internal/service -run ^$ -bench SimulateBacktest -benchtime 1x
+func BenchmarkSimulateBacktest_500Symbols5Years(b *testing.B) {
+	workers := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		workers = append(workers, n)
+	}
+	for _, n := range workers {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			benchmarkSimulation(b, 500, 5, n)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+// symbolDay 单只股票在某个交易日的行情、撮合环境和各策略的信号
+type symbolDay struct {
+	symbol     string
+	marketData *models.MarketData
+	bar        *orderBar
+	signals    []*models.Signal // 与策略列表按下标对应，定期调仓策略、非评估日的基本面策略和执行失败时为空
+}
+
+// prepareSymbolDays 并行构造当日各股票的行情和撮合环境，并执行策略生成信号
+// 策略只依赖截至当日的历史K线，与组合状态无关，因此可以在撮合之前并发计算；
+// 返回结果与 symbols 顺序一致，当日之前没有任何K线的股票为空，撮合仍按股票顺序串行进行以保证结果确定；
+// 策略执行出现panic时返回错误，由回测按失败处理
+func (s *BacktestService) prepareSymbolDays(ctx context.Context, backtest *models.Backtest, strategies []*models.Strategy, rebalanceParams map[string]*models.RebalanceStrategyParams,
+	fundamentalDecisions map[string]map[string]*fundamentalDecision, symbols []string, histories map[string]*symbolHistory, day int, date time.Time, universeSize int) ([]*symbolDay, error) {
+	days := make([]*symbolDay, len(symbols))
+
+	err := parallelEach(len(symbols), s.simulationWorkers, func(i int) {
+		symbol := symbols[i]
+		history := histories[symbol]
+		latest, ok := history.latestAt(day, date)
+		if !ok {
+			s.logger.Debug("当日之前没有行情数据，跳过该股票",
+				logger.String("backtest_id", backtest.ID),
+				logger.String("symbol", symbol),
+				logger.String("date", date.Format("2006-01-02")),
+			)
+			return
+		}
+
+		marketData, _ := s.convertStockDailyToMarketData(latest, symbol, date, history.units)
+		end := history.endAt(day, date)
+		bar := history.orderBarEnding(marketData, end, date)
+		bar.history = history.windowEnding(end, StrategyLookbackDays)
+		bar.universeSize = universeSize
+
+		signals := make([]*models.Signal, len(strategies))
+		for j, strategy := range strategies {
+			if _, ok := rebalanceParams[strategy.ID]; ok {
+				continue
+			}
+			// 基本面策略使用评估日按截面计算的结论
+			if decisions, ok := fundamentalDecisions[strategy.ID]; ok {
+				if decision := decisions[symbol]; decision != nil {
+					signals[j] = decision.signal(strategy, marketData)
+				}
+				continue
+			}
+			signal, err := s.strategyService.ExecuteStrategyWith(ctx, strategy, marketData, bar.history)
+			if err != nil {
+				s.logger.Error("策略执行失败",
+					logger.String("backtest_id", backtest.ID),
+					logger.String("strategy_id", strategy.ID),
+					logger.String("symbol", symbol),
+					logger.String("date", date.Format("2006-01-02")),
+					logger.ErrorField(err),
+				)
+				continue
+			}
+			signals[j] = signal
+		}
+
+		days[i] = &symbolDay{symbol: symbol, marketData: marketData, bar: bar, signals: signals}
+	})
+	var panicked *panicError
+	if errors.As(err, &panicked) {
+		s.logger.Error("策略执行出现panic",
+			logger.String("backtest_id", backtest.ID),
+			logger.String("symbol", symbols[panicked.index]),
+			logger.String("date", date.Format("2006-01-02")),
+			logger.Any("panic", panicked.value),
+			logger.String("stack", string(panicked.stack)),
+		)
+		return nil, fmt.Errorf("股票 %s 在 %s %w", symbols[panicked.index], date.Format("2006-01-02"), err)
+	}
+	return days, nil
+}
+
+// panicError fn 执行时出现的panic，工作goroutine中的panic无法被回测任务的recover捕获，需要转换为错误返回
+type panicError struct {
+	index int         // 出现panic的下标
+	value interface{} // recover 得到的值
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("执行异常: %v", e.value)
+}
+
+// parallelEach 使用最多 workers 个goroutine对 [0, n) 的每个下标执行 fn，全部完成后返回
+// fn 出现panic时不再处理剩余下标，等待已开始的执行结束后返回第一个panic对应的 *panicError
+func parallelEach(n, workers int, fn func(i int)) error {
+	var (
+		once     sync.Once
+		panicked *panicError
+		stopped  atomic.Bool
+	)
+	call := func(i int) {
+		defer func() {
+			if r := recover(); r != nil {
+				once.Do(func() { panicked = &panicError{index: i, value: r, stack: debug.Stack()} })
+				stopped.Store(true)
+			}
+		}()
+		fn(i)
+	}
+
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n && !stopped.Load(); i++ {
+			call(i)
+		}
+	} else {
+		var next int64 = -1
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for !stopped.Load() {
+					i := int(atomic.AddInt64(&next, 1))
+					if i >= n {
+						return
+					}
+					call(i)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if panicked != nil {
+		return panicked
+	}
+	return nil
+}
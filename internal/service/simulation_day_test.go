@@ -0,0 +1,27 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallelEach(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		var sum int64
+		if err := parallelEach(100, workers, func(i int) { atomic.AddInt64(&sum, int64(i)) }); err != nil || sum != 4950 {
+			t.Errorf("workers=%d 应处理全部下标: sum=%d, err=%v", workers, sum, err)
+		}
+
+		// 工作goroutine中的panic转换为错误返回，不会导致进程崩溃
+		err := parallelEach(100, workers, func(i int) {
+			if i == 42 {
+				panic("策略异常")
+			}
+		})
+		var panicked *panicError
+		if !errors.As(err, &panicked) || panicked.index != 42 || panicked.value != "策略异常" || len(panicked.stack) == 0 {
+			t.Errorf("workers=%d 应返回第42项的panic: %v", workers, err)
+		}
+	}
+}
@@ -8,29 +8,43 @@ import (
 	"math/rand"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"stock-a-future/internal/indicators"
 	"stock-a-future/internal/logger"
 	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
 )
 
 var (
-	ErrStrategyNotFound = errors.New("策略不存在")
-	ErrStrategyExists   = errors.New("策略已存在")
+	ErrStrategyNotFound        = errors.New("策略不存在")
+	ErrStrategyExists          = errors.New("策略已存在")
+	ErrStrategyVersionNotFound = errors.New("策略版本不存在")
 )
 
 // StrategyService 策略服务
 type StrategyService struct {
-	// 在真实环境中，这里会有数据库连接
-	// 目前使用内存存储进行演示
+	// 策略定义和版本历史缓存在内存中，设置存储后每次修改同步写入SQLite
 	strategies map[string]*models.Strategy
+	versions   map[string][]models.StrategyVersion // 按版本号升序
+	store      *StrategyStore
+	mutex      sync.RWMutex
+	calculator *indicators.Calculator
 	logger     logger.Logger
+
+	rulePrograms sync.Map                   // 策略代码 -> *ruleProgram，规则策略的解析结果
+	mlModels     map[string]*models.MLModel // 策略ID -> 最近一次训练的机器学习模型
 }
 
 // NewStrategyService 创建策略服务
 func NewStrategyService(log logger.Logger) *StrategyService {
 	service := &StrategyService{
 		strategies: make(map[string]*models.Strategy),
+		versions:   make(map[string][]models.StrategyVersion),
+		mlModels:   make(map[string]*models.MLModel),
+		calculator: indicators.NewCalculator(),
 		logger:     log,
 	}
 
@@ -45,7 +59,9 @@ func (s *StrategyService) initDefaultStrategies() {
 	for _, strategy := range models.DefaultStrategies {
 		// 创建副本避免指针问题
 		strategyCopy := strategy
+		strategyCopy.Version = "1"
 		s.strategies[strategy.ID] = &strategyCopy
+		s.versions[strategy.ID] = []models.StrategyVersion{newStrategyVersion(&strategyCopy, "初始版本")}
 	}
 
 	s.logger.Info("默认策略初始化完成", logger.Int("count", len(models.DefaultStrategies)))
@@ -53,6 +69,9 @@ func (s *StrategyService) initDefaultStrategies() {
 
 // GetStrategiesList 获取策略列表
 func (s *StrategyService) GetStrategiesList(ctx context.Context, req *models.StrategyListRequest) ([]models.Strategy, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	var results []models.Strategy
 
 	// 过滤策略
@@ -112,6 +131,9 @@ func (s *StrategyService) matchesFilter(strategy *models.Strategy, req *models.S
 
 // GetStrategy 获取策略详情
 func (s *StrategyService) GetStrategy(ctx context.Context, strategyID string) (*models.Strategy, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	strategy, exists := s.strategies[strategyID]
 	if !exists {
 		return nil, ErrStrategyNotFound
@@ -122,8 +144,11 @@ func (s *StrategyService) GetStrategy(ctx context.Context, strategyID string) (*
 	return &strategyCopy, nil
 }
 
-// CreateStrategy 创建策略
+// CreateStrategy 创建策略，同时记录版本1
 func (s *StrategyService) CreateStrategy(ctx context.Context, strategy *models.Strategy) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	// 检查策略是否已存在
 	if _, exists := s.strategies[strategy.ID]; exists {
 		return ErrStrategyExists
@@ -147,7 +172,9 @@ func (s *StrategyService) CreateStrategy(ctx context.Context, strategy *models.S
 	}
 
 	// 保存策略
-	s.strategies[strategy.ID] = strategy
+	if err := s.commitStrategyVersion(strategy, "创建策略"); err != nil {
+		return err
+	}
 
 	s.logger.Info("策略创建成功",
 		logger.String("strategy_id", strategy.ID),
@@ -159,12 +186,20 @@ func (s *StrategyService) CreateStrategy(ctx context.Context, strategy *models.S
 }
 
 // UpdateStrategy 更新策略
+// 修改名称、描述、参数或代码时生成新版本；只修改状态时不生成版本
 func (s *StrategyService) UpdateStrategy(ctx context.Context, strategyID string, req *models.UpdateStrategyRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	strategy, exists := s.strategies[strategyID]
 	if !exists {
 		return ErrStrategyNotFound
 	}
 
+	// 在副本上修改，校验和保存都成功后才替换
+	updated := *strategy
+	var changed []string
+
 	// 更新字段
 	if req.Name != nil {
 		// 检查名称是否重复
@@ -173,67 +208,108 @@ func (s *StrategyService) UpdateStrategy(ctx context.Context, strategyID string,
 				return fmt.Errorf("策略名称已存在: %s", *req.Name)
 			}
 		}
-		strategy.Name = *req.Name
+		updated.Name = *req.Name
+		changed = append(changed, "名称")
 	}
 
 	if req.Description != nil {
-		strategy.Description = *req.Description
+		updated.Description = *req.Description
+		changed = append(changed, "描述")
 	}
 
 	if req.Status != nil {
-		strategy.Status = *req.Status
+		updated.Status = *req.Status
 	}
 
 	if req.Parameters != nil {
-		strategy.Parameters = *req.Parameters
-		// 验证更新后的参数
-		if err := s.validateStrategyParameters(strategy); err != nil {
-			return fmt.Errorf("策略参数验证失败: %w", err)
-		}
+		updated.Parameters = *req.Parameters
+		changed = append(changed, "参数")
 	}
 
 	if req.Code != nil {
-		strategy.Code = *req.Code
+		updated.Code = *req.Code
+		changed = append(changed, "代码")
+	}
+
+	// 验证更新后的参数，规则策略的代码引用参数，修改代码时也需要验证
+	if req.Parameters != nil || (req.Code != nil && isRuleStrategy(&updated)) {
+		if err := s.validateStrategyParameters(&updated); err != nil {
+			return fmt.Errorf("策略参数验证失败: %w", err)
+		}
 	}
 
 	// 更新时间戳
-	strategy.UpdatedAt = time.Now()
+	updated.UpdatedAt = time.Now()
+
+	if len(changed) == 0 {
+		if err := s.saveStrategy(&updated); err != nil {
+			return err
+		}
+	} else {
+		changelog := req.Changelog
+		if changelog == "" {
+			changelog = "修改" + strings.Join(changed, "、")
+		}
+		if err := s.commitStrategyVersion(&updated, changelog); err != nil {
+			return err
+		}
+	}
 
 	s.logger.Info("策略更新成功",
 		logger.String("strategy_id", strategyID),
-		logger.String("strategy_name", strategy.Name),
+		logger.String("strategy_name", updated.Name),
+		logger.String("version", updated.Version),
 	)
 
 	return nil
 }
 
-// DeleteStrategy 删除策略
+// DeleteStrategy 删除策略及其版本历史
 func (s *StrategyService) DeleteStrategy(ctx context.Context, strategyID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if _, exists := s.strategies[strategyID]; !exists {
 		return ErrStrategyNotFound
 	}
+	if referrers := s.compositeReferrers(strategyID); len(referrers) > 0 {
+		return fmt.Errorf("%w: %s", ErrStrategyInUse, strings.Join(referrers, ", "))
+	}
 
+	if s.store != nil {
+		if err := s.store.DeleteStrategy(strategyID); err != nil {
+			return err
+		}
+	}
 	delete(s.strategies, strategyID)
+	delete(s.versions, strategyID)
+	delete(s.mlModels, strategyID)
 
 	s.logger.Info("策略删除成功", logger.String("strategy_id", strategyID))
 
 	return nil
 }
 
-// UpdateStrategyStatus 更新策略状态
+// UpdateStrategyStatus 更新策略状态，状态不属于策略定义，不生成新版本
 func (s *StrategyService) UpdateStrategyStatus(ctx context.Context, strategyID string, status models.StrategyStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	strategy, exists := s.strategies[strategyID]
 	if !exists {
 		return ErrStrategyNotFound
 	}
 
-	oldStatus := strategy.Status
-	strategy.Status = status
-	strategy.UpdatedAt = time.Now()
+	updated := *strategy
+	updated.Status = status
+	updated.UpdatedAt = time.Now()
+	if err := s.saveStrategy(&updated); err != nil {
+		return err
+	}
 
 	s.logger.Info("策略状态更新成功",
 		logger.String("strategy_id", strategyID),
-		logger.String("old_status", string(oldStatus)),
+		logger.String("old_status", string(strategy.Status)),
 		logger.String("new_status", string(status)),
 	)
 
@@ -242,9 +318,9 @@ func (s *StrategyService) UpdateStrategyStatus(ctx context.Context, strategyID s
 
 // GetStrategyPerformance 获取策略表现
 func (s *StrategyService) GetStrategyPerformance(ctx context.Context, strategyID string) (*models.StrategyPerformance, error) {
-	strategy, exists := s.strategies[strategyID]
-	if !exists {
-		return nil, ErrStrategyNotFound
+	strategy, err := s.GetStrategy(ctx, strategyID)
+	if err != nil {
+		return nil, err
 	}
 
 	// 生成模拟性能数据
@@ -296,6 +372,19 @@ func (s *StrategyService) generateMockPerformance(strategy *models.Strategy) *mo
 
 // validateStrategyParameters 验证策略参数
 func (s *StrategyService) validateStrategyParameters(strategy *models.Strategy) error {
+	if isRuleStrategy(strategy) {
+		return s.ValidateRules(strategy.Code, strategy.Parameters)
+	}
+	// 复合策略必须引用子策略，基本面策略必须设置筛选条件，都不能省略参数；机器学习策略省略参数时校验默认值
+	switch strategy.Type {
+	case models.StrategyTypeComposite:
+		return s.validateCompositeStrategyParameters(strategy)
+	case models.StrategyTypeFundamental:
+		return s.validateFundamentalStrategyParameters(strategy)
+	case models.StrategyTypeML:
+		return s.validateMLStrategyParameters(strategy)
+	}
+
 	if strategy.Parameters == nil {
 		return nil
 	}
@@ -303,12 +392,9 @@ func (s *StrategyService) validateStrategyParameters(strategy *models.Strategy)
 	switch strategy.Type {
 	case models.StrategyTypeTechnical:
 		return s.validateTechnicalStrategyParameters(strategy)
-	case models.StrategyTypeFundamental:
-		return s.validateFundamentalStrategyParameters(strategy)
-	case models.StrategyTypeML:
-		return s.validateMLStrategyParameters(strategy)
-	case models.StrategyTypeComposite:
-		return s.validateCompositeStrategyParameters(strategy)
+	case models.StrategyTypeRebalance:
+		_, err := ParseRebalanceParams(strategy.Parameters)
+		return err
 	}
 
 	return nil
@@ -435,23 +521,14 @@ func (s *StrategyService) validateBollingerParameters(params map[string]interfac
 
 // validateFundamentalStrategyParameters 验证基本面策略参数
 func (s *StrategyService) validateFundamentalStrategyParameters(strategy *models.Strategy) error {
-	// 基本面策略参数验证
-	// 这里可以添加具体的基本面指标验证逻辑
-	return nil
+	_, err := ParseFundamentalParams(strategy.Parameters)
+	return err
 }
 
 // validateMLStrategyParameters 验证机器学习策略参数
 func (s *StrategyService) validateMLStrategyParameters(strategy *models.Strategy) error {
-	// 机器学习策略参数验证
-	// 这里可以添加具体的ML模型参数验证逻辑
-	return nil
-}
-
-// validateCompositeStrategyParameters 验证复合策略参数
-func (s *StrategyService) validateCompositeStrategyParameters(strategy *models.Strategy) error {
-	// 复合策略参数验证
-	// 这里可以添加具体的复合策略参数验证逻辑
-	return nil
+	_, err := ParseMLParams(strategy.Parameters)
+	return err
 }
 
 // GetStrategyTemplates 获取策略模板列表
@@ -515,6 +592,23 @@ func (s *StrategyService) GetStrategyTemplates() []models.StrategyTemplate {
 			Tags:      []string{"布林带", "均值回归", "波动率"},
 			CreatedAt: time.Now(),
 		},
+		{
+			ID:          "monthly_momentum_template",
+			Name:        "月度动量轮动策略模板",
+			Description: "每月第一个交易日选出过去20日涨幅最高的5只股票等权持有",
+			Type:        models.StrategyTypeRebalance,
+			Parameters: map[string]interface{}{
+				"frequency":    string(models.RebalanceMonthly),
+				"top_n":        defaultRebalanceTopN,
+				"score":        "momentum",
+				"lookback":     defaultRebalanceLookback,
+				"weighting":    string(models.RebalanceWeightEqual),
+				"max_turnover": 0.0,
+			},
+			Category:  "定期调仓",
+			Tags:      []string{"轮动", "动量", "等权"},
+			CreatedAt: time.Now(),
+		},
 	}
 }
 
@@ -532,6 +626,13 @@ func (s *StrategyService) ValidateParameters(strategyType models.StrategyType, p
 		errors = s.validateMLParams(parameters)
 	case models.StrategyTypeComposite:
 		errors = s.validateCompositeParams(parameters)
+	case models.StrategyTypeRebalance:
+		if _, err := ParseRebalanceParams(parameters); err != nil {
+			errors = append(errors, map[string]string{
+				"field":   "parameters",
+				"message": err.Error(),
+			})
+		}
 	}
 
 	return errors
@@ -656,21 +757,24 @@ func (s *StrategyService) validateTechnicalParams(parameters map[string]interfac
 // validateFundamentalParams 验证基本面策略参数
 func (s *StrategyService) validateFundamentalParams(parameters map[string]interface{}) []map[string]string {
 	var errors []map[string]string
-	// TODO: 实现基本面参数验证
+	if _, err := ParseFundamentalParams(parameters); err != nil {
+		errors = append(errors, map[string]string{
+			"field":   "parameters",
+			"message": err.Error(),
+		})
+	}
 	return errors
 }
 
 // validateMLParams 验证机器学习策略参数
 func (s *StrategyService) validateMLParams(parameters map[string]interface{}) []map[string]string {
 	var errors []map[string]string
-	// TODO: 实现机器学习参数验证
-	return errors
-}
-
-// validateCompositeParams 验证复合策略参数
-func (s *StrategyService) validateCompositeParams(parameters map[string]interface{}) []map[string]string {
-	var errors []map[string]string
-	// TODO: 实现复合策略参数验证
+	if _, err := ParseMLParams(parameters); err != nil {
+		errors = append(errors, map[string]string{
+			"field":   "parameters",
+			"message": err.Error(),
+		})
+	}
 	return errors
 }
 
@@ -717,43 +821,282 @@ func (s *StrategyService) GetStrategyTypeDefinitions() []models.StrategyTypeDefi
 		{
 			Type:        models.StrategyTypeFundamental,
 			Name:        "基本面策略",
-			Description: "基于公司基本面数据的投资策略",
-			Parameters:  []models.ParameterDefinition{},
+			Description: "按基本面因子得分在股票池中的分位数和估值上限定期评估买卖",
+			Parameters: []models.ParameterDefinition{
+				{
+					Name:         "frequency",
+					DisplayName:  "评估频率",
+					Type:         "select",
+					DefaultValue: string(models.RebalanceMonthly),
+					Options:      []string{string(models.RebalanceWeekly), string(models.RebalanceMonthly), string(models.RebalanceQuarterly)},
+					Required:     true,
+					Description:  "在每周、每月或每季度的第一个交易日重新评估，其余交易日不产生信号",
+				},
+				{
+					Name:         "score",
+					DisplayName:  "打分因子",
+					Type:         "select",
+					DefaultValue: "composite",
+					Options:      []string{"value", "growth", "quality", "profitability", "composite"},
+					Required:     false,
+					Description:  "按该因子得分在当日股票池中的分位数决定买卖，为空时只按估值上限筛选",
+				},
+				{
+					Name:         "buy_percentile",
+					DisplayName:  "买入分位数",
+					Type:         "float",
+					DefaultValue: defaultFundamentalBuyPercentile,
+					MinValue:     0,
+					MaxValue:     100,
+					Required:     false,
+					Description:  "得分分位数不低于该值时买入",
+				},
+				{
+					Name:         "sell_percentile",
+					DisplayName:  "卖出分位数",
+					Type:         "float",
+					DefaultValue: defaultFundamentalSellPercentile,
+					MinValue:     0,
+					MaxValue:     100,
+					Required:     false,
+					Description:  "得分分位数低于该值时卖出",
+				},
+				{
+					Name:         "max_pe",
+					DisplayName:  "市盈率上限",
+					Type:         "float",
+					DefaultValue: 0,
+					MinValue:     0,
+					Required:     false,
+					Description:  "PE超过上限或亏损时卖出且不买入，0表示不限制",
+				},
+				{
+					Name:         "max_pb",
+					DisplayName:  "市净率上限",
+					Type:         "float",
+					DefaultValue: 0,
+					MinValue:     0,
+					Required:     false,
+					Description:  "PB超过上限时卖出且不买入，0表示不限制",
+				},
+			},
 		},
 		{
 			Type:        models.StrategyTypeML,
 			Name:        "机器学习策略",
-			Description: "基于机器学习模型的预测策略",
-			Parameters:  []models.ParameterDefinition{},
+			Description: "用技术指标和图形特征训练逻辑回归模型，按预测的上涨概率买卖",
+			Parameters: []models.ParameterDefinition{
+				{
+					Name:         "horizon",
+					DisplayName:  "预测周期",
+					Type:         "int",
+					DefaultValue: defaultMLHorizon,
+					MinValue:     1,
+					MaxValue:     maxMLHorizon,
+					Required:     false,
+					Description:  "预测未来N个交易日的收益，修改后需要重新训练",
+				},
+				{
+					Name:         "label_threshold",
+					DisplayName:  "上涨阈值",
+					Type:         "float",
+					DefaultValue: 0,
+					Required:     false,
+					Description:  "未来收益超过该值的样本标为上涨，修改后需要重新训练",
+				},
+				{
+					Name:         "buy_probability",
+					DisplayName:  "买入概率",
+					Type:         "float",
+					DefaultValue: defaultMLBuyProbability,
+					MinValue:     0,
+					MaxValue:     1,
+					Required:     false,
+					Description:  "上涨概率不低于该值时买入",
+				},
+				{
+					Name:         "sell_probability",
+					DisplayName:  "卖出概率",
+					Type:         "float",
+					DefaultValue: defaultMLSellProbability,
+					MinValue:     0,
+					MaxValue:     1,
+					Required:     false,
+					Description:  "上涨概率不高于该值时卖出",
+				},
+				{
+					Name:         "l2",
+					DisplayName:  "L2正则系数",
+					Type:         "float",
+					DefaultValue: defaultMLL2,
+					MinValue:     0,
+					Required:     false,
+					Description:  "越大模型越保守，用于抑制过拟合",
+				},
+				{
+					Name:         "folds",
+					DisplayName:  "交叉验证折数",
+					Type:         "int",
+					DefaultValue: defaultMLFolds,
+					MinValue:     minMLFolds,
+					MaxValue:     maxMLFolds,
+					Required:     false,
+					Description:  "按时间顺序划分的交叉验证折数，只用于评估，不影响最终模型",
+				},
+			},
 		},
 		{
 			Type:        models.StrategyTypeComposite,
 			Name:        "复合策略",
-			Description: "结合多种策略类型的综合策略",
-			Parameters:  []models.ParameterDefinition{},
+			Description: "引用其他策略并合并它们的信号",
+			Parameters: []models.ParameterDefinition{
+				{
+					Name:         "mode",
+					DisplayName:  "组合方式",
+					Type:         "select",
+					DefaultValue: string(models.CompositeModeAnd),
+					Options:      []string{string(models.CompositeModeAnd), string(models.CompositeModeOr), string(models.CompositeModeWeighted), string(models.CompositeModeFilter)},
+					Required:     true,
+					Description:  "and: 全部一致；or: 任一发出信号；weighted: 按 强度×置信度 加权投票；filter: 过滤策略放行触发策略",
+				},
+				{
+					Name:        "strategies",
+					DisplayName: "子策略",
+					Type:        "string",
+					Required:    false,
+					Description: "and/or/weighted 模式引用的策略ID列表，至少2个",
+				},
+				{
+					Name:         "threshold",
+					DisplayName:  "投票阈值",
+					Type:         "float",
+					DefaultValue: defaultCompositeThreshold,
+					MinValue:     0.01,
+					MaxValue:     1,
+					Required:     false,
+					Description:  "weighted 模式下加权得分的绝对值达到阈值才发出信号",
+				},
+				{
+					Name:        "filter",
+					DisplayName: "过滤策略",
+					Type:        "string",
+					Required:    false,
+					Description: "filter 模式下该策略为买入时才放行触发策略的买入",
+				},
+				{
+					Name:        "trigger",
+					DisplayName: "触发策略",
+					Type:        "string",
+					Required:    false,
+					Description: "filter 模式下决定买卖时机的策略",
+				},
+			},
+		},
+		{
+			Type:        models.StrategyTypeRebalance,
+			Name:        "定期调仓策略",
+			Description: "按周/月/季度对股票打分，选出前N只并调整到目标权重",
+			Parameters: []models.ParameterDefinition{
+				{
+					Name:         "frequency",
+					DisplayName:  "调仓频率",
+					Type:         "select",
+					DefaultValue: string(models.RebalanceMonthly),
+					Options:      []string{string(models.RebalanceWeekly), string(models.RebalanceMonthly), string(models.RebalanceQuarterly)},
+					Required:     true,
+					Description:  "在每周、每月或每季度的第一个交易日调仓",
+				},
+				{
+					Name:         "top_n",
+					DisplayName:  "持股数量",
+					Type:         "int",
+					DefaultValue: defaultRebalanceTopN,
+					MinValue:     1,
+					Required:     true,
+					Description:  "每次调仓持有打分最高的股票数量",
+				},
+				{
+					Name:         "score",
+					DisplayName:  "打分方法",
+					Type:         "select",
+					DefaultValue: defaultRebalanceScore,
+					Options:      []string{"momentum", "low_volatility", "trend", "value", "growth", "quality", "profitability", "composite"},
+					Required:     true,
+					Description:  "技术指标打分（动量、低波动、趋势）或基本面因子得分",
+				},
+				{
+					Name:         "lookback",
+					DisplayName:  "回看天数",
+					Type:         "int",
+					DefaultValue: defaultRebalanceLookback,
+					MinValue:     2,
+					MaxValue:     StrategyLookbackDays - 1,
+					Description:  "技术指标打分使用的交易日数",
+				},
+				{
+					Name:         "weighting",
+					DisplayName:  "权重分配",
+					Type:         "select",
+					DefaultValue: string(models.RebalanceWeightEqual),
+					Options:      []string{string(models.RebalanceWeightEqual), string(models.RebalanceWeightRank)},
+					Description:  "等权或按排名线性加权",
+				},
+				{
+					Name:         "max_turnover",
+					DisplayName:  "换手率上限",
+					Type:         "float",
+					DefaultValue: 0.0,
+					MinValue:     0.0,
+					MaxValue:     2.0,
+					Description:  "单次调仓买卖金额合计占总资产的上限，0表示不限制",
+				},
+			},
 		},
 	}
 }
 
+// StrategyLookbackDays 策略执行所需的历史K线窗口长度（交易日）
+// 需要覆盖所有内置策略参数上限（长期均线最长200日）并留出指标预热空间
+const StrategyLookbackDays = 250
+
 // ExecuteStrategy 执行策略（生成交易信号）
-func (s *StrategyService) ExecuteStrategy(ctx context.Context, strategyID string, marketData *models.MarketData) (*models.Signal, error) {
-	strategy, exists := s.strategies[strategyID]
-	if !exists {
-		return nil, ErrStrategyNotFound
+// history 为截至 marketData.Date（含当日）的历史日线数据，按交易日期升序排列
+func (s *StrategyService) ExecuteStrategy(ctx context.Context, strategyID string, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	strategy, err := s.GetStrategy(ctx, strategyID)
+	if err != nil {
+		return nil, err
 	}
 
+	return s.ExecuteStrategyWith(ctx, strategy, marketData, history)
+}
+
+// ExecuteStrategyWith 使用给定的策略定义执行策略，不要求策略已注册
+// 参数优化时用于以候选参数运行同一策略
+func (s *StrategyService) ExecuteStrategyWith(ctx context.Context, strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
 	// 移除策略状态检查 - 任何定义好的策略都应该可以执行
 
 	// 根据策略类型执行不同的逻辑
 	switch strategy.ID {
 	case "macd_strategy":
-		return s.executeMACDStrategyImproved(strategy, marketData)
+		return s.executeMACDStrategy(strategy, marketData, history)
 	case "ma_crossover":
-		return s.executeMAStrategyImproved(strategy, marketData)
+		return s.executeMAStrategy(strategy, marketData, history)
 	case "rsi_strategy":
-		return s.executeRSIStrategyImproved(strategy, marketData)
+		return s.executeRSIStrategy(strategy, marketData, history)
 	case "bollinger_strategy":
-		return s.executeBollingerStrategyImproved(strategy, marketData)
+		return s.executeBollingerStrategy(strategy, marketData, history)
+	}
+
+	if strategy.Type == models.StrategyTypeComposite {
+		return s.executeCompositeStrategy(ctx, strategy, marketData, history)
+	}
+	if strategy.Type == models.StrategyTypeML {
+		return s.executeMLStrategy(ctx, strategy, marketData, history)
+	}
+
+	// 用户自定义策略按策略代码中的规则执行
+	if isRuleStrategy(strategy) {
+		return s.executeRuleStrategy(strategy, marketData, history)
 	}
 
 	s.logger.Error("未知的策略类型",
@@ -763,215 +1106,289 @@ func (s *StrategyService) ExecuteStrategy(ctx context.Context, strategyID string
 	return nil, fmt.Errorf("未知的策略类型: %s", strategy.ID)
 }
 
-// ==================== 改进的策略实现 ====================
+// ==================== 基于技术指标的策略实现 ====================
 
-// executeMACDStrategyImproved 改进的MACD策略
-func (s *StrategyService) executeMACDStrategyImproved(strategy *models.Strategy, marketData *models.MarketData) (*models.Signal, error) {
-	signal := &models.Signal{
-		ID:         fmt.Sprintf("signal_%d", time.Now().Unix()),
+// newStrategySignal 创建默认为持有的信号
+// 信号ID由策略、股票和日期确定，保证同样的输入得到同样的输出
+func newStrategySignal(strategy *models.Strategy, marketData *models.MarketData) *models.Signal {
+	return &models.Signal{
+		ID:         fmt.Sprintf("signal_%s_%s_%s", strategy.ID, marketData.Symbol, marketData.Date.Format("20060102")),
 		StrategyID: strategy.ID,
 		Symbol:     marketData.Symbol,
+		SignalType: models.SignalTypeHold,
 		Price:      marketData.Close,
 		Timestamp:  marketData.Date,
 		CreatedAt:  time.Now(),
 	}
+}
+
+// holdSignal 将信号设置为持有
+func holdSignal(signal *models.Signal, reason string) *models.Signal {
+	signal.SignalType = models.SignalTypeHold
+	signal.Side = ""
+	signal.Strength = 0.5
+	signal.Confidence = 0.5
+	signal.Reason = reason
+	return signal
+}
+
+// getIntParameter 读取整数类型的策略参数
+// 参数可能来自代码中的默认值（int）或JSON反序列化（float64）
+func getIntParameter(params map[string]interface{}, key string, defaultValue int) int {
+	switch v := params[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(math.Round(v))
+	case float32:
+		return int(math.Round(float64(v)))
+	}
+	return defaultValue
+}
+
+// getFloatParameter 读取浮点类型的策略参数
+func getFloatParameter(params map[string]interface{}, key string, defaultValue float64) float64 {
+	switch v := params[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return defaultValue
+}
+
+// getStringParameter 读取字符串类型的策略参数
+func getStringParameter(params map[string]interface{}, key string, defaultValue string) string {
+	if v, ok := params[key].(string); ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+// executeMACDStrategy MACD金叉死叉策略
+// MACD柱由阈值下方上穿阈值时买入，由阈值上方下穿阈值时卖出
+func (s *StrategyService) executeMACDStrategy(strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	signal := newStrategySignal(strategy, marketData)
+
+	fastPeriod := getIntParameter(strategy.Parameters, "fast_period", 12)
+	slowPeriod := getIntParameter(strategy.Parameters, "slow_period", 26)
+	signalPeriod := getIntParameter(strategy.Parameters, "signal_period", 9)
+	buyThreshold := getFloatParameter(strategy.Parameters, "buy_threshold", 0)
+	sellThreshold := getFloatParameter(strategy.Parameters, "sell_threshold", 0)
 
-	// 基于价格趋势的简化MACD逻辑
-	// 使用价格相对于某个基准的变化来模拟MACD信号
-	priceBase := 5.0 // 假设基准价格
-	priceChange := (marketData.Close - priceBase) / priceBase
+	macd := s.calculator.CalculateMACDWithPeriods(history, fastPeriod, slowPeriod, signalPeriod)
+	if len(macd) < 2 {
+		return holdSignal(signal, fmt.Sprintf("历史数据不足，无法计算MACD(%d,%d,%d)", fastPeriod, slowPeriod, signalPeriod)), nil
+	}
+
+	current := macd[len(macd)-1]
+	previous := macd[len(macd)-2]
+	hist := current.Histogram.InexactFloat64()
+	prevHist := previous.Histogram.InexactFloat64()
+	dif := current.DIF.InexactFloat64()
+	dea := current.DEA.InexactFloat64()
 
-	// 添加一些随机性，但更有逻辑
-	randomFactor := (rand.Float64() - 0.5) * 0.2 // -0.1 到 0.1 的随机因子
-	adjustedChange := priceChange + randomFactor
+	// 信号强度：柱状图相对价格的幅度，放大后截断到[0,1]
+	strength := 0.0
+	if marketData.Close > 0 {
+		strength = math.Min(math.Abs(hist)/marketData.Close*100, 1.0)
+	}
 
-	// 更严格的买入/卖出条件，减少频繁交易
-	if adjustedChange > 0.05 { // 价格上涨超过5%
+	switch {
+	case prevHist <= buyThreshold && hist > buyThreshold:
 		signal.SignalType = models.SignalTypeBuy
 		signal.Side = models.TradeSideBuy
-		signal.Strength = math.Min(adjustedChange*2, 1.0)
+		signal.Strength = strength
 		signal.Confidence = 0.75
-		signal.Reason = fmt.Sprintf("MACD金叉信号 (价格变化: %.2f%%)", adjustedChange*100)
-	} else if adjustedChange < -0.05 { // 价格下跌超过5%
+		signal.Reason = fmt.Sprintf("MACD金叉 (DIF: %.4f, DEA: %.4f, 柱: %.4f)", dif, dea, hist)
+	case prevHist >= sellThreshold && hist < sellThreshold:
 		signal.SignalType = models.SignalTypeSell
 		signal.Side = models.TradeSideSell
-		signal.Strength = math.Min(-adjustedChange*2, 1.0)
+		signal.Strength = strength
 		signal.Confidence = 0.75
-		signal.Reason = fmt.Sprintf("MACD死叉信号 (价格变化: %.2f%%)", adjustedChange*100)
-	} else {
-		signal.SignalType = models.SignalTypeHold
-		signal.Strength = 0.5
-		signal.Confidence = 0.5
-		signal.Reason = "MACD震荡区间，等待明确信号"
+		signal.Reason = fmt.Sprintf("MACD死叉 (DIF: %.4f, DEA: %.4f, 柱: %.4f)", dif, dea, hist)
+	default:
+		holdSignal(signal, fmt.Sprintf("MACD无交叉 (DIF: %.4f, DEA: %.4f, 柱: %.4f)", dif, dea, hist))
 	}
 
 	return signal, nil
 }
 
-// executeMAStrategyImproved 改进的移动平均策略
-func (s *StrategyService) executeMAStrategyImproved(strategy *models.Strategy, marketData *models.MarketData) (*models.Signal, error) {
-	signal := &models.Signal{
-		ID:         fmt.Sprintf("signal_%d", time.Now().Unix()),
-		StrategyID: strategy.ID,
-		Symbol:     marketData.Symbol,
-		Price:      marketData.Close,
-		Timestamp:  marketData.Date,
-		CreatedAt:  time.Now(),
+// executeMAStrategy 双均线策略
+// 短期均线相对长期均线的偏离由阈值内突破到阈值外时产生信号
+func (s *StrategyService) executeMAStrategy(strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	signal := newStrategySignal(strategy, marketData)
+
+	shortPeriod := getIntParameter(strategy.Parameters, "short_period", 5)
+	longPeriod := getIntParameter(strategy.Parameters, "long_period", 20)
+	maType := getStringParameter(strategy.Parameters, "ma_type", "sma")
+	threshold := getFloatParameter(strategy.Parameters, "threshold", 0.01)
+
+	if shortPeriod <= 0 || longPeriod <= shortPeriod {
+		return nil, fmt.Errorf("均线周期参数无效: short=%d, long=%d", shortPeriod, longPeriod)
+	}
+
+	shortMA := s.recentMovingAverage(history, shortPeriod, maType, 2)
+	longMA := s.recentMovingAverage(history, longPeriod, maType, 2)
+	if len(shortMA) < 2 || len(longMA) < 2 {
+		return holdSignal(signal, fmt.Sprintf("历史数据不足，无法计算%d/%d日均线", shortPeriod, longPeriod)), nil
 	}
 
-	// 模拟短期和长期均线
-	shortMA := marketData.Close * (0.95 + rand.Float64()*0.1) // 短期均线在价格附近波动
-	longMA := marketData.Close * (0.90 + rand.Float64()*0.2)  // 长期均线波动更大
+	short := shortMA[len(shortMA)-1]
+	long := longMA[len(longMA)-1]
+	prevShort := shortMA[len(shortMA)-2]
+	prevLong := longMA[len(longMA)-2]
+	if long == 0 || prevLong == 0 {
+		return holdSignal(signal, "长期均线为零，无法判断"), nil
+	}
 
-	crossover := (marketData.Close - shortMA) / shortMA
-	trend := (shortMA - longMA) / longMA
+	spread := (short - long) / long
+	prevSpread := (prevShort - prevLong) / prevLong
+	strength := math.Min(math.Abs(spread)*10, 1.0)
 
-	// 更智能的信号生成：需要价格突破且趋势确认
-	if crossover > 0.02 && trend > 0.03 { // 价格突破短期均线且短期均线在长期均线之上
+	switch {
+	case prevSpread <= threshold && spread > threshold:
 		signal.SignalType = models.SignalTypeBuy
 		signal.Side = models.TradeSideBuy
-		signal.Strength = math.Min((crossover+trend)*5, 1.0)
+		signal.Strength = strength
 		signal.Confidence = 0.8
-		signal.Reason = "短期均线上穿长期均线，趋势向上"
-	} else if crossover < -0.02 && trend < -0.03 { // 价格跌破短期均线且短期均线在长期均线之下
+		signal.Reason = fmt.Sprintf("%d日均线上穿%d日均线 (%s: %.2f / %.2f, 偏离: %.2f%%)",
+			shortPeriod, longPeriod, strings.ToUpper(maType), short, long, spread*100)
+	case prevSpread >= -threshold && spread < -threshold:
 		signal.SignalType = models.SignalTypeSell
 		signal.Side = models.TradeSideSell
-		signal.Strength = math.Min(-(crossover+trend)*5, 1.0)
+		signal.Strength = strength
 		signal.Confidence = 0.8
-		signal.Reason = "短期均线下穿长期均线，趋势向下"
-	} else {
-		signal.SignalType = models.SignalTypeHold
-		signal.Strength = 0.5
-		signal.Confidence = 0.5
-		signal.Reason = "均线纠缠状态，观望"
+		signal.Reason = fmt.Sprintf("%d日均线下穿%d日均线 (%s: %.2f / %.2f, 偏离: %.2f%%)",
+			shortPeriod, longPeriod, strings.ToUpper(maType), short, long, spread*100)
+	default:
+		holdSignal(signal, fmt.Sprintf("均线无有效突破 (偏离: %.2f%%)", spread*100))
 	}
 
 	return signal, nil
 }
 
-// executeRSIStrategyImproved 改进的RSI策略
-func (s *StrategyService) executeRSIStrategyImproved(strategy *models.Strategy, marketData *models.MarketData) (*models.Signal, error) {
-	signal := &models.Signal{
-		ID:         fmt.Sprintf("signal_%d", time.Now().Unix()),
-		StrategyID: strategy.ID,
-		Symbol:     marketData.Symbol,
-		Price:      marketData.Close,
-		Timestamp:  marketData.Date,
-		CreatedAt:  time.Now(),
+// recentMovingAverage 按均线类型计算最近 count 个移动平均值（按时间升序），数据不足时返回的值少于 count 个
+// 简单和加权均线只依赖最近 period 根K线，只截取所需的K线计算；指数均线依赖全部历史，需要完整计算
+func (s *StrategyService) recentMovingAverage(history []models.StockDaily, period int, maType string, count int) []float64 {
+	recent := history
+	if n := period + count - 1; len(recent) > n {
+		recent = recent[len(recent)-n:]
+	}
+
+	var values []decimal.Decimal
+	switch strings.ToLower(maType) {
+	case "ema":
+		values = s.calculator.CalculateEMA(history, period)
+	case "wma":
+		values = s.calculator.CalculateWMA(recent, period)
+	default:
+		values = s.calculator.CalculateMA(recent, period)
+	}
+	if len(values) > count {
+		values = values[len(values)-count:]
 	}
 
-	// 基于价格位置模拟RSI值
-	priceRange := marketData.High - marketData.Low
-	if priceRange == 0 {
-		priceRange = marketData.Close * 0.02 // 假设2%的波动
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = v.InexactFloat64()
 	}
+	return result
+}
 
-	pricePosition := (marketData.Close - marketData.Low) / priceRange
-	rsiValue := 30 + pricePosition*40 + (rand.Float64()-0.5)*20 // 30-70区间，加随机波动
+// executeRSIStrategy RSI超买超卖策略
+// RSI由正常区间跌入超卖区时买入，升入超买区时卖出，停留在区间内的K线不重复产生信号
+func (s *StrategyService) executeRSIStrategy(strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	signal := newStrategySignal(strategy, marketData)
 
-	overbought := 75.0
-	oversold := 25.0
+	period := getIntParameter(strategy.Parameters, "period", 14)
+	overbought := getFloatParameter(strategy.Parameters, "overbought", 70)
+	oversold := getFloatParameter(strategy.Parameters, "oversold", 30)
 
-	if params, ok := strategy.Parameters["overbought"].(float64); ok {
-		overbought = params
+	if period <= 0 {
+		return nil, fmt.Errorf("RSI周期参数无效: %d", period)
 	}
-	if params, ok := strategy.Parameters["oversold"].(float64); ok {
-		oversold = params
+
+	rsiResults := s.calculator.CalculateRSI(history, period)
+	if len(rsiResults) < 2 {
+		return holdSignal(signal, fmt.Sprintf("历史数据不足，无法计算RSI(%d)", period)), nil
 	}
 
-	// 更严格的RSI条件，避免频繁交易
-	if rsiValue < oversold && pricePosition < 0.3 { // RSI超卖且价格在低位
+	rsiValue := rsiResults[len(rsiResults)-1].RSI14.InexactFloat64()
+	prevRSI := rsiResults[len(rsiResults)-2].RSI14.InexactFloat64()
+
+	switch {
+	case prevRSI >= oversold && rsiValue < oversold:
 		signal.SignalType = models.SignalTypeBuy
 		signal.Side = models.TradeSideBuy
-		signal.Strength = (oversold - rsiValue) / oversold
+		signal.Strength = math.Min((oversold-rsiValue)/oversold, 1.0)
 		signal.Confidence = 0.85
-		signal.Reason = fmt.Sprintf("RSI超卖信号 (RSI: %.1f, 价格低位)", rsiValue)
-	} else if rsiValue > overbought && pricePosition > 0.7 { // RSI超买且价格在高位
+		signal.Reason = fmt.Sprintf("RSI超卖信号 (RSI%d: %.1f < %.1f)", period, rsiValue, oversold)
+	case prevRSI <= overbought && rsiValue > overbought:
 		signal.SignalType = models.SignalTypeSell
 		signal.Side = models.TradeSideSell
-		signal.Strength = (rsiValue - overbought) / (100 - overbought)
+		signal.Strength = math.Min((rsiValue-overbought)/(100-overbought), 1.0)
 		signal.Confidence = 0.85
-		signal.Reason = fmt.Sprintf("RSI超买信号 (RSI: %.1f, 价格高位)", rsiValue)
-	} else {
-		signal.SignalType = models.SignalTypeHold
-		signal.Strength = 0.5
-		signal.Confidence = 0.5
-		signal.Reason = fmt.Sprintf("RSI正常区间 (RSI: %.1f)", rsiValue)
+		signal.Reason = fmt.Sprintf("RSI超买信号 (RSI%d: %.1f > %.1f)", period, rsiValue, overbought)
+	default:
+		holdSignal(signal, fmt.Sprintf("RSI未穿越超买超卖阈值 (RSI%d: %.1f)", period, rsiValue))
 	}
 
 	return signal, nil
 }
 
-// executeBollingerStrategyImproved 改进的布林带策略
-func (s *StrategyService) executeBollingerStrategyImproved(strategy *models.Strategy, marketData *models.MarketData) (*models.Signal, error) {
-	signal := &models.Signal{
-		ID:         fmt.Sprintf("signal_%d", time.Now().Unix()),
-		StrategyID: strategy.ID,
-		Symbol:     marketData.Symbol,
-		Price:      marketData.Close,
-		Timestamp:  marketData.Date,
-		CreatedAt:  time.Now(),
-	}
+// executeBollingerStrategy 布林带均值回归策略
+// 收盘价跌破下轨时买入，突破上轨时卖出
+func (s *StrategyService) executeBollingerStrategy(strategy *models.Strategy, marketData *models.MarketData, history []models.StockDaily) (*models.Signal, error) {
+	signal := newStrategySignal(strategy, marketData)
 
-	// 获取策略参数
-	stdDevMultiplier := 2.0
-	if params, ok := strategy.Parameters["std_dev"].(float64); ok {
-		stdDevMultiplier = params
-	}
-	// period 参数暂时未使用，因为我们使用简化的布林带计算
-
-	// 简化的布林带计算：使用当前价格的移动平均估算
-	// 在实际应用中，这里应该获取历史数据来计算真正的移动平均线
-	// 为了演示，我们使用一个简化的方法：基于当日的开高低收来估算趋势
+	period := getIntParameter(strategy.Parameters, "period", 20)
+	stdDevMultiplier := getFloatParameter(strategy.Parameters, "std_dev", 2.0)
 
-	// 估算移动平均线（中轨）：使用当日均价作为近似
-	middleBand := (marketData.High + marketData.Low + marketData.Close*2) / 4
+	if period <= 0 {
+		return nil, fmt.Errorf("布林带周期参数无效: %d", period)
+	}
 
-	// 计算当日波动率作为标准差的估算
-	dailyRange := marketData.High - marketData.Low
-	estimatedStdDev := dailyRange / 4 // 简化估算：日内波动的1/4作为标准差
+	bands := s.calculator.CalculateBollingerBands(history, period, stdDevMultiplier)
+	if len(bands) == 0 {
+		return holdSignal(signal, fmt.Sprintf("历史数据不足，无法计算%d日布林带", period)), nil
+	}
 
-	// 计算布林带上下轨
-	upperBand := middleBand + (estimatedStdDev * stdDevMultiplier)
-	lowerBand := middleBand - (estimatedStdDev * stdDevMultiplier)
+	band := bands[len(bands)-1]
+	upper := band.Upper.InexactFloat64()
+	middle := band.Middle.InexactFloat64()
+	lower := band.Lower.InexactFloat64()
+	price := marketData.Close
 
-	// 计算价格相对于布林带的位置
-	bandWidth := upperBand - lowerBand
-	if bandWidth <= 0 {
-		// 避免除零错误，使用默认持有信号
-		signal.SignalType = models.SignalTypeHold
-		signal.Strength = 0.5
-		signal.Confidence = 0.5
-		signal.Reason = "布林带宽度过小，无法判断"
-		return signal, nil
+	halfWidth := upper - middle
+	if halfWidth <= 0 {
+		return holdSignal(signal, "布林带宽度过小，无法判断"), nil
 	}
 
-	pricePosition := (marketData.Close - lowerBand) / bandWidth
-
-	// 计算相对波动率
-	relativeVolatility := dailyRange / marketData.Close
+	// 价格偏离中轨的程度（以半个带宽为单位）
+	deviation := (price - middle) / halfWidth
 
-	// 布林带策略逻辑：更宽松的条件以便产生交易信号
-	if pricePosition < 0.3 && relativeVolatility > 0.01 { // 价格在下30%且有波动
+	switch {
+	case price < lower:
 		signal.SignalType = models.SignalTypeBuy
 		signal.Side = models.TradeSideBuy
-		signal.Strength = math.Min((0.3-pricePosition)*3, 1.0)
+		signal.Strength = math.Min(-deviation-1, 1.0)
 		signal.Confidence = 0.75
-		signal.Reason = fmt.Sprintf("价格接近布林带下轨 (位置: %.1f%%, 中轨: %.2f, 下轨: %.2f)",
-			pricePosition*100, middleBand, lowerBand)
-	} else if pricePosition > 0.7 && relativeVolatility > 0.01 { // 价格在上30%且有波动
+		signal.Reason = fmt.Sprintf("价格跌破布林带下轨 (价格: %.2f, 中轨: %.2f, 下轨: %.2f)", price, middle, lower)
+	case price > upper:
 		signal.SignalType = models.SignalTypeSell
 		signal.Side = models.TradeSideSell
-		signal.Strength = math.Min((pricePosition-0.7)*3, 1.0)
+		signal.Strength = math.Min(deviation-1, 1.0)
 		signal.Confidence = 0.75
-		signal.Reason = fmt.Sprintf("价格接近布林带上轨 (位置: %.1f%%, 中轨: %.2f, 上轨: %.2f)",
-			pricePosition*100, middleBand, upperBand)
-	} else {
-		signal.SignalType = models.SignalTypeHold
-		signal.Strength = 0.5
-		signal.Confidence = 0.5
-		signal.Reason = fmt.Sprintf("价格在布林带中部 (位置: %.1f%%, 中轨: %.2f)",
-			pricePosition*100, middleBand)
+		signal.Reason = fmt.Sprintf("价格突破布林带上轨 (价格: %.2f, 中轨: %.2f, 上轨: %.2f)", price, middle, upper)
+	default:
+		holdSignal(signal, fmt.Sprintf("价格在布林带内 (价格: %.2f, 中轨: %.2f)", price, middle))
 	}
 
 	return signal, nil
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// buildTestDailyBars 根据收盘价序列构造连续交易日的日线数据（高低价为收盘价±1%）
+func buildTestDailyBars(symbol string, start time.Time, closes []float64) []models.StockDaily {
+	bars := make([]models.StockDaily, 0, len(closes))
+	date := start
+	for i, c := range closes {
+		for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			date = date.AddDate(0, 0, 1)
+		}
+		open := c
+		if i > 0 {
+			open = closes[i-1]
+		}
+		bars = append(bars, models.StockDaily{
+			TSCode:    symbol,
+			TradeDate: date.Format("20060102"),
+			Open:      models.NewJSONDecimal(decimal.NewFromFloat(open)),
+			High:      models.NewJSONDecimal(decimal.NewFromFloat(c * 1.01)),
+			Low:       models.NewJSONDecimal(decimal.NewFromFloat(c * 0.99)),
+			Close:     models.NewJSONDecimal(decimal.NewFromFloat(c)),
+			PreClose:  models.NewJSONDecimal(decimal.NewFromFloat(open)),
+			Vol:       models.NewJSONDecimal(decimal.NewFromFloat(10000)),
+			Amount:    models.NewJSONDecimal(decimal.NewFromFloat(c * 10000 * 100 / 1000)),
+		})
+		date = date.AddDate(0, 0, 1)
+	}
+	return bars
+}
+
+// lastBarMarketData 将历史数据的最后一根K线转换为策略输入
+func lastBarMarketData(t *testing.T, bars []models.StockDaily) *models.MarketData {
+	t.Helper()
+	last := bars[len(bars)-1]
+	date, err := parseTradeDate(last.TradeDate)
+	if err != nil {
+		t.Fatalf("解析交易日期失败: %v", err)
+	}
+	return &models.MarketData{
+		Symbol: last.TSCode,
+		Date:   date,
+		Open:   last.Open.InexactFloat64(),
+		High:   last.High.InexactFloat64(),
+		Low:    last.Low.InexactFloat64(),
+		Close:  last.Close.InexactFloat64(),
+	}
+}
+
+func newTestStrategyService(t testing.TB) *StrategyService {
+	t.Helper()
+	log, err := logger.NewLogger(&logger.Config{Level: "error", Format: "console", Output: "stdout"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	return NewStrategyService(log)
+}
+
+func TestExecuteStrategy_MACrossoverUsesRealHistory(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// 先下跌后急涨，短期均线上穿长期均线
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 20-float64(i)*0.2)
+	}
+	var signal *models.Signal
+	for i := 0; i < 15 && (signal == nil || signal.SignalType != models.SignalTypeBuy); i++ {
+		closes = append(closes, closes[len(closes)-1]*1.04)
+		bars := buildTestDailyBars("000001.SZ", start, closes)
+		var err error
+		signal, err = service.ExecuteStrategy(ctx, "ma_crossover", lastBarMarketData(t, bars), bars)
+		if err != nil {
+			t.Fatalf("执行策略失败: %v", err)
+		}
+	}
+
+	if signal.SignalType != models.SignalTypeBuy {
+		t.Fatalf("期望出现均线金叉买入信号, 实际: %s (%s)", signal.SignalType, signal.Reason)
+	}
+}
+
+func TestExecuteStrategy_InsufficientHistoryHolds(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	bars := buildTestDailyBars("000001.SZ", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), []float64{10, 10.5, 11})
+
+	for _, strategyID := range []string{"macd_strategy", "ma_crossover", "rsi_strategy", "bollinger_strategy"} {
+		signal, err := service.ExecuteStrategy(ctx, strategyID, lastBarMarketData(t, bars), bars)
+		if err != nil {
+			t.Fatalf("%s 执行失败: %v", strategyID, err)
+		}
+		if signal.SignalType != models.SignalTypeHold {
+			t.Errorf("%s 历史数据不足时应返回持有信号, 实际: %s", strategyID, signal.SignalType)
+		}
+	}
+}
+
+func TestExecuteStrategy_Deterministic(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+
+	var closes []float64
+	for i := 0; i < 120; i++ {
+		closes = append(closes, 10+float64(i%17)*0.3-float64(i%5)*0.2)
+	}
+	bars := buildTestDailyBars("600000.SH", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), closes)
+	marketData := lastBarMarketData(t, bars)
+
+	for _, strategyID := range []string{"macd_strategy", "ma_crossover", "rsi_strategy", "bollinger_strategy"} {
+		first, err := service.ExecuteStrategy(ctx, strategyID, marketData, bars)
+		if err != nil {
+			t.Fatalf("%s 执行失败: %v", strategyID, err)
+		}
+		for i := 0; i < 5; i++ {
+			again, err := service.ExecuteStrategy(ctx, strategyID, marketData, bars)
+			if err != nil {
+				t.Fatalf("%s 执行失败: %v", strategyID, err)
+			}
+			if again.ID != first.ID || again.SignalType != first.SignalType ||
+				again.Strength != first.Strength || again.Reason != first.Reason {
+				t.Fatalf("%s 相同输入产生了不同信号: %+v vs %+v", strategyID, first, again)
+			}
+		}
+	}
+}
+
+func TestExecuteStrategy_RSIOversoldAndBollingerBreakout(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// 平稳震荡后连续大跌：RSI进入超卖区，价格跌破布林带下轨
+	var closes []float64
+	for i := 0; i < 30; i++ {
+		closes = append(closes, 10+float64(i%2)*0.1)
+	}
+	for i := 0; i < 8; i++ {
+		closes = append(closes, closes[len(closes)-1]*0.95)
+	}
+	bars := buildTestDailyBars("000002.SZ", start, closes)
+	marketData := lastBarMarketData(t, bars)
+
+	// RSI只在跌入超卖区的那根K线买入，之后持续超卖不再重复产生信号
+	buyBars := 0
+	lastBuy := -1
+	for i := 30; i < len(bars); i++ {
+		rsiSignal, err := service.ExecuteStrategy(ctx, "rsi_strategy", lastBarMarketData(t, bars[:i+1]), bars[:i+1])
+		if err != nil {
+			t.Fatalf("RSI策略执行失败: %v", err)
+		}
+		if rsiSignal.SignalType == models.SignalTypeBuy {
+			buyBars++
+			lastBuy = i
+		}
+	}
+	if buyBars != 1 || lastBuy == len(bars)-1 {
+		t.Errorf("期望RSI仅在穿越超卖阈值的K线买入一次, 实际买入%d次 (最后一次在第%d根)", buyBars, lastBuy)
+	}
+
+	bollSignal, err := service.ExecuteStrategy(ctx, "bollinger_strategy", marketData, bars)
+	if err != nil {
+		t.Fatalf("布林带策略执行失败: %v", err)
+	}
+	if bollSignal.SignalType != models.SignalTypeBuy {
+		t.Errorf("期望跌破布林带下轨买入信号, 实际: %s (%s)", bollSignal.SignalType, bollSignal.Reason)
+	}
+}
+
+func TestSymbolHistoryWindowExcludesFutureBars(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bars := buildTestDailyBars("000001.SZ", start, []float64{1, 2, 3, 4, 5, 6})
+	history := newSymbolHistory(bars)
+
+	target, _ := parseTradeDate(bars[3].TradeDate)
+	window := history.window(target, 2)
+	if len(window) != 2 {
+		t.Fatalf("期望窗口长度2, 实际: %d", len(window))
+	}
+	if window[1].TradeDate != bars[3].TradeDate {
+		t.Errorf("窗口应以目标日期结束, 实际: %s", window[1].TradeDate)
+	}
+}
+
+func TestSymbolHistoryAlignToMatchesDateLookup(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bars := buildTestDailyBars("000001.SZ", start, []float64{1, 2, 3, 4, 5, 6})
+	// 去掉第3根K线模拟停牌
+	history := newSymbolHistory(append(append([]models.StockDaily{}, bars[:2]...), bars[3:]...))
+
+	var days []time.Time
+	for d := start.AddDate(0, 0, -2); d.Before(start.AddDate(0, 0, 12)); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	history.alignTo(days)
+
+	for i, day := range days {
+		if got, want := len(history.windowAt(i, day, 3)), len(history.window(day, 3)); got != want {
+			t.Errorf("%s 对齐窗口长度 %d 与按日期查找的 %d 不一致", day.Format("2006-01-02"), got, want)
+		}
+		latest, ok := history.latestAt(i, day)
+		window := history.window(day, 1)
+		if ok != (len(window) == 1) || (ok && latest.TradeDate != window[0].TradeDate) {
+			t.Errorf("%s 最新K线错误: %s, ok=%v", day.Format("2006-01-02"), latest.TradeDate, ok)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"stock-a-future/internal/models"
+)
+
+// StrategyStore 策略及其版本历史的SQLite存储，表结构在 DatabaseService.initTables 中创建
+type StrategyStore struct {
+	db *sql.DB
+}
+
+// NewStrategyStore 创建策略存储
+func NewStrategyStore(db *sql.DB) *StrategyStore {
+	return &StrategyStore{db: db}
+}
+
+// SaveStrategy 保存策略，已存在时覆盖；version 不为空时在同一事务中追加版本记录
+func (s *StrategyStore) SaveStrategy(strategy *models.Strategy, version *models.StrategyVersion) error {
+	data, err := json.Marshal(strategy)
+	if err != nil {
+		return fmt.Errorf("序列化策略失败: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO strategies (id, name, data, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			data = excluded.data,
+			updated_at = excluded.updated_at
+	`, strategy.ID, strategy.Name, string(data), strategy.CreatedAt, strategy.UpdatedAt); err != nil {
+		return fmt.Errorf("保存策略失败: %w", err)
+	}
+
+	if version != nil {
+		number, err := strconv.Atoi(version.Version)
+		if err != nil {
+			return fmt.Errorf("策略版本号无效: %s", version.Version)
+		}
+		versionData, err := json.Marshal(version)
+		if err != nil {
+			return fmt.Errorf("序列化策略版本失败: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO strategy_versions (id, strategy_id, version, data, created_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, version.ID, version.StrategyID, number, string(versionData), version.CreatedAt); err != nil {
+			return fmt.Errorf("保存策略版本失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteStrategy 删除策略及其全部版本和训练好的模型
+func (s *StrategyStore) DeleteStrategy(strategyID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM strategy_versions WHERE strategy_id = ?`, strategyID); err != nil {
+		return fmt.Errorf("删除策略版本失败: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM ml_models WHERE strategy_id = ?`, strategyID); err != nil {
+		return fmt.Errorf("删除机器学习模型失败: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM strategies WHERE id = ?`, strategyID); err != nil {
+		return fmt.Errorf("删除策略失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// LoadStrategies 加载全部策略
+func (s *StrategyStore) LoadStrategies() ([]*models.Strategy, error) {
+	rows, err := s.db.Query(`SELECT data FROM strategies ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("查询策略失败: %w", err)
+	}
+	defer rows.Close()
+
+	var strategies []*models.Strategy
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("扫描策略记录失败: %w", err)
+		}
+		var strategy models.Strategy
+		if err := json.Unmarshal([]byte(data), &strategy); err != nil {
+			return nil, fmt.Errorf("解析策略失败: %w", err)
+		}
+		strategies = append(strategies, &strategy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历策略记录失败: %w", err)
+	}
+	return strategies, nil
+}
+
+// LoadStrategyVersions 加载全部策略版本，按策略分组并按版本号升序排列
+func (s *StrategyStore) LoadStrategyVersions() (map[string][]models.StrategyVersion, error) {
+	rows, err := s.db.Query(`SELECT strategy_id, data FROM strategy_versions ORDER BY strategy_id, version`)
+	if err != nil {
+		return nil, fmt.Errorf("查询策略版本失败: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string][]models.StrategyVersion)
+	for rows.Next() {
+		var strategyID, data string
+		if err := rows.Scan(&strategyID, &data); err != nil {
+			return nil, fmt.Errorf("扫描策略版本失败: %w", err)
+		}
+		var version models.StrategyVersion
+		if err := json.Unmarshal([]byte(data), &version); err != nil {
+			return nil, fmt.Errorf("解析策略版本失败: %w", err)
+		}
+		versions[strategyID] = append(versions[strategyID], version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历策略版本失败: %w", err)
+	}
+	return versions, nil
+}
+
+// SaveMLModel 保存机器学习策略的模型，覆盖该策略之前训练的模型
+func (s *StrategyStore) SaveMLModel(model *models.MLModel) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("序列化机器学习模型失败: %w", err)
+	}
+	if _, err := s.db.Exec(`
+		INSERT INTO ml_models (strategy_id, data, trained_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(strategy_id) DO UPDATE SET
+			data = excluded.data,
+			trained_at = excluded.trained_at
+	`, model.StrategyID, string(data), model.TrainedAt); err != nil {
+		return fmt.Errorf("保存机器学习模型失败: %w", err)
+	}
+	return nil
+}
+
+// LoadMLModels 加载全部机器学习模型，按策略ID索引
+func (s *StrategyStore) LoadMLModels() (map[string]*models.MLModel, error) {
+	rows, err := s.db.Query(`SELECT data FROM ml_models`)
+	if err != nil {
+		return nil, fmt.Errorf("查询机器学习模型失败: %w", err)
+	}
+	defer rows.Close()
+
+	mlModels := make(map[string]*models.MLModel)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("扫描机器学习模型失败: %w", err)
+		}
+		var model models.MLModel
+		if err := json.Unmarshal([]byte(data), &model); err != nil {
+			return nil, fmt.Errorf("解析机器学习模型失败: %w", err)
+		}
+		mlModels[model.StrategyID] = &model
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历机器学习模型失败: %w", err)
+	}
+	return mlModels, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+// SetStore 启用策略持久化存储，从数据库加载策略和版本历史
+// 数据库中还没有策略时，把当前内存中的默认策略写入数据库
+func (s *StrategyService) SetStore(store *StrategyStore) error {
+	strategies, err := store.LoadStrategies()
+	if err != nil {
+		return err
+	}
+	versions, err := store.LoadStrategyVersions()
+	if err != nil {
+		return err
+	}
+	mlModels, err := store.LoadMLModels()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(strategies) == 0 {
+		for id, strategy := range s.strategies {
+			if err := saveStrategyWithVersions(store, strategy, s.versions[id]); err != nil {
+				return err
+			}
+		}
+		s.store = store
+		s.logger.Info("已将默认策略写入数据库", logger.Int("count", len(s.strategies)))
+		return nil
+	}
+
+	s.strategies = make(map[string]*models.Strategy, len(strategies))
+	for _, strategy := range strategies {
+		s.strategies[strategy.ID] = strategy
+	}
+	s.versions = versions
+	s.mlModels = mlModels
+	s.store = store
+
+	s.logger.Info("已加载持久化的策略", logger.Int("count", len(strategies)))
+	return nil
+}
+
+// saveStrategyWithVersions 写入策略及其全部版本
+func saveStrategyWithVersions(store *StrategyStore, strategy *models.Strategy, versions []models.StrategyVersion) error {
+	if len(versions) == 0 {
+		return store.SaveStrategy(strategy, nil)
+	}
+	for i := range versions {
+		if err := store.SaveStrategy(strategy, &versions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveStrategy 保存策略但不生成新版本，调用方需持有写锁
+func (s *StrategyService) saveStrategy(strategy *models.Strategy) error {
+	if s.store != nil {
+		if err := s.store.SaveStrategy(strategy, nil); err != nil {
+			return err
+		}
+	}
+	s.strategies[strategy.ID] = strategy
+	return nil
+}
+
+// commitStrategyVersion 为策略分配下一个版本号并保存版本快照，调用方需持有写锁
+func (s *StrategyService) commitStrategyVersion(strategy *models.Strategy, changelog string) error {
+	next := 1
+	if history := s.versions[strategy.ID]; len(history) > 0 {
+		last, err := strconv.Atoi(history[len(history)-1].Version)
+		if err != nil {
+			return fmt.Errorf("策略版本号无效: %s", history[len(history)-1].Version)
+		}
+		next = last + 1
+	}
+	strategy.Version = strconv.Itoa(next)
+
+	version := newStrategyVersion(strategy, changelog)
+	if s.store != nil {
+		if err := s.store.SaveStrategy(strategy, &version); err != nil {
+			return err
+		}
+	}
+	s.strategies[strategy.ID] = strategy
+	s.versions[strategy.ID] = append(s.versions[strategy.ID], version)
+	return nil
+}
+
+// newStrategyVersion 按策略当前定义生成版本快照，参数深拷贝，之后修改策略不影响快照
+func newStrategyVersion(strategy *models.Strategy, changelog string) models.StrategyVersion {
+	createdAt := strategy.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = strategy.CreatedAt
+	}
+	return models.StrategyVersion{
+		ID:          fmt.Sprintf("%s-v%s", strategy.ID, strategy.Version),
+		StrategyID:  strategy.ID,
+		Version:     strategy.Version,
+		Name:        strategy.Name,
+		Description: strategy.Description,
+		Code:        strategy.Code,
+		Parameters:  copyStrategyParameters(strategy.Parameters),
+		Changelog:   changelog,
+		CreatedAt:   createdAt,
+	}
+}
+
+// copyStrategyParameters 通过JSON往返深拷贝参数，同时把数值统一为 float64，便于比较
+func copyStrategyParameters(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return params
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return params
+	}
+	return copied
+}
+
+// ListStrategyVersions 获取策略的全部版本，按版本号升序
+func (s *StrategyService) ListStrategyVersions(ctx context.Context, strategyID string) ([]models.StrategyVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.strategies[strategyID]; !exists {
+		return nil, ErrStrategyNotFound
+	}
+
+	versions := make([]models.StrategyVersion, len(s.versions[strategyID]))
+	copy(versions, s.versions[strategyID])
+	return versions, nil
+}
+
+// GetStrategyVersion 获取策略的指定版本
+func (s *StrategyService) GetStrategyVersion(ctx context.Context, strategyID, version string) (*models.StrategyVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	found, err := s.findStrategyVersion(strategyID, version)
+	if err != nil {
+		return nil, err
+	}
+	versionCopy := *found
+	versionCopy.Parameters = copyStrategyParameters(found.Parameters)
+	return &versionCopy, nil
+}
+
+// findStrategyVersion 查找策略版本，调用方需持有锁
+func (s *StrategyService) findStrategyVersion(strategyID, version string) (*models.StrategyVersion, error) {
+	if _, exists := s.strategies[strategyID]; !exists {
+		return nil, ErrStrategyNotFound
+	}
+	history := s.versions[strategyID]
+	for i := range history {
+		if history[i].Version == version {
+			return &history[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s 版本 %s", ErrStrategyVersionNotFound, strategyID, version)
+}
+
+// DiffStrategyVersions 比较策略两个版本的参数
+func (s *StrategyService) DiffStrategyVersions(ctx context.Context, strategyID, fromVersion, toVersion string) (*models.StrategyVersionDiff, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	from, err := s.findStrategyVersion(strategyID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.findStrategyVersion(strategyID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.StrategyVersionDiff{
+		StrategyID:  strategyID,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Changes:     diffStrategyParameters(from.Parameters, to.Parameters),
+		CodeChanged: from.Code != to.Code,
+	}, nil
+}
+
+// diffStrategyParameters 列出从 from 到 to 新增、删除和修改的参数，按参数名排序
+func diffStrategyParameters(from, to map[string]interface{}) []models.StrategyParameterChange {
+	keys := make(map[string]struct{}, len(from)+len(to))
+	for key := range from {
+		keys[key] = struct{}{}
+	}
+	for key := range to {
+		keys[key] = struct{}{}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	changes := []models.StrategyParameterChange{}
+	for _, key := range sortedKeys {
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		switch {
+		case !inFrom:
+			changes = append(changes, models.StrategyParameterChange{Key: key, Change: "added", To: toValue})
+		case !inTo:
+			changes = append(changes, models.StrategyParameterChange{Key: key, Change: "removed", From: fromValue})
+		case !reflect.DeepEqual(fromValue, toValue):
+			changes = append(changes, models.StrategyParameterChange{Key: key, Change: "modified", From: fromValue, To: toValue})
+		}
+	}
+	return changes
+}
+
+// RollbackStrategy 把策略的名称、描述、参数和代码恢复为指定版本，并作为新版本保存
+// 历史版本保持不变，回滚本身也可以再次回滚
+func (s *StrategyService) RollbackStrategy(ctx context.Context, strategyID, version string) (*models.Strategy, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	target, err := s.findStrategyVersion(strategyID, version)
+	if err != nil {
+		return nil, err
+	}
+	for id, existing := range s.strategies {
+		if id != strategyID && existing.Name == target.Name {
+			return nil, fmt.Errorf("策略名称已存在: %s", target.Name)
+		}
+	}
+
+	updated := *s.strategies[strategyID]
+	updated.Name = target.Name
+	updated.Description = target.Description
+	updated.Code = target.Code
+	updated.Parameters = copyStrategyParameters(target.Parameters)
+	if err := s.validateStrategyParameters(&updated); err != nil {
+		return nil, fmt.Errorf("策略参数验证失败: %w", err)
+	}
+	updated.UpdatedAt = time.Now()
+
+	if err := s.commitStrategyVersion(&updated, fmt.Sprintf("回滚到版本 %s", version)); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("策略回滚成功",
+		logger.String("strategy_id", strategyID),
+		logger.String("target_version", version),
+		logger.String("new_version", updated.Version),
+	)
+
+	strategyCopy := updated
+	return &strategyCopy, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"stock-a-future/internal/models"
+)
+
+func TestStrategyVersions(t *testing.T) {
+	service := newTestStrategyService(t)
+	ctx := context.Background()
+
+	strategy, err := service.GetStrategy(ctx, "ma_crossover")
+	if err != nil {
+		t.Fatalf("获取策略失败: %v", err)
+	}
+	if strategy.Version != "1" {
+		t.Fatalf("默认策略应为版本1, 实际 %s", strategy.Version)
+	}
+
+	params := copyStrategyParameters(strategy.Parameters)
+	params["short_period"] = 8.0
+	params["extra"] = "x"
+	if err := service.UpdateStrategy(ctx, "ma_crossover", &models.UpdateStrategyRequest{Parameters: &params}); err != nil {
+		t.Fatalf("更新策略失败: %v", err)
+	}
+	status := models.StrategyStatusInactive
+	if err := service.UpdateStrategy(ctx, "ma_crossover", &models.UpdateStrategyRequest{Status: &status}); err != nil {
+		t.Fatalf("更新策略状态失败: %v", err)
+	}
+
+	versions, err := service.ListStrategyVersions(ctx, "ma_crossover")
+	if err != nil {
+		t.Fatalf("获取版本列表失败: %v", err)
+	}
+	if len(versions) != 2 || versions[1].Version != "2" || versions[1].Changelog != "修改参数" {
+		t.Fatalf("更新参数应生成版本2，只修改状态不生成版本: %+v", versions)
+	}
+
+	// 参数校验失败时不生成版本，也不修改策略
+	invalid := map[string]interface{}{"short_period": 30.0, "long_period": 10.0}
+	if err := service.UpdateStrategy(ctx, "ma_crossover", &models.UpdateStrategyRequest{Parameters: &invalid}); err == nil {
+		t.Fatal("短期周期大于长期周期应校验失败")
+	}
+	if current, _ := service.GetStrategy(ctx, "ma_crossover"); current.Version != "2" || current.Parameters["short_period"] != 8.0 {
+		t.Errorf("校验失败不应修改策略: %+v", current)
+	}
+
+	diff, err := service.DiffStrategyVersions(ctx, "ma_crossover", "1", "2")
+	if err != nil {
+		t.Fatalf("比较版本失败: %v", err)
+	}
+	if len(diff.Changes) != 2 ||
+		diff.Changes[0].Key != "extra" || diff.Changes[0].Change != "added" ||
+		diff.Changes[1].Key != "short_period" || diff.Changes[1].Change != "modified" || diff.Changes[1].To != 8.0 {
+		t.Errorf("参数差异不正确: %+v", diff.Changes)
+	}
+
+	rolledBack, err := service.RollbackStrategy(ctx, "ma_crossover", "1")
+	if err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	if rolledBack.Version != "3" || rolledBack.Status != models.StrategyStatusInactive {
+		t.Errorf("回滚应生成版本3并保留当前状态: %+v", rolledBack)
+	}
+	diff, err = service.DiffStrategyVersions(ctx, "ma_crossover", "1", "3")
+	if err != nil || len(diff.Changes) != 0 {
+		t.Errorf("回滚后的参数应与版本1一致: %+v, %v", diff, err)
+	}
+
+	if _, err := service.GetStrategyVersion(ctx, "ma_crossover", "9"); !errors.Is(err, ErrStrategyVersionNotFound) {
+		t.Errorf("不存在的版本应返回 ErrStrategyVersionNotFound, 实际 %v", err)
+	}
+	if _, err := service.ListStrategyVersions(ctx, "missing"); !errors.Is(err, ErrStrategyNotFound) {
+		t.Errorf("不存在的策略应返回 ErrStrategyNotFound, 实际 %v", err)
+	}
+}
+
+func TestStrategyStore_SurvivesRestart(t *testing.T) {
+	database, err := NewDatabaseService(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+
+	service := newTestStrategyService(t)
+	if err := service.SetStore(NewStrategyStore(database.GetDB())); err != nil {
+		t.Fatalf("启用持久化存储失败: %v", err)
+	}
+
+	name := "均线交叉策略（调优）"
+	if err := service.UpdateStrategy(ctx, "ma_crossover", &models.UpdateStrategyRequest{Name: &name, Changelog: "调整名称"}); err != nil {
+		t.Fatalf("更新策略失败: %v", err)
+	}
+	if err := service.DeleteStrategy(ctx, "rsi_strategy"); err != nil {
+		t.Fatalf("删除策略失败: %v", err)
+	}
+
+	restarted := newTestStrategyService(t)
+	if err := restarted.SetStore(NewStrategyStore(database.GetDB())); err != nil {
+		t.Fatalf("重新加载策略失败: %v", err)
+	}
+
+	strategy, err := restarted.GetStrategy(ctx, "ma_crossover")
+	if err != nil {
+		t.Fatalf("重启后应能获取策略: %v", err)
+	}
+	if strategy.Name != name || strategy.Version != "2" {
+		t.Errorf("重启后策略应保持最新版本: %+v", strategy)
+	}
+	versions, err := restarted.ListStrategyVersions(ctx, "ma_crossover")
+	if err != nil || len(versions) != 2 || versions[1].Changelog != "调整名称" || versions[0].Name == name {
+		t.Errorf("重启后应恢复版本历史: %+v, %v", versions, err)
+	}
+	if _, err := restarted.GetStrategy(ctx, "rsi_strategy"); !errors.Is(err, ErrStrategyNotFound) {
+		t.Errorf("已删除的策略重启后不应恢复默认定义, 实际 %v", err)
+	}
+}
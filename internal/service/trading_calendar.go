@@ -2,6 +2,8 @@ package service
 
 import (
 	"time"
+
+	"stock-a-future/internal/models"
 )
 
 // TradingCalendar 交易日历服务
@@ -122,6 +124,25 @@ func (tc *TradingCalendar) GetPreviousTradingDay(date time.Time) time.Time {
 	return prevDay
 }
 
+// IsFirstTradingDayOfPeriod 判断是否为所在周、月或季度的第一个交易日
+func (tc *TradingCalendar) IsFirstTradingDayOfPeriod(date time.Time, frequency models.RebalanceFrequency) bool {
+	if !tc.IsTradingDay(date) {
+		return false
+	}
+
+	prev := tc.GetPreviousTradingDay(date)
+	switch frequency {
+	case models.RebalanceWeekly:
+		year, week := date.ISOWeek()
+		prevYear, prevWeek := prev.ISOWeek()
+		return year != prevYear || week != prevWeek
+	case models.RebalanceQuarterly:
+		return date.Year() != prev.Year() || (date.Month()-1)/3 != (prev.Month()-1)/3
+	default:
+		return date.Year() != prev.Year() || date.Month() != prev.Month()
+	}
+}
+
 // GetTradingDaysInRange 获取指定日期范围内的所有交易日
 func (tc *TradingCalendar) GetTradingDaysInRange(startDate, endDate time.Time) []time.Time {
 	var tradingDays []time.Time
@@ -3,6 +3,8 @@ package service
 import (
 	"testing"
 	"time"
+
+	"stock-a-future/internal/models"
 )
 
 func TestTradingCalendar_IsTradingDay(t *testing.T) {
@@ -137,3 +139,33 @@ func TestTradingCalendar_GetNextTradingDay(t *testing.T) {
 		})
 	}
 }
+
+func TestTradingCalendar_IsFirstTradingDayOfPeriod(t *testing.T) {
+	tc := NewTradingCalendar()
+
+	testCases := []struct {
+		date      string
+		frequency models.RebalanceFrequency
+		expected  bool
+	}{
+		{"2024-10-08", models.RebalanceWeekly, true},     // 国庆节后第一个交易日
+		{"2024-10-08", models.RebalanceMonthly, true},    // 10月1-7日休市
+		{"2024-10-08", models.RebalanceQuarterly, true},  // 第四季度
+		{"2024-10-09", models.RebalanceMonthly, false},   // 10月第二个交易日
+		{"2024-09-23", models.RebalanceWeekly, true},     // 周一
+		{"2024-09-24", models.RebalanceWeekly, false},    // 周二
+		{"2024-11-01", models.RebalanceMonthly, true},    // 11月第一个交易日
+		{"2024-11-01", models.RebalanceQuarterly, false}, // 季度中间的月份
+		{"2024-09-21", models.RebalanceWeekly, false},    // 周六非交易日
+	}
+
+	for _, tcCase := range testCases {
+		date, err := time.Parse("2006-01-02", tcCase.date)
+		if err != nil {
+			t.Fatalf("解析日期失败: %v", err)
+		}
+		if result := tc.IsFirstTradingDayOfPeriod(date, tcCase.frequency); result != tcCase.expected {
+			t.Errorf("%s 是否为%s调仓日: 期望 %v, 实际 %v", tcCase.date, tcCase.frequency, tcCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"stock-a-future/internal/models"
+)
+
+// MarketBoard 股票所属板块
+type MarketBoard string
+
+const (
+	MarketBoardMain    MarketBoard = "main"    // 沪深主板
+	MarketBoardChiNext MarketBoard = "chinext" // 创业板
+	MarketBoardSTAR    MarketBoard = "star"    // 科创板
+	MarketBoardBSE     MarketBoard = "bse"     // 北交所
+)
+
+const (
+	// priceTick A股最小报价单位
+	priceTick = 0.01
+	// boardLotSize 一手股数
+	boardLotSize = 100
+	// starMinOrderQuantity 科创板单笔最小申报数量
+	starMinOrderQuantity = 200
+)
+
+// DetectMarketBoard 根据股票代码判断所属板块
+// 支持 "688001"、"688001.SH"、"SH688001" 等格式
+func DetectMarketBoard(symbol string) MarketBoard {
+	code := strings.ToUpper(strings.TrimSpace(symbol))
+	if strings.HasSuffix(code, ".BJ") || strings.HasPrefix(code, "BJ") {
+		return MarketBoardBSE
+	}
+	if idx := strings.Index(code, "."); idx >= 0 {
+		code = code[:idx]
+	}
+	code = strings.TrimPrefix(strings.TrimPrefix(code, "SH"), "SZ")
+
+	switch {
+	case strings.HasPrefix(code, "688") || strings.HasPrefix(code, "689"):
+		return MarketBoardSTAR
+	case strings.HasPrefix(code, "300") || strings.HasPrefix(code, "301"):
+		return MarketBoardChiNext
+	case strings.HasPrefix(code, "4") || strings.HasPrefix(code, "8") || strings.HasPrefix(code, "92"):
+		return MarketBoardBSE
+	}
+	return MarketBoardMain
+}
+
+// IsSTStockName 根据股票名称判断是否为ST/*ST股票
+func IsSTStockName(name string) bool {
+	return strings.Contains(strings.ToUpper(name), "ST")
+}
+
+// AShareTradingRules A股模拟交易所规则（T+1、整手、涨跌停、停牌、最小报价单位）
+type AShareTradingRules struct{}
+
+// NewAShareTradingRules 创建A股交易规则
+func NewAShareTradingRules() *AShareTradingRules {
+	return &AShareTradingRules{}
+}
+
+// PriceLimitRatio 获取涨跌幅限制比例
+// 主板±10%，创业板/科创板±20%，北交所±30%，主板ST股票±5%
+func (r *AShareTradingRules) PriceLimitRatio(symbol string, isST bool) float64 {
+	switch DetectMarketBoard(symbol) {
+	case MarketBoardChiNext, MarketBoardSTAR:
+		return 0.20
+	case MarketBoardBSE:
+		return 0.30
+	}
+	if isST {
+		return 0.05
+	}
+	return 0.10
+}
+
+// LimitPrices 根据昨收价计算涨停价和跌停价
+func (r *AShareTradingRules) LimitPrices(symbol string, isST bool, prevClose float64) (limitUp, limitDown float64) {
+	upCents, downCents := r.limitCents(symbol, isST, prevClose)
+	return centsToPrice(upCents), centsToPrice(downCents)
+}
+
+// limitCents 以分为单位计算涨停价和跌停价：昨收价×(1±涨跌幅)按四舍五入取到分
+// 全程使用整数运算，避免 1.1300000000000001 这类浮点误差让恰好涨跌停的价格通过检查
+func (r *AShareTradingRules) limitCents(symbol string, isST bool, prevClose float64) (limitUp, limitDown int64) {
+	prevCents := priceCents(prevClose)
+	ratioBasisPoints := int64(math.Round(r.PriceLimitRatio(symbol, isST) * 10000))
+	limitUp = (prevCents*(10000+ratioBasisPoints) + 5000) / 10000
+	limitDown = (prevCents*(10000-ratioBasisPoints) + 5000) / 10000
+	return limitUp, limitDown
+}
+
+// RoundToTick 将价格对齐到0.01元的最小报价单位
+func (r *AShareTradingRules) RoundToTick(price float64) float64 {
+	return centsToPrice(priceCents(price))
+}
+
+// priceCents 将价格换算为整数分，价格比较都按分进行
+func priceCents(price float64) int64 {
+	return int64(math.Round(price / priceTick))
+}
+
+// centsToPrice 将整数分换算为元，结果是最接近该两位小数的浮点数
+func centsToPrice(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// ClampToPriceLimits 将成交价限制在当日涨跌停价范围内
+func (r *AShareTradingRules) ClampToPriceLimits(bar *orderBar, price float64) float64 {
+	if bar.prevClose <= 0 {
+		return price
+	}
+	limitUp, limitDown := r.limitCents(bar.marketData.Symbol, bar.isST, bar.prevClose)
+	switch cents := priceCents(price); {
+	case cents > limitUp:
+		return centsToPrice(limitUp)
+	case cents < limitDown:
+		return centsToPrice(limitDown)
+	}
+	return price
+}
+
+// NormalizeBuyQuantity 将买入数量调整为合法的申报数量，不满足最小申报数量时返回0
+// 主板、创业板、北交所按100股整数倍申报；科创板最少200股，超出部分可按1股递增
+func (r *AShareTradingRules) NormalizeBuyQuantity(symbol string, quantity int) int {
+	if DetectMarketBoard(symbol) == MarketBoardSTAR {
+		if quantity < starMinOrderQuantity {
+			return 0
+		}
+		return quantity
+	}
+	return quantity / boardLotSize * boardLotSize
+}
+
+// orderBar 单只股票在某个交易日的撮合环境
+type orderBar struct {
+	marketData   *models.MarketData
+	prevClose    float64             // 昨收价，用于计算涨跌停价
+	suspended    bool                // 当日是否停牌（无成交数据）
+	isST         bool                // 是否为ST股票
+	history      []models.StockDaily // 截至当日的历史K线，供仓位计算等使用
+	universeSize int                 // 当日股票池的股票数量，供等权仓位计算，为0时使用回测的股票列表数量
+}
+
+// CheckBuy 检查买入订单是否满足交易规则，返回拒绝原因（为空表示允许）
+func (r *AShareTradingRules) CheckBuy(bar *orderBar, price float64) models.OrderRejectReason {
+	if bar.suspended {
+		return models.OrderRejectSuspended
+	}
+	if bar.prevClose > 0 {
+		limitUp, _ := r.limitCents(bar.marketData.Symbol, bar.isST, bar.prevClose)
+		if priceCents(price) >= limitUp {
+			return models.OrderRejectLimitUp
+		}
+	}
+	return ""
+}
+
+// CheckSell 检查卖出订单是否满足交易规则，返回拒绝原因（为空表示允许）
+func (r *AShareTradingRules) CheckSell(bar *orderBar, price float64, position models.Position) models.OrderRejectReason {
+	if bar.suspended {
+		return models.OrderRejectSuspended
+	}
+	if r.SellableQuantity(position, bar.marketData.Date) <= 0 {
+		return models.OrderRejectTPlusOne
+	}
+	if bar.prevClose > 0 {
+		_, limitDown := r.limitCents(bar.marketData.Symbol, bar.isST, bar.prevClose)
+		if priceCents(price) <= limitDown {
+			return models.OrderRejectLimitDown
+		}
+	}
+	return ""
+}
+
+// SellableQuantity 计算T+1规则下当日可卖出的数量（当日买入的股份不可卖出）
+func (r *AShareTradingRules) SellableQuantity(position models.Position, date time.Time) int {
+	if sameTradingDay(position.LastBuyDate, date) {
+		return position.Quantity - position.LastBuyQuantity
+	}
+	return position.Quantity
+}
+
+// sameTradingDay 判断两个时间是否为同一自然日
+func sameTradingDay(a, b time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return false
+	}
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDetectMarketBoardAndPriceLimit(t *testing.T) {
+	rules := NewAShareTradingRules()
+
+	tests := []struct {
+		symbol string
+		isST   bool
+		board  MarketBoard
+		ratio  float64
+	}{
+		{"600000.SH", false, MarketBoardMain, 0.10},
+		{"000001.SZ", true, MarketBoardMain, 0.05},
+		{"300750.SZ", false, MarketBoardChiNext, 0.20},
+		{"300750.SZ", true, MarketBoardChiNext, 0.20},
+		{"688981.SH", false, MarketBoardSTAR, 0.20},
+		{"SH688981", false, MarketBoardSTAR, 0.20},
+		{"830799.BJ", false, MarketBoardBSE, 0.30},
+	}
+
+	for _, tt := range tests {
+		if board := DetectMarketBoard(tt.symbol); board != tt.board {
+			t.Errorf("%s 板块判断错误: 期望 %s, 实际 %s", tt.symbol, tt.board, board)
+		}
+		if ratio := rules.PriceLimitRatio(tt.symbol, tt.isST); ratio != tt.ratio {
+			t.Errorf("%s (ST=%v) 涨跌幅错误: 期望 %.2f, 实际 %.2f", tt.symbol, tt.isST, tt.ratio, ratio)
+		}
+	}
+
+	limitUp, limitDown := rules.LimitPrices("600000.SH", false, 10.05)
+	if math.Abs(limitUp-11.06) > 1e-9 || math.Abs(limitDown-9.05) > 1e-9 {
+		t.Errorf("涨跌停价计算错误: %.2f / %.2f", limitUp, limitDown)
+	}
+}
+
+// 遍历昨收价网格：恰好等于涨停价/跌停价的价格必须被拒绝，差一个最小报价单位的价格必须允许
+// 涨跌停价用 decimal 独立计算，价格按行情数据的方式由十进制转换为浮点数
+func TestPriceLimitsOnTickGrid(t *testing.T) {
+	rules := NewAShareTradingRules()
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		symbol string
+		isST   bool
+		ratio  string
+	}{
+		{"600000.SH", false, "0.10"},
+		{"600000.SH", true, "0.05"},
+		{"300750.SZ", false, "0.20"},
+	}
+	tick := decimal.New(1, -2)
+
+	for _, c := range cases {
+		ratio := decimal.RequireFromString(c.ratio)
+		failures := 0
+		for cents := int64(100); cents <= 5000; cents++ {
+			prev := decimal.New(cents, -2)
+			limitUp := prev.Mul(decimal.NewFromInt(1).Add(ratio)).Round(2)
+			limitDown := prev.Mul(decimal.NewFromInt(1).Sub(ratio)).Round(2)
+			bar := &orderBar{
+				marketData: &models.MarketData{Symbol: c.symbol, Date: date},
+				prevClose:  prev.InexactFloat64(),
+				isST:       c.isST,
+			}
+			position := models.Position{Symbol: c.symbol, Quantity: 100}
+
+			if up, down := rules.LimitPrices(c.symbol, c.isST, bar.prevClose); up != limitUp.InexactFloat64() || down != limitDown.InexactFloat64() {
+				t.Errorf("%s 昨收 %s 涨跌停价错误: %v / %v", c.symbol, prev, up, down)
+			}
+			if rules.CheckBuy(bar, limitUp.InexactFloat64()) != models.OrderRejectLimitUp ||
+				rules.CheckBuy(bar, limitUp.Sub(tick).InexactFloat64()) != "" ||
+				rules.CheckSell(bar, limitDown.InexactFloat64(), position) != models.OrderRejectLimitDown ||
+				rules.CheckSell(bar, limitDown.Add(tick).InexactFloat64(), position) != "" {
+				failures++
+				if failures <= 5 {
+					t.Errorf("%s (ST=%v) 昨收 %s: 涨停 %s / 跌停 %s 的检查错误", c.symbol, c.isST, prev, limitUp, limitDown)
+				}
+			}
+		}
+		if failures > 0 {
+			t.Errorf("%s (ST=%v) 共 %d 个昨收价的涨跌停检查错误", c.symbol, c.isST, failures)
+		}
+	}
+}
+
+func TestSymbolHistoryDatedST(t *testing.T) {
+	bars := buildTestDailyBars("600001.SH", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), []float64{10, 10.2})
+	history := newSymbolHistory(bars)
+	history.isST = true // 当前名称为ST
+	history.nameChanges = []models.NameChange{
+		{Name: "示例股份", StartDate: "20100105"},
+		{Name: "ST示例", StartDate: "20210430"},
+		{Name: "示例股份", StartDate: "20220601"},
+		{Name: "*ST示例", StartDate: "20240430"},
+	}
+
+	tests := []struct {
+		date string
+		st   bool
+	}{
+		{"20200103", false},
+		{"20210430", true},
+		{"20220531", true},
+		{"20230301", false},
+		{"20240506", true},
+	}
+	for _, tt := range tests {
+		date, _ := parseTradeDate(tt.date)
+		if got := history.isSTOn(date); got != tt.st {
+			t.Errorf("%s 的ST状态应为 %v", tt.date, tt.st)
+		}
+	}
+
+	// 2020年尚未戴帽，应使用主板±10%的涨跌停价
+	first, _ := parseTradeDate(bars[1].TradeDate)
+	if bar := history.orderBar(&models.MarketData{Symbol: "600001.SH", Date: first}, first); bar.isST {
+		t.Error("戴帽之前的交易日不应按ST股票撮合")
+	}
+
+	// 没有简称变更历史时按当前名称判断
+	history.nameChanges = nil
+	if !history.isSTOn(first) {
+		t.Error("没有简称变更历史时应按当前名称判断")
+	}
+}
+
+func TestNormalizeBuyQuantity(t *testing.T) {
+	rules := NewAShareTradingRules()
+
+	if q := rules.NormalizeBuyQuantity("600000.SH", 1234); q != 1200 {
+		t.Errorf("主板应按100股取整, 实际 %d", q)
+	}
+	if q := rules.NormalizeBuyQuantity("600000.SH", 99); q != 0 {
+		t.Errorf("不足一手应返回0, 实际 %d", q)
+	}
+	if q := rules.NormalizeBuyQuantity("688981.SH", 199); q != 0 {
+		t.Errorf("科创板不足200股应返回0, 实际 %d", q)
+	}
+	if q := rules.NormalizeBuyQuantity("688981.SH", 201); q != 201 {
+		t.Errorf("科创板超过200股可按1股递增, 实际 %d", q)
+	}
+}
+
+func TestCheckOrderRules(t *testing.T) {
+	rules := NewAShareTradingRules()
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	bar := &orderBar{
+		marketData: &models.MarketData{Symbol: "600000.SH", Date: date, Close: 11.00},
+		prevClose:  10.00,
+	}
+
+	if reason := rules.CheckBuy(bar, 11.00); reason != models.OrderRejectLimitUp {
+		t.Errorf("涨停价买入应被拒绝, 实际: %q", reason)
+	}
+	if reason := rules.CheckBuy(bar, 10.99); reason != "" {
+		t.Errorf("未涨停应允许买入, 实际: %q", reason)
+	}
+
+	position := models.Position{Symbol: "600000.SH", Quantity: 300, LastBuyDate: date, LastBuyQuantity: 300}
+	if reason := rules.CheckSell(bar, 10.50, position); reason != models.OrderRejectTPlusOne {
+		t.Errorf("当日买入的股份卖出应被拒绝, 实际: %q", reason)
+	}
+	position.LastBuyQuantity = 100
+	if q := rules.SellableQuantity(position, date); q != 200 {
+		t.Errorf("可卖数量应扣除当日买入部分, 实际 %d", q)
+	}
+	if q := rules.SellableQuantity(position, date.AddDate(0, 0, 1)); q != 300 {
+		t.Errorf("次日应可全部卖出, 实际 %d", q)
+	}
+
+	bar.marketData.Close = 9.00
+	if reason := rules.CheckSell(bar, 9.00, position); reason != models.OrderRejectLimitDown {
+		t.Errorf("跌停价卖出应被拒绝, 实际: %q", reason)
+	}
+
+	bar.suspended = true
+	if reason := rules.CheckBuy(bar, 10.00); reason != models.OrderRejectSuspended {
+		t.Errorf("停牌日买入应被拒绝, 实际: %q", reason)
+	}
+}
+
+func TestSymbolHistoryOrderBarDetectsSuspension(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bars := buildTestDailyBars("600000.SH", start, []float64{10, 10.5, 11})
+	history := newSymbolHistory(bars)
+
+	last, _ := parseTradeDate(bars[2].TradeDate)
+	bar := history.orderBar(&models.MarketData{Symbol: "600000.SH", Date: last}, last)
+	if bar.suspended {
+		t.Error("有成交数据的交易日不应视为停牌")
+	}
+	if bar.prevClose != 10.5 {
+		t.Errorf("昨收价应为10.5, 实际 %.2f", bar.prevClose)
+	}
+
+	// 数据中缺失的交易日视为停牌
+	missing := last.AddDate(0, 0, 1)
+	bar = history.orderBar(&models.MarketData{Symbol: "600000.SH", Date: missing}, missing)
+	if !bar.suspended {
+		t.Error("缺失K线的交易日应视为停牌")
+	}
+}
+
+func TestExecuteSignalForStrategy_AppliesTradingRules(t *testing.T) {
+	service := NewBacktestService(nil, nil, nil, &noopLogger{})
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	backtest := &models.Backtest{ID: "bt", Commission: 0.0003}
+	bar := &orderBar{
+		marketData: &models.MarketData{Symbol: "600000.SH", Date: date, Close: 10.004},
+		prevClose:  10.00,
+	}
+	buy := &models.Signal{SignalType: models.SignalTypeBuy}
+	sell := &models.Signal{SignalType: models.SignalTypeSell}
+
+	portfolio := &models.Portfolio{Cash: 100000, Positions: make(map[string]models.Position)}
+	trade, rejected := service.executeSignalForStrategy(buy, bar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if trade == nil || rejected != nil {
+		t.Fatalf("期望买入成交, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+	if trade.Quantity%boardLotSize != 0 {
+		t.Errorf("买入数量应为整手, 实际 %d", trade.Quantity)
+	}
+	if trade.Price != 10.00 {
+		t.Errorf("成交价应对齐到0.01, 实际 %v", trade.Price)
+	}
+
+	// 当日卖出受T+1限制
+	trade, rejected = service.executeSignalForStrategy(sell, bar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if trade != nil || rejected == nil || rejected.Reason != models.OrderRejectTPlusOne {
+		t.Fatalf("期望T+1拒绝, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+
+	// 关闭交易规则后可当日卖出
+	backtest.DisableTradingRules = true
+	trade, rejected = service.executeSignalForStrategy(sell, bar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if trade == nil || rejected != nil {
+		t.Fatalf("关闭规则后应允许卖出, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+	backtest.DisableTradingRules = false
+
+	// 涨停价不可买入
+	bar.marketData.Close = 11.00
+	trade, rejected = service.executeSignalForStrategy(buy, bar, portfolio, backtest, "s1", NewPositionSizer(nil, nil))
+	if trade != nil || rejected == nil || rejected.Reason != models.OrderRejectLimitUp {
+		t.Fatalf("期望涨停拒绝, 实际 trade=%v rejected=%v", trade, rejected)
+	}
+}
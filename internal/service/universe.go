@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+// ErrInvalidUniverse 动态股票池配置无效
+var ErrInvalidUniverse = errors.New("股票池配置无效")
+
+// universeListingGrace 缺少上市日期时，首根K线晚于数据起点超过该自然日数才视为回测期间新上市（容忍长假休市和短期停牌）
+const universeListingGrace = 15
+
+// StockListSource 全部A股基本信息的来源，LocalStockService 实现了该接口
+type StockListSource interface {
+	GetAllStocks() []*models.StockBasic
+}
+
+// FavoriteStockSource 自选股的来源，FavoriteService 实现了该接口
+type FavoriteStockSource interface {
+	GetFavorites() []*models.FavoriteStock
+}
+
+// ValidateUniverseConfig 校验动态股票池参数，为空表示使用固定股票列表
+func ValidateUniverseConfig(config *models.UniverseConfig) error {
+	if config == nil {
+		return nil
+	}
+
+	switch config.Type {
+	case models.UniverseAll:
+	case models.UniverseIndustry:
+		if strings.TrimSpace(config.Industry) == "" {
+			return fmt.Errorf("%w: 行业股票池需要指定 industry", ErrInvalidUniverse)
+		}
+	case models.UniverseBoard:
+		switch MarketBoard(config.Board) {
+		case MarketBoardMain, MarketBoardChiNext, MarketBoardSTAR, MarketBoardBSE:
+		default:
+			return fmt.Errorf("%w: 不支持的板块 %q", ErrInvalidUniverse, config.Board)
+		}
+	case models.UniverseFavorites:
+		if strings.TrimSpace(config.GroupID) == "" {
+			return fmt.Errorf("%w: 自选股股票池需要指定 group_id", ErrInvalidUniverse)
+		}
+	default:
+		return fmt.Errorf("%w: 不支持的股票池类型 %q", ErrInvalidUniverse, config.Type)
+	}
+	if config.MinListingDays < 0 {
+		return fmt.Errorf("%w: min_listing_days 不能为负数", ErrInvalidUniverse)
+	}
+	return nil
+}
+
+// backtestUniverse 回测的股票池：候选股票在回测开始时确定，每个交易日再按上市、退市和ST状态筛选成员
+type backtestUniverse struct {
+	config      *models.UniverseConfig // 为空表示固定股票列表，所有股票每天都是成员
+	symbols     []string               // 候选股票，需要预加载数据
+	listDates   map[string]time.Time   // 上市日期，未知时不限制上市时间
+	delistDates map[string]time.Time   // 已退市股票的退市日期
+	warnings    []string               // 数据源能力不足时降级处理的警告，记录到回测上
+}
+
+// resolveUniverse 确定回测的候选股票，未设置动态股票池时使用回测的固定股票列表
+// 全部A股、行业和板块股票池的候选股票包括回测开始后才退市的股票，避免幸存者偏差；
+// 数据源不提供退市股票列表时只使用当前上市的股票并记录警告，获取失败时返回错误
+func (s *BacktestService) resolveUniverse(backtest *models.Backtest) (*backtestUniverse, error) {
+	config := backtest.Universe
+	if config == nil {
+		return &backtestUniverse{symbols: backtest.Symbols, listDates: make(map[string]time.Time), delistDates: make(map[string]time.Time)}, nil
+	}
+	if err := ValidateUniverseConfig(config); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	stockList, favorites := s.stockListSource, s.favoriteSource
+	s.mutex.RUnlock()
+
+	universe := &backtestUniverse{config: config, listDates: make(map[string]time.Time), delistDates: make(map[string]time.Time)}
+	seen := make(map[string]bool)
+	add := func(symbol string) {
+		if symbol != "" && !seen[symbol] {
+			seen[symbol] = true
+			universe.symbols = append(universe.symbols, symbol)
+		}
+	}
+
+	if config.Type == models.UniverseFavorites {
+		if favorites == nil {
+			return nil, fmt.Errorf("%w: 未配置自选股服务", ErrInvalidUniverse)
+		}
+		for _, favorite := range favorites.GetFavorites() {
+			if favorite.GroupID == config.GroupID {
+				add(favorite.TSCode)
+			}
+		}
+	} else {
+		if stockList == nil {
+			return nil, fmt.Errorf("%w: 未配置股票列表", ErrInvalidUniverse)
+		}
+		delisted, err := s.delistedStocks()
+		switch {
+		case errors.Is(err, client.ErrUnsupported):
+			universe.warnings = append(universe.warnings, "数据源不提供已退市的股票列表，股票池只包含当前上市的股票，回测结果存在幸存者偏差")
+			s.logger.Warn("数据源不提供已退市的股票列表，股票池存在幸存者偏差",
+				logger.String("backtest_id", backtest.ID),
+				logger.ErrorField(err),
+			)
+		case err != nil:
+			return nil, fmt.Errorf("%w: 无法获取已退市的股票列表，股票池会遗漏回测期间退市的股票: %v", ErrInvalidUniverse, err)
+		}
+
+		stocks := stockList.GetAllStocks()
+		for i := range delisted {
+			// 回测开始前已退市的股票在回测期间不可能是成员
+			delistDate, err := parseTradeDate(delisted[i].DelistDate)
+			if err == nil && delistDate.Before(backtest.StartDate) {
+				continue
+			}
+			if err == nil {
+				universe.delistDates[delisted[i].TSCode] = delistDate
+			}
+			stocks = append(stocks, &delisted[i])
+		}
+		for _, stock := range stocks {
+			if !universeIncludes(config, stock) || seen[stock.TSCode] {
+				continue
+			}
+			add(stock.TSCode)
+			if listDate, err := parseTradeDate(stock.ListDate); err == nil {
+				universe.listDates[stock.TSCode] = listDate
+			}
+		}
+	}
+
+	if len(universe.symbols) == 0 {
+		return nil, fmt.Errorf("%w: 股票池中没有股票", ErrInvalidUniverse)
+	}
+	sort.Strings(universe.symbols)
+	return universe, nil
+}
+
+// delistedStocks 从当前数据源获取已退市的股票列表
+func (s *BacktestService) delistedStocks() ([]models.StockBasic, error) {
+	if s.dataSourceService == nil {
+		return nil, errors.New("数据源服务未配置")
+	}
+	dataClient, err := s.dataSourceService.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	return dataClient.GetDelistedStocks()
+}
+
+// universeIncludes 判断股票列表中的股票是否符合股票池的静态条件（行业、板块），B股不属于A股股票池
+// ST状态随时间变化，不在这里按当前名称判断，而是在每个交易日按当时的简称筛选
+func universeIncludes(config *models.UniverseConfig, stock *models.StockBasic) bool {
+	if stock == nil || stock.TSCode == "" || isBShare(stock.TSCode) {
+		return false
+	}
+	switch config.Type {
+	case models.UniverseIndustry:
+		return stock.Industry == config.Industry
+	case models.UniverseBoard:
+		return DetectMarketBoard(stock.TSCode) == MarketBoard(config.Board)
+	}
+	return true
+}
+
+// isBShare 判断是否为B股（沪市900、深市200开头）
+func isBShare(symbol string) bool {
+	return strings.HasPrefix(symbol, "900") || strings.HasPrefix(symbol, "200")
+}
+
+// prepare 预加载数据后补全上市日期：优先使用股票列表中的上市日期，其次是数据源的股票基本信息；
+// 都缺失时，若首根K线明显晚于所有股票的数据起点，视为当日上市，否则视为在数据起点之前上市
+// 排除ST股票需要按交易日还原当时的简称，数据源不提供证券简称变更历史时按当前名称判断并记录警告
+func (u *backtestUniverse) prepare(histories map[string]*symbolHistory) {
+	if u.config == nil {
+		return
+	}
+
+	var dataStart time.Time
+	for _, history := range histories {
+		if history.Len() > 0 && (dataStart.IsZero() || history.dates[0].Before(dataStart)) {
+			dataStart = history.dates[0]
+		}
+	}
+
+	for _, symbol := range u.symbols {
+		if _, ok := u.listDates[symbol]; ok {
+			continue
+		}
+		history := histories[symbol]
+		if history == nil || history.Len() == 0 {
+			continue
+		}
+		switch {
+		case !history.listDate.IsZero():
+			u.listDates[symbol] = history.listDate
+		case history.dates[0].After(dataStart.AddDate(0, 0, universeListingGrace)):
+			u.listDates[symbol] = history.dates[0]
+		}
+	}
+
+	if u.config.ExcludeST {
+		missing := 0
+		for _, symbol := range u.symbols {
+			if history := histories[symbol]; history != nil && history.Len() > 0 && !history.nameHistory {
+				missing++
+			}
+		}
+		if missing > 0 {
+			u.warnings = append(u.warnings, fmt.Sprintf("%d 只股票缺少证券简称变更历史，按当前名称排除ST股票，回测期间摘帽或戴帽的股票判断不准确", missing))
+		}
+	}
+}
+
+// members 返回指定交易日股票池中的股票，顺序与候选股票一致
+func (u *backtestUniverse) members(date time.Time, histories map[string]*symbolHistory) []string {
+	if u.config == nil {
+		return u.symbols
+	}
+
+	members := make([]string, 0, len(u.symbols))
+	for _, symbol := range u.symbols {
+		if u.isMember(symbol, date, histories[symbol]) {
+			members = append(members, symbol)
+		}
+	}
+	return members
+}
+
+// isMember 判断股票在指定交易日是否属于股票池：已上市且满足最短上市天数、未退市、当日不是被排除的ST股票
+// 退市日及之后、最后一根K线之后的交易日视为已退市（长期停牌的股票同样无法交易，一并移出）
+func (u *backtestUniverse) isMember(symbol string, date time.Time, history *symbolHistory) bool {
+	if history == nil || history.Len() == 0 {
+		return false
+	}
+	if u.config.ExcludeST && history.isSTOn(date) {
+		return false
+	}
+
+	lastDate := history.dates[history.Len()-1]
+	if date.After(lastDate) && !sameTradingDay(date, lastDate) {
+		return false
+	}
+	if delistDate, ok := u.delistDates[symbol]; ok && (date.After(delistDate) || sameTradingDay(date, delistDate)) {
+		return false
+	}
+
+	listDate, ok := u.listDates[symbol]
+	if !ok {
+		return true
+	}
+	eligible := listDate.AddDate(0, 0, u.config.MinListingDays)
+	return !date.Before(eligible) || sameTradingDay(date, eligible)
+}
+
+// holdsOrPending 判断是否有策略持有该股票或有该股票的未成交挂单
+func holdsOrPending(symbol string, portfolios map[string]*models.Portfolio, pendingOrders map[string]map[string]*models.Order) bool {
+	for strategyID, portfolio := range portfolios {
+		if portfolio.Positions[symbol].Quantity > 0 {
+			return true
+		}
+		if _, ok := pendingOrders[strategyID][symbol]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// describeUniverse 股票池参数的文字描述，用于报告展示
+func describeUniverse(config *models.UniverseConfig) string {
+	var parts []string
+	switch config.Type {
+	case models.UniverseAll:
+		parts = append(parts, "全部A股")
+	case models.UniverseIndustry:
+		parts = append(parts, "行业: "+config.Industry)
+	case models.UniverseBoard:
+		parts = append(parts, "板块: "+config.Board)
+	case models.UniverseFavorites:
+		parts = append(parts, "自选股分组: "+config.GroupID)
+	}
+	if config.ExcludeST {
+		parts = append(parts, "排除ST")
+	}
+	if config.MinListingDays > 0 {
+		parts = append(parts, fmt.Sprintf("上市满%d天", config.MinListingDays))
+	}
+	return strings.Join(parts, "，")
+}
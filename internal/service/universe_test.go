@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+// stubStockList 固定返回给定股票列表的模拟股票列表来源
+type stubStockList []*models.StockBasic
+
+func (l stubStockList) GetAllStocks() []*models.StockBasic { return l }
+
+// unsupportedUniverseClient 不提供退市股票列表和证券简称变更历史的模拟数据源（如AKTools）
+type unsupportedUniverseClient struct {
+	*client.MockDataSourceClient
+}
+
+func (c unsupportedUniverseClient) GetDelistedStocks() ([]models.StockBasic, error) {
+	return nil, client.ErrUnsupported
+}
+
+func (c unsupportedUniverseClient) GetNameChanges(symbol string) ([]models.NameChange, error) {
+	return nil, client.ErrUnsupported
+}
+
+// stubFavorites 固定返回给定自选股的模拟自选股来源
+type stubFavorites []*models.FavoriteStock
+
+func (f stubFavorites) GetFavorites() []*models.FavoriteStock { return f }
+
+func TestValidateUniverseConfig(t *testing.T) {
+	valid := []*models.UniverseConfig{
+		nil,
+		{Type: models.UniverseAll, ExcludeST: true, MinListingDays: 365},
+		{Type: models.UniverseIndustry, Industry: "银行"},
+		{Type: models.UniverseBoard, Board: "chinext"},
+		{Type: models.UniverseFavorites, GroupID: "default"},
+	}
+	for _, config := range valid {
+		if err := ValidateUniverseConfig(config); err != nil {
+			t.Errorf("配置 %+v 应有效: %v", config, err)
+		}
+	}
+
+	invalid := []*models.UniverseConfig{
+		{Type: "index"},
+		{Type: models.UniverseIndustry},
+		{Type: models.UniverseBoard, Board: "sme"},
+		{Type: models.UniverseFavorites},
+		{Type: models.UniverseAll, MinListingDays: -1},
+	}
+	for _, config := range invalid {
+		if err := ValidateUniverseConfig(config); !errors.Is(err, ErrInvalidUniverse) {
+			t.Errorf("配置 %+v 应返回 ErrInvalidUniverse, 实际 %v", config, err)
+		}
+	}
+}
+
+func TestResolveUniverse(t *testing.T) {
+	dataClient := client.NewMockDataSourceClient()
+	dataClient.DelistedStockData = []models.StockBasic{
+		{TSCode: "000003.SZ", Name: "PT金田A", Industry: "银行", ListDate: "19910703", DelistDate: "20020614"},
+		{TSCode: "600002.SH", Name: "退市银行", Industry: "银行", ListDate: "19990101", DelistDate: "20240315"},
+	}
+	service := NewBacktestService(nil, &DataSourceService{currentClient: dataClient}, nil, &noopLogger{})
+	stocks := stubStockList{
+		{TSCode: "600000.SH", Name: "浦发银行", Industry: "银行"},
+		{TSCode: "000001.SZ", Name: "平安银行", Industry: "银行", ListDate: "19910403"},
+		{TSCode: "300750.SZ", Name: "宁德时代", Industry: "电池"},
+		{TSCode: "688981.SH", Name: "中芯国际", Industry: "半导体"},
+		{TSCode: "600001.SH", Name: "*ST测试", Industry: "银行"},
+		{TSCode: "200002.SZ", Name: "万科B", Industry: "房地产"},
+	}
+	favorites := stubFavorites{
+		{TSCode: "000001.SZ", GroupID: "g1"},
+		{TSCode: "600519.SH", GroupID: "g1"},
+		{TSCode: "300750.SZ", GroupID: "g2"},
+	}
+
+	resolve := func(config *models.UniverseConfig) ([]string, error) {
+		universe, err := service.resolveUniverse(&models.Backtest{Symbols: []string{"fixed"}, StartDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Universe: config})
+		if err != nil {
+			return nil, err
+		}
+		return universe.symbols, nil
+	}
+
+	if _, err := resolve(&models.UniverseConfig{Type: models.UniverseAll}); !errors.Is(err, ErrInvalidUniverse) {
+		t.Errorf("未配置股票列表时应返回 ErrInvalidUniverse, 实际 %v", err)
+	}
+	service.SetUniverseSources(stocks, favorites)
+
+	// 候选股票包括回测开始后退市的股票（600002.SH），不包括回测开始前已退市的股票（000003.SZ）；
+	// ST状态按交易日判断，候选股票不按当前名称排除ST
+	tests := []struct {
+		config *models.UniverseConfig
+		want   []string
+	}{
+		{nil, []string{"fixed"}},
+		{&models.UniverseConfig{Type: models.UniverseAll}, []string{"000001.SZ", "300750.SZ", "600000.SH", "600001.SH", "600002.SH", "688981.SH"}},
+		{&models.UniverseConfig{Type: models.UniverseAll, ExcludeST: true}, []string{"000001.SZ", "300750.SZ", "600000.SH", "600001.SH", "600002.SH", "688981.SH"}},
+		{&models.UniverseConfig{Type: models.UniverseIndustry, Industry: "银行", ExcludeST: true}, []string{"000001.SZ", "600000.SH", "600001.SH", "600002.SH"}},
+		{&models.UniverseConfig{Type: models.UniverseBoard, Board: "star"}, []string{"688981.SH"}},
+		{&models.UniverseConfig{Type: models.UniverseBoard, Board: "main"}, []string{"000001.SZ", "600000.SH", "600001.SH", "600002.SH"}},
+		{&models.UniverseConfig{Type: models.UniverseFavorites, GroupID: "g1"}, []string{"000001.SZ", "600519.SH"}},
+	}
+	for _, tt := range tests {
+		symbols, err := resolve(tt.config)
+		if err != nil || !reflect.DeepEqual(symbols, tt.want) {
+			t.Errorf("股票池 %+v 解析错误: %v, err=%v", tt.config, symbols, err)
+		}
+	}
+
+	if _, err := resolve(&models.UniverseConfig{Type: models.UniverseIndustry, Industry: "保险"}); !errors.Is(err, ErrInvalidUniverse) {
+		t.Errorf("股票池为空时应返回 ErrInvalidUniverse, 实际 %v", err)
+	}
+
+	universe, _ := service.resolveUniverse(&models.Backtest{Universe: &models.UniverseConfig{Type: models.UniverseAll}})
+	if listDate := universe.listDates["000001.SZ"]; !listDate.Equal(time.Date(1991, 4, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("应使用股票列表中的上市日期: %v", listDate)
+	}
+	if delistDate := universe.delistDates["600002.SH"]; !delistDate.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("应记录退市股票的退市日期: %v", delistDate)
+	}
+
+	// 获取退市股票列表失败时无法判断是否存在幸存者偏差，拒绝回测；自选股股票池不受影响
+	dataClient.ShouldFail = true
+	if _, err := resolve(&models.UniverseConfig{Type: models.UniverseAll}); !errors.Is(err, ErrInvalidUniverse) {
+		t.Errorf("无法获取退市股票列表时应返回 ErrInvalidUniverse, 实际 %v", err)
+	}
+	if symbols, err := resolve(&models.UniverseConfig{Type: models.UniverseFavorites, GroupID: "g2"}); err != nil || !reflect.DeepEqual(symbols, []string{"300750.SZ"}) {
+		t.Errorf("自选股股票池不需要退市股票列表: %v, err=%v", symbols, err)
+	}
+}
+
+func TestResolveUniverse_UnsupportedDataSource(t *testing.T) {
+	service := NewBacktestService(nil, &DataSourceService{currentClient: unsupportedUniverseClient{client.NewMockDataSourceClient()}}, nil, &noopLogger{})
+	service.SetUniverseSources(stubStockList{
+		{TSCode: "600000.SH", Name: "浦发银行", Industry: "银行"},
+		{TSCode: "000001.SZ", Name: "平安银行", Industry: "银行"},
+	}, nil)
+
+	// 数据源不提供退市股票列表时只使用当前上市的股票，并记录幸存者偏差警告
+	universe, err := service.resolveUniverse(&models.Backtest{Universe: &models.UniverseConfig{Type: models.UniverseIndustry, Industry: "银行", ExcludeST: true}})
+	if err != nil {
+		t.Fatalf("数据源不支持退市股票列表时应降级处理: %v", err)
+	}
+	if !reflect.DeepEqual(universe.symbols, []string{"000001.SZ", "600000.SH"}) || len(universe.warnings) != 1 {
+		t.Errorf("股票池或警告错误: %v, %v", universe.symbols, universe.warnings)
+	}
+
+	// 数据源不提供简称变更历史时按当前名称排除ST股票，并记录警告
+	histories := make(map[string]*symbolHistory)
+	for _, symbol := range universe.symbols {
+		history := newSymbolHistory(buildTestDailyBars(symbol, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), steadyCloses(5, 0.1)))
+		service.applyStockBasic(service.dataSourceService.currentClient, symbol, history)
+		histories[symbol] = history
+	}
+	universe.prepare(histories)
+	if len(universe.warnings) != 2 {
+		t.Errorf("缺少简称变更历史时应记录警告: %v", universe.warnings)
+	}
+}
+
+func TestBacktestUniverseMembers(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	histories := map[string]*symbolHistory{
+		"old":      newSymbolHistory(buildTestDailyBars("old", start, steadyCloses(60, 0))),
+		"new":      newSymbolHistory(buildTestDailyBars("new", start.AddDate(0, 0, 30), steadyCloses(30, 0))),
+		"delisted": newSymbolHistory(buildTestDailyBars("delisted", start, steadyCloses(20, 0))),
+		"basic":    newSymbolHistory(buildTestDailyBars("basic", start, steadyCloses(60, 0))),
+		"st":       newSymbolHistory(buildTestDailyBars("st", start, steadyCloses(60, 0))),
+	}
+	for _, history := range histories {
+		history.nameHistory = true
+	}
+	histories["basic"].listDate = start.AddDate(0, 0, 20)
+	// st 当前名称为ST，但1月22日才被实施ST，之前的交易日不应按当前名称排除
+	histories["st"].isST = true
+	histories["st"].nameChanges = []models.NameChange{
+		{Name: "测试股份", StartDate: "20200101", EndDate: "20240121"},
+		{Name: "ST测试", StartDate: "20240122"},
+	}
+
+	universe := &backtestUniverse{
+		config:    &models.UniverseConfig{Type: models.UniverseAll, ExcludeST: true, MinListingDays: 10},
+		symbols:   []string{"basic", "delisted", "new", "old", "st", "missing"},
+		listDates: make(map[string]time.Time),
+		// old 2月12日退市，当日即不在股票池中
+		delistDates: map[string]time.Time{"old": time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	universe.prepare(histories)
+	if len(universe.warnings) != 0 {
+		t.Fatalf("数据完整时不应有警告: %v", universe.warnings)
+	}
+
+	if _, ok := universe.listDates["old"]; ok {
+		t.Error("数据起点即有K线的股票应视为早已上市")
+	}
+	if !universe.listDates["new"].Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("缺少上市日期时应以首根K线为上市日期: %v", universe.listDates["new"])
+	}
+
+	tests := []struct {
+		date time.Time
+		want []string
+	}{
+		// 1月10日：basic 1月21日上市，new 尚未上市，st 尚未被实施ST
+		{time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), []string{"delisted", "old", "st"}},
+		// 1月31日：basic 上市满10天（1月31日起），delisted 最后一根K线为1月26日，st 已被实施ST
+		{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), []string{"basic", "old"}},
+		// 2月12日：new 1月31日上市满10天，old 退市
+		{time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC), []string{"basic", "new"}},
+	}
+	for _, tt := range tests {
+		if members := universe.members(tt.date, histories); !reflect.DeepEqual(members, tt.want) {
+			t.Errorf("%s 股票池成员错误: %v, 期望 %v", tt.date.Format("2006-01-02"), members, tt.want)
+		}
+	}
+
+	// 数据源不提供简称变更历史时按当前名称排除ST股票并记录警告，不排除ST时不需要简称变更历史
+	histories["old"].nameHistory = false
+	universe.config.ExcludeST = false
+	if universe.prepare(histories); len(universe.warnings) != 0 {
+		t.Errorf("不排除ST时不需要简称变更历史: %v", universe.warnings)
+	}
+	universe.config.ExcludeST = true
+	if universe.prepare(histories); len(universe.warnings) != 1 {
+		t.Errorf("缺少简称变更历史时排除ST应记录警告: %v", universe.warnings)
+	}
+
+	fixed := &backtestUniverse{symbols: []string{"a", "b"}}
+	if members := fixed.members(start, nil); !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Errorf("固定股票列表每天都应包含全部股票: %v", members)
+	}
+}
+
+func TestSimulateBacktest_Universe(t *testing.T) {
+	start := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	listed := time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+
+	// 000002.SZ 3月18日退市，只在数据源的退市股票列表中，3月15日之后没有K线
+	var delisted []models.StockDaily
+	for _, bar := range buildTestDailyBars("000002.SZ", start, steadyCloses(140, 0.006)) {
+		if bar.TradeDate <= "20240315" {
+			delisted = append(delisted, bar)
+		}
+	}
+	dataClient := &perSymbolDataClient{
+		MockDataSourceClient: client.NewMockDataSourceClient(),
+		bars: map[string][]models.StockDaily{
+			"000001.SZ": buildTestDailyBars("000001.SZ", start, steadyCloses(140, 0.004)),
+			"000002.SZ": delisted,
+			"600000.SH": buildTestDailyBars("600000.SH", listed, steadyCloses(60, 0.008)),
+			"600001.SH": buildTestDailyBars("600001.SH", start, steadyCloses(140, 0.01)),
+		},
+		// 600001.SH 3月11日起被实施ST
+		nameChanges: map[string][]models.NameChange{
+			"600001.SH": {
+				{TSCode: "600001.SH", Name: "测试股份", StartDate: "20100101", EndDate: "20240310"},
+				{TSCode: "600001.SH", Name: "ST测试", StartDate: "20240311"},
+			},
+		},
+	}
+	dataClient.DelistedStockData = []models.StockBasic{{TSCode: "000002.SZ", Name: "退市测试", DelistDate: "20240318"}}
+	service := NewBacktestService(newTestStrategyService(t), &DataSourceService{currentClient: dataClient}, NewDailyCacheService(nil), &noopLogger{})
+	service.SetUniverseSources(stubStockList{
+		{TSCode: "000001.SZ", Name: "平安银行"},
+		{TSCode: "600000.SH", Name: "浦发银行"},
+		{TSCode: "600001.SH", Name: "ST测试"},
+	}, nil)
+
+	strategies := []*models.Strategy{{
+		ID:         "momentum_rotation",
+		Type:       models.StrategyTypeRebalance,
+		Parameters: map[string]interface{}{"frequency": "monthly", "top_n": 3.0, "lookback": 5.0},
+	}}
+	backtest := &models.Backtest{
+		ID:          "bt-universe",
+		StrategyIDs: []string{"momentum_rotation"},
+		StartDate:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+		InitialCash: 1000000,
+		Universe:    &models.UniverseConfig{Type: models.UniverseAll, ExcludeST: true, MinListingDays: 20},
+	}
+
+	runData, err := service.simulateBacktest(context.Background(), backtest, strategies, nil)
+	if err != nil {
+		t.Fatalf("回测失败: %v", err)
+	}
+
+	var newListingTrades, delistedBuys, stBuys int
+	for _, trade := range runData.Trades {
+		switch trade.Symbol {
+		case "600001.SH":
+			// 被实施ST之前按当时的简称可以入选，之后的调仓日应移出股票池
+			if trade.Side == models.TradeSideBuy {
+				if !trade.Timestamp.Before(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("被实施ST后不应买入: %+v", trade)
+				}
+				stBuys++
+			}
+		case "600000.SH":
+			// 2月15日上市，上市满20天（3月6日）后的首个调仓日为4月1日
+			if trade.Timestamp.Before(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("次新股上市未满20天不应买入: %s", trade.Timestamp.Format("2006-01-02"))
+			}
+			newListingTrades++
+		case "000002.SZ":
+			if trade.Side == models.TradeSideBuy {
+				if trade.Timestamp.After(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("退市后不应买入: %+v", trade)
+				}
+				delistedBuys++
+			}
+		}
+	}
+	if newListingTrades == 0 {
+		t.Error("新上市的股票满足条件后应进入股票池")
+	}
+	if delistedBuys == 0 {
+		t.Error("回测期间退市的股票在退市前应属于股票池")
+	}
+	if stBuys == 0 {
+		t.Error("被实施ST之前的股票应属于股票池")
+	}
+}
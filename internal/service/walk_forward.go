@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-a-future/internal/logger"
+	"stock-a-future/internal/models"
+)
+
+var ErrInvalidWalkForward = errors.New("前向分析参数无效")
+
+// WalkForwardConfig 前向分析参数，窗口长度均以交易日计
+type WalkForwardConfig struct {
+	TrainingDays int  `json:"training_days"` // 样本内（训练）窗口长度
+	TestingDays  int  `json:"testing_days"`  // 样本外（测试）窗口长度
+	StepDays     int  `json:"step_days"`     // 窗口每次向前移动的交易日数，默认等于测试窗口长度
+	Anchored     bool `json:"anchored"`      // 锚定模式：训练窗口起点固定为优化开始日期；否则按固定长度滚动
+}
+
+// WalkForwardWindowResult 单个前向分析窗口的结果
+type WalkForwardWindowResult struct {
+	Index            int                    `json:"index"`
+	TrainStart       string                 `json:"train_start"`
+	TrainEnd         string                 `json:"train_end"`
+	TestStart        string                 `json:"test_start"`
+	TestEnd          string                 `json:"test_end"`
+	BestParameters   map[string]interface{} `json:"best_parameters"`     // 训练窗口上的最佳参数
+	InSampleScore    float64                `json:"in_sample_score"`     // 最佳参数在训练窗口上的得分
+	OutOfSampleScore float64                `json:"out_of_sample_score"` // 最佳参数在测试窗口上的得分
+	InSample         *models.BacktestResult `json:"in_sample"`
+	OutOfSample      *models.BacktestResult `json:"out_of_sample"`
+	Efficiency       float64                `json:"efficiency"`      // 前向效率：样本外年化收益 / 样本内年化收益
+	Failed           bool                   `json:"failed"`          // 测试窗口回测失败，不计入前向效率和样本外表现
+	Error            string                 `json:"error,omitempty"` // 测试窗口回测失败的原因
+}
+
+// WalkForwardResult 前向分析结果
+type WalkForwardResult struct {
+	Windows     []WalkForwardWindowResult `json:"windows"`
+	EquityCurve []models.EquityPoint      `json:"equity_curve"`  // 各测试窗口拼接而成的样本外权益曲线
+	OutOfSample *models.BacktestResult    `json:"out_of_sample"` // 拼接后样本外区间的整体表现
+	Efficiency  float64                   `json:"efficiency"`    // 测试窗口回测成功的各窗口前向效率的平均值
+	Failed      int                       `json:"failed"`        // 测试窗口回测失败的窗口数
+}
+
+// walkForwardWindow 前向分析窗口的日期范围
+type walkForwardWindow struct {
+	trainStart, trainEnd time.Time
+	testStart, testEnd   time.Time
+}
+
+// ValidateWalkForwardConfig 校验前向分析参数
+func ValidateWalkForwardConfig(config *WalkForwardConfig) error {
+	if config == nil {
+		return nil
+	}
+	if config.TrainingDays <= 0 || config.TestingDays <= 0 {
+		return fmt.Errorf("%w: training_days 和 testing_days 必须大于0", ErrInvalidWalkForward)
+	}
+	if config.StepDays < 0 {
+		return fmt.Errorf("%w: step_days 不能为负数", ErrInvalidWalkForward)
+	}
+	return nil
+}
+
+// splitWalkForwardWindows 按交易日切分训练/测试窗口，最后一个测试窗口可以不足 TestingDays
+func splitWalkForwardWindows(tradingDays []time.Time, config *WalkForwardConfig) []walkForwardWindow {
+	step := config.StepDays
+	if step == 0 {
+		step = config.TestingDays
+	}
+
+	var windows []walkForwardWindow
+	for offset := 0; ; offset += step {
+		trainStart := offset
+		if config.Anchored {
+			trainStart = 0
+		}
+		trainEnd := offset + config.TrainingDays - 1
+		testStart := trainEnd + 1
+		if testStart >= len(tradingDays) {
+			break
+		}
+		testEnd := minInt(testStart+config.TestingDays-1, len(tradingDays)-1)
+
+		windows = append(windows, walkForwardWindow{
+			trainStart: tradingDays[trainStart],
+			trainEnd:   tradingDays[trainEnd],
+			testStart:  tradingDays[testStart],
+			testEnd:    tradingDays[testEnd],
+		})
+	}
+	return windows
+}
+
+// walkForwardOptimization 前向分析：在每个训练窗口上优化参数，并在紧随其后的测试窗口上检验
+func (s *ParameterOptimizer) walkForwardOptimization(ctx context.Context, task *OptimizationTask, config *OptimizationConfig) (*OptimizationResult, error) {
+	startTime := time.Now()
+
+	if err := ValidateWalkForwardConfig(config.WalkForward); err != nil {
+		return nil, err
+	}
+	startDate, err := time.Parse("2006-01-02", config.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("开始日期格式错误: %w", err)
+	}
+	endDate, err := time.Parse("2006-01-02", config.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("结束日期格式错误: %w", err)
+	}
+
+	tradingDays := s.backtestService.tradingCalendar.GetTradingDaysInRange(startDate, endDate)
+	windows := splitWalkForwardWindows(tradingDays, config.WalkForward)
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("%w: 优化区间内的交易日数（%d）不足一个训练窗口加测试窗口", ErrInvalidWalkForward, len(tradingDays))
+	}
+
+	s.logger.Info("开始前向分析",
+		logger.String("optimization_id", task.ID),
+		logger.Int("windows", len(windows)),
+		logger.Bool("anchored", config.WalkForward.Anchored),
+	)
+
+	walkForward := &WalkForwardResult{}
+	var lastOptimization *OptimizationResult
+	var oosTrades []models.Trade
+	totalTested := 0
+
+	for i, window := range windows {
+		if ctx.Err() != nil {
+			return nil, errors.New("优化任务被取消")
+		}
+
+		// 在训练窗口上优化
+		trainConfig := *config
+		trainConfig.WalkForward = nil
+		trainConfig.skipBaseline = true
+		trainConfig.StartDate = window.trainStart.Format("2006-01-02")
+		trainConfig.EndDate = window.trainEnd.Format("2006-01-02")
+
+		optimization, err := s.runOptimization(ctx, task, &trainConfig)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个窗口优化失败: %w", i+1, err)
+		}
+		lastOptimization = optimization
+		totalTested += optimization.TotalTested
+
+		windowResult := WalkForwardWindowResult{
+			Index:          i + 1,
+			TrainStart:     trainConfig.StartDate,
+			TrainEnd:       trainConfig.EndDate,
+			TestStart:      window.testStart.Format("2006-01-02"),
+			TestEnd:        window.testEnd.Format("2006-01-02"),
+			BestParameters: optimization.BestParameters,
+			InSampleScore:  optimization.BestScore,
+			InSample:       optimization.Performance,
+		}
+
+		// 用训练窗口的最佳参数在测试窗口上回测
+		testConfig := trainConfig
+		testConfig.StartDate = windowResult.TestStart
+		testConfig.EndDate = windowResult.TestEnd
+		runData, err := s.runBacktest(ctx, &testConfig, s.optimizationStrategy(config, optimization.BestParameters))
+		if err != nil {
+			s.logger.Warn("前向分析测试窗口回测失败",
+				logger.String("optimization_id", task.ID),
+				logger.Int("window", i+1),
+				logger.ErrorField(err),
+			)
+			windowResult.Failed = true
+			windowResult.Error = err.Error()
+		} else {
+			windowResult.OutOfSample = &runData.Results[0]
+			windowResult.OutOfSampleScore = s.calculateScore(windowResult.OutOfSample, config.OptimizationTarget)
+			windowResult.Efficiency = walkForwardEfficiency(windowResult.InSample, windowResult.OutOfSample)
+			walkForward.EquityCurve = stitchEquityCurve(walkForward.EquityCurve, runData.EquityCurve, config.InitialCash)
+			oosTrades = append(oosTrades, runData.Trades...)
+		}
+
+		walkForward.Windows = append(walkForward.Windows, windowResult)
+
+		s.tasksMutex.Lock()
+		task.Progress = int(float64(i+1) / float64(len(windows)) * 100)
+		s.publishTaskLocked(task)
+		s.tasksMutex.Unlock()
+
+		s.logger.Info("前向分析窗口完成",
+			logger.String("optimization_id", task.ID),
+			logger.Int("window", i+1),
+			logger.Float64("in_sample_score", windowResult.InSampleScore),
+			logger.Float64("out_of_sample_score", windowResult.OutOfSampleScore),
+		)
+	}
+
+	walkForward.Efficiency, walkForward.Failed, err = summarizeWalkForwardWindows(walkForward.Windows)
+	if err != nil {
+		return nil, err
+	}
+	walkForward.OutOfSample = (&models.PerformanceMetrics{
+		Returns:          equityCurveReturns(walkForward.EquityCurve, func(p models.EquityPoint) float64 { return p.PortfolioValue }),
+		BenchmarkReturns: equityCurveReturns(walkForward.EquityCurve, func(p models.EquityPoint) float64 { return p.BenchmarkValue }),
+		RiskFreeRate:     0.03 / 252,
+		Trades:           oosTrades,
+	}).CalculateMetrics()
+
+	// 最后一个窗口的参数即为当前应使用的参数
+	return &OptimizationResult{
+		OptimizationID: task.ID,
+		StrategyID:     config.StrategyID,
+		BestParameters: lastOptimization.BestParameters,
+		BestScore:      lastOptimization.BestScore,
+		Performance:    walkForward.OutOfSample,
+		AllResults:     lastOptimization.AllResults,
+		TotalTested:    totalTested,
+		StartTime:      startTime,
+		EndTime:        time.Now(),
+		Duration:       time.Since(startTime).String(),
+		WalkForward:    walkForward,
+	}, nil
+}
+
+// optimizationStrategy 以候选参数构造临时策略，沿用原策略ID以便按相同的策略逻辑执行
+func (s *ParameterOptimizer) optimizationStrategy(config *OptimizationConfig, parameters map[string]interface{}) *models.Strategy {
+	return &models.Strategy{
+		ID:         config.StrategyID,
+		Name:       "临时优化策略",
+		Type:       config.StrategyType,
+		Parameters: parameters,
+		Status:     models.StrategyStatusInactive,
+	}
+}
+
+// summarizeWalkForwardWindows 计算测试窗口回测成功的各窗口前向效率的平均值，失败的窗口不计入平均；全部失败时返回错误
+func summarizeWalkForwardWindows(windows []WalkForwardWindowResult) (efficiency float64, failed int, err error) {
+	var sum float64
+	for _, window := range windows {
+		if window.Failed {
+			failed++
+			continue
+		}
+		sum += window.Efficiency
+	}
+	if failed == len(windows) {
+		return 0, failed, fmt.Errorf("前向分析的%d个测试窗口回测全部失败", failed)
+	}
+	return sum / float64(len(windows)-failed), failed, nil
+}
+
+// walkForwardEfficiency 计算前向效率，样本内年化收益不为正时无意义，返回0
+func walkForwardEfficiency(inSample, outOfSample *models.BacktestResult) float64 {
+	if inSample == nil || outOfSample == nil || inSample.AnnualReturn <= 0 {
+		return 0
+	}
+	return outOfSample.AnnualReturn / inSample.AnnualReturn
+}
+
+// stitchEquityCurve 将测试窗口的权益曲线接到已拼接曲线之后
+// 每段曲线都从初始资金开始，按上一段末尾的净值等比例缩放；窗口重叠时跳过已覆盖的日期
+func stitchEquityCurve(stitched, segment []models.EquityPoint, initialCash float64) []models.EquityPoint {
+	if len(segment) == 0 {
+		return stitched
+	}
+	if len(stitched) == 0 {
+		return append(stitched, segment...)
+	}
+
+	last := stitched[len(stitched)-1]
+	base, benchmarkBase := initialCash, initialCash
+	start := 0
+	for i, point := range segment {
+		if point.Date > last.Date {
+			break
+		}
+		base, benchmarkBase = point.PortfolioValue, point.BenchmarkValue
+		start = i + 1
+	}
+
+	scale := last.PortfolioValue / base
+	benchmarkScale := 0.0
+	if benchmarkBase > 0 {
+		benchmarkScale = last.BenchmarkValue / benchmarkBase
+	}
+	for _, point := range segment[start:] {
+		stitched = append(stitched, models.EquityPoint{
+			Date:           point.Date,
+			PortfolioValue: point.PortfolioValue * scale,
+			BenchmarkValue: point.BenchmarkValue * benchmarkScale,
+			Cash:           point.Cash * scale,
+			Holdings:       point.Holdings * scale,
+		})
+	}
+	return stitched
+}
+
+// equityCurveReturns 计算权益曲线的日收益率序列，取值为0时返回nil
+func equityCurveReturns(curve []models.EquityPoint, value func(models.EquityPoint) float64) []float64 {
+	var returns []float64
+	for i := 1; i < len(curve); i++ {
+		prev, current := value(curve[i-1]), value(curve[i])
+		if prev <= 0 {
+			return nil
+		}
+		returns = append(returns, current/prev-1)
+	}
+	return returns
+}
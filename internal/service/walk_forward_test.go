@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stock-a-future/internal/client"
+	"stock-a-future/internal/models"
+)
+
+// newSimulationTestService 构造使用模拟数据源的回测服务，可以直接运行 simulateBacktest
+func newSimulationTestService(t testing.TB, bars []models.StockDaily) *BacktestService {
+	t.Helper()
+	strategyService := newTestStrategyService(t)
+	mock := client.NewMockDataSourceClient()
+	mock.StockDailyData = bars
+	backtestService := NewBacktestService(strategyService, &DataSourceService{currentClient: mock}, NewDailyCacheService(nil), &noopLogger{})
+	return backtestService
+}
+
+// trendingCloses 构造每 period 个交易日交替涨跌的收盘价序列，使均线和MACD策略反复发出买卖信号
+func trendingCloses(n, period int, step float64) []float64 {
+	closes := make([]float64, 0, n)
+	price := 10.0
+	for i := 0; i < n; i++ {
+		if (i/period)%2 == 0 {
+			price *= 1 + step
+		} else {
+			price *= 1 - step
+		}
+		closes = append(closes, price)
+	}
+	return closes
+}
+
+func testTradingDays(n int) []time.Time {
+	days := make([]time.Time, n)
+	for i := range days {
+		days[i] = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+	}
+	return days
+}
+
+func TestSplitWalkForwardWindows(t *testing.T) {
+	days := testTradingDays(10)
+
+	rolling := splitWalkForwardWindows(days, &WalkForwardConfig{TrainingDays: 4, TestingDays: 2})
+	if len(rolling) != 3 {
+		t.Fatalf("滚动模式应切分出3个窗口, 实际 %d", len(rolling))
+	}
+	for i, window := range rolling {
+		if !window.trainStart.Equal(days[i*2]) || !window.trainEnd.Equal(days[i*2+3]) || !window.testStart.Equal(days[i*2+4]) {
+			t.Errorf("第%d个窗口日期错误: %+v", i+1, window)
+		}
+	}
+	if !rolling[2].testEnd.Equal(days[9]) {
+		t.Errorf("最后一个测试窗口应到区间末尾, 实际 %v", rolling[2].testEnd)
+	}
+
+	anchored := splitWalkForwardWindows(days, &WalkForwardConfig{TrainingDays: 4, TestingDays: 4, StepDays: 3, Anchored: true})
+	if len(anchored) != 2 {
+		t.Fatalf("锚定模式应切分出2个窗口, 实际 %d", len(anchored))
+	}
+	if !anchored[1].trainStart.Equal(days[0]) || !anchored[1].trainEnd.Equal(days[6]) || !anchored[1].testEnd.Equal(days[9]) {
+		t.Errorf("锚定模式训练窗口应从区间起点开始并逐步扩大: %+v", anchored[1])
+	}
+
+	if windows := splitWalkForwardWindows(days, &WalkForwardConfig{TrainingDays: 10, TestingDays: 2}); len(windows) != 0 {
+		t.Errorf("交易日不足时不应切分出窗口, 实际 %d", len(windows))
+	}
+}
+
+func TestValidateWalkForwardConfig(t *testing.T) {
+	invalid := []*WalkForwardConfig{
+		{TrainingDays: 0, TestingDays: 10},
+		{TrainingDays: 60, TestingDays: 0},
+		{TrainingDays: 60, TestingDays: 10, StepDays: -1},
+	}
+	for _, config := range invalid {
+		if err := ValidateWalkForwardConfig(config); !errors.Is(err, ErrInvalidWalkForward) {
+			t.Errorf("参数 %+v 应校验失败, 实际 %v", config, err)
+		}
+	}
+	if err := ValidateWalkForwardConfig(&WalkForwardConfig{TrainingDays: 60, TestingDays: 20}); err != nil {
+		t.Errorf("合法参数校验失败: %v", err)
+	}
+}
+
+func TestStitchEquityCurve(t *testing.T) {
+	first := []models.EquityPoint{
+		{Date: "2024-01-02", PortfolioValue: 100000, BenchmarkValue: 100000},
+		{Date: "2024-01-03", PortfolioValue: 110000, BenchmarkValue: 105000},
+	}
+	second := []models.EquityPoint{
+		{Date: "2024-01-04", PortfolioValue: 100000, BenchmarkValue: 100000},
+		{Date: "2024-01-05", PortfolioValue: 90000, BenchmarkValue: 102000},
+	}
+
+	curve := stitchEquityCurve(nil, first, 100000)
+	curve = stitchEquityCurve(curve, second, 100000)
+	if len(curve) != 4 {
+		t.Fatalf("拼接后应有4个点, 实际 %d", len(curve))
+	}
+	if math.Abs(curve[3].PortfolioValue-99000) > 1e-6 || math.Abs(curve[3].BenchmarkValue-107100) > 1e-6 {
+		t.Errorf("第二段应按第一段末尾净值缩放, 实际 %+v", curve[3])
+	}
+
+	// 窗口重叠时以重叠日的净值为基准，只追加新日期
+	overlap := []models.EquityPoint{
+		{Date: "2024-01-05", PortfolioValue: 100000, BenchmarkValue: 100000},
+		{Date: "2024-01-08", PortfolioValue: 105000, BenchmarkValue: 100000},
+	}
+	curve = stitchEquityCurve(curve, overlap, 100000)
+	if len(curve) != 5 || curve[4].Date != "2024-01-08" || math.Abs(curve[4].PortfolioValue-103950) > 1e-6 {
+		t.Errorf("重叠窗口拼接错误: %+v", curve)
+	}
+}
+
+func TestSummarizeWalkForwardWindows(t *testing.T) {
+	windows := []WalkForwardWindowResult{
+		{Index: 1, Efficiency: 0.8},
+		{Index: 2, Failed: true, Error: "数据缺失"},
+		{Index: 3, Efficiency: 0.4},
+	}
+	efficiency, failed, err := summarizeWalkForwardWindows(windows)
+	if err != nil || failed != 1 || math.Abs(efficiency-0.6) > 1e-12 {
+		t.Errorf("失败的窗口不应计入前向效率: %.4f, %d, %v", efficiency, failed, err)
+	}
+
+	windows[0].Failed, windows[2].Failed = true, true
+	if _, _, err := summarizeWalkForwardWindows(windows); err == nil {
+		t.Error("所有测试窗口都失败时应返回错误")
+	}
+}
+
+func TestWalkForwardOptimization(t *testing.T) {
+	// 交替的涨跌趋势，保证均线策略在各窗口都有交易
+	bars := buildTestDailyBars("000001.SZ", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), trendingCloses(160, 8, 0.02))
+	backtestService := newSimulationTestService(t, bars)
+
+	optimizer := NewParameterOptimizer(backtestService, backtestService.strategyService, &noopLogger{})
+	config := &OptimizationConfig{
+		StrategyID:   "ma_crossover",
+		StrategyType: models.StrategyTypeTechnical,
+		ParameterRanges: map[string]ParameterRange{
+			"short_period": {Min: 3, Max: 5, Step: 2},
+			"long_period":  {Min: 10, Max: 10, Step: 1},
+		},
+		OptimizationTarget: "total_return",
+		Symbols:            []string{"000001.SZ"},
+		StartDate:          "2024-03-01",
+		EndDate:            "2024-03-29",
+		InitialCash:        100000,
+		Commission:         0.0003,
+		WalkForward:        &WalkForwardConfig{TrainingDays: 10, TestingDays: 5},
+	}
+	task := &OptimizationTask{ID: "wf-test", Status: "running"}
+
+	result, err := optimizer.walkForwardOptimization(context.Background(), task, config)
+	if err != nil {
+		t.Fatalf("前向分析失败: %v", err)
+	}
+
+	walkForward := result.WalkForward
+	if walkForward == nil || len(walkForward.Windows) != 3 {
+		t.Fatalf("21个交易日应切分出3个窗口, 实际 %+v", walkForward)
+	}
+	for _, window := range walkForward.Windows {
+		if window.OutOfSample == nil || window.BestParameters == nil {
+			t.Errorf("窗口 %d 缺少样本外结果或最佳参数", window.Index)
+		}
+		if window.Failed {
+			t.Errorf("窗口 %d 的测试窗口回测不应失败: %s", window.Index, window.Error)
+		}
+		if window.TestStart <= window.TrainEnd {
+			t.Errorf("窗口 %d 的测试区间应在训练区间之后", window.Index)
+		}
+	}
+	if len(walkForward.EquityCurve) == 0 || walkForward.EquityCurve[0].Date != walkForward.Windows[0].TestStart {
+		t.Errorf("样本外权益曲线应从第一个测试窗口开始: %+v", walkForward.EquityCurve)
+	}
+	if walkForward.OutOfSample == nil || result.Performance != walkForward.OutOfSample {
+		t.Fatal("优化结果应以拼接后的样本外表现作为整体表现")
+	}
+	if walkForward.OutOfSample.TotalTrades == 0 {
+		t.Error("样本外区间应有交易")
+	}
+	if task.Progress != 100 {
+		t.Errorf("任务进度应为100, 实际 %d", task.Progress)
+	}
+}